@@ -3,11 +3,12 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"sync"
 	"time"
 
 	"raidhub/lib/env"
-	"raidhub/lib/services/instance_storage"
+	"raidhub/lib/services/gap_registry"
 	"raidhub/lib/utils/logging"
 	"raidhub/lib/web/discord"
 
@@ -85,8 +86,9 @@ func logWorkersStarting(numWorkers int, period int, latestId int64) {
 	})
 }
 
+// logMissedInstance announces an instance Atlas gave up on. The caller records it in the
+// missed PGCR ledger for process-missed-pgcrs.
 func logMissedInstance(instanceId int64, startTime time.Time) {
-	instance_storage.WriteMissedLog(instanceId)
 	elapsed := time.Since(startTime).Seconds()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -120,30 +122,6 @@ func logMissedInstance(instanceId int64, startTime time.Time) {
 	})
 }
 
-func logMissedInstanceWarning(instanceId int64, startTime time.Time) {
-	elapsed := time.Since(startTime).Seconds()
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	err := missedInstanceRateLimiter.Wait(ctx)
-
-	if err == nil {
-		fields := []discord.Field{{
-			Name:  "Instance Id",
-			Value: fmt.Sprintf("`%d`", instanceId),
-		}, {
-			Name:  "Time Elapsed",
-			Value: discord.FormatDuration(elapsed),
-		}}
-		atlasAlerting.SendWarning("Unresolved Instance (Warning)", fields, "", nil)
-	}
-	AtlasLogger.Warn("INSTANCE_RESOLUTION_WARNING", nil, map[string]any{
-		logging.INSTANCE_ID: instanceId,
-		logging.DURATION:    fmt.Sprintf("%dms", time.Since(startTime).Milliseconds()),
-		logging.ACTION:      "monitoring",
-	})
-}
-
 func logHigh404Rate(count int, rate float64) {
 	fields := []discord.Field{{
 		Name:  "Rate",
@@ -259,3 +237,50 @@ func logGapCheckBlockSkip(oldId int64, newId int64) {
 		logging.ACTION: "skipping_gap",
 	})
 }
+
+// logControlChange announces a change made through the control API
+func logControlChange(title string, r *http.Request, fields []discord.Field, logFields map[string]any) {
+	fields = append(fields, discord.Field{
+		Name:  "Requested By",
+		Value: fmt.Sprintf("`%s`", r.RemoteAddr),
+	})
+	if logFields == nil {
+		logFields = map[string]any{}
+	}
+	logFields["remote"] = r.RemoteAddr
+	atlasAlerting.SendInfo(title, fields, controlActionKey(title), logFields)
+}
+
+func logGapBackfilled(gap *gap_registry.Gap) {
+	fields := []discord.Field{{
+		Name:  "Range",
+		Value: fmt.Sprintf("`%d` - `%d`", gap.StartId, gap.EndId),
+	}, {
+		Name:  "Size",
+		Value: fmt.Sprintf("%d", gap.Size()),
+	}, {
+		Name:  "Raids",
+		Value: fmt.Sprintf("%d (%.3f%%)", gap.Counts.Raids, 100*gap.Share(gap.Counts.Raids)),
+	}, {
+		Name:  "Non-Raids",
+		Value: fmt.Sprintf("%d (%.3f%%)", gap.Counts.NonRaids, 100*gap.Share(gap.Counts.NonRaids)),
+	}, {
+		Name:  "404s",
+		Value: fmt.Sprintf("%d (%.3f%%)", gap.Counts.NotFound, 100*gap.Share(gap.Counts.NotFound)),
+	}, {
+		Name:  "Errors",
+		Value: fmt.Sprintf("%d (%.3f%%)", gap.Counts.Errors, 100*gap.Share(gap.Counts.Errors)),
+	}, {
+		Name:  "Detected",
+		Value: fmt.Sprintf("<t:%d:R> by %s", gap.DetectedAt.Unix(), gap.Method),
+	}}
+	atlasAlerting.SendInfo("Gap Backfilled", fields, "GAP_BACKFILLED", map[string]any{
+		"gap_id":     gap.GapId,
+		logging.FROM: gap.StartId,
+		logging.TO:   gap.EndId,
+		"raids":      gap.Counts.Raids,
+		"non_raids":  gap.Counts.NonRaids,
+		"not_found":  gap.Counts.NotFound,
+		"errors":     gap.Counts.Errors,
+	})
+}
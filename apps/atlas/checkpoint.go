@@ -0,0 +1,258 @@
+package main
+
+import (
+	"database/sql"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"raidhub/lib/database/postgres"
+	"raidhub/lib/utils/logging"
+
+	"github.com/lib/pq"
+)
+
+const (
+	checkpointCrawler  = "default"
+	checkpointInterval = 15 * time.Second
+)
+
+var checkpointLogger = logging.NewLogger("atlas::checkpoint")
+
+// CrawlCheckpoint is the persisted crawl position of Atlas
+type CrawlCheckpoint struct {
+	Cursor            int64 // Last id handed out to a worker
+	LowWaterMark      int64 // Smallest id handed out but not yet resolved
+	PendingOffloadIds []int64
+	UpdatedAt         time.Time
+}
+
+// crawlTracker records which ids are still being worked on so the checkpoint never
+// moves past an id that has not been resolved yet
+type crawlTracker struct {
+	mu       sync.Mutex
+	inflight map[int64]struct{}
+	offload  map[int64]bool // true once handed over to pgcr_offload
+}
+
+func newCrawlTracker() *crawlTracker {
+	return &crawlTracker{
+		inflight: make(map[int64]struct{}),
+		offload:  make(map[int64]bool),
+	}
+}
+
+// Advance moves the cursor forward by step and marks the new id as in flight.
+// Both happen under the tracker lock so a snapshot never sees one without the other.
+func (t *crawlTracker) Advance(cursor *int64, step int64) int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := atomic.AddInt64(cursor, step)
+	t.inflight[id] = struct{}{}
+	return id
+}
+
+// Claim records an id handed out from a leased block as the cursor and marks it as in flight
+func (t *crawlTracker) Claim(cursor *int64, id int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	atomic.StoreInt64(cursor, id)
+	t.inflight[id] = struct{}{}
+}
+
+// Resolve marks an in flight id as done (stored, non-raid, retried elsewhere, or missed)
+func (t *crawlTracker) Resolve(id int64) {
+	t.mu.Lock()
+	delete(t.inflight, id)
+	t.mu.Unlock()
+}
+
+// Offload hands an id over from the workers to the offload worker
+func (t *crawlTracker) Offload(id int64) {
+	t.mu.Lock()
+	delete(t.inflight, id)
+	t.offload[id] = false
+	t.mu.Unlock()
+}
+
+// HandOverOffload marks an offloaded id as published to pgcr_offload. It stays in the checkpoint
+// until pgcr_offload resolves it.
+func (t *crawlTracker) HandOverOffload(id int64) {
+	t.mu.Lock()
+	if _, ok := t.offload[id]; ok {
+		t.offload[id] = true
+	}
+	t.mu.Unlock()
+}
+
+// HandedOverOffloads returns the offloaded ids waiting on pgcr_offload
+func (t *crawlTracker) HandedOverOffloads() []int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ids := make([]int64, 0, len(t.offload))
+	for id, handedOver := range t.offload {
+		if handedOver {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// ResolveOffload marks an offloaded id as done
+func (t *crawlTracker) ResolveOffload(id int64) {
+	t.mu.Lock()
+	delete(t.offload, id)
+	t.mu.Unlock()
+}
+
+// Snapshot captures the current cursor, low-water mark, and offload backlog
+func (t *crawlTracker) Snapshot(cursor *int64) CrawlCheckpoint {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cp := CrawlCheckpoint{
+		Cursor:            atomic.LoadInt64(cursor),
+		PendingOffloadIds: make([]int64, 0, len(t.offload)),
+		UpdatedAt:         time.Now(),
+	}
+	cp.LowWaterMark = cp.Cursor + 1
+	for id := range t.inflight {
+		if id < cp.LowWaterMark {
+			cp.LowWaterMark = id
+		}
+	}
+	for id := range t.offload {
+		cp.PendingOffloadIds = append(cp.PendingOffloadIds, id)
+	}
+	sort.Slice(cp.PendingOffloadIds, func(i, j int) bool { return cp.PendingOffloadIds[i] < cp.PendingOffloadIds[j] })
+	return cp
+}
+
+// OldestInFlight returns the smallest id in [from, to) that workers are still working on
+func (t *crawlTracker) OldestInFlight(from, to int64) (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	oldest, found := to, false
+	for id := range t.inflight {
+		if id >= from && id < oldest {
+			oldest, found = id, true
+		}
+	}
+	return oldest, found
+}
+
+// OffloadBacklog returns the number of ids currently held by the offload worker
+func (t *crawlTracker) OffloadBacklog() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for _, handedOver := range t.offload {
+		if !handedOver {
+			n++
+		}
+	}
+	return n
+}
+
+// loadCheckpoint returns the stored checkpoint, or nil if none has been written yet
+func loadCheckpoint(crawler string) (*CrawlCheckpoint, error) {
+	var cp CrawlCheckpoint
+	err := postgres.DB.QueryRow(`
+		SELECT cursor, low_water_mark, pending_offload_ids, updated_at
+		FROM atlas.crawl_checkpoint
+		WHERE crawler = $1
+	`, crawler).Scan(&cp.Cursor, &cp.LowWaterMark, pq.Array(&cp.PendingOffloadIds), &cp.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+func saveCheckpoint(crawler string, cp CrawlCheckpoint) error {
+	_, err := postgres.DB.Exec(`
+		INSERT INTO atlas.crawl_checkpoint (crawler, cursor, low_water_mark, pending_offload_ids, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (crawler) DO UPDATE SET
+			cursor = EXCLUDED.cursor,
+			low_water_mark = EXCLUDED.low_water_mark,
+			pending_offload_ids = EXCLUDED.pending_offload_ids,
+			updated_at = EXCLUDED.updated_at
+	`, crawler, cp.Cursor, cp.LowWaterMark, pq.Array(cp.PendingOffloadIds), cp.UpdatedAt)
+	return err
+}
+
+func deleteCheckpoint(crawler string) error {
+	_, err := postgres.DB.Exec(`DELETE FROM atlas.crawl_checkpoint WHERE crawler = $1`, crawler)
+	return err
+}
+
+// writeCheckpoint snapshots the crawl state and persists it
+func writeCheckpoint(consumerConfig *ConsumerConfig) {
+	cp := consumerConfig.Tracker.Snapshot(&consumerConfig.LatestId)
+	if err := saveCheckpoint(checkpointCrawler, cp); err != nil {
+		checkpointLogger.Warn("CHECKPOINT_WRITE_FAILED", err, map[string]any{
+			"cursor":         cp.Cursor,
+			"low_water_mark": cp.LowWaterMark,
+		})
+		return
+	}
+	checkpointLogger.Debug("CHECKPOINT_WRITTEN", map[string]any{
+		"cursor":          cp.Cursor,
+		"low_water_mark":  cp.LowWaterMark,
+		"pending_offload": len(cp.PendingOffloadIds),
+	})
+}
+
+// checkpointWorker periodically persists the crawl position
+func checkpointWorker(consumerConfig *ConsumerConfig) {
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		writeCheckpoint(consumerConfig)
+	}
+}
+
+// shutdown writes a final checkpoint when Atlas is asked to stop. In cluster mode it hands
+// its leased blocks back instead.
+func shutdown(consumerConfig *ConsumerConfig) {
+	AtlasLogger.Info("RECEIVED_SHUTDOWN_SIGNAL", map[string]any{
+		"cursor": atomic.LoadInt64(&consumerConfig.LatestId),
+	})
+	if consumerConfig.Leases != nil {
+		if err := consumerConfig.Leases.ReleaseAll(); err != nil {
+			leaseLogger.Warn("FAILED_TO_RELEASE_LEASES", err, nil)
+		}
+	} else {
+		writeCheckpoint(consumerConfig)
+	}
+}
+
+// resumeFromCheckpoint loads the stored checkpoint and returns the cursor to resume from
+// (so that the next id handed out is the low-water mark) along with the offload backlog.
+// ok is false when there is nothing to resume from.
+func resumeFromCheckpoint(devSkip int) (cursor int64, pendingOffloadIds []int64, ok bool) {
+	cp, err := loadCheckpoint(checkpointCrawler)
+	if err != nil {
+		AtlasLogger.Warn("CHECKPOINT_LOAD_FAILED", err, map[string]any{
+			logging.ACTION: "falling_back_to_latest_instance",
+		})
+		return 0, nil, false
+	}
+	if cp == nil {
+		AtlasLogger.Info("NO_CHECKPOINT_FOUND", map[string]any{
+			logging.ACTION: "falling_back_to_latest_instance",
+		})
+		return 0, nil, false
+	}
+
+	AtlasLogger.Info("RESUMING_FROM_CHECKPOINT", map[string]any{
+		"cursor":          cp.Cursor,
+		"low_water_mark":  cp.LowWaterMark,
+		"pending_offload": len(cp.PendingOffloadIds),
+		"checkpoint_age":  time.Since(cp.UpdatedAt).Round(time.Second).String(),
+	})
+	return cp.LowWaterMark - int64(devSkip+1), cp.PendingOffloadIds, true
+}
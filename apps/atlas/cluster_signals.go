@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	rdb "raidhub/lib/database/redis"
+	"raidhub/lib/services/pgcr_processing"
+	"raidhub/lib/utils/logging"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// clusterSignalsKeyPrefix + unix minute is a HASH of fetch results counted by every instance in that minute
+	clusterSignalsKeyPrefix = "atlas:signals:status:"
+	clusterSignalsFlush     = 5 * time.Second
+	clusterSignalsRetention = 15 * time.Minute
+)
+
+// clusterStatusCounts holds fetch results observed since the last flush to Redis
+var clusterStatusCounts struct {
+	total    atomic.Int64
+	notFound atomic.Int64
+}
+
+// recordClusterStatus counts a fetch result towards the cluster-wide 404 rate
+func recordClusterStatus(result pgcr_processing.PGCRResult) {
+	clusterStatusCounts.total.Add(1)
+	if result == pgcr_processing.NotFound {
+		clusterStatusCounts.notFound.Add(1)
+	}
+}
+
+// clusterSignalsWorker flushes this instance's fetch results into the shared per-minute buckets
+func clusterSignalsWorker() {
+	ticker := time.NewTicker(clusterSignalsFlush)
+	defer ticker.Stop()
+	for range ticker.C {
+		total := clusterStatusCounts.total.Swap(0)
+		notFound := clusterStatusCounts.notFound.Swap(0)
+		if total == 0 {
+			continue
+		}
+
+		key := clusterSignalsKey(time.Now().Unix() / 60)
+		pipe := rdb.Client.Pipeline()
+		pipe.HIncrBy(context.Background(), key, "total", total)
+		pipe.HIncrBy(context.Background(), key, "404", notFound)
+		pipe.Expire(context.Background(), key, clusterSignalsRetention)
+		if _, err := pipe.Exec(context.Background()); err != nil {
+			leaseLogger.Warn("FAILED_TO_FLUSH_CLUSTER_SIGNALS", err, map[string]any{
+				logging.COUNT: total,
+			})
+			// put them back so the next flush tries again
+			clusterStatusCounts.total.Add(total)
+			clusterStatusCounts.notFound.Add(notFound)
+		}
+	}
+}
+
+func clusterSignalsKey(minute int64) string {
+	return fmt.Sprintf("%s%d", clusterSignalsKeyPrefix, minute)
+}
+
+// clusterSignals replaces the 404 rate of another signal source with the one measured across every
+// Atlas instance. Each instance crawls only its own blocks, so a gap looks like a trickle of 404s
+// to any one of them; the scaling strategy and gap checker need the combined picture.
+type clusterSignals struct {
+	inner ScalingSignals
+}
+
+func newClusterSignals(inner ScalingSignals) *clusterSignals {
+	return &clusterSignals{inner: inner}
+}
+
+func (c *clusterSignals) GetMetricsForScaling(elapsedTime time.Duration) (*AtlasMetrics, error) {
+	metrics, err := c.inner.GetMetricsForScaling(elapsedTime)
+	if err != nil {
+		return nil, err
+	}
+	return c.withClusterNotFound(metrics, min(4, int(elapsedTime.Minutes()))), nil
+}
+
+func (c *clusterSignals) GetMetrics(intervalMinutes int) (*AtlasMetrics, error) {
+	metrics, err := c.inner.GetMetrics(intervalMinutes)
+	if err != nil {
+		return nil, err
+	}
+	return c.withClusterNotFound(metrics, intervalMinutes), nil
+}
+
+// withClusterNotFound overwrites the 404 fraction and count with the sums of the trailing minute buckets.
+// If Redis can't be read, or nothing has been flushed yet, the instance's own numbers are kept.
+func (c *clusterSignals) withClusterNotFound(metrics *AtlasMetrics, intervalMinutes int) *AtlasMetrics {
+	minutes := max(1, intervalMinutes)
+	now := time.Now().Unix() / 60
+
+	ctx := context.Background()
+	pipe := rdb.Client.Pipeline()
+	cmds := make([]*redis.SliceCmd, 0, minutes)
+	for m := now - int64(minutes) + 1; m <= now; m++ {
+		cmds = append(cmds, pipe.HMGet(ctx, clusterSignalsKey(m), "total", "404"))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		leaseLogger.Warn("FAILED_TO_READ_CLUSTER_SIGNALS", err, map[string]any{
+			logging.ACTION: "using_instance_signals",
+		})
+		return metrics
+	}
+
+	var total, notFound int64
+	for _, cmd := range cmds {
+		vals := cmd.Val()
+		total += parseRedisCount(vals[0])
+		notFound += parseRedisCount(vals[1])
+	}
+	if total == 0 {
+		return metrics
+	}
+
+	metrics.Count404 = float64(notFound)
+	metrics.Fraction404 = float64(notFound) / float64(total)
+	return metrics
+}
+
+func parseRedisCount(val any) int64 {
+	s, ok := val.(string)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
@@ -2,24 +2,46 @@ package main
 
 import (
 	"flag"
+	"time"
 
 	"raidhub/lib/utils/logging"
 )
 
 var (
-	numWorkers       = flag.Int("workers", 10, "number of workers to spawn at the start")
-	buffer           = flag.Int64("buffer", -1, "number of ids to start behind last added (-1 means auto: 10000 in prod, 0 in dev)")
-	targetInstanceId = flag.Int64("target", -1, "specific instance id to start at (optional)")
-	maxWorkersFlag   = flag.Int("max-workers", 0, "maximum number of workers (0 uses default constant, or 8 in dev mode)")
-	devFlag          = flag.Bool("dev", false, "enable dev mode (defaults: skip=3, max-workers=8, buffer=0)")
-	devSkip          = flag.Int("dev-skip", 0, "skip N instances between each processed instance (requires --dev flag, defaults to 3)")
+	numWorkers          = flag.Int("workers", 10, "number of workers to spawn at the start")
+	buffer              = flag.Int64("buffer", -1, "number of ids to start behind last added (-1 means auto: 10000 in prod, 0 in dev)")
+	targetInstanceId    = flag.Int64("target", -1, "specific instance id to start at (optional)")
+	maxWorkersFlag      = flag.Int("max-workers", 0, "maximum number of workers (0 uses default constant, or 8 in dev mode)")
+	devFlag             = flag.Bool("dev", false, "enable dev mode (defaults: skip=3, max-workers=8, buffer=0)")
+	devSkip             = flag.Int("dev-skip", 0, "skip N instances between each processed instance (requires --dev flag, defaults to 3)")
+	resumeFlag          = flag.Bool("resume", true, "resume from the last stored crawl checkpoint (ignored when --target is set)")
+	resetCursorFlag     = flag.Bool("reset-cursor", false, "discard the stored crawl checkpoint and start from the latest instance minus buffer")
+	signalsFlag         = flag.String("scaling-signals", ScalingSignalsPrometheus, "source of scaling signals: prometheus (PromQL) or in-process (sliding windows fed by the workers)")
+	backfillRateFlag    = flag.Float64("backfill-rate", 20, "ids per second the gap backfill may fetch (0 disables the backfill)")
+	backfillWorkersFlag = flag.Int("backfill-workers", 4, "concurrent fetches of the gap backfill")
+	clusterFlag         = flag.Bool("cluster", false, "coordinate with other Atlas instances by leasing id blocks through Redis")
+	leaseBlockFlag      = flag.Int64("lease-block", defaultLeaseBlockSize, "number of ids per leased block (requires --cluster)")
+	leaseTTLFlag        = flag.Duration("lease-ttl", defaultLeaseTTL, "how long a block stays leased without renewal before another instance may reclaim it (requires --cluster)")
+	contestMinFlag      = flag.Int("contest-min-workers", contestMinWorkers, "minimum number of workers while the contest profile is in effect")
+	contestMaxFlag      = flag.Int("contest-max-workers", contestMaxWorkers, "maximum number of workers while the contest profile is in effect (capped at max-workers in dev mode)")
 )
 
 const (
 	minWorkers = 3
 	maxWorkers = 250
 
+	// Worker bounds while the contest profile is in effect
+	contestMinWorkers = 25
+	contestMaxWorkers = 400
+
 	retryDelayTime = 5500
+
+	// systemDisabledBackoff is how long to wait when Bungie reports the Destiny2 system as disabled
+	systemDisabledBackoff = 60 * time.Second
+	// rateLimitedBackoff is how long to wait after being throttled
+	rateLimitedBackoff = 5 * time.Second
+	// externalErrorBackoff is how long to wait after an error on Bungie's side
+	externalErrorBackoff = 10 * time.Second
 )
 
 func parseConfig() AtlasConfig {
@@ -70,6 +92,55 @@ func parseConfig() AtlasConfig {
 		})
 	}
 
+	// --reset-cursor wins over the default --resume, but asking for both explicitly is a mistake
+	explicitResume := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "resume" {
+			explicitResume = true
+		}
+	})
+	if explicitResume && *resumeFlag && *resetCursorFlag {
+		AtlasLogger.Fatal("INVALID_FLAG_COMBINATION", nil, map[string]any{
+			logging.REASON: "--resume and --reset-cursor are mutually exclusive",
+		})
+	}
+
+	if *signalsFlag != ScalingSignalsPrometheus && *signalsFlag != ScalingSignalsInProcess {
+		AtlasLogger.Fatal("INVALID_FLAG_VALUE", nil, map[string]any{
+			logging.REASON:    "scaling-signals must be prometheus or in-process",
+			"scaling_signals": *signalsFlag,
+		})
+	}
+
+	if *leaseBlockFlag <= 0 || *leaseTTLFlag < 3*time.Second {
+		AtlasLogger.Fatal("INVALID_FLAG_VALUE", nil, map[string]any{
+			logging.REASON: "lease-block must be > 0 and lease-ttl at least 3s",
+			"lease_block":  *leaseBlockFlag,
+			"lease_ttl":    leaseTTLFlag.String(),
+		})
+	}
+
+	if *backfillRateFlag < 0 || *backfillWorkersFlag <= 0 {
+		AtlasLogger.Fatal("INVALID_FLAG_VALUE", nil, map[string]any{
+			logging.REASON:     "backfill-rate must be >= 0 and backfill-workers > 0",
+			"backfill_rate":    *backfillRateFlag,
+			"backfill_workers": *backfillWorkersFlag,
+		})
+	}
+
+	contestMax := *contestMaxFlag
+	if *devFlag {
+		contestMax = min(contestMax, effectiveMaxWorkers)
+	}
+	contestMin := min(*contestMinFlag, contestMax)
+	if contestMin < 1 {
+		AtlasLogger.Fatal("INVALID_FLAG_VALUE", nil, map[string]any{
+			logging.REASON:        "contest-min-workers and contest-max-workers must be > 0",
+			"contest_min_workers": *contestMinFlag,
+			"contest_max_workers": *contestMaxFlag,
+		})
+	}
+
 	workersValue := *numWorkers
 	if effectiveBuffer < 0 || workersValue <= 0 {
 		AtlasLogger.Fatal("INVALID_FLAGS", nil, map[string]any{
@@ -98,6 +169,16 @@ func parseConfig() AtlasConfig {
 		DevMode:          *devFlag,
 		DevSkip:          effectiveDevSkip,
 		MaxWorkers:       effectiveMaxWorkers,
+		Resume:           *resumeFlag && !*resetCursorFlag && *targetInstanceId == -1,
+		ResetCursor:      *resetCursorFlag,
+		ScalingSignals:   *signalsFlag,
+		BackfillRate:     *backfillRateFlag,
+		BackfillWorkers:  *backfillWorkersFlag,
+		Cluster:          *clusterFlag,
+		LeaseBlockSize:   *leaseBlockFlag,
+		LeaseTTL:         *leaseTTLFlag,
+		ContestMin:       contestMin,
+		ContestMax:       contestMax,
 	}
 
 	AtlasLogger.Info("ATLAS_CONFIG_LOADED", map[string]any{
@@ -107,6 +188,16 @@ func parseConfig() AtlasConfig {
 		"dev_mode":           config.DevMode,
 		"dev_skip":           config.DevSkip,
 		"max_workers":        config.MaxWorkers,
+		"resume":             config.Resume,
+		"reset_cursor":       config.ResetCursor,
+		"scaling_signals":    config.ScalingSignals,
+		"backfill_rate":      config.BackfillRate,
+		"backfill_workers":   config.BackfillWorkers,
+		"cluster":            config.Cluster,
+		"lease_block":        config.LeaseBlockSize,
+		"lease_ttl":          config.LeaseTTL.String(),
+		"contest_min":        config.ContestMin,
+		"contest_max":        config.ContestMax,
 	})
 
 	return config
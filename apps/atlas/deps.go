@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"raidhub/lib/dto"
+	"raidhub/lib/messaging/messages"
+	"raidhub/lib/messaging/publishing"
+	"raidhub/lib/messaging/routing"
+	"raidhub/lib/services/gap_registry"
+	"raidhub/lib/services/instance"
+	"raidhub/lib/services/missed_pgcr"
+	"raidhub/lib/services/pgcr_processing"
+	"raidhub/lib/web/bungie"
+)
+
+// crawlDeps is everything the crawl loops reach outside of Atlas: Bungie, the queues, and the database.
+// The simulation harness swaps it for the fake Bungie stream so it can drive the real loops.
+type crawlDeps struct {
+	// fetch fetches and processes one PGCR
+	fetch func(ctx context.Context, instanceId int64, malformedRetryCount int) (pgcr_processing.PGCRResult, *dto.Instance, *bungie.DestinyPostGameCarnageReport)
+	// waitForBungie blocks while the Destiny2 API is disabled
+	waitForBungie func()
+	// store hands a raid over to instance_store
+	store func(ctx context.Context, instance *dto.Instance, pgcr *bungie.DestinyPostGameCarnageReport) error
+	// sendToRetry hands a blocked instance over to pgcr_blocked_retry
+	sendToRetry func(ctx context.Context, instanceId int64) error
+	// resolveMissed resolves a missed PGCR ledger entry for an instance that was stored after all
+	resolveMissed func(ctx context.Context, instanceId int64) error
+	// recordGap registers a skipped range for the backfill worker
+	recordGap func(ctx context.Context, startId, endId int64, method gap_registry.Method) (*gap_registry.Gap, error)
+	// latestInstance returns the newest stored instance, where a runaway crawler is reset to
+	latestInstance func() (int64, time.Time, error)
+	// probe is what the gap search fetches with
+	probe blockProbe
+}
+
+// liveCrawlDeps crawls Bungie through Zeus and publishes to RabbitMQ
+var liveCrawlDeps = crawlDeps{
+	fetch: pgcr_processing.FetchAndProcessPGCR,
+	waitForBungie: func() {
+		if wg := bungie.GetAPIAvailabilityMonitor("Destiny2").GetReadOnlyWaitGroup(); wg != nil {
+			wg.Wait()
+		}
+	},
+	store: func(ctx context.Context, instance *dto.Instance, pgcr *bungie.DestinyPostGameCarnageReport) error {
+		return publishing.PublishJSONMessage(ctx, routing.InstanceStore, messages.NewPGCRStoreMessage(instance, pgcr))
+	},
+	sendToRetry: func(ctx context.Context, instanceId int64) error {
+		return publishing.PublishInt64Message(ctx, routing.PGCRRetry, instanceId)
+	},
+	resolveMissed: func(ctx context.Context, instanceId int64) error {
+		return missed_pgcr.Resolve(ctx, instanceId)
+	},
+	recordGap:      gap_registry.Record,
+	latestInstance: instance.GetLatestInstance,
+	probe:          bungieBlockProbe,
+}
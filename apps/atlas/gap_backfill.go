@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"raidhub/lib/messaging/messages"
+	"raidhub/lib/messaging/publishing"
+	"raidhub/lib/messaging/routing"
+	"raidhub/lib/services/gap_registry"
+	"raidhub/lib/services/missed_pgcr"
+	"raidhub/lib/services/pgcr_processing"
+	"raidhub/lib/utils/logging"
+	"raidhub/lib/utils/sentry"
+	"raidhub/lib/web/bungie"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// gapBackfillChunk is how many ids are swept between progress writes
+	gapBackfillChunk = 100
+	// gapBackfillStaleAfter is how long a claimed gap can go without progress before another sweep takes it over
+	gapBackfillStaleAfter = 10 * time.Minute
+	// gapBackfillIdle is how long to wait when there is nothing to backfill or the crawl needs the room
+	gapBackfillIdle = time.Minute
+	// gapBackfillYieldLag is how far behind head (P20, seconds) the crawl can be before the backfill stands aside
+	gapBackfillYieldLag = 600
+	// gapBackfillAttempts is how many failed fetches an id gets before it goes to the missed PGCR ledger
+	gapBackfillAttempts = 3
+)
+
+var backfillLogger = logging.NewLogger("atlas::gapBackfill")
+
+// gapBackfill sweeps registered gaps at low priority. It has its own rate budget, stands aside while the
+// crawl is paused, searching for a gap, or behind head, and does not feed the scaling signals, so a
+// sweep through a gap full of 404s never looks like a gap at the head.
+type gapBackfill struct {
+	limiter *rate.Limiter
+	workers int
+	owner   string // claims gaps in the registry
+}
+
+// gapBackfillWorker sweeps gaps until ctx is cancelled, handing back the gap it was sweeping
+func gapBackfillWorker(ctx context.Context, idsPerSecond float64, workers int) {
+	hostname, _ := os.Hostname()
+	b := &gapBackfill{
+		limiter: rate.NewLimiter(rate.Limit(idsPerSecond), workers),
+		workers: workers,
+		owner:   fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+	}
+	for ctx.Err() == nil {
+		if b.waitForCrawl(ctx, nil) != nil {
+			return
+		}
+		gap, err := gap_registry.Claim(ctx, b.owner, gapBackfillStaleAfter)
+		if err != nil {
+			backfillLogger.Warn("FAILED_TO_CLAIM_GAP", err, nil)
+		} else if gap != nil {
+			b.sweep(ctx, gap)
+			continue
+		}
+		sleepCtx(ctx, gapBackfillIdle)
+	}
+}
+
+// waitForCrawl blocks while the crawl at the head needs the rate budget more than the backfill does.
+// While it waits it keeps the claim on gap from going stale. It returns ctx's error once ctx is
+// cancelled, or gap_registry.ErrClaimLost if another sweep took gap over.
+func (b *gapBackfill) waitForCrawl(ctx context.Context, gap *gap_registry.Gap) error {
+	for {
+		if err := control.WaitWhilePaused(ctx); err != nil {
+			return err
+		}
+		if !gapSearchRunning.Load() && !crawlBehind() {
+			return nil
+		}
+		if !sleepCtx(ctx, gapBackfillIdle) {
+			return ctx.Err()
+		}
+		if gap == nil {
+			continue
+		}
+		if err := gap_registry.Refresh(ctx, gap.GapId, b.owner); errors.Is(err, gap_registry.ErrClaimLost) {
+			return err
+		} else if err != nil {
+			backfillLogger.Warn("FAILED_TO_REFRESH_GAP_CLAIM", err, map[string]any{
+				"gap_id": gap.GapId,
+			})
+		}
+	}
+}
+
+func crawlBehind() bool {
+	d := control.LastDecision()
+	return d != nil && d.Metrics != nil && d.Metrics.P20Lag >= gapBackfillYieldLag
+}
+
+// sweep works through a claimed gap from its cursor, writing progress after every chunk. It stops
+// when another sweep takes the gap over, and hands the gap back if ctx is cancelled first.
+func (b *gapBackfill) sweep(ctx context.Context, gap *gap_registry.Gap) {
+	backfillLogger.Info("BACKFILLING_GAP", map[string]any{
+		"gap_id":     gap.GapId,
+		logging.FROM: gap.Cursor,
+		logging.TO:   gap.EndId,
+		"method":     gap.Method,
+	})
+
+	for gap.Cursor < gap.EndId {
+		if err := b.waitForCrawl(ctx, gap); err != nil {
+			b.abandon(gap, err)
+			return
+		}
+		end := min(gap.Cursor+gapBackfillChunk, gap.EndId)
+		delta := b.sweepChunk(gap.Cursor, end)
+
+		for {
+			updated, err := gap_registry.Advance(ctx, gap.GapId, b.owner, end, delta)
+			if err == nil {
+				gap = updated
+				break
+			}
+			if errors.Is(err, gap_registry.ErrClaimLost) {
+				b.abandon(gap, err)
+				return
+			}
+			backfillLogger.Warn("FAILED_TO_RECORD_GAP_PROGRESS", err, map[string]any{
+				"gap_id":            gap.GapId,
+				logging.INSTANCE_ID: end,
+				logging.ACTION:      "retrying",
+			})
+			if !sleepCtx(ctx, 5*time.Second) {
+				b.abandon(gap, ctx.Err())
+				return
+			}
+		}
+	}
+
+	logGapBackfilled(gap)
+}
+
+// abandon stops sweeping gap, handing it back unless another sweep already took it over
+func (b *gapBackfill) abandon(gap *gap_registry.Gap, reason error) {
+	backfillLogger.Info("ABANDONED_GAP_SWEEP", map[string]any{
+		"gap_id":            gap.GapId,
+		logging.INSTANCE_ID: gap.Cursor,
+		logging.REASON:      reason.Error(),
+	})
+	if errors.Is(reason, gap_registry.ErrClaimLost) {
+		return
+	}
+	if err := gap_registry.Release(context.Background(), gap.GapId, b.owner); err != nil {
+		backfillLogger.Warn("FAILED_TO_RELEASE_GAP", err, map[string]any{
+			"gap_id":       gap.GapId,
+			logging.ACTION: "leaving_claim_to_go_stale",
+		})
+	}
+}
+
+// sweepChunk resolves every id in [from, to) and counts how they resolved
+func (b *gapBackfill) sweepChunk(from, to int64) gap_registry.Counts {
+	ids := make(chan int64)
+	var mu sync.Mutex
+	var counts gap_registry.Counts
+
+	var wg sync.WaitGroup
+	wg.Add(b.workers)
+	for range b.workers {
+		sentry.Go(func() {
+			defer wg.Done()
+			for id := range ids {
+				delta := b.resolve(id)
+				mu.Lock()
+				counts = counts.Add(delta)
+				mu.Unlock()
+			}
+		})
+	}
+	for id := from; id < to; id++ {
+		ids <- id
+	}
+	close(ids)
+	wg.Wait()
+	return counts
+}
+
+// resolve fetches one id of a gap and returns how it resolved as a single count
+func (b *gapBackfill) resolve(instanceId int64) gap_registry.Counts {
+	// Backfill yields to the live crawl in Zeus's scheduler
+	ctx := bungie.WithPriority(context.Background(), bungie.PriorityLow)
+	apiWG := bungie.GetAPIAvailabilityMonitor("Destiny2").GetReadOnlyWaitGroup()
+
+	malformed := 0
+	lastResult := pgcr_processing.ExternalError
+	for attempt := 0; attempt < gapBackfillAttempts; {
+		if apiWG != nil {
+			apiWG.Wait()
+		}
+		b.limiter.Wait(ctx)
+
+		result, instance, pgcr := pgcr_processing.FetchAndProcessPGCR(ctx, instanceId, malformed)
+		lastResult = result
+
+		switch result {
+		case pgcr_processing.Success:
+			storeMessage := messages.NewPGCRStoreMessage(instance, pgcr)
+			if err := publishing.PublishJSONMessage(ctx, routing.InstanceStore, storeMessage); err != nil {
+				backfillLogger.Warn("FAILED_TO_PUBLISH_INSTANCE_STORE_MESSAGE", err, map[string]any{
+					logging.INSTANCE_ID: instanceId,
+				})
+				lastResult = pgcr_processing.ExternalError
+				attempt++
+				time.Sleep(5 * time.Second)
+				continue
+			}
+			backfillLogger.Info("BACKFILLED_INSTANCE", map[string]any{
+				logging.INSTANCE_ID: instanceId,
+			})
+			if !instance.IsRaid() {
+				// an accepted non-raid mode, stored but not a raid
+				return gap_registry.Counts{NonRaids: 1}
+			}
+			return gap_registry.Counts{Raids: 1}
+		case pgcr_processing.NonRaid:
+			return gap_registry.Counts{NonRaids: 1}
+		case pgcr_processing.NotFound:
+			// the gap was confirmed by a binary search, so a 404 here is the expected answer
+			return gap_registry.Counts{NotFound: 1}
+		case pgcr_processing.InsufficientPrivileges:
+			// the blocked retry topic records it in the ledger if it never opens up
+			publishing.PublishInt64Message(ctx, routing.PGCRRetry, instanceId)
+			return gap_registry.Counts{Errors: 1}
+		case pgcr_processing.SystemDisabled:
+			time.Sleep(systemDisabledBackoff)
+			continue
+		case pgcr_processing.RateLimited:
+			time.Sleep(rateLimitedBackoff)
+		case pgcr_processing.BadFormat:
+			malformed++
+		default:
+			time.Sleep(externalErrorBackoff)
+		}
+		attempt++
+	}
+
+	missed_pgcr.Log(ctx, instanceId, missed_pgcr.ReasonForResult(lastResult), missed_pgcr.SourceGapBackfill)
+	return gap_registry.Counts{Errors: 1}
+}
@@ -6,85 +6,205 @@ import (
 	"sync/atomic"
 	"time"
 
-	"raidhub/lib/services/instance"
-	"raidhub/lib/services/instance_storage"
+	"raidhub/lib/services/gap_registry"
+	"raidhub/lib/services/missed_pgcr"
 	"raidhub/lib/services/pgcr_processing"
 	"raidhub/lib/utils/logging"
+	"raidhub/lib/web/bungie"
 )
 
-func gapCheckWorker(consumerConfig *ConsumerConfig) {
+const (
+	// gapSuperchargeWorkers and gapSuperchargePeriod size the extra burst spawned when a gap is suspected
+	gapSuperchargeWorkers = 500
+	gapSuperchargePeriod  = 10_000
+	// gapSearchSpan is how far past the cursor the gap checker looks for the start of the next block
+	gapSearchSpan = 5_000_000
+)
+
+// gapSearchRunning guards against the gap checker and the control API binary searching at the same time.
+// In cluster mode the search also takes a lock in Redis, so only one instance searches.
+var gapSearchRunning atomic.Bool
+
+// startGapSearch claims the gap search for this instance, returning false if one is already running
+func startGapSearch(consumerConfig *ConsumerConfig) bool {
+	if !gapSearchRunning.CompareAndSwap(false, true) {
+		return false
+	}
+	if consumerConfig.Leases == nil {
+		return true
+	}
+	locked, err := consumerConfig.Leases.LockGapSearch()
+	if err != nil {
+		AtlasLogger.Warn("FAILED_TO_LOCK_GAP_SEARCH", err, map[string]any{
+			logging.ACTION: "skipping_search",
+		})
+	}
+	if !locked {
+		gapSearchRunning.Store(false)
+	}
+	return locked
+}
+
+// endGapSearch releases what startGapSearch claimed
+func endGapSearch(consumerConfig *ConsumerConfig) {
+	if consumerConfig.Leases != nil {
+		if err := consumerConfig.Leases.UnlockGapSearch(); err != nil {
+			AtlasLogger.Warn("FAILED_TO_UNLOCK_GAP_SEARCH", err, nil)
+		}
+	}
+	gapSearchRunning.Store(false)
+}
+
+// blockProbe is how the gap search fetches instances and waits between retries,
+// so it can run against a fake Bungie on a virtual clock
+type blockProbe struct {
+	fetch func(instanceId int64) pgcr_processing.PGCRResult
+	sleep func(d time.Duration)
+}
+
+// bungieBlockProbe searches against Bungie in real time
+var bungieBlockProbe = blockProbe{
+	fetch: func(instanceId int64) pgcr_processing.PGCRResult {
+		// The search holds up the crawl at the head, so it shares its priority
+		result, _ := pgcr_processing.FetchPGCR(bungie.WithPriority(context.Background(), bungie.PriorityCritical), instanceId, 0)
+		return result
+	},
+	sleep: time.Sleep,
+}
+
+// suspectsGap reports whether recent 404s look like the crawler ran into a gap rather than the head
+func suspectsGap(metrics *AtlasMetrics) bool {
+	return metrics.Fraction404 > 0.8 && metrics.Count404 > 50
+}
+
+// confirmsGap reports whether 404s persisted through the supercharge, so it is worth searching past the gap
+func confirmsGap(metrics *AtlasMetrics) bool {
+	return metrics.Fraction404 > 0.99
+}
+
+func gapCheckWorker(ctx context.Context, consumerConfig *ConsumerConfig) {
 	// Check for gaps in the PGCRs
-	for {
-		metrics, err := GetMetrics(4)
+	for sleepCtx(ctx, 5*time.Minute) {
+		metrics, err := scalingSignals.GetMetrics(4)
 		if err != nil {
 			AtlasLogger.Error("FAILED_TO_GET_METRICS_IN_GAP_CHECKER", err, nil)
-			time.Sleep(5 * time.Minute)
 			continue
 		}
 
-		if metrics.Fraction404 > 0.8 && metrics.Count404 > 50 {
+		if suspectsGap(metrics) {
 			startTime := time.Now()
 			logHigh404Rate(int(metrics.Count404), metrics.Fraction404*100)
 			// spawn an additional 500 workers to process the potential gap
-			spawnWorkers(500, 10_000, consumerConfig)
+			spawnWorkers(ctx, gapSuperchargeWorkers, gapSuperchargePeriod, consumerConfig)
 
-			metrics, err := GetMetricsForScaling(time.Since(startTime))
+			metrics, err := scalingSignals.GetMetricsForScaling(time.Since(startTime))
 			if err != nil {
 				AtlasLogger.Error("FAILED_TO_GET_METRICS_AFTER_GAP_SUPERCHARGE", err, nil)
 				// Continue loop without evaluating metrics
-				time.Sleep(5 * time.Minute)
 				continue
 			}
 
 			logExitGapSupercharge(100*metrics.Fraction404, metrics.P20Lag)
 
-			if metrics.Fraction404 > 0.99 {
-				// try to find the starting point after the gap, if there is one
-				minCursor := consumerConfig.LatestId
-				maxCursor := consumerConfig.LatestId + 5_000_000
-				foundId, err := binarySearchForBlockStart(minCursor, maxCursor)
-
-				if err != nil {
-					// Error finding block start
-					AtlasLogger.Warn("GAP_BLOCK_SEARCH_FAILED", err, map[string]any{
-						logging.INSTANCE_ID: consumerConfig.LatestId,
-						logging.FROM:        minCursor,
-						logging.TO:          maxCursor,
-						logging.ACTION:      "resetting_to_latest",
-					})
-					latestId, completionDate, err := instance.GetLatestInstance()
-					if err != nil {
-						AtlasLogger.Fatal("FAILED_TO_GET_LATEST_INSTANCE", err, nil)
-					}
-
-					// reset the crawler
-					currentId := consumerConfig.LatestId
-					logRunawayError(100*metrics.Fraction404, currentId, latestId, completionDate)
-					atomic.StoreInt64(&consumerConfig.LatestId, latestId-10_000)
-				} else {
-					prevId := consumerConfig.LatestId
-
-					for id := prevId; id < foundId; id++ {
-						instance_storage.WriteMissedLog(id)
-					}
-
-					// push the crawler forward
-					logGapCheckBlockSkip(prevId, foundId)
-					atomic.StoreInt64(&consumerConfig.LatestId, foundId)
-				}
+			if confirmsGap(metrics) && startGapSearch(consumerConfig) {
+				searchForGap(consumerConfig, metrics)
+				endGapSearch(consumerConfig)
 			}
 		}
+	}
+}
+
+// searchForGap binary searches for the start of the next block past the crawl, and skips to it.
+// If there is none, the crawl ran past the head and is reset to the latest stored instance.
+func searchForGap(consumerConfig *ConsumerConfig, metrics *AtlasMetrics) {
+	// The search starts from the oldest id still to be crawled, across the cluster in cluster mode
+	currentId, minCursor, err := consumerConfig.frontier()
+	if err != nil {
+		AtlasLogger.Warn("FAILED_TO_READ_CRAWL_FRONTIER", err, map[string]any{
+			logging.ACTION: "skipping_search",
+		})
+		return
+	}
+	maxCursor := minCursor + gapSearchSpan
+	foundId, err := binarySearchForBlockStart(minCursor, maxCursor, consumerConfig.Deps.probe)
+	if err == nil {
+		skipToBlockStart(consumerConfig, foundId, gap_registry.MethodBinarySearch)
+		return
+	}
+
+	// Error finding block start
+	AtlasLogger.Warn("GAP_BLOCK_SEARCH_FAILED", err, map[string]any{
+		logging.INSTANCE_ID: currentId,
+		logging.FROM:        minCursor,
+		logging.TO:          maxCursor,
+		logging.ACTION:      "resetting_to_latest",
+	})
+	latestId, completionDate, err := consumerConfig.Deps.latestInstance()
+	if err != nil {
+		AtlasLogger.Fatal("FAILED_TO_GET_LATEST_INSTANCE", err, nil)
+	}
 
-		time.Sleep(5 * time.Minute)
+	// reset the crawler, unless it was already moved back while we searched
+	logRunawayError(100*metrics.Fraction404, currentId, latestId, completionDate)
+	if _, err := consumerConfig.resetCursor(currentId, latestId-10_000); err != nil {
+		AtlasLogger.Warn("FAILED_TO_RESET_CURSOR", err, map[string]any{
+			logging.FROM: currentId,
+			logging.TO:   latestId - 10_000,
+		})
 	}
 }
 
-func binarySearchForBlockStart(minCursor, maxCursor int64) (int64, error) {
+// skipToBlockStart pushes the crawler forward so foundId is the next id handed out, and registers every
+// id it skipped over as a gap for the backfill worker
+func skipToBlockStart(consumerConfig *ConsumerConfig, foundId int64, method gap_registry.Method) {
+	firstId, err := consumerConfig.skipTo(foundId)
+	if err != nil {
+		AtlasLogger.Warn("FAILED_TO_MOVE_CURSOR", err, map[string]any{
+			logging.TO:     foundId,
+			logging.ACTION: "leaving_cursor_unchanged",
+		})
+		return
+	}
+	if firstId >= foundId {
+		AtlasLogger.Info("GAP_ALREADY_CRAWLED", map[string]any{
+			logging.TO: foundId,
+		})
+		return
+	}
+
+	gap, err := consumerConfig.Deps.recordGap(context.Background(), firstId, foundId, method)
+	if err != nil {
+		AtlasLogger.Warn("FAILED_TO_REGISTER_GAP", err, map[string]any{
+			logging.FROM:   firstId,
+			logging.TO:     foundId,
+			logging.ACTION: "recording_ids_as_missed",
+		})
+		// the ledger is the next best place for them
+		err = missed_pgcr.RecordRange(context.Background(), firstId, foundId, missed_pgcr.ReasonNotFound, missed_pgcr.SourceGapChecker)
+		if err != nil {
+			AtlasLogger.Warn("FAILED_TO_RECORD_SKIPPED_BLOCK", err, map[string]any{
+				logging.FROM: firstId,
+				logging.TO:   foundId,
+			})
+		}
+	} else if gap != nil {
+		AtlasLogger.Info("GAP_REGISTERED", map[string]any{
+			"gap_id":     gap.GapId,
+			logging.FROM: gap.StartId,
+			logging.TO:   gap.EndId,
+			"method":     gap.Method,
+		})
+	}
+
+	logGapCheckBlockSkip(firstId-1, foundId)
+}
+
+func binarySearchForBlockStart(minCursor, maxCursor int64, probe blockProbe) (int64, error) {
 	// Binary search to find the latest instanceId
 	hasFound := false
 	for minCursor < maxCursor {
 		mid := (minCursor + maxCursor) / 2
-		result, _ := pgcr_processing.FetchPGCR(context.Background(), mid, 0)
+		result := probe.fetch(mid)
 		switch result {
 		case pgcr_processing.Success:
 			hasFound = true
@@ -96,10 +216,10 @@ func binarySearchForBlockStart(minCursor, maxCursor int64) (int64, error) {
 				maxCursor = mid
 			}
 		case pgcr_processing.SystemDisabled:
-			time.Sleep(60 * time.Second)
+			probe.sleep(systemDisabledBackoff)
 		case pgcr_processing.ExternalError, pgcr_processing.RateLimited:
 			// retry the request
-			time.Sleep(5 * time.Second)
+			probe.sleep(rateLimitedBackoff)
 		default:
 			return -1, fmt.Errorf("unexpected result %d for instanceId %d while binary searching", result, mid)
 		}
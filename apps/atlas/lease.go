@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	rdb "raidhub/lib/database/redis"
+	"raidhub/lib/utils/logging"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// leaseCursorKey holds the first id no instance has leased yet
+	leaseCursorKey = "atlas:lease:cursor"
+	// leaseExpiryKey is a ZSET of block start ids scored by lease expiry in unix milliseconds
+	leaseExpiryKey = "atlas:lease:expiry"
+	// leaseBlockKeyPrefix + block start is a HASH with the block end, owner, and progress
+	leaseBlockKeyPrefix = "atlas:lease:block:"
+	// gapSearchLockKey holds the owner of the gap search running in the cluster, if any
+	gapSearchLockKey = "atlas:lease:gap_search"
+	// gapSearchLockTTL outlasts a binary search through throttling, so the lock only expires if its owner died
+	gapSearchLockTTL = 15 * time.Minute
+
+	defaultLeaseBlockSize = 1000
+	defaultLeaseTTL       = 2 * time.Minute
+)
+
+var leaseLogger = logging.NewLogger("atlas::lease")
+
+// acquireLeaseScript reclaims the oldest expired block if there is one, otherwise leases the next
+// block past the cursor. Returns {from, to, progress, reclaimed}.
+var acquireLeaseScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local expires = now + tonumber(ARGV[2])
+local expired = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', now, 'LIMIT', 0, 1)
+if #expired > 0 then
+	local from = expired[1]
+	local key = ARGV[5] .. from
+	redis.call('ZADD', KEYS[1], expires, from)
+	redis.call('HSET', key, 'owner', ARGV[3])
+	local block = redis.call('HMGET', key, 'to', 'progress')
+	return {tonumber(from), tonumber(block[1]), tonumber(block[2]), 1}
+end
+local size = tonumber(ARGV[4])
+local to = redis.call('INCRBY', KEYS[2], size)
+local from = to - size
+redis.call('HSET', ARGV[5] .. from, 'to', to, 'owner', ARGV[3], 'progress', from)
+redis.call('ZADD', KEYS[1], expires, from)
+return {from, to, from, 0}
+`)
+
+// renewLeaseScript moves the expiry of the blocks still owned by ARGV[2] to ARGV[3] and stores their
+// progress. ARGV[4:] are (from, progress) pairs. Returns the block starts lost to another instance.
+var renewLeaseScript = redis.NewScript(`
+local lost = {}
+for i = 4, #ARGV, 2 do
+	local key = ARGV[1] .. ARGV[i]
+	if redis.call('HGET', key, 'owner') == ARGV[2] then
+		redis.call('HSET', key, 'progress', ARGV[i + 1])
+		redis.call('ZADD', KEYS[1], ARGV[3], ARGV[i])
+	else
+		table.insert(lost, tonumber(ARGV[i]))
+	end
+end
+return lost
+`)
+
+// releaseLeaseScript deletes finished blocks still owned by ARGV[2]. ARGV[3:] are block starts.
+var releaseLeaseScript = redis.NewScript(`
+for i = 3, #ARGV do
+	local key = ARGV[1] .. ARGV[i]
+	if redis.call('HGET', key, 'owner') == ARGV[2] then
+		redis.call('DEL', key)
+		redis.call('ZREM', KEYS[1], ARGV[i])
+	end
+end
+return 0
+`)
+
+// advanceCursorScript moves the cursor forward to ARGV[1] and never back. Returns the cursor it found.
+var advanceCursorScript = redis.NewScript(`
+local cursor = tonumber(redis.call('GET', KEYS[1]) or '0')
+if cursor < tonumber(ARGV[1]) then
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+return cursor
+`)
+
+// resetCursorScript moves the cursor to ARGV[2] unless it was already moved below ARGV[1].
+// Returns 1 if it was moved.
+var resetCursorScript = redis.NewScript(`
+local cursor = tonumber(redis.call('GET', KEYS[1]) or '0')
+if cursor < tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2])
+return 1
+`)
+
+// unlockScript deletes the lock in KEYS[1] if ARGV[1] still holds it
+var unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// idLease is a block of ids [from, to) this instance holds
+type idLease struct {
+	from int64
+	to   int64
+	next int64 // next id to hand out
+}
+
+// leaseState is a held block as reported by the control API
+type leaseState struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+	Next int64 `json:"next"`
+}
+
+// leaseManager hands out ids from contiguous blocks leased through Redis, so several Atlas instances
+// can crawl side by side without duplicating work. Blocks are renewed while this instance works on
+// them; if it dies, another instance reclaims them from the last reported progress once they expire.
+type leaseManager struct {
+	owner     string
+	blockSize int64
+	ttl       time.Duration
+	tracker   *crawlTracker // set by run once the crawl starts
+
+	mu      sync.Mutex
+	held    map[int64]*idLease
+	current *idLease
+}
+
+func newLeaseManager(blockSize int64, ttl time.Duration) *leaseManager {
+	hostname, _ := os.Hostname()
+	return &leaseManager{
+		owner:     fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+		blockSize: blockSize,
+		ttl:       ttl,
+		held:      make(map[int64]*idLease),
+	}
+}
+
+// Join sets the cluster cursor to start unless another instance already did, and returns the cursor
+// in effect. With force the cursor is overwritten.
+func (m *leaseManager) Join(start int64, force bool) (int64, error) {
+	ctx := context.Background()
+	if force {
+		return start, rdb.Client.Set(ctx, leaseCursorKey, start, 0).Err()
+	}
+	if err := rdb.Client.SetNX(ctx, leaseCursorKey, start, 0).Err(); err != nil {
+		return 0, err
+	}
+	return rdb.Client.Get(ctx, leaseCursorKey).Int64()
+}
+
+// Next hands out the next id, leasing a new block when the current one runs out.
+// The cursor and tracker are updated the same way Advance updates them.
+func (m *leaseManager) Next(cursor *int64, step int64) int64 {
+	for {
+		m.mu.Lock()
+		if m.current != nil && m.current.next < m.current.to {
+			id := m.current.next
+			m.current.next += step
+			m.tracker.Claim(cursor, id)
+			m.mu.Unlock()
+			return id
+		}
+		m.mu.Unlock()
+
+		lease, err := m.acquire()
+		if err != nil {
+			leaseLogger.Warn("FAILED_TO_ACQUIRE_LEASE", err, map[string]any{
+				logging.ACTION: "retrying",
+			})
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		m.mu.Lock()
+		m.held[lease.from] = lease
+		m.current = lease
+		m.mu.Unlock()
+	}
+}
+
+func (m *leaseManager) acquire() (*idLease, error) {
+	res, err := acquireLeaseScript.Run(context.Background(), rdb.Client,
+		[]string{leaseExpiryKey, leaseCursorKey},
+		time.Now().UnixMilli(), m.ttl.Milliseconds(), m.owner, m.blockSize, leaseBlockKeyPrefix,
+	).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(res) != 4 {
+		return nil, fmt.Errorf("unexpected lease reply %v", res)
+	}
+
+	lease := &idLease{from: res[0], to: res[1], next: res[2]}
+	fields := map[string]any{
+		logging.FROM: lease.from,
+		logging.TO:   lease.to,
+		"progress":   lease.next,
+	}
+	if res[3] == 1 {
+		leaseLogger.Info("RECLAIMED_EXPIRED_LEASE", fields)
+	} else {
+		leaseLogger.Debug("LEASED_BLOCK", fields)
+	}
+	return lease, nil
+}
+
+// MoveCursor points the cluster cursor at next and stops handing out the rest of the current block,
+// so the next block leased by any instance starts at next. It is for operators; the crawl itself only
+// moves the cursor through AdvanceCursor and ResetCursor.
+func (m *leaseManager) MoveCursor(next int64) error {
+	m.dropCurrent()
+	return rdb.Client.Set(context.Background(), leaseCursorKey, next, 0).Err()
+}
+
+// AdvanceCursor moves the cluster cursor forward to next, so no instance leases the ids before it.
+// It returns the cursor it found, which is next or past it if the cluster already leased that far.
+// Blocks leased before the move are crawled to the end by their holders.
+func (m *leaseManager) AdvanceCursor(next int64) (int64, error) {
+	return advanceCursorScript.Run(context.Background(), rdb.Client, []string{leaseCursorKey}, next).Int64()
+}
+
+// ResetCursor moves the cluster cursor back to next after the crawl ran past the head. seen is the
+// cursor the caller decided on, so a reset another instance already made is not undone.
+func (m *leaseManager) ResetCursor(seen, next int64) (bool, error) {
+	moved, err := resetCursorScript.Run(context.Background(), rdb.Client, []string{leaseCursorKey}, seen, next).Int()
+	if err != nil || moved == 0 {
+		return false, err
+	}
+	m.dropCurrent()
+	return true, nil
+}
+
+// dropCurrent stops handing out the rest of the current block
+func (m *leaseManager) dropCurrent() {
+	m.mu.Lock()
+	if m.current != nil {
+		m.current.next = m.current.to
+	}
+	m.mu.Unlock()
+}
+
+// Frontier returns the cluster cursor and the low-water mark of the cluster: the smallest id a leased
+// block has yet to hand out, as of its last renewal, or the cursor if no block is leased
+func (m *leaseManager) Frontier() (cursor int64, lowWaterMark int64, err error) {
+	ctx := context.Background()
+	cursor, err = rdb.Client.Get(ctx, leaseCursorKey).Int64()
+	if err != nil {
+		return 0, 0, err
+	}
+	blocks, err := rdb.Client.ZRange(ctx, leaseExpiryKey, 0, -1).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	pipe := rdb.Client.Pipeline()
+	progress := make([]*redis.StringCmd, len(blocks))
+	for i, from := range blocks {
+		progress[i] = pipe.HGet(ctx, leaseBlockKeyPrefix+from, "progress")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, 0, err
+	}
+
+	lowWaterMark = cursor
+	for _, cmd := range progress {
+		if mark, err := cmd.Int64(); err == nil && mark < lowWaterMark {
+			lowWaterMark = mark
+		}
+	}
+	return cursor, lowWaterMark, nil
+}
+
+// LockGapSearch takes the cluster's gap search lock. Returns false if another instance holds it.
+func (m *leaseManager) LockGapSearch() (bool, error) {
+	return rdb.Client.SetNX(context.Background(), gapSearchLockKey, m.owner, gapSearchLockTTL).Result()
+}
+
+// UnlockGapSearch releases the gap search lock if this instance still holds it
+func (m *leaseManager) UnlockGapSearch() error {
+	return unlockScript.Run(context.Background(), rdb.Client, []string{gapSearchLockKey}, m.owner).Err()
+}
+
+// progress splits held blocks into finished ones and the low-water mark of the rest.
+// Offloaded ids are with Hermes and no longer hold a block open.
+func (m *leaseManager) progress() (finished []int64, marks map[int64]int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	marks = make(map[int64]int64)
+	for from, lease := range m.held {
+		mark := lease.next
+		if oldest, ok := m.tracker.OldestInFlight(lease.from, lease.to); ok && oldest < mark {
+			mark = oldest
+		}
+		if mark >= lease.to {
+			finished = append(finished, from)
+			delete(m.held, from)
+			continue
+		}
+		marks[from] = mark
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i] < finished[j] })
+	return finished, marks
+}
+
+// Renew releases finished blocks and extends the rest by expiresIn, recording their progress
+func (m *leaseManager) Renew(expiresIn time.Duration) error {
+	ctx := context.Background()
+	finished, marks := m.progress()
+
+	if len(finished) > 0 {
+		args := []any{leaseBlockKeyPrefix, m.owner}
+		for _, from := range finished {
+			args = append(args, from)
+		}
+		if err := releaseLeaseScript.Run(ctx, rdb.Client, []string{leaseExpiryKey}, args...).Err(); err != nil {
+			return err
+		}
+	}
+	if len(marks) == 0 {
+		return nil
+	}
+
+	args := []any{leaseBlockKeyPrefix, m.owner, time.Now().Add(expiresIn).UnixMilli()}
+	for from, mark := range marks {
+		args = append(args, from, mark)
+	}
+	lost, err := renewLeaseScript.Run(ctx, rdb.Client, []string{leaseExpiryKey}, args...).Int64Slice()
+	if err != nil {
+		return err
+	}
+
+	if len(lost) > 0 {
+		m.mu.Lock()
+		for _, from := range lost {
+			if m.current == m.held[from] {
+				m.current = nil
+			}
+			delete(m.held, from)
+		}
+		m.mu.Unlock()
+		leaseLogger.Warn("LEASES_LOST", nil, map[string]any{
+			logging.COUNT:  len(lost),
+			"blocks":       lost,
+			logging.REASON: "renewal came after another instance reclaimed them",
+		})
+	}
+	return nil
+}
+
+// ReleaseAll hands every unfinished block back for immediate reclaiming, keeping its progress
+func (m *leaseManager) ReleaseAll() error {
+	m.mu.Lock()
+	m.current = nil
+	m.mu.Unlock()
+	return m.Renew(0)
+}
+
+// State lists the blocks this instance holds
+func (m *leaseManager) State() []leaseState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	states := make([]leaseState, 0, len(m.held))
+	for _, lease := range m.held {
+		states = append(states, leaseState{From: lease.from, To: lease.to, Next: lease.next})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].From < states[j].From })
+	return states
+}
+
+// leaseRenewWorker renews held blocks three times per TTL
+func leaseRenewWorker(leases *leaseManager) {
+	ticker := time.NewTicker(leases.ttl / 3)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := leases.Renew(leases.ttl); err != nil {
+			leaseLogger.Warn("FAILED_TO_RENEW_LEASES", err, nil)
+		}
+	}
+}
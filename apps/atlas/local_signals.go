@@ -0,0 +1,174 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"raidhub/lib/monitoring/atlas_metrics"
+	"raidhub/lib/services/pgcr_processing"
+)
+
+const (
+	// localSignalsWindow is how much history the in-process signals keep
+	localSignalsWindow = 10 * time.Minute
+	// localLagWindow matches the fixed [2m] window of the Prometheus lag query
+	localLagWindow = 2 * time.Minute
+	// localLagFallback matches the Prometheus fallback when no lag has been observed
+	localLagFallback = 900
+
+	maxPGCRResult = int(pgcr_processing.RateLimited)
+)
+
+// signalBucket holds everything observed during one second
+type signalBucket struct {
+	second   int64
+	statuses [maxPGCRResult + 1]int64
+	lag      []int64 // counts per atlas_metrics.PGCRCrawlLagBuckets bound, plus +Inf
+}
+
+// localSignals computes scaling signals from sliding-window counters fed directly by the workers.
+// It keeps one bucket per second in a ring so reads never depend on Prometheus being reachable.
+type localSignals struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	buckets []signalBucket
+}
+
+func newLocalSignals(now func() time.Time) *localSignals {
+	size := int(localSignalsWindow / time.Second)
+	buckets := make([]signalBucket, size)
+	for i := range buckets {
+		buckets[i].lag = make([]int64, len(atlas_metrics.PGCRCrawlLagBuckets)+1)
+	}
+	return &localSignals{
+		now:     now,
+		buckets: buckets,
+	}
+}
+
+// bucket returns the bucket for the current second, clearing it if it holds stale data.
+// Caller must hold s.mu.
+func (s *localSignals) bucket() *signalBucket {
+	second := s.now().Unix()
+	b := &s.buckets[second%int64(len(s.buckets))]
+	if b.second != second {
+		b.second = second
+		b.statuses = [maxPGCRResult + 1]int64{}
+		clear(b.lag)
+	}
+	return b
+}
+
+// RecordStatus counts one PGCR fetch result
+func (s *localSignals) RecordStatus(result pgcr_processing.PGCRResult) {
+	if int(result) < 0 || int(result) > maxPGCRResult {
+		return
+	}
+	s.mu.Lock()
+	s.bucket().statuses[result]++
+	s.mu.Unlock()
+}
+
+// RecordLag adds one lag observation to the quantile sketch
+func (s *localSignals) RecordLag(seconds float64) {
+	idx := len(atlas_metrics.PGCRCrawlLagBuckets)
+	for i, bound := range atlas_metrics.PGCRCrawlLagBuckets {
+		if seconds <= bound {
+			idx = i
+			break
+		}
+	}
+	s.mu.Lock()
+	s.bucket().lag[idx]++
+	s.mu.Unlock()
+}
+
+// sum aggregates all buckets within the trailing window. Caller must hold s.mu.
+func (s *localSignals) sum(window time.Duration) (statuses [maxPGCRResult + 1]int64, lag []int64) {
+	lag = make([]int64, len(atlas_metrics.PGCRCrawlLagBuckets)+1)
+	now := s.now().Unix()
+	oldest := now - int64(window/time.Second)
+	for i := range s.buckets {
+		b := &s.buckets[i]
+		if b.second <= oldest || b.second > now {
+			continue
+		}
+		for status, c := range b.statuses {
+			statuses[status] += c
+		}
+		for j, c := range b.lag {
+			lag[j] += c
+		}
+	}
+	return statuses, lag
+}
+
+// lagQuantile estimates a quantile from bucket counts the same way histogram_quantile does:
+// linear interpolation inside the bucket holding the rank. Returns -1 with no observations.
+func lagQuantile(q float64, counts []int64) float64 {
+	total := int64(0)
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		return -1
+	}
+
+	bounds := atlas_metrics.PGCRCrawlLagBuckets
+	rank := q * float64(total)
+	cumulative := int64(0)
+	for i, c := range counts {
+		if float64(cumulative+c) < rank || c == 0 {
+			cumulative += c
+			continue
+		}
+		if i == len(bounds) {
+			// +Inf bucket, return the highest finite bound
+			return bounds[len(bounds)-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = bounds[i-1]
+		}
+		return lower + (bounds[i]-lower)*(rank-float64(cumulative))/float64(c)
+	}
+	return bounds[len(bounds)-1]
+}
+
+func (s *localSignals) GetMetricsForScaling(elapsedTime time.Duration) (*AtlasMetrics, error) {
+	intervalMinutes := min(4, int(elapsedTime.Minutes()))
+	return s.GetMetrics(intervalMinutes)
+}
+
+func (s *localSignals) GetMetrics(intervalMinutes int) (*AtlasMetrics, error) {
+	window := time.Duration(max(1, intervalMinutes)) * time.Minute
+
+	s.mu.Lock()
+	statuses, _ := s.sum(window)
+	_, lag := s.sum(localLagWindow)
+	s.mu.Unlock()
+
+	total := int64(0)
+	for _, c := range statuses {
+		total += c
+	}
+
+	metrics := &AtlasMetrics{
+		P20Lag:   lagQuantile(0.20, lag),
+		Count404: float64(statuses[pgcr_processing.NotFound]),
+		PGCRRate: float64(statuses[pgcr_processing.Success]+statuses[pgcr_processing.NonRaid]) / window.Seconds(),
+	}
+	if metrics.P20Lag == -1 || math.IsNaN(metrics.P20Lag) {
+		metrics.P20Lag = localLagFallback
+	}
+	if total > 0 {
+		errors := int64(0)
+		for status := int(pgcr_processing.BadFormat); status <= maxPGCRResult; status++ {
+			errors += statuses[status]
+		}
+		metrics.Fraction404 = float64(statuses[pgcr_processing.NotFound]) / float64(total)
+		metrics.ErrorFraction = float64(errors) / float64(total)
+	}
+	return metrics, nil
+}
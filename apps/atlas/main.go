@@ -1,9 +1,17 @@
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"raidhub/lib/database/postgres"
+	rdb "raidhub/lib/database/redis"
 	"raidhub/lib/messaging/publishing"
 	"raidhub/lib/monitoring"
+	"raidhub/lib/services/bungie_status"
+	"raidhub/lib/services/contest_profile"
 	"raidhub/lib/services/instance"
 	"raidhub/lib/utils/logging"
 )
@@ -13,45 +21,107 @@ var AtlasLogger = logging.NewLogger("atlas")
 func main() {
 	logging.ParseFlags()
 
+	// Cancelled on SIGINT/SIGTERM. run checkpoints and returns, so the deferred flushes still happen.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	flushSentry, recoverSentry := AtlasLogger.InitSentry()
 	defer flushSentry()
 	defer recoverSentry()
 
 	config := parseConfig()
-	workers = config.Workers
+
+	var err error
+	if scalingSignals, err = selectScalingSignals(config.ScalingSignals); err != nil {
+		AtlasLogger.Fatal("INVALID_SCALING_SIGNALS", err, nil)
+	}
 
 	monitoring.RegisterAtlasMetrics()
 
 	AtlasLogger.Debug("WAITING_ON_CONNECTIONS", map[string]any{
-		"services": []string{"postgres", "publishing"},
+		"services": []string{"postgres", "redis", "publishing"},
 	})
 	postgres.Wait()
+	rdb.Wait()
 	publishing.Wait()
 
-	var instanceId int64
-	var err error
-	if config.TargetInstanceId == -1 {
-		if instanceId, err = instance.GetLatestInstanceId(config.Buffer); err != nil {
-			// In dev mode, if database is empty, try to find latest from web using binary search
-			if config.DevMode {
-				AtlasLogger.Info("DATABASE_EMPTY_IN_DEV_MODE", map[string]any{
-					"attempting": "binary_search_from_web",
-				})
-				if instanceId, err = instance.GetLatestInstanceIdFromWeb(config.Buffer); err != nil {
-					AtlasLogger.Fatal("FAILED_TO_GET_LATEST_INSTANCE_ID", err, map[string]any{
-						"buffer": config.Buffer,
-						"source": "database_and_web",
-					})
-				}
-			} else {
-				AtlasLogger.Fatal("FAILED_TO_GET_LATEST_INSTANCE_ID", err, map[string]any{
-					"buffer": config.Buffer,
-				})
-			}
+	bungie_status.Start()
+	contest_profile.Start("Atlas")
+
+	if config.ResetCursor {
+		if err := deleteCheckpoint(checkpointCrawler); err != nil {
+			AtlasLogger.Fatal("FAILED_TO_RESET_CHECKPOINT", err, nil)
 		}
+		AtlasLogger.Info("CHECKPOINT_RESET", nil)
+	}
+
+	var instanceId int64
+	var pendingOffloadIds []int64
+	var leases *leaseManager
+	if config.Cluster {
+		// The shared cursor and block leases replace the checkpoint in cluster mode
+		leases = newLeaseManager(config.LeaseBlockSize, config.LeaseTTL)
+		instanceId = joinCluster(config, leases)
 	} else {
-		instanceId = config.TargetInstanceId - config.Buffer
+		resumed := false
+		if config.Resume {
+			instanceId, pendingOffloadIds, resumed = resumeFromCheckpoint(config.DevSkip)
+		}
+
+		if !resumed {
+			instanceId = getStartingInstanceId(config)
+		}
 	}
 
-	run(instanceId, config.DevSkip, config.MaxWorkers)
+	run(ctx, config, instanceId, pendingOffloadIds, leases)
+}
+
+// joinCluster seeds the shared cursor if this is the first instance (or the cursor is being reset)
+// and returns the id to start from
+func joinCluster(config AtlasConfig, leases *leaseManager) int64 {
+	start := getStartingInstanceId(config) + 1
+	force := config.ResetCursor || config.TargetInstanceId != -1
+	cursor, err := leases.Join(start, force)
+	if err != nil {
+		AtlasLogger.Fatal("FAILED_TO_JOIN_CLUSTER", err, nil)
+	}
+	AtlasLogger.Info("JOINED_CLUSTER", map[string]any{
+		"owner":       leases.owner,
+		"cursor":      cursor,
+		"seeded":      cursor == start,
+		"lease_block": leases.blockSize,
+		"lease_ttl":   leases.ttl.String(),
+	})
+	return cursor - 1
+}
+
+// getStartingInstanceId determines where to start crawling when there is no checkpoint to resume from
+func getStartingInstanceId(config AtlasConfig) int64 {
+	if config.TargetInstanceId != -1 {
+		return config.TargetInstanceId - config.Buffer
+	}
+
+	instanceId, err := instance.GetLatestInstanceId(config.Buffer)
+	if err == nil {
+		return instanceId
+	}
+
+	// In dev mode, if database is empty, try to find latest from web using binary search
+	if config.DevMode {
+		AtlasLogger.Info("DATABASE_EMPTY_IN_DEV_MODE", map[string]any{
+			"attempting": "binary_search_from_web",
+		})
+		if instanceId, err = instance.GetLatestInstanceIdFromWeb(config.Buffer); err != nil {
+			AtlasLogger.Fatal("FAILED_TO_GET_LATEST_INSTANCE_ID", err, map[string]any{
+				"buffer": config.Buffer,
+				"source": "database_and_web",
+			})
+		}
+		return instanceId
+	}
+
+	AtlasLogger.Fatal("FAILED_TO_GET_LATEST_INSTANCE_ID", err, map[string]any{
+		"buffer": config.Buffer,
+	})
+	return 0
 }
@@ -28,45 +28,50 @@ type AtlasMetrics struct {
 	Count404      float64
 }
 
+// prometheusSignals reads scaling signals back out of Prometheus with PromQL
+type prometheusSignals struct {
+	client *prometheus_api.PrometheusClient
+}
+
 // GetMetricsForScaling fetches all metrics needed for scaling decisions
 // intervalMinutes is automatically calculated from elapsedTime
-func GetMetricsForScaling(elapsedTime time.Duration) (*AtlasMetrics, error) {
+func (p *prometheusSignals) GetMetricsForScaling(elapsedTime time.Duration) (*AtlasMetrics, error) {
 	intervalMinutes := min(4, int(elapsedTime.Minutes()))
-	return GetMetrics(intervalMinutes)
+	return p.GetMetrics(intervalMinutes)
 }
 
 // GetMetrics fetches all metrics for the given interval
-func GetMetrics(intervalMinutes int) (*AtlasMetrics, error) {
+func (p *prometheusSignals) GetMetrics(intervalMinutes int) (*AtlasMetrics, error) {
 	metrics := &AtlasMetrics{}
 
 	// Fetch all metrics in parallel would be ideal, but for now we'll do sequentially
 	// to keep it simple and avoid complex error handling
 
-	p20Lag, err := getP20Lag(intervalMinutes)
+	p20Lag, err := p.getP20Lag(intervalMinutes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get p20 lag: %w", err)
 	}
 	metrics.P20Lag = p20Lag
 
-	fraction404, err := get404Fraction(intervalMinutes)
+	fraction404, err := p.get404Fraction(intervalMinutes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get 404 fraction: %w", err)
 	}
 	metrics.Fraction404 = fraction404
 
-	errorFraction, err := getErrorFraction(intervalMinutes)
+	errorFraction, err := p.getErrorFraction(intervalMinutes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get error fraction: %w", err)
 	}
 	metrics.ErrorFraction = errorFraction
 
-	pgcrRate, err := getPgcrsPerSecond(intervalMinutes)
+	pgcrRate, err := p.getPgcrsPerSecond(intervalMinutes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get PGCR rate: %w", err)
 	}
 	metrics.PGCRRate = pgcrRate
 
-	count404, err := get404Rate(intervalMinutes)
+	count404, err := p.get404Rate(intervalMinutes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get 404 count: %w", err)
 	}
@@ -75,27 +80,27 @@ func GetMetrics(intervalMinutes int) (*AtlasMetrics, error) {
 	return metrics, nil
 }
 
-func get404Fraction(intervalMins int) (float64, error) {
+func (p *prometheusSignals) get404Fraction(intervalMins int) (float64, error) {
 	query := fmt.Sprintf(`sum(rate(pgcr_crawl_summary_status_count{status="3"}[%dm])) / sum(rate(pgcr_crawl_summary_status_count{}[%dm]))`, intervalMins, intervalMins)
-	f, err := execWeightedQuery(query, intervalMins)
+	f, err := p.execWeightedQuery(query, intervalMins)
 	if err != nil || f == -1 {
 		return 0, err
 	}
 	return f, nil
 }
 
-func getErrorFraction(intervalMins int) (float64, error) {
+func (p *prometheusSignals) getErrorFraction(intervalMins int) (float64, error) {
 	query := fmt.Sprintf(`sum(rate(pgcr_crawl_summary_status_count{status=~"6|7|8|9|10"}[%dm])) / sum(rate(pgcr_crawl_summary_status_count{}[%dm]))`, intervalMins, intervalMins)
-	f, err := execWeightedQuery(query, intervalMins)
+	f, err := p.execWeightedQuery(query, intervalMins)
 	if err != nil || f == -1 {
 		return 0, err
 	}
 	return f, nil
 }
 
-func getP20Lag(intervalMins int) (float64, error) {
+func (p *prometheusSignals) getP20Lag(intervalMins int) (float64, error) {
 	query := `histogram_quantile(0.20, sum(rate(pgcr_crawl_summary_lag_seconds_bucket[2m])) by (le))`
-	p20Lag, err := execWeightedQuery(query, intervalMins)
+	p20Lag, err := p.execWeightedQuery(query, intervalMins)
 	if err != nil {
 		return 0, err
 	}
@@ -105,9 +110,9 @@ func getP20Lag(intervalMins int) (float64, error) {
 	return p20Lag, nil
 }
 
-func get404Rate(intervalMins int) (float64, error) {
+func (p *prometheusSignals) get404Rate(intervalMins int) (float64, error) {
 	query := fmt.Sprintf(`sum(rate(pgcr_crawl_summary_status_count{status="3"}[%dm])) * %d * 60`, intervalMins, intervalMins)
-	res, err := prometheusClient.QueryRange(query, intervalMins)
+	res, err := p.client.QueryRange(query, intervalMins)
 	if err != nil {
 		return 0, err
 	}
@@ -117,9 +122,9 @@ func get404Rate(intervalMins int) (float64, error) {
 	return strconv.ParseFloat(res.Data.Result[0].Values[0][1].(string), 64)
 }
 
-func getPgcrsPerSecond(intervalMins int) (float64, error) {
+func (p *prometheusSignals) getPgcrsPerSecond(intervalMins int) (float64, error) {
 	query := fmt.Sprintf(`sum(rate(pgcr_crawl_summary_status_count{status=~"1|2"}[%dm]))`, intervalMins)
-	f, err := execWeightedQuery(query, intervalMins)
+	f, err := p.execWeightedQuery(query, intervalMins)
 	if err != nil || f == -1 {
 		return 0, err
 	}
@@ -127,8 +132,8 @@ func getPgcrsPerSecond(intervalMins int) (float64, error) {
 }
 
 // execWeightedQuery executes a Prometheus query and calculates a weighted average
-func execWeightedQuery(query string, intervalMins int) (float64, error) {
-	res, err := prometheusClient.QueryRange(query, intervalMins)
+func (p *prometheusSignals) execWeightedQuery(query string, intervalMins int) (float64, error) {
+	res, err := p.client.QueryRange(query, intervalMins)
 	if err != nil {
 		return 0, err
 	}
@@ -2,74 +2,119 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"math/rand"
+	"strconv"
+	"sync/atomic"
 	"time"
 
+	rdb "raidhub/lib/database/redis"
 	"raidhub/lib/messaging/messages"
 	"raidhub/lib/messaging/publishing"
 	"raidhub/lib/messaging/routing"
-	"raidhub/lib/services/pgcr_processing"
+	"raidhub/lib/monitoring/atlas_metrics"
+	"raidhub/lib/services/missed_pgcr"
 	"raidhub/lib/utils/logging"
-	"raidhub/lib/utils/sentry"
+
+	"github.com/redis/go-redis/v9"
 )
 
-var offloadLogger = logging.NewLogger("atlas::offloadWorker")
+const offloadBacklogInterval = 15 * time.Second
 
-func offloadWorker(consumerConfig *ConsumerConfig) {
-	for id := range consumerConfig.OffloadChannel {
-		// Spawn a worker for each instanceId
-		instanceId := id // Capture for closure
-		sentry.Go(func() {
-			time.Sleep(15 * time.Second)
-			malformedRetryCount := 0
-			startTime := time.Now()
-			for i := 1; i <= 6; i++ {
-				result, instance, pgcr := pgcr_processing.FetchAndProcessPGCR(context.Background(), instanceId, malformedRetryCount)
+var (
+	offloadLogger = logging.NewLogger("atlas::offloadWorker")
+	// offloadBacklogDepth is the last observed offload backlog, reported by the control API
+	offloadBacklogDepth atomic.Int64
+)
 
-				if result == pgcr_processing.NonRaid {
-					return
-				} else if result == pgcr_processing.Success {
-					// Publish to queue for async storage
-					storeMessage := messages.NewPGCRStoreMessage(instance, pgcr)
-					err := publishing.PublishJSONMessage(context.Background(), routing.InstanceStore, storeMessage)
-					if err != nil {
-						offloadLogger.Warn("FAILED_TO_PUBLISH_PGCR_STORE_MESSAGE", err, map[string]any{
-							logging.INSTANCE_ID: instanceId,
-							logging.ATTEMPT:     i,
-						})
-					} else {
-						offloadLogger.Debug("PGCR_QUEUED_FOR_STORAGE", map[string]any{
-							logging.INSTANCE_ID: instanceId,
-							logging.ATTEMPT:     i,
-							"duration":          fmt.Sprintf("%dms", time.Since(startTime).Milliseconds()),
-						})
-						return
-					}
-				} else if result == pgcr_processing.SystemDisabled {
-					i--
-					time.Sleep(60 * time.Second)
-					continue
-				} else if result == pgcr_processing.InsufficientPrivileges {
-					publishing.PublishInt64Message(context.Background(), routing.PGCRRetry, instanceId)
-					return
-				} else if result == pgcr_processing.BadFormat {
-					malformedRetryCount++
-					continue
-				} else if result == pgcr_processing.ExternalError {
-					i--
-					continue
-				}
+// offloadWorker hands malformed or slowly resolving PGCRs over to the pgcr_offload topic in Hermes,
+// which retries them through the delayed exchange so a restart or a burst of bad PGCRs costs nothing here
+func offloadWorker(consumerConfig *ConsumerConfig) {
+	for instanceId := range consumerConfig.OffloadChannel {
+		offloadInstance(consumerConfig, instanceId)
+	}
+}
 
-				if i == 3 {
-					go logMissedInstanceWarning(instanceId, startTime)
-				}
+func offloadInstance(consumerConfig *ConsumerConfig, instanceId int64) {
+	ctx := context.Background()
+	offloadedAt := time.Now()
 
-				// Exponential Backoff
-				time.Sleep(time.Duration(i*(2*i+rand.Intn(5*(i)))) * time.Second)
-			}
+	// Mark as pending before publishing so the backlog never undercounts
+	if err := rdb.Client.ZAdd(ctx, messages.PGCROffloadPendingKey, redis.Z{
+		Score:  float64(offloadedAt.Unix()),
+		Member: instanceId,
+	}).Err(); err != nil {
+		offloadLogger.Warn("FAILED_TO_TRACK_OFFLOAD_BACKLOG", err, map[string]any{
+			logging.INSTANCE_ID: instanceId,
+		})
+	}
 
-			logMissedInstance(instanceId, startTime)
+	message := messages.NewPGCROffloadMessage(instanceId, offloadedAt)
+	err := publishing.PublishDelayedJSONMessage(ctx, routing.PGCROffload, message, messages.PGCROffloadInitialDelay)
+	if err != nil {
+		offloadLogger.Error("FAILED_TO_PUBLISH_OFFLOAD_MESSAGE", err, map[string]any{
+			logging.INSTANCE_ID: instanceId,
+			logging.ACTION:      "logging_missed_instance",
 		})
+		rdb.Client.ZRem(ctx, messages.PGCROffloadPendingKey, instanceId)
+		missed_pgcr.Log(ctx, instanceId, missed_pgcr.ReasonExternalError, missed_pgcr.SourceAtlas)
+		logMissedInstance(instanceId, offloadedAt)
+		consumerConfig.Tracker.ResolveOffload(instanceId)
+		return
+	}
+	consumerConfig.Tracker.HandOverOffload(instanceId)
+
+	offloadLogger.Debug("PGCR_OFFLOADED", map[string]any{
+		logging.INSTANCE_ID: instanceId,
+		logging.QUEUE:       routing.PGCROffload,
+	})
+}
+
+// offloadBacklogWorker periodically reports the offload backlog depth
+func offloadBacklogWorker(consumerConfig *ConsumerConfig) {
+	ticker := time.NewTicker(offloadBacklogInterval)
+	defer ticker.Stop()
+	for {
+		reportOffloadBacklog(consumerConfig)
+		<-ticker.C
+	}
+}
+
+// reportOffloadBacklog counts offloaded instances that are still unresolved:
+// those waiting in pgcr_offload plus those not handed over yet
+func reportOffloadBacklog(consumerConfig *ConsumerConfig) {
+	resolveHandedOverOffloads(consumerConfig)
+
+	pending, err := rdb.Client.ZCard(context.Background(), messages.PGCROffloadPendingKey).Result()
+	if err != nil {
+		offloadLogger.Warn("FAILED_TO_READ_OFFLOAD_BACKLOG", err, nil)
+		return
+	}
+	depth := pending + int64(consumerConfig.Tracker.OffloadBacklog())
+	offloadBacklogDepth.Store(depth)
+	atlas_metrics.OffloadBacklog.Set(float64(depth))
+}
+
+// resolveHandedOverOffloads drops the offloads pgcr_offload has finished with from the tracker, so they
+// leave the checkpoint. pgcr_offload removes an instance from the pending set once it is stored, skipped,
+// or given up on.
+func resolveHandedOverOffloads(consumerConfig *ConsumerConfig) {
+	ids := consumerConfig.Tracker.HandedOverOffloads()
+	if len(ids) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	pipe := rdb.Client.Pipeline()
+	scores := make([]*redis.FloatCmd, len(ids))
+	for i, id := range ids {
+		scores[i] = pipe.ZScore(ctx, messages.PGCROffloadPendingKey, strconv.FormatInt(id, 10))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		offloadLogger.Warn("FAILED_TO_READ_OFFLOAD_BACKLOG", err, nil)
+		return
+	}
+	for i, id := range ids {
+		if scores[i].Err() == redis.Nil {
+			consumerConfig.Tracker.ResolveOffload(id)
+		}
 	}
 }
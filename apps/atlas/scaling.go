@@ -1,101 +1,191 @@
 package main
 
 import (
+	"context"
 	"math"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"raidhub/lib/monitoring/atlas_metrics"
+	"raidhub/lib/services/contest_profile"
+	"raidhub/lib/utils/logging"
 	"raidhub/lib/utils/sentry"
+	"raidhub/lib/web/bungie"
 )
 
-var workers = 0
+// control holds the settings that can be changed at runtime through the control API
+var control *crawlControl
 
-func run(latestId int64, devSkip int, maxWorkersValue int) {
+// run crawls until ctx is cancelled, then writes a final checkpoint (or hands back its leases) and returns
+func run(ctx context.Context, config AtlasConfig, latestId int64, pendingOffloadIds []int64, leases *leaseManager) {
 	consumerConfig := ConsumerConfig{
 		LatestId:       latestId,
 		OffloadChannel: make(chan int64),
-		Skip:           devSkip,
+		Skip:           config.DevSkip,
+		Tracker:        newCrawlTracker(),
+		Leases:         leases,
+		Deps:           &liveCrawlDeps,
+	}
+	if leases != nil {
+		leases.tracker = consumerConfig.Tracker
+		// 404 rates are only meaningful across the whole cluster
+		scalingSignals = newClusterSignals(scalingSignals)
 	}
 
 	sendStartUpAlert()
 
+	minBound, maxBound := profileBounds(config, contest_profile.Active())
+	control = newCrawlControl(config.Workers, minBound, maxBound, 10_000)
+	registerControlAPI(&consumerConfig)
+
+	// The contest profile brings its own worker bounds, replacing any set through the control API
+	contest_profile.OnSwitch(func(s contest_profile.Switch) {
+		minBound, maxBound := profileBounds(config, s.Active)
+		if err := control.SetBounds(minBound, maxBound); err != nil {
+			AtlasLogger.Warn("PROFILE_BOUNDS_INVALID", err, nil)
+			return
+		}
+		AtlasLogger.Info("WORKER_BOUNDS_SWITCHED", map[string]any{
+			"contest":      s.Active,
+			logging.SOURCE: s.Source,
+			"min_workers":  minBound,
+			"max_workers":  maxBound,
+		})
+	})
+
 	// Initialize worker metric with initial worker count
-	if workers < minWorkers {
-		workers = minWorkers
-	}
-	atlas_metrics.ActiveWorkers.Set(float64(workers))
+	atlas_metrics.ActiveWorkers.Set(float64(control.Workers()))
 
 	// Start a goroutine to offload malformed or slowly resolving PGCRs
 	sentry.Go(func() { offloadWorker(&consumerConfig) })
+	sentry.Go(func() { offloadBacklogWorker(&consumerConfig) })
+
+	// Re-queue anything the previous process had offloaded but not resolved
+	if len(pendingOffloadIds) > 0 {
+		sentry.Go(func() {
+			for _, id := range pendingOffloadIds {
+				consumerConfig.Tracker.Offload(id)
+				consumerConfig.OffloadChannel <- id
+			}
+		})
+	}
+
+	if leases != nil {
+		// keep leased blocks alive, and record progress so a crashed instance's blocks resume where it left off
+		sentry.Go(func() { leaseRenewWorker(leases) })
+		sentry.Go(clusterSignalsWorker)
+	} else {
+		// persist the crawl position so a restart resumes exactly where we left off
+		sentry.Go(func() { checkpointWorker(&consumerConfig) })
+	}
 
 	// check for gaps
-	sentry.Go(func() { gapCheckWorker(&consumerConfig) })
+	sentry.Go(func() { gapCheckWorker(ctx, &consumerConfig) })
+
+	// sweep the gaps we skipped over
+	if config.BackfillRate > 0 {
+		sentry.Go(func() { gapBackfillWorker(ctx, config.BackfillRate, config.BackfillWorkers) })
+	}
+
+	crawl(ctx, &consumerConfig)
+
+	shutdown(&consumerConfig)
+}
 
-	periodLength := 10_000
-	for {
+// crawl runs scaling periods until ctx is cancelled
+func crawl(ctx context.Context, consumerConfig *ConsumerConfig) {
+	// The crawl at the head is what Zeus schedules ahead of everything else
+	ctx = bungie.WithPriority(ctx, bungie.PriorityCritical)
+	for ctx.Err() == nil {
 		startTime := time.Now()
 
-		// Ensure workers is at least minWorkers to avoid zero workers on first iteration
-		if workers < minWorkers {
-			workers = minWorkers
-		}
+		// Bounds may have changed through the control API since the last period
+		workers, periodLength := control.NextPeriod()
+		minBound, maxBound := control.Bounds()
 
 		// Set metric before spawning workers so it shows the active count while workers are running
 		atlas_metrics.ActiveWorkers.Set(float64(workers))
 
-		spawnWorkers(workers, periodLength, &consumerConfig)
+		spawnWorkers(ctx, workers, periodLength, consumerConfig)
+		if ctx.Err() != nil {
+			break
+		}
 
-		metrics, err := GetMetricsForScaling(time.Since(startTime))
+		metrics, err := scalingSignals.GetMetricsForScaling(time.Since(startTime))
 		if err != nil {
 			AtlasLogger.Error("FAILED_TO_GET_METRICS", err, nil)
+			control.RecordDecision(scalingDecision{
+				Strategy:     "metrics_unavailable",
+				Workers:      workers,
+				PeriodLength: periodLength,
+			})
 			// Continue with previous worker count and period length on metrics failure
 			continue
 		}
 
 		logIntervalState(metrics.P20Lag, workers, 100*metrics.Fraction404, 100*metrics.ErrorFraction)
 
-		var newPeriodLength int
-		newWorkers := 0
-		if metrics.Fraction404 > 0.50 {
-			// If we are getting a lot of 404s, let's do a quick probe set
-			newPeriodLength = 2500
-			newWorkers = 25
-		} else if metrics.Fraction404 < 0.001 || metrics.P20Lag >= 600 {
-			// Ensure we have at least minWorkers to avoid zero workers edge case
-			effectiveWorkers := max(workers, minWorkers)
-			// Clamp P20Lag to at least 20 to avoid negative scaling when close to live
-			effectiveLag := math.Max(metrics.P20Lag, 20.0)
-			// how much we expect to get catch up
-			newPeriodLength = max(int(math.Round(math.Pow(float64(effectiveWorkers)*(math.Ceil(effectiveLag)-20.0), 0.824))), 10_000)
-			// If we aren't getting 404's, just spike the workers up to ensure we catch up to live ASAP
-			// Use consistent ceil operation for both period and worker calculations
-			newWorkers = int(math.Ceil(float64(workers) * (1 + float64(effectiveLag-20)/100)))
+		control.RecordDecision(decideScaling(metrics, workers, minBound, maxBound))
+	}
+}
+
+// profileBounds returns the worker bounds of the contest or the normal profile
+func profileBounds(config AtlasConfig, contest bool) (int, int) {
+	if contest {
+		return config.ContestMin, config.ContestMax
+	}
+	return minWorkers, config.MaxWorkers
+}
+
+// decideScaling picks the worker count and period length for the next period from the metrics of the one
+// that just finished. It has no side effects so it can be driven by the simulation harness.
+func decideScaling(metrics *AtlasMetrics, workers, minBound, maxBound int) scalingDecision {
+	var newPeriodLength int
+	var strategy string
+	newWorkers := 0
+	if metrics.Fraction404 > 0.50 {
+		strategy = "gap_probe"
+		// If we are getting a lot of 404s, let's do a quick probe set
+		newPeriodLength = 2500
+		newWorkers = 25
+	} else if metrics.Fraction404 < 0.001 || metrics.P20Lag >= 600 {
+		strategy = "catch_up"
+		// Ensure we have at least minWorkers to avoid zero workers edge case
+		effectiveWorkers := max(workers, minBound)
+		// Clamp P20Lag to at least 20 to avoid negative scaling when close to live
+		effectiveLag := math.Max(metrics.P20Lag, 20.0)
+		// how much we expect to get catch up
+		newPeriodLength = max(int(math.Round(math.Pow(float64(effectiveWorkers)*(math.Ceil(effectiveLag)-20.0), 0.824))), 10_000)
+		// If we aren't getting 404's, just spike the workers up to ensure we catch up to live ASAP
+		// Use consistent ceil operation for both period and worker calculations
+		newWorkers = int(math.Ceil(float64(workers) * (1 + float64(effectiveLag-20)/100)))
+	} else {
+		strategy = "fine_tune"
+		adjf := metrics.Fraction404 - 0.025 // do not let workers go below 2.5 %
+		decreaseFraction := min(math.Pow(retryDelayTime/8*math.Abs(adjf), 0.88)/100, 0.65)
+		sign := adjf / math.Abs(adjf)
+		// Adjust number of workers for the next period
+		newWorkers = int(math.Round(float64(workers) - sign*decreaseFraction*float64(workers)))
+
+		// Calculate the new period length based on the number of PGCRs per second
+		if metrics.PGCRRate == 0 {
+			newPeriodLength = 600 * newWorkers
+		} else if metrics.Fraction404 >= 0.075 {
+			newPeriodLength = int(math.Round(100 * metrics.PGCRRate))
 		} else {
-			adjf := metrics.Fraction404 - 0.025 // do not let workers go below 2.5 %
-			decreaseFraction := min(math.Pow(retryDelayTime/8*math.Abs(adjf), 0.88)/100, 0.65)
-			sign := adjf / math.Abs(adjf)
-			// Adjust number of workers for the next period
-			newWorkers = int(math.Round(float64(workers) - sign*decreaseFraction*float64(workers)))
-
-			// Calculate the new period length based on the number of PGCRs per second
-			if metrics.PGCRRate == 0 {
-				newPeriodLength = 600 * newWorkers
-			} else if metrics.Fraction404 >= 0.075 {
-				newPeriodLength = int(math.Round(100 * metrics.PGCRRate))
-			} else {
-				newPeriodLength = int(math.Round(300 * metrics.PGCRRate))
-			}
+			newPeriodLength = int(math.Round(300 * metrics.PGCRRate))
 		}
+	}
 
-		// Use the max workers value passed to run function
-		workers = min(max(newWorkers, minWorkers), maxWorkersValue)
-		periodLength = newPeriodLength
+	return scalingDecision{
+		Strategy:     strategy,
+		Workers:      min(max(newWorkers, minBound), maxBound),
+		PeriodLength: newPeriodLength,
+		Metrics:      metrics,
 	}
 }
 
-func spawnWorkers(countWorkers int, periodLength int, consumerConfig *ConsumerConfig) {
+func spawnWorkers(ctx context.Context, countWorkers int, periodLength int, consumerConfig *ConsumerConfig) {
 	var wg sync.WaitGroup
 	// unbuffered channel ensures ids don't sit in the buffer and are immediately passed to workers
 	ids := make(chan int64)
@@ -104,16 +194,26 @@ func spawnWorkers(countWorkers int, periodLength int, consumerConfig *ConsumerCo
 
 	wg.Add(countWorkers)
 	for i := 0; i < countWorkers; i++ {
-		worker := NewAtlasWorker(i, consumerConfig.OffloadChannel)
-		sentry.Go(func() { worker.Run(&wg, ids) })
+		worker := NewAtlasWorker(i, consumerConfig)
+		sentry.Go(func() { worker.Run(ctx, &wg, ids) })
 	}
 
 	// Pass IDs to workers
 	for i := 0; i < periodLength; i++ {
-		latest := atomic.AddInt64(&consumerConfig.LatestId, int64(consumerConfig.Skip)+1)
-		ids <- latest
+		if control.WaitWhilePaused(ctx) != nil {
+			break
+		}
+		select {
+		case ids <- consumerConfig.nextId():
+		case <-ctx.Done():
+		}
 	}
 	close(ids)
 
+	if ctx.Err() != nil {
+		// Don't wait out the workers' retries. Their ids are still in flight, so the final
+		// checkpoint resumes from them.
+		return
+	}
 	wg.Wait()
 }
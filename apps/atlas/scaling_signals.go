@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"raidhub/lib/monitoring/atlas_metrics"
+	"raidhub/lib/services/pgcr_processing"
+)
+
+const (
+	ScalingSignalsPrometheus = "prometheus"
+	ScalingSignalsInProcess  = "in-process"
+)
+
+// ScalingSignals provides the inputs for scaling and gap detection decisions
+type ScalingSignals interface {
+	// GetMetricsForScaling returns metrics for the period that just finished
+	GetMetricsForScaling(elapsedTime time.Duration) (*AtlasMetrics, error)
+	// GetMetrics returns metrics over the trailing interval
+	GetMetrics(intervalMinutes int) (*AtlasMetrics, error)
+}
+
+var (
+	// localSignalsRecorder is always fed by the workers, regardless of which source drives scaling
+	localSignalsRecorder = newLocalSignals(time.Now)
+	scalingSignals       ScalingSignals
+)
+
+// selectScalingSignals picks the signal source that drives run() and the gap checker
+func selectScalingSignals(source string) (ScalingSignals, error) {
+	switch source {
+	case ScalingSignalsPrometheus:
+		return &prometheusSignals{client: prometheusClient}, nil
+	case ScalingSignalsInProcess:
+		return localSignalsRecorder, nil
+	default:
+		return nil, fmt.Errorf("unknown scaling signal source %q", source)
+	}
+}
+
+// observeCrawlStatus records a PGCR fetch result for Prometheus, the in-process signals, and the cluster-wide 404 rate
+func observeCrawlStatus(result pgcr_processing.PGCRResult, attempt int) {
+	atlas_metrics.PGCRCrawlStatus.WithLabelValues(fmt.Sprintf("%d", result), fmt.Sprintf("%d", attempt)).Inc()
+	localSignalsRecorder.RecordStatus(result)
+	recordClusterStatus(result)
+}
+
+// observeCrawlLag records how far behind head a PGCR was for both Prometheus and the in-process signals
+func observeCrawlLag(result pgcr_processing.PGCRResult, attempt int, lagSeconds float64) {
+	atlas_metrics.PGCRCrawlLag.WithLabelValues(fmt.Sprintf("%d", result), fmt.Sprintf("%d", attempt)).Observe(lagSeconds)
+	localSignalsRecorder.RecordLag(lagSeconds)
+}
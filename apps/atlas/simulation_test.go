@@ -0,0 +1,518 @@
+//go:build sim
+
+// The simulation harness runs Atlas's real crawl loop, workers, and gap checker against the fake Bungie
+// stream inside a synctest bubble, so hours of crawling run on a virtual clock in seconds. Only the
+// edges are swapped out through crawlDeps: fetches are answered from the stream without the HTTP round
+// trip, and publishes are recorded instead of sent. TestSimulationFetchMatchesBungieClient checks the
+// shortcut against the real client talking to fakebungie.Server. Like every Atlas binary it needs the
+// environment loaded:
+//
+//	ENV_PATH=$(pwd)/.env go test -tags sim ./apps/atlas/
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"raidhub/lib/dto"
+	"raidhub/lib/services/gap_registry"
+	"raidhub/lib/services/pgcr_processing"
+	"raidhub/lib/web/bungie"
+	"raidhub/lib/web/bungie/fakebungie"
+	"raidhub/lib/web/discord"
+)
+
+// simRequestLatency is how long one PGCR request keeps a worker busy
+const simRequestLatency = 300 * time.Millisecond
+
+// simResults maps the fake's error outcomes onto what FetchPGCR returns for them. Every other
+// outcome carries a report.
+var simResults = map[fakebungie.Outcome]pgcr_processing.PGCRResult{
+	fakebungie.OutcomeNotFound:       pgcr_processing.NotFound,
+	fakebungie.OutcomeThrottled:      pgcr_processing.RateLimited,
+	fakebungie.OutcomeSystemDisabled: pgcr_processing.SystemDisabled,
+	fakebungie.OutcomeBlocked:        pgcr_processing.InsufficientPrivileges,
+}
+
+// simResolution is one id a worker finished with
+type simResolution struct {
+	id  int64
+	at  time.Time
+	lag time.Duration
+}
+
+// simPeriod is one pass of the scaling loop
+type simPeriod struct {
+	start    time.Time
+	workers  int
+	decision scalingDecision
+}
+
+// simSignals counts the gap checker's supercharges as it reads the in-process signals
+type simSignals struct {
+	*localSignals
+	superchargers *atomic.Int64
+}
+
+func (s simSignals) GetMetrics(intervalMinutes int) (*AtlasMetrics, error) {
+	metrics, err := s.localSignals.GetMetrics(intervalMinutes)
+	if err == nil && suspectsGap(metrics) {
+		s.superchargers.Add(1)
+	}
+	return metrics, err
+}
+
+// simulation records what the real loops did with every id. It must be created inside a synctest bubble.
+type simulation struct {
+	t              *testing.T
+	start          time.Time
+	stream         *fakebungie.Stream
+	consumerConfig *ConsumerConfig
+	startId        int64
+	superchargers  atomic.Int64
+
+	mu           sync.Mutex
+	resolutions  []simResolution
+	resolved     map[int64]bool
+	blocked      map[int64]bool
+	offloaded    map[int64]bool
+	skipped      []fakebungie.IdRange
+	periods      []simPeriod
+	failedSearch int
+}
+
+func newSimulation(t *testing.T, scenario fakebungie.Scenario, behind int64, workers int) *simulation {
+	t.Helper()
+	scenario.Start = time.Now()
+	stream, err := fakebungie.NewStream(scenario, fakebungie.SystemClock)
+	if err != nil {
+		t.Fatalf("invalid scenario: %v", err)
+	}
+	s := &simulation{
+		t:         t,
+		start:     scenario.Start,
+		stream:    stream,
+		startId:   scenario.HeadId - behind,
+		resolved:  make(map[int64]bool),
+		blocked:   make(map[int64]bool),
+		offloaded: make(map[int64]bool),
+	}
+	s.consumerConfig = &ConsumerConfig{
+		LatestId:       s.startId,
+		OffloadChannel: make(chan int64),
+		Tracker:        newCrawlTracker(),
+		Deps: &crawlDeps{
+			fetch:         s.fetch,
+			waitForBungie: func() {},
+			store: func(ctx context.Context, instance *dto.Instance, pgcr *bungie.DestinyPostGameCarnageReport) error {
+				return nil
+			},
+			sendToRetry:   s.sendToRetry,
+			resolveMissed: func(ctx context.Context, instanceId int64) error { return nil },
+			recordGap:     s.recordGap,
+			latestInstance: func() (int64, time.Time, error) {
+				s.mu.Lock()
+				s.failedSearch++
+				s.mu.Unlock()
+				head := s.stream.Head()
+				return head, s.stream.CompletedAt(head), nil
+			},
+			probe: s.probe(),
+		},
+	}
+
+	// The loops read these globals, and the bubble's clock has to drive them
+	localSignalsRecorder = newLocalSignals(time.Now)
+	scalingSignals = simSignals{localSignals: localSignalsRecorder, superchargers: &s.superchargers}
+	atlasAlerting = discord.NewDiscordAlerting("", AtlasLogger)
+	control = newCrawlControl(workers, minWorkers, maxWorkers, 10_000)
+
+	periodStart := s.start
+	control.OnDecision(func(d scalingDecision) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		periodWorkers := workers
+		if n := len(s.periods); n > 0 {
+			periodWorkers = s.periods[n-1].decision.Workers
+		}
+		s.periods = append(s.periods, simPeriod{start: periodStart, workers: periodWorkers, decision: d})
+		periodStart = d.Time
+	})
+	return s
+}
+
+// fetchPGCR answers a request from the stream after the request latency
+func (s *simulation) fetchPGCR(id int64, malformedRetry int) (pgcr_processing.PGCRResult, *bungie.DestinyPostGameCarnageReport) {
+	time.Sleep(simRequestLatency)
+	outcome := s.stream.Outcome(id, malformedRetry)
+	if result, ok := simResults[outcome]; ok {
+		return result, nil
+	}
+	return pgcr_processing.Success, s.stream.Report(id, outcome)
+}
+
+// fetch stands in for FetchAndProcessPGCR, processing the fake's report with the real ProcessPGCR
+func (s *simulation) fetch(ctx context.Context, id int64, malformedRetry int) (pgcr_processing.PGCRResult, *dto.Instance, *bungie.DestinyPostGameCarnageReport) {
+	result, report := s.fetchPGCR(id, malformedRetry)
+	if result != pgcr_processing.Success {
+		return result, nil, nil
+	}
+	result, instance, pgcr := pgcr_processing.ProcessPGCR(id, report)
+	if result == pgcr_processing.Success || result == pgcr_processing.NonRaid {
+		now := time.Now()
+		s.mu.Lock()
+		s.resolutions = append(s.resolutions, simResolution{id: id, at: now, lag: now.Sub(s.stream.CompletedAt(id))})
+		s.resolved[id] = true
+		s.mu.Unlock()
+	}
+	return result, instance, pgcr
+}
+
+func (s *simulation) sendToRetry(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	s.blocked[id] = true
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *simulation) recordGap(ctx context.Context, startId, endId int64, method gap_registry.Method) (*gap_registry.Gap, error) {
+	s.mu.Lock()
+	s.skipped = append(s.skipped, fakebungie.IdRange{From: startId, To: endId})
+	s.mu.Unlock()
+	return &gap_registry.Gap{StartId: startId, EndId: endId, Method: method}, nil
+}
+
+// probe is a blockProbe against the fake that spends virtual time on every request
+func (s *simulation) probe() blockProbe {
+	return blockProbe{
+		fetch: func(instanceId int64) pgcr_processing.PGCRResult {
+			result, _ := s.fetchPGCR(instanceId, 0)
+			return result
+		},
+		sleep: time.Sleep,
+	}
+}
+
+// run drives crawl and gapCheckWorker for d, then stops them the way a shutdown signal does
+func (s *simulation) run(d time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Go(func() { crawl(ctx, s.consumerConfig) })
+	wg.Go(func() { gapCheckWorker(ctx, s.consumerConfig) })
+	// Stands in for offloadWorker, which hands the id to pgcr_offload
+	wg.Go(func() {
+		for {
+			select {
+			case id := <-s.consumerConfig.OffloadChannel:
+				s.mu.Lock()
+				s.offloaded[id] = true
+				s.mu.Unlock()
+				s.consumerConfig.Tracker.ResolveOffload(id)
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+	wg.Wait()
+
+	// Let workers finish the request they were making when the crawl stopped
+	time.Sleep(simRequestLatency)
+	synctest.Wait()
+}
+
+// lowWaterMark is the smallest id not yet accounted for
+func (s *simulation) lowWaterMark() int64 {
+	return s.consumerConfig.Tracker.Snapshot(&s.consumerConfig.LatestId).LowWaterMark
+}
+
+func (s *simulation) wasSkipped(id int64) bool {
+	for _, r := range s.skipped {
+		if r.Contains(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// unaccounted lists ids below the low-water mark that were neither resolved, handed to the retry
+// queue, offloaded (or still waiting to be), nor skipped past by the gap checker. It should always be empty.
+func (s *simulation) unaccounted() []int64 {
+	pending := s.consumerConfig.Tracker.Snapshot(&s.consumerConfig.LatestId).PendingOffloadIds
+	var ids []int64
+	for id := s.startId + 1; id < s.lowWaterMark(); id++ {
+		if !s.resolved[id] && !s.blocked[id] && !s.offloaded[id] && !s.wasSkipped(id) && !slices.Contains(pending, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// missed lists real instances Atlas gave up on, which would land on the offload topic or the
+// missed PGCR ledger
+func (s *simulation) missed() []int64 {
+	var ids []int64
+	for id := range s.offloaded {
+		if !s.stream.InGap(id) {
+			ids = append(ids, id)
+		}
+	}
+	for _, r := range s.skipped {
+		for id := r.From; id < r.To; id++ {
+			if !s.stream.InGap(id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// lagQuantile returns the q quantile of lag over ids resolved in the trailing window
+func (s *simulation) lagQuantile(q float64, window time.Duration) time.Duration {
+	since := time.Now().Add(-window)
+	var lags []time.Duration
+	for _, r := range s.resolutions {
+		if r.at.After(since) {
+			lags = append(lags, r.lag)
+		}
+	}
+	if len(lags) == 0 {
+		s.t.Fatalf("no ids resolved in the last %s", window)
+	}
+	slices.Sort(lags)
+	return lags[int(q*float64(len(lags)-1))]
+}
+
+// workerRange returns the smallest and largest worker count of scaling periods started in [from, to)
+func (s *simulation) workerRange(from, to time.Duration) (int, int) {
+	lo, hi := -1, -1
+	for _, p := range s.periods {
+		offset := p.start.Sub(s.start)
+		if offset < from || offset >= to {
+			continue
+		}
+		if lo == -1 || p.workers < lo {
+			lo = p.workers
+		}
+		hi = max(hi, p.workers)
+	}
+	return lo, hi
+}
+
+// baseScenario is a quiet day: 40 new ids a second, one in 25 a raid, some throttling,
+// and the occasional malformed PGCR that heals after two cache busts
+func baseScenario() fakebungie.Scenario {
+	return fakebungie.Scenario{
+		HeadId:                  16_000_000_000,
+		HeadRate:                40,
+		RaidEvery:               25,
+		MissingExtendedEvery:    997,
+		EntryCountMismatchEvery: 1499,
+		MalformedHealsAfter:     2,
+		ThrottleFraction:        0.005,
+		Seed:                    1,
+	}
+}
+
+func assertNothingUnaccounted(t *testing.T, s *simulation) {
+	t.Helper()
+	if ids := s.unaccounted(); len(ids) > 0 {
+		t.Fatalf("%d ids below the low-water mark were never accounted for, first %d", len(ids), ids[0])
+	}
+}
+
+func assertWorkersWithinBounds(t *testing.T, s *simulation) {
+	t.Helper()
+	for _, p := range s.periods {
+		if p.workers < minWorkers || p.workers > maxWorkers {
+			t.Fatalf("period at %s ran %d workers, outside [%d, %d]", p.start.Sub(s.start), p.workers, minWorkers, maxWorkers)
+		}
+	}
+}
+
+func TestSimulationCatchesUpToHead(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		// Start 100,000 ids (about 40 minutes) behind the head with the default worker count
+		s := newSimulation(t, baseScenario(), 100_000, 10)
+		s.run(3 * time.Hour)
+
+		assertWorkersWithinBounds(t, s)
+		assertNothingUnaccounted(t, s)
+
+		if _, hi := s.workerRange(0, 30*time.Minute); hi <= 10 {
+			t.Errorf("expected catch_up to add workers in the first 30 minutes, peaked at %d", hi)
+		}
+		if p50 := s.lagQuantile(0.5, 30*time.Minute); p50 > 2*time.Minute {
+			t.Errorf("median lag over the last 30 minutes is %s, expected Atlas to have caught up", p50)
+		}
+		if missed := s.missed(); len(missed) > len(s.resolutions)/100 {
+			t.Errorf("gave up on %d real instances out of %d resolved", len(missed), len(s.resolutions))
+		}
+		if n := s.superchargers.Load(); n > 0 {
+			t.Errorf("gap supercharge fired %d times without a gap", n)
+		}
+	})
+}
+
+func TestSimulationRidesOutSystemDisabled(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		scenario := baseScenario()
+		scenario.SystemDisabled = []fakebungie.Window{{From: time.Hour, To: time.Hour + 20*time.Minute}}
+		s := newSimulation(t, scenario, 10_000, 10)
+		s.run(3 * time.Hour)
+
+		assertWorkersWithinBounds(t, s)
+		assertNothingUnaccounted(t, s)
+
+		// SystemDisabled never counts as an attempt, so nothing should be given up on because of it
+		for _, id := range s.missed() {
+			if s.stream.CompletedAt(id).Before(s.start.Add(time.Hour)) {
+				t.Fatalf("instance %d completed before the outage but was given up on", id)
+			}
+		}
+		if p50 := s.lagQuantile(0.5, 30*time.Minute); p50 > 2*time.Minute {
+			t.Errorf("median lag over the last 30 minutes is %s, expected Atlas to recover from the outage", p50)
+		}
+	})
+}
+
+func TestSimulationSendsBlockedToRetryQueue(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		scenario := baseScenario()
+		blocked := fakebungie.IdRange{From: scenario.HeadId - 5_000, To: scenario.HeadId - 3_000}
+		scenario.Blocked = []fakebungie.IdRange{blocked}
+		s := newSimulation(t, scenario, 10_000, 10)
+		s.run(time.Hour)
+
+		assertNothingUnaccounted(t, s)
+		for id := blocked.From; id < blocked.To; id++ {
+			if !s.blocked[id] {
+				t.Fatalf("blocked instance %d was not handed to the retry queue", id)
+			}
+		}
+	})
+}
+
+func TestSimulationGivesUpOnPermanentlyMalformed(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		scenario := baseScenario()
+		scenario.MalformedHealsAfter = 0
+		// ProcessPGCR stops looking at extended data once it reaches an entry with a duration, which is
+		// the first entry of every fake report, so only entry count mismatches come back BadFormat
+		scenario.MissingExtendedEvery = 0
+		s := newSimulation(t, scenario, 10_000, 10)
+		s.run(time.Hour)
+
+		assertNothingUnaccounted(t, s)
+		malformed := func(id int64) bool {
+			return s.stream.IsRaid(id) && id%scenario.EntryCountMismatchEvery == 0
+		}
+		for _, r := range s.resolutions {
+			if malformed(r.id) {
+				t.Fatalf("malformed raid %d was resolved", r.id)
+			}
+		}
+		pending := s.consumerConfig.Tracker.Snapshot(&s.consumerConfig.LatestId).PendingOffloadIds
+		for id := s.startId + 1; id < s.lowWaterMark(); id++ {
+			if malformed(id) && !s.offloaded[id] && !slices.Contains(pending, id) {
+				t.Fatalf("malformed raid %d was not offloaded", id)
+			}
+		}
+	})
+}
+
+func TestSimulationSkipsGap(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		scenario := baseScenario()
+		// The head jumps 20,000 ids about 8 minutes in, while Atlas is crawling close to live
+		gap := fakebungie.IdRange{From: scenario.HeadId + 20_000, To: scenario.HeadId + 40_000}
+		scenario.Gaps = []fakebungie.IdRange{gap}
+		s := newSimulation(t, scenario, 5_000, 10)
+		s.run(2 * time.Hour)
+
+		assertWorkersWithinBounds(t, s)
+		assertNothingUnaccounted(t, s)
+		if s.superchargers.Load() == 0 {
+			t.Fatal("gap supercharge never fired")
+		}
+		if s.failedSearch > 0 {
+			t.Fatalf("%d gap searches failed", s.failedSearch)
+		}
+		if s.lowWaterMark() <= gap.To {
+			t.Fatalf("crawler never got past the gap, low-water mark %d", s.lowWaterMark())
+		}
+		if p50 := s.lagQuantile(0.5, 30*time.Minute); p50 > 2*time.Minute {
+			t.Errorf("median lag over the last 30 minutes is %s, expected Atlas to be back at the head", p50)
+		}
+		if missed := s.missed(); len(missed) > len(s.resolutions)/100 {
+			t.Errorf("gave up on %d real instances out of %d resolved", len(missed), len(s.resolutions))
+		}
+	})
+}
+
+func TestBinarySearchForBlockStart(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		scenario := baseScenario()
+		gap := fakebungie.IdRange{From: scenario.HeadId - 400_000, To: scenario.HeadId - 100_000}
+		scenario.Gaps = []fakebungie.IdRange{gap}
+		scenario.ThrottleFraction = 0.3
+		s := newSimulation(t, scenario, 0, minWorkers)
+
+		foundId, err := binarySearchForBlockStart(gap.From, gap.From+gapSearchSpan, s.probe())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if foundId != gap.To {
+			t.Errorf("found block start %d, expected %d", foundId, gap.To)
+		}
+	})
+}
+
+// TestSimulationFetchMatchesBungieClient checks the harness's fetch shortcut against the real
+// FetchAndProcessPGCR talking to fakebungie.Server through the Bungie client. SystemDisabled is left
+// out because the client reacts to it by polling Bungie's settings in the background.
+func TestSimulationFetchMatchesBungieClient(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		scenario := baseScenario()
+		scenario.RaidEvery = 2
+		scenario.MissingExtendedEvery = 3
+		scenario.EntryCountMismatchEvery = 5
+		scenario.Blocked = []fakebungie.IdRange{{From: scenario.HeadId - 20, To: scenario.HeadId - 10}}
+		scenario.ThrottleFraction = 0
+		s := newSimulation(t, scenario, 0, minWorkers)
+
+		client := bungie.NewClient(&http.Client{Transport: fakebungie.NewServer(s.stream)}, "bungie.fake", bungie.PriorityNormal)
+		prevClient, prevPGCRClient := bungie.Client, bungie.PGCRClient
+		bungie.Client, bungie.PGCRClient = client, client
+		t.Cleanup(func() { bungie.Client, bungie.PGCRClient = prevClient, prevPGCRClient })
+
+		seen := make(map[pgcr_processing.PGCRResult]bool)
+		// Ids past the head stay 404s however long the comparison takes
+		for id := scenario.HeadId - 40; id <= scenario.HeadId+10_000_000; id += max(1, id-scenario.HeadId) {
+			for malformedRetry := range 3 {
+				want, _, _ := s.fetch(t.Context(), id, malformedRetry)
+				got, instance, _ := pgcr_processing.FetchAndProcessPGCR(t.Context(), id, malformedRetry)
+				if got != want {
+					t.Fatalf("instance %d (malformed retry %d): harness says %d, Bungie client says %d", id, malformedRetry, want, got)
+				}
+				if got == pgcr_processing.Success && instance.InstanceId != id {
+					t.Fatalf("instance %d was parsed as %d", id, instance.InstanceId)
+				}
+				seen[got] = true
+			}
+		}
+		for _, result := range []pgcr_processing.PGCRResult{pgcr_processing.Success, pgcr_processing.NonRaid, pgcr_processing.NotFound, pgcr_processing.BadFormat, pgcr_processing.InsufficientPrivileges} {
+			if !seen[result] {
+				t.Errorf("no instance came back %d, the scenario no longer covers it", result)
+			}
+		}
+	})
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"sync/atomic"
+	"time"
+
 	"raidhub/lib/utils/logging"
 )
 
@@ -8,6 +11,89 @@ type ConsumerConfig struct {
 	LatestId       int64
 	OffloadChannel chan int64
 	Skip           int // Number of instances to skip between each processed instance (dev mode)
+	Tracker        *crawlTracker
+	Leases         *leaseManager // nil unless Atlas runs in cluster mode
+	Deps           *crawlDeps
+}
+
+// nextId hands out the next id to crawl, from a leased block in cluster mode
+func (c *ConsumerConfig) nextId() int64 {
+	step := int64(c.Skip) + 1
+	if c.Leases != nil {
+		return c.Leases.Next(&c.LatestId, step)
+	}
+	return c.Tracker.Advance(&c.LatestId, step)
+}
+
+// moveCursor sets the last handed out id and returns the previous one. In cluster mode the shared
+// cursor moves too, so the next block leased by any instance starts right after latestId. It is for
+// operators; the crawl itself only moves the cursor through skipTo and resetCursor.
+func (c *ConsumerConfig) moveCursor(latestId int64) int64 {
+	prev := atomic.SwapInt64(&c.LatestId, latestId)
+	if c.Leases != nil {
+		if err := c.Leases.MoveCursor(latestId + 1); err != nil {
+			leaseLogger.Warn("FAILED_TO_MOVE_CLUSTER_CURSOR", err, map[string]any{
+				logging.INSTANCE_ID: latestId + 1,
+			})
+		}
+	}
+	return prev
+}
+
+// frontier returns the last id handed out and the last id below which everything was handed out.
+// In cluster mode both come from the shared cursor and the leased blocks rather than this instance.
+func (c *ConsumerConfig) frontier() (latestId int64, lowWaterMark int64, err error) {
+	if c.Leases == nil {
+		latestId = atomic.LoadInt64(&c.LatestId)
+		return latestId, latestId, nil
+	}
+	cursor, mark, err := c.Leases.Frontier()
+	if err != nil {
+		return 0, 0, err
+	}
+	return cursor - 1, mark - 1, nil
+}
+
+// skipTo moves the cursor forward so nextId is the next id handed out, and returns the first id
+// skipped over. It never moves the cursor back, so nothing is skipped if the crawl already got there.
+func (c *ConsumerConfig) skipTo(nextId int64) (int64, error) {
+	if c.Leases != nil {
+		cursor, err := c.Leases.AdvanceCursor(nextId)
+		if err != nil {
+			return 0, err
+		}
+		return min(cursor, nextId), nil
+	}
+	for {
+		prev := atomic.LoadInt64(&c.LatestId)
+		if prev >= nextId-1 {
+			return nextId, nil
+		}
+		if atomic.CompareAndSwapInt64(&c.LatestId, prev, nextId-1) {
+			return prev + 1, nil
+		}
+	}
+}
+
+// resetCursor points the crawl back at latestId after it ran past the head, unless the cursor was
+// already moved back below seen, the last handed out id the caller decided on
+func (c *ConsumerConfig) resetCursor(seen, latestId int64) (bool, error) {
+	if c.Leases != nil {
+		moved, err := c.Leases.ResetCursor(seen+1, latestId+1)
+		if moved {
+			atomic.StoreInt64(&c.LatestId, latestId)
+		}
+		return moved, err
+	}
+	for {
+		prev := atomic.LoadInt64(&c.LatestId)
+		if prev < seen {
+			return false, nil
+		}
+		if atomic.CompareAndSwapInt64(&c.LatestId, prev, latestId) {
+			return true, nil
+		}
+	}
 }
 
 type WorkerResult struct {
@@ -22,6 +108,16 @@ type AtlasConfig struct {
 	DevMode          bool
 	DevSkip          int
 	MaxWorkers       int
+	Resume           bool
+	ResetCursor      bool
+	ScalingSignals   string
+	BackfillRate     float64
+	BackfillWorkers  int
+	Cluster          bool
+	LeaseBlockSize   int64
+	LeaseTTL         time.Duration
+	ContestMin       int // worker bounds while the contest profile is in effect
+	ContestMax       int
 }
 
 // AtlasWorker represents a worker goroutine that processes PGCR instances
@@ -29,13 +125,17 @@ type AtlasWorker struct {
 	ID             int
 	logger         logging.Logger
 	offloadChannel chan int64
+	tracker        *crawlTracker
+	deps           *crawlDeps
 }
 
-func NewAtlasWorker(workerID int, offloadChannel chan int64) *AtlasWorker {
+func NewAtlasWorker(workerID int, consumerConfig *ConsumerConfig) *AtlasWorker {
 	return &AtlasWorker{
 		ID:             workerID,
 		logger:         AtlasLogger,
-		offloadChannel: offloadChannel,
+		offloadChannel: consumerConfig.OffloadChannel,
+		tracker:        consumerConfig.Tracker,
+		deps:           consumerConfig.Deps,
 	}
 }
 
@@ -7,46 +7,60 @@ import (
 	"sync"
 	"time"
 
-	"raidhub/lib/messaging/messages"
-	"raidhub/lib/messaging/publishing"
-	"raidhub/lib/messaging/routing"
-	"raidhub/lib/monitoring/atlas_metrics"
-	"raidhub/lib/services/instance_storage"
 	"raidhub/lib/services/pgcr_processing"
 	"raidhub/lib/utils/logging"
-	"raidhub/lib/web/bungie"
 	"raidhub/lib/web/discord"
 )
 
-// Run starts the worker processing loop
-func (w *AtlasWorker) Run(wg *sync.WaitGroup, ch chan int64) {
-	defer wg.Done()
+// attemptCounts tracks why a worker has not resolved an instance yet
+type attemptCounts struct {
+	notFound  int
+	errors    int
+	malformed int
+}
+
+// exhausted reports whether the worker should stop retrying and offload the instance
+func (c attemptCounts) exhausted() bool {
+	return c.notFound > 3 || c.errors > 2 || c.malformed > 2
+}
 
+// retryDelay is how long a worker waits after failed attempt i+1 of an instance.
+// intn supplies the jitter, rand.Intn outside of the simulation harness.
+func retryDelay(i int, intn func(n int) int) time.Duration {
 	randomVariation := retryDelayTime / 3
+	return time.Duration(retryDelayTime-randomVariation+intn(retryDelayTime*(i+1))) * time.Millisecond
+}
 
-	// Get API availability monitor for Destiny2
-	destiny2Monitor := bungie.GetAPIAvailabilityMonitor("Destiny2")
-	apiWG := destiny2Monitor.GetReadOnlyWaitGroup()
+// sleepCtx sleeps for d, returning early with false if ctx is cancelled first
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Run starts the worker processing loop. Once ctx is cancelled the worker stops between attempts
+// without resolving its instance, so the final checkpoint resumes from it.
+func (w *AtlasWorker) Run(ctx context.Context, wg *sync.WaitGroup, ch chan int64) {
+	defer wg.Done()
 
 	for instanceID := range ch {
 		// Wait for API availability if needed
-		if apiWG != nil {
-			apiWG.Wait()
-		}
+		w.deps.waitForBungie()
 
 		startTime := time.Now()
-		notFoundCount := 0
-		errCount := 0
-		malformedRetryCount := 0
+		var counts attemptCounts
 		i := 0
 
 		for {
-			result, instance, pgcr := pgcr_processing.FetchAndProcessPGCR(context.Background(), instanceID, malformedRetryCount)
-
-			statusStr := fmt.Sprintf("%d", result)
-			attemptsStr := fmt.Sprintf("%d", i+1)
+			if ctx.Err() != nil {
+				return
+			}
+			result, instance, pgcr := w.deps.fetch(ctx, instanceID, counts.malformed)
 
-			atlas_metrics.PGCRCrawlStatus.WithLabelValues(statusStr, attemptsStr).Inc()
+			observeCrawlStatus(result, i+1)
 
 			// Handle the result
 			if result == pgcr_processing.NonRaid {
@@ -59,23 +73,22 @@ func (w *AtlasWorker) Run(wg *sync.WaitGroup, ch chan int64) {
 
 				lag := time.Since(endDate)
 				if lag >= 0 {
-					atlas_metrics.PGCRCrawlLag.WithLabelValues(statusStr, attemptsStr).Observe(float64(lag.Seconds()))
+					observeCrawlLag(result, i+1, lag.Seconds())
 				}
 				break
 			} else if result == pgcr_processing.Success {
 				// Publish to queue for async storage
-				storeMessage := messages.NewPGCRStoreMessage(instance, pgcr)
-				err := publishing.PublishJSONMessage(context.Background(), routing.InstanceStore, storeMessage)
+				err := w.deps.store(ctx, instance, pgcr)
 				if err != nil {
-					errCount++
+					counts.errors++
 					w.Warn("FAILED_TO_PUBLISH_INSTANCE_STORE_MESSAGE", err, nil)
-					time.Sleep(5 * time.Second)
+					sleepCtx(ctx, 5*time.Second)
 				} else {
 					endTime := time.Now()
 					workerTime := endTime.Sub(startTime)
 					lag := time.Since(instance.DateCompleted)
 					if lag >= 0 {
-						atlas_metrics.PGCRCrawlLag.WithLabelValues(statusStr, attemptsStr).Observe(float64(lag.Seconds()))
+						observeCrawlLag(result, i+1, lag.Seconds())
 					}
 					w.Info("PUBLISHED_INSTANCE", map[string]any{
 						logging.INSTANCE_ID: instanceID,
@@ -83,47 +96,58 @@ func (w *AtlasWorker) Run(wg *sync.WaitGroup, ch chan int64) {
 						"duration":          fmt.Sprintf("%dms", workerTime.Milliseconds()),
 						"lag":               discord.FormatDuration(lag.Seconds()),
 					})
+					// Another component may have logged the instance as missed before Atlas got it
+					if err := w.deps.resolveMissed(ctx, instanceID); err != nil {
+						w.Warn("FAILED_TO_RESOLVE_MISSED_PGCR", err, map[string]any{
+							logging.INSTANCE_ID: instanceID,
+						})
+					}
 					break
 				}
 			} else if result == pgcr_processing.NotFound {
-				notFoundCount++
+				counts.notFound++
 			} else if result == pgcr_processing.SystemDisabled {
-				atlas_metrics.PGCRCrawlLag.WithLabelValues(statusStr, attemptsStr).Observe(0)
-				time.Sleep(60 * time.Second)
+				observeCrawlLag(result, i+1, 0)
+				sleepCtx(ctx, systemDisabledBackoff)
 				continue
 			} else if result == pgcr_processing.RateLimited {
-				atlas_metrics.PGCRCrawlLag.WithLabelValues(statusStr, attemptsStr).Observe(0)
+				observeCrawlLag(result, i+1, 0)
 				// Back off when rate limited (e.g., ThrottledByGameServer)
-				time.Sleep(5 * time.Second)
+				sleepCtx(ctx, rateLimitedBackoff)
 			} else if result == pgcr_processing.InsufficientPrivileges {
-				publishing.PublishInt64Message(context.Background(), routing.PGCRRetry, instanceID)
+				w.deps.sendToRetry(ctx, instanceID)
 				break
 
 			} else if result == pgcr_processing.BadFormat {
-				instance_storage.WriteMissedLog(instanceID)
-				malformedRetryCount++
+				counts.malformed++
 			} else if result == pgcr_processing.ExternalError {
-				instance_storage.WriteMissedLog(instanceID)
-				errCount++
-				time.Sleep(10 * time.Second)
+				counts.errors++
+				sleepCtx(ctx, externalErrorBackoff)
 			}
 
 			// If we have not found the instance id after some time
-			if notFoundCount > 3 || errCount > 2 || malformedRetryCount > 2 {
-				instance_storage.WriteMissedLog(instanceID)
+			// pgcr_offload records it in the missed PGCR ledger if it gives up too
+			if counts.exhausted() {
 				w.Info("WRITING_TO_OFFLOAD_CHANNEL", map[string]any{
 					logging.INSTANCE_ID:     instanceID,
-					"not_found_count":       notFoundCount,
-					"err_count":             errCount,
-					"malformed_retry_count": malformedRetryCount,
+					"not_found_count":       counts.notFound,
+					"err_count":             counts.errors,
+					"malformed_retry_count": counts.malformed,
 				})
-				w.offloadChannel <- instanceID
+				w.tracker.Offload(instanceID)
+				select {
+				case w.offloadChannel <- instanceID:
+				case <-ctx.Done():
+					// still an offload in the tracker, so the final checkpoint keeps it
+					return
+				}
 				break
 			}
 
-			timeout := time.Duration((retryDelayTime - randomVariation + rand.Intn(retryDelayTime*(i+1)))) * time.Millisecond
-			time.Sleep(timeout)
+			sleepCtx(ctx, retryDelay(i, rand.Intn))
 			i++
 		}
+
+		w.tracker.Resolve(instanceID)
 	}
 }
@@ -0,0 +1,597 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"raidhub/lib/env"
+	"raidhub/lib/messaging/processing"
+	"raidhub/lib/monitoring/hermes_metrics"
+	"raidhub/lib/services/contest_profile"
+	"raidhub/lib/utils/logging"
+	"raidhub/lib/web/bungie"
+)
+
+var (
+	errTopicPaused   = errors.New("topic is paused")
+	errTopicDraining = errors.New("topic is draining")
+	errTopicRunning  = errors.New("topic is not paused")
+	errNotPinned     = errors.New("worker count is not pinned")
+)
+
+// topicScalingConfig is the part of a topic's config the admin API reports and can change
+type topicScalingConfig struct {
+	MinWorkers            int     `json:"min_workers"`
+	MaxWorkers            int     `json:"max_workers"`
+	DesiredWorkers        int     `json:"desired_workers"`
+	ScaleUpThreshold      int     `json:"scale_up_threshold"`
+	ScaleDownThreshold    int     `json:"scale_down_threshold"`
+	ScaleUpPercent        float64 `json:"scale_up_percent"`
+	ScaleDownPercent      float64 `json:"scale_down_percent"`
+	ScaleCheckInterval    string  `json:"scale_check_interval"`
+	ScaleCooldown         string  `json:"scale_cooldown"`
+	MinWorkersPerStep     int     `json:"min_workers_per_step"`
+	MaxWorkersPerStep     int     `json:"max_workers_per_step"`
+	ConsecutiveChecksUp   int     `json:"consecutive_checks_up"`
+	ConsecutiveChecksDown int     `json:"consecutive_checks_down"`
+}
+
+// topicState is one topic as returned by GET /admin/topics
+type topicState struct {
+	Topic         string             `json:"topic"`
+	State         string             `json:"state"` // running, paused, or draining
+	Profile       string             `json:"profile"`
+	QueueDepth    int                `json:"queue_depth"`
+	Workers       int                `json:"workers"`
+	PinnedWorkers int                `json:"pinned_workers,omitempty"`
+	LastDecision  *scalingDecision   `json:"last_scaling_decision"`
+	Availability  map[string]bool    `json:"availability,omitempty"` // Bungie systems the topic waits on
+	Blocked       bool               `json:"blocked"`                // workers are waiting on an unavailable system
+	Config        topicScalingConfig `json:"config"`
+	// Throughput is the last estimate of a topic scaled on throughput
+	Throughput *throughputEstimate `json:"throughput,omitempty"`
+	// BungieBudget is the topic's share of the Hermes Bungie budget
+	BungieBudget *topicBudgetState `json:"bungie_budget,omitempty"`
+}
+
+// State reports the topic for the admin API. The queue depth is read live, falling back to the last
+// depth the scaling loop saw.
+func (tm *TopicManager) State() topicState {
+	queueDepth, err := tm.getQueueDepth()
+
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+	tm.scalingMutex.Lock()
+	defer tm.scalingMutex.Unlock()
+
+	if err != nil {
+		queueDepth = tm.scalingState.cachedQueueDepth
+	}
+	state, profile := "running", contest_profile.Normal
+	if tm.contest {
+		profile = contest_profile.Contest
+	}
+	if tm.draining {
+		state = "draining"
+	} else if tm.paused {
+		state = "paused"
+	}
+
+	s := topicState{
+		Topic:         tm.config.QueueName,
+		State:         state,
+		Profile:       profile,
+		QueueDepth:    queueDepth,
+		Workers:       tm.activeWorkers,
+		PinnedWorkers: tm.pinnedWorkers,
+		LastDecision:  tm.scalingState.lastDecision,
+		Config: topicScalingConfig{
+			MinWorkers:            tm.config.MinWorkers,
+			MaxWorkers:            tm.config.MaxWorkers,
+			DesiredWorkers:        tm.config.DesiredWorkers,
+			ScaleUpThreshold:      tm.config.ScaleUpThreshold,
+			ScaleDownThreshold:    tm.config.ScaleDownThreshold,
+			ScaleUpPercent:        tm.config.ScaleUpPercent,
+			ScaleDownPercent:      tm.config.ScaleDownPercent,
+			ScaleCheckInterval:    tm.config.ScaleCheckInterval.String(),
+			ScaleCooldown:         tm.config.ScaleCooldown.String(),
+			MinWorkersPerStep:     tm.config.MinWorkersPerStep,
+			MaxWorkersPerStep:     tm.config.MaxWorkersPerStep,
+			ConsecutiveChecksUp:   tm.config.ConsecutiveChecksUp,
+			ConsecutiveChecksDown: tm.config.ConsecutiveChecksDown,
+		},
+	}
+	if len(tm.config.BungieSystemDeps) > 0 {
+		s.Availability = make(map[string]bool, len(tm.config.BungieSystemDeps))
+		for _, system := range tm.config.BungieSystemDeps {
+			available := bungie.IsSystemAvailable(system)
+			s.Availability[system] = available
+			s.Blocked = s.Blocked || !available
+		}
+	}
+	if last := tm.throughput.last; last != nil {
+		estimate := *last
+		s.Throughput = &estimate
+	}
+	if tm.budget != nil {
+		s.BungieBudget = hermesBudget.state(tm.budget)
+	}
+	return s
+}
+
+// Pin holds the topic at workers, within its bounds, until Unpin. A paused topic resumes at the
+// pinned count. Returns the previous pin (0 when there was none).
+func (tm *TopicManager) Pin(workers int) (int, error) {
+	tm.mutex.Lock()
+	if workers < tm.config.MinWorkers || workers > tm.config.MaxWorkers {
+		tm.mutex.Unlock()
+		return 0, fmt.Errorf("workers must be between %d and %d", tm.config.MinWorkers, tm.config.MaxWorkers)
+	}
+	previous := tm.pinnedWorkers
+	tm.pinnedWorkers = workers
+	running := !tm.paused && !tm.draining
+	tm.mutex.Unlock()
+
+	if !running {
+		return previous, nil
+	}
+	return previous, tm.scaleTo(workers)
+}
+
+// Unpin hands the worker count back to autoscaling. Returns the pin that was removed.
+func (tm *TopicManager) Unpin() (int, error) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	if tm.pinnedWorkers == 0 {
+		return 0, errNotPinned
+	}
+	previous := tm.pinnedWorkers
+	tm.pinnedWorkers = 0
+	return previous, nil
+}
+
+// Pause stops every worker of the topic. The manager stays up and Resume restarts the same number of
+// workers. Messages the workers were holding go back to the queue. Returns the number of workers stopped.
+func (tm *TopicManager) Pause() (int, error) {
+	tm.scaleMutex.Lock()
+	defer tm.scaleMutex.Unlock()
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	if tm.draining {
+		return 0, errTopicDraining
+	}
+	if tm.paused {
+		return 0, errTopicPaused
+	}
+
+	stopped := tm.activeWorkers
+	for id, worker := range tm.workers {
+		worker.cancel(errors.New(ADMIN_PAUSED))
+		delete(tm.workers, id)
+	}
+	tm.activeWorkers = 0
+	tm.resumeWorkers = stopped
+	tm.paused = true
+	hermes_metrics.QueueWorkerCount.WithLabelValues(tm.config.QueueName).Set(0)
+	return stopped, nil
+}
+
+// Resume restarts a paused or drained topic at its pinned worker count, or the count it had when it
+// was stopped. Returns the worker count it resumed at.
+func (tm *TopicManager) Resume() (int, error) {
+	// Held until the workers are back, so autoscaling and a second pause wait for them
+	tm.scaleMutex.Lock()
+	defer tm.scaleMutex.Unlock()
+
+	tm.mutex.Lock()
+	if tm.draining {
+		tm.mutex.Unlock()
+		return 0, errTopicDraining
+	}
+	if !tm.paused {
+		tm.mutex.Unlock()
+		return 0, errTopicRunning
+	}
+	target := tm.resumeWorkers
+	if tm.pinnedWorkers > 0 {
+		target = tm.pinnedWorkers
+	}
+	tm.paused = false
+	tm.mutex.Unlock()
+
+	err := tm.scaleToInternal(target, false, false)
+
+	tm.mutex.RLock()
+	workers := tm.activeWorkers
+	tm.mutex.RUnlock()
+	return workers, err
+}
+
+// Drain cancels the topic's consumers so no new messages are delivered, lets each worker finish what
+// it was already holding, and leaves the topic paused once every worker has stopped. It returns
+// straight away with the number of workers draining.
+func (tm *TopicManager) Drain() (int, error) {
+	tm.scaleMutex.Lock()
+	defer tm.scaleMutex.Unlock()
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	if tm.draining {
+		return 0, errTopicDraining
+	}
+	if tm.paused {
+		return 0, errTopicPaused
+	}
+
+	workers := make([]*Worker, 0, len(tm.workers))
+	for _, worker := range tm.workers {
+		if err := worker.Drain(); err != nil {
+			// The channel is already gone, so the worker stops on its own
+			tm.Warn("WORKER_DRAIN_ERROR", err, map[string]any{
+				"worker_id": worker.ID,
+			})
+		}
+		workers = append(workers, worker)
+	}
+	tm.resumeWorkers = tm.activeWorkers
+	tm.draining = true
+
+	go tm.finishDrain(workers, time.Now())
+	return len(workers), nil
+}
+
+// finishDrain waits for the drained workers to stop and marks the topic paused
+func (tm *TopicManager) finishDrain(workers []*Worker, start time.Time) {
+	for _, worker := range workers {
+		select {
+		case <-worker.Done():
+		case <-tm.Context().Done():
+			// Shutdown waits for the workers instead
+			return
+		}
+	}
+
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	for _, worker := range workers {
+		if tm.workers[worker.ID] == worker {
+			delete(tm.workers, worker.ID)
+			tm.activeWorkers--
+		}
+	}
+	tm.draining = false
+	tm.paused = true
+	hermes_metrics.QueueWorkerCount.WithLabelValues(tm.config.QueueName).Set(float64(tm.activeWorkers))
+
+	tm.Info("TOPIC_DRAINED", map[string]any{
+		logging.COUNT:    len(workers),
+		logging.DURATION: time.Since(start).String(),
+	})
+}
+
+// scalingConfigPatch is the body of POST /admin/topics/config. Fields left out keep their value.
+type scalingConfigPatch struct {
+	MinWorkers            *int     `json:"min_workers"`
+	MaxWorkers            *int     `json:"max_workers"`
+	ScaleUpThreshold      *int     `json:"scale_up_threshold"`
+	ScaleDownThreshold    *int     `json:"scale_down_threshold"`
+	ScaleUpPercent        *float64 `json:"scale_up_percent"`
+	ScaleDownPercent      *float64 `json:"scale_down_percent"`
+	ScaleCooldown         *string  `json:"scale_cooldown"`
+	MinWorkersPerStep     *int     `json:"min_workers_per_step"`
+	MaxWorkersPerStep     *int     `json:"max_workers_per_step"`
+	ConsecutiveChecksUp   *int     `json:"consecutive_checks_up"`
+	ConsecutiveChecksDown *int     `json:"consecutive_checks_down"`
+}
+
+// SetScalingConfig applies patch to the topic's scaling config in memory; a restart or a profile
+// switch goes back to the topic's declared config. Workers outside new bounds are brought back within them. Returns the
+// fields that changed, as "old → new".
+func (tm *TopicManager) SetScalingConfig(patch scalingConfigPatch) (map[string]string, error) {
+	tm.mutex.Lock()
+	tm.scalingMutex.Lock()
+	config := tm.config
+	changes := make(map[string]string)
+	setInt := func(name string, field *int, value *int) {
+		if value != nil && *value != *field {
+			changes[name] = fmt.Sprintf("%d → %d", *field, *value)
+			*field = *value
+		}
+	}
+	setFloat := func(name string, field *float64, value *float64) {
+		if value != nil && *value != *field {
+			changes[name] = fmt.Sprintf("%g → %g", *field, *value)
+			*field = *value
+		}
+	}
+	setInt("min_workers", &config.MinWorkers, patch.MinWorkers)
+	setInt("max_workers", &config.MaxWorkers, patch.MaxWorkers)
+	setInt("scale_up_threshold", &config.ScaleUpThreshold, patch.ScaleUpThreshold)
+	setInt("scale_down_threshold", &config.ScaleDownThreshold, patch.ScaleDownThreshold)
+	setFloat("scale_up_percent", &config.ScaleUpPercent, patch.ScaleUpPercent)
+	setFloat("scale_down_percent", &config.ScaleDownPercent, patch.ScaleDownPercent)
+	setInt("min_workers_per_step", &config.MinWorkersPerStep, patch.MinWorkersPerStep)
+	setInt("max_workers_per_step", &config.MaxWorkersPerStep, patch.MaxWorkersPerStep)
+	setInt("consecutive_checks_up", &config.ConsecutiveChecksUp, patch.ConsecutiveChecksUp)
+	setInt("consecutive_checks_down", &config.ConsecutiveChecksDown, patch.ConsecutiveChecksDown)
+	if patch.ScaleCooldown != nil {
+		cooldown, err := time.ParseDuration(*patch.ScaleCooldown)
+		if err != nil {
+			tm.scalingMutex.Unlock()
+			tm.mutex.Unlock()
+			return nil, fmt.Errorf("scale_cooldown: %w", err)
+		}
+		if cooldown != config.ScaleCooldown {
+			changes["scale_cooldown"] = fmt.Sprintf("%s → %s", config.ScaleCooldown, cooldown)
+			config.ScaleCooldown = cooldown
+		}
+	}
+
+	if err := validateScalingConfig(config, tm.pinnedWorkers); err != nil {
+		tm.scalingMutex.Unlock()
+		tm.mutex.Unlock()
+		return nil, err
+	}
+	tm.config = config
+	target := min(max(tm.activeWorkers, config.MinWorkers), config.MaxWorkers)
+	reclamp := target != tm.activeWorkers && !tm.paused && !tm.draining
+	tm.scalingMutex.Unlock()
+	tm.mutex.Unlock()
+	if tm.budget != nil {
+		hermesBudget.update(tm.budget, config, target)
+	}
+
+	if reclamp {
+		return changes, tm.scaleTo(target)
+	}
+	return changes, nil
+}
+
+func validateScalingConfig(config processing.TopicConfig, pinnedWorkers int) error {
+	switch {
+	case config.MinWorkers < 1:
+		return errors.New("min_workers must be at least 1")
+	case config.MaxWorkers < config.MinWorkers:
+		return errors.New("max_workers must be at least min_workers")
+	case pinnedWorkers > 0 && (pinnedWorkers < config.MinWorkers || pinnedWorkers > config.MaxWorkers):
+		return fmt.Errorf("pinned worker count %d would be outside the new bounds", pinnedWorkers)
+	case config.ScaleDownThreshold < 0 || config.ScaleUpThreshold <= config.ScaleDownThreshold:
+		return errors.New("scale_up_threshold must be above scale_down_threshold, which must not be negative")
+	case config.ScaleUpPercent <= 0 || config.ScaleDownPercent <= 0:
+		return errors.New("scale percents must be positive")
+	case config.ScaleCooldown < 0:
+		return errors.New("scale_cooldown must not be negative")
+	case config.MinWorkersPerStep < 1 || config.MaxWorkersPerStep < config.MinWorkersPerStep:
+		return errors.New("min_workers_per_step must be at least 1 and max_workers_per_step at least min_workers_per_step")
+	case config.ConsecutiveChecksUp < 1 || config.ConsecutiveChecksDown < 1:
+		return errors.New("consecutive checks must be at least 1")
+	}
+	return nil
+}
+
+// registerAdminAPI serves the admin API under /admin/ on the metrics port.
+// Every request must carry Authorization: Bearer HERMES_ADMIN_TOKEN.
+func registerAdminAPI(topicManagers []*TopicManager, portOverride string) {
+	if env.HermesAdminToken == "" {
+		HermesLogger.Info("ADMIN_API_DISABLED", map[string]any{
+			logging.REASON: "HERMES_ADMIN_TOKEN not set",
+		})
+		return
+	}
+
+	api := &adminAPI{topics: make(map[string]*TopicManager, len(topicManagers))}
+	for _, tm := range topicManagers {
+		api.topics[tm.topic.Config.QueueName] = tm
+		api.order = append(api.order, tm)
+	}
+	http.Handle("/admin/topics", api.authorized(http.MethodGet, api.handleTopics))
+	http.Handle("/admin/topics/pin", api.authorized(http.MethodPost, api.handlePin))
+	http.Handle("/admin/topics/unpin", api.authorized(http.MethodPost, api.handleUnpin))
+	http.Handle("/admin/topics/pause", api.authorized(http.MethodPost, api.handlePause))
+	http.Handle("/admin/topics/resume", api.authorized(http.MethodPost, api.handleResume))
+	http.Handle("/admin/topics/drain", api.authorized(http.MethodPost, api.handleDrain))
+	http.Handle("/admin/topics/config", api.authorized(http.MethodPost, api.handleConfig))
+
+	port := portOverride
+	if port == "" {
+		port = env.HermesMetricsPort
+	}
+	HermesLogger.Info("ADMIN_API_ENABLED", map[string]any{
+		logging.PORT:  port,
+		logging.COUNT: len(topicManagers),
+	})
+}
+
+type adminAPI struct {
+	topics map[string]*TopicManager
+	order  []*TopicManager
+}
+
+func (api *adminAPI) authorized(method string, handler http.HandlerFunc) http.Handler {
+	expected := []byte("Bearer " + env.HermesAdminToken)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			HermesLogger.Warn("ADMIN_API_UNAUTHORIZED", nil, map[string]any{
+				logging.PATH: r.URL.Path,
+				"remote":     r.RemoteAddr,
+			})
+			writeAdminError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		if r.Method != method {
+			writeAdminError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		handler(w, r)
+	})
+}
+
+// topicRequest is the body every per-topic endpoint takes; workers is only read by pin
+type topicRequest struct {
+	Topic   string `json:"topic"`
+	Workers *int   `json:"workers"`
+}
+
+// decodeTopic reads a topicRequest and looks up its topic, writing the error response if either fails
+func (api *adminAPI) decodeTopic(w http.ResponseWriter, r *http.Request) (*TopicManager, topicRequest, bool) {
+	var body topicRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return nil, body, false
+	}
+	tm, ok := api.topics[body.Topic]
+	if !ok {
+		writeAdminError(w, http.StatusNotFound, fmt.Sprintf("unknown topic %q", body.Topic))
+		return nil, body, false
+	}
+	return tm, body, true
+}
+
+func (api *adminAPI) handleTopics(w http.ResponseWriter, r *http.Request) {
+	states := make([]topicState, 0, len(api.order))
+	for _, tm := range api.order {
+		states = append(states, tm.State())
+	}
+	writeAdminJSON(w, http.StatusOK, states)
+}
+
+func (api *adminAPI) handlePin(w http.ResponseWriter, r *http.Request) {
+	tm, body, ok := api.decodeTopic(w, r)
+	if !ok {
+		return
+	}
+	if body.Workers == nil {
+		writeAdminError(w, http.StatusBadRequest, "workers is required")
+		return
+	}
+	previous, err := tm.Pin(*body.Workers)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	logAdminChange(tm, "ADMIN_WORKERS_PINNED", r, map[string]any{
+		logging.FROM: previous,
+		logging.TO:   *body.Workers,
+	})
+	writeAdminJSON(w, http.StatusOK, tm.State())
+}
+
+func (api *adminAPI) handleUnpin(w http.ResponseWriter, r *http.Request) {
+	tm, _, ok := api.decodeTopic(w, r)
+	if !ok {
+		return
+	}
+	previous, err := tm.Unpin()
+	if err != nil {
+		writeAdminError(w, http.StatusConflict, err.Error())
+		return
+	}
+	logAdminChange(tm, "ADMIN_WORKERS_UNPINNED", r, map[string]any{
+		logging.FROM: previous,
+	})
+	writeAdminJSON(w, http.StatusOK, tm.State())
+}
+
+func (api *adminAPI) handlePause(w http.ResponseWriter, r *http.Request) {
+	tm, _, ok := api.decodeTopic(w, r)
+	if !ok {
+		return
+	}
+	stopped, err := tm.Pause()
+	if err != nil {
+		writeAdminError(w, http.StatusConflict, err.Error())
+		return
+	}
+	logAdminChange(tm, "ADMIN_TOPIC_PAUSED", r, map[string]any{
+		"workers": stopped,
+	})
+	writeAdminJSON(w, http.StatusOK, tm.State())
+}
+
+func (api *adminAPI) handleResume(w http.ResponseWriter, r *http.Request) {
+	tm, _, ok := api.decodeTopic(w, r)
+	if !ok {
+		return
+	}
+	workers, err := tm.Resume()
+	if errors.Is(err, errTopicRunning) || errors.Is(err, errTopicDraining) {
+		writeAdminError(w, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	logAdminChange(tm, "ADMIN_TOPIC_RESUMED", r, map[string]any{
+		"workers": workers,
+	})
+	writeAdminJSON(w, http.StatusOK, tm.State())
+}
+
+func (api *adminAPI) handleDrain(w http.ResponseWriter, r *http.Request) {
+	tm, _, ok := api.decodeTopic(w, r)
+	if !ok {
+		return
+	}
+	draining, err := tm.Drain()
+	if err != nil {
+		writeAdminError(w, http.StatusConflict, err.Error())
+		return
+	}
+	logAdminChange(tm, "ADMIN_TOPIC_DRAINING", r, map[string]any{
+		"workers": draining,
+	})
+	writeAdminJSON(w, http.StatusAccepted, tm.State())
+}
+
+func (api *adminAPI) handleConfig(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Topic string `json:"topic"`
+		scalingConfigPatch
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tm, ok := api.topics[body.Topic]
+	if !ok {
+		writeAdminError(w, http.StatusNotFound, fmt.Sprintf("unknown topic %q", body.Topic))
+		return
+	}
+	changes, err := tm.SetScalingConfig(body.scalingConfigPatch)
+	if err != nil && changes == nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(changes) > 0 {
+		fields := make(map[string]any, len(changes))
+		for name, change := range changes {
+			fields[name] = change
+		}
+		logAdminChange(tm, "ADMIN_SCALING_CONFIG_CHANGED", r, fields)
+	}
+	if err != nil {
+		// The config took, but bringing the workers within the new bounds did not
+		writeAdminError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, tm.State())
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeAdminError(w http.ResponseWriter, status int, message string) {
+	writeAdminJSON(w, status, map[string]string{"error": message})
+}
+
+// logAdminChange is the audit log entry for a change made through the admin API
+func logAdminChange(tm *TopicManager, key string, r *http.Request, fields map[string]any) {
+	fields["remote"] = r.RemoteAddr
+	tm.Info(key, fields)
+}
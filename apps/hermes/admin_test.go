@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"raidhub/lib/env"
+	"raidhub/lib/messaging/processing"
+)
+
+// newTestTopicManager is a topic running the given number of stand-in workers, so the admin operations
+// that only stop workers run without RabbitMQ
+func newTestTopicManager(t *testing.T, workers int) *TopicManager {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	config := processing.TopicConfig{
+		QueueName:             "test_topic",
+		MinWorkers:            1,
+		MaxWorkers:            10,
+		DesiredWorkers:        workers,
+		ScaleUpThreshold:      100,
+		ScaleDownThreshold:    10,
+		ScaleUpPercent:        0.2,
+		ScaleDownPercent:      0.1,
+		ScaleCheckInterval:    time.Minute,
+		ScaleCooldown:         time.Minute,
+		MinWorkersPerStep:     1,
+		MaxWorkersPerStep:     10,
+		ConsecutiveChecksUp:   2,
+		ConsecutiveChecksDown: 3,
+	}
+	tm := &TopicManager{
+		topic:        processing.Topic{Config: config},
+		config:       config,
+		baseConfig:   config,
+		ctx:          ctx,
+		workers:      make(map[int]*Worker),
+		logger:       HermesLogger,
+		scalingState: scalingState{lastScaleDirection: "none"},
+	}
+	for i := range workers {
+		workerCtx, workerCancel := context.WithCancelCause(context.Background())
+		tm.workers[i] = &Worker{
+			ID:        i,
+			QueueName: config.QueueName,
+			logger:    HermesLogger,
+			ctx:       workerCtx,
+			cancel:    workerCancel,
+			done:      make(chan struct{}),
+		}
+		tm.activeWorkers++
+	}
+	return tm
+}
+
+func TestPauseStopsWorkers(t *testing.T) {
+	tm := newTestTopicManager(t, 3)
+	workers := make([]*Worker, 0, len(tm.workers))
+	for _, w := range tm.workers {
+		workers = append(workers, w)
+	}
+
+	stopped, err := tm.Pause()
+	if err != nil || stopped != 3 {
+		t.Fatalf("Pause() = (%d, %v), want (3, nil)", stopped, err)
+	}
+	for _, w := range workers {
+		if cause := context.Cause(w.Context()); cause == nil || cause.Error() != ADMIN_PAUSED {
+			t.Errorf("worker %d cause = %v, want %s", w.ID, cause, ADMIN_PAUSED)
+		}
+	}
+	if tm.activeWorkers != 0 || len(tm.workers) != 0 || tm.resumeWorkers != 3 {
+		t.Errorf("after pause active = %d, workers = %d, resume = %d, want 0, 0, 3", tm.activeWorkers, len(tm.workers), tm.resumeWorkers)
+	}
+
+	if _, err := tm.Pause(); !errors.Is(err, errTopicPaused) {
+		t.Errorf("second Pause() error = %v, want %v", err, errTopicPaused)
+	}
+	if _, err := tm.Drain(); !errors.Is(err, errTopicPaused) {
+		t.Errorf("Drain() of a paused topic error = %v, want %v", err, errTopicPaused)
+	}
+}
+
+func TestPausedTopicIgnoresScaling(t *testing.T) {
+	tm := newTestTopicManager(t, 2)
+	if _, err := tm.Pause(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A pin or a scaling check that lands after the pause must not bring workers back
+	if _, err := tm.Pin(5); err != nil {
+		t.Fatalf("Pin() error = %v", err)
+	}
+	if err := tm.scaleTo(5); err != nil {
+		t.Fatalf("scaleTo() error = %v", err)
+	}
+	if tm.activeWorkers != 0 {
+		t.Errorf("active workers = %d, want 0 while paused", tm.activeWorkers)
+	}
+	if tm.pinnedWorkers != 5 {
+		t.Errorf("pinned workers = %d, want 5", tm.pinnedWorkers)
+	}
+}
+
+func TestPinBeatsPendingAutoscale(t *testing.T) {
+	tm := newTestTopicManager(t, 2)
+
+	// A pin that lands between the scaling check and the scale must win
+	if _, err := tm.Pin(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := tm.autoscaleTo(5); !errors.Is(err, errAutoscaleHeld) {
+		t.Errorf("autoscaleTo() error = %v, want %v", err, errAutoscaleHeld)
+	}
+	if tm.activeWorkers != 2 {
+		t.Errorf("active workers = %d, want the pinned 2", tm.activeWorkers)
+	}
+}
+
+func TestResumeRunningTopic(t *testing.T) {
+	tm := newTestTopicManager(t, 1)
+	if _, err := tm.Resume(); !errors.Is(err, errTopicRunning) {
+		t.Errorf("Resume() error = %v, want %v", err, errTopicRunning)
+	}
+}
+
+func TestPinAndUnpin(t *testing.T) {
+	tm := newTestTopicManager(t, 2)
+	if _, err := tm.Pause(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tm.Pin(11); err == nil {
+		t.Error("Pin(11) above max_workers succeeded")
+	}
+	if _, err := tm.Unpin(); !errors.Is(err, errNotPinned) {
+		t.Errorf("Unpin() error = %v, want %v", err, errNotPinned)
+	}
+	if _, err := tm.Pin(4); err != nil {
+		t.Fatal(err)
+	}
+	previous, err := tm.Pin(6)
+	if err != nil || previous != 4 {
+		t.Errorf("Pin(6) = (%d, %v), want (4, nil)", previous, err)
+	}
+	removed, err := tm.Unpin()
+	if err != nil || removed != 6 {
+		t.Errorf("Unpin() = (%d, %v), want (6, nil)", removed, err)
+	}
+}
+
+func TestSetScalingConfig(t *testing.T) {
+	intPtr := func(v int) *int { return &v }
+	stringPtr := func(v string) *string { return &v }
+
+	tm := newTestTopicManager(t, 5)
+	changes, err := tm.SetScalingConfig(scalingConfigPatch{
+		MaxWorkers:    intPtr(3),
+		MinWorkers:    intPtr(1),
+		ScaleCooldown: stringPtr("30s"),
+	})
+	if err != nil {
+		t.Fatalf("SetScalingConfig() error = %v", err)
+	}
+	want := map[string]string{
+		"max_workers":    "10 → 3",
+		"scale_cooldown": "1m0s → 30s",
+	}
+	if len(changes) != len(want) {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+	for name, change := range want {
+		if changes[name] != change {
+			t.Errorf("changes[%q] = %q, want %q", name, changes[name], change)
+		}
+	}
+	if got := tm.currentConfig(); got.MaxWorkers != 3 || got.ScaleCooldown != 30*time.Second {
+		t.Errorf("config max_workers = %d, cooldown = %s, want 3, 30s", got.MaxWorkers, got.ScaleCooldown)
+	}
+	// Workers above the new maximum are scaled in
+	if tm.activeWorkers != 3 {
+		t.Errorf("active workers = %d, want 3", tm.activeWorkers)
+	}
+
+	if _, err := tm.SetScalingConfig(scalingConfigPatch{ScaleCooldown: stringPtr("soon")}); err == nil {
+		t.Error("SetScalingConfig() with a bad duration succeeded")
+	}
+	if _, err := tm.SetScalingConfig(scalingConfigPatch{MinWorkers: intPtr(4)}); err == nil {
+		t.Error("SetScalingConfig() with min_workers above max_workers succeeded")
+	}
+	if got := tm.currentConfig().MinWorkers; got != 1 {
+		t.Errorf("rejected patch changed min_workers to %d", got)
+	}
+}
+
+func TestValidateScalingConfig(t *testing.T) {
+	valid := newTestTopicManager(t, 0).config
+
+	tests := []struct {
+		name   string
+		change func(*processing.TopicConfig)
+		pinned int
+		ok     bool
+	}{
+		{"valid", func(*processing.TopicConfig) {}, 0, true},
+		{"zero min workers", func(c *processing.TopicConfig) { c.MinWorkers = 0 }, 0, false},
+		{"max below min", func(c *processing.TopicConfig) { c.MaxWorkers = 0 }, 0, false},
+		{"pin outside bounds", func(c *processing.TopicConfig) { c.MaxWorkers = 4 }, 5, false},
+		{"pin inside bounds", func(c *processing.TopicConfig) { c.MaxWorkers = 5 }, 5, true},
+		{"thresholds crossed", func(c *processing.TopicConfig) { c.ScaleUpThreshold = 10 }, 0, false},
+		{"zero percent", func(c *processing.TopicConfig) { c.ScaleDownPercent = 0 }, 0, false},
+		{"negative cooldown", func(c *processing.TopicConfig) { c.ScaleCooldown = -time.Second }, 0, false},
+		{"step bounds crossed", func(c *processing.TopicConfig) { c.MaxWorkersPerStep = 0 }, 0, false},
+		{"zero checks", func(c *processing.TopicConfig) { c.ConsecutiveChecksDown = 0 }, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.change(&config)
+			err := validateScalingConfig(config, tt.pinned)
+			if (err == nil) != tt.ok {
+				t.Errorf("validateScalingConfig() error = %v, want ok = %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAdminAPIRejects(t *testing.T) {
+	previous := env.HermesAdminToken
+	env.HermesAdminToken = "secret"
+	t.Cleanup(func() { env.HermesAdminToken = previous })
+
+	tm := newTestTopicManager(t, 1)
+	api := &adminAPI{
+		topics: map[string]*TopicManager{"test_topic": tm},
+		order:  []*TopicManager{tm},
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		token   string
+		body    string
+		want    int
+	}{
+		{"missing token", api.handleUnpin, http.MethodPost, "", `{"topic":"test_topic"}`, http.StatusUnauthorized},
+		{"wrong token", api.handleUnpin, http.MethodPost, "nope", `{"topic":"test_topic"}`, http.StatusUnauthorized},
+		{"wrong method", api.handleUnpin, http.MethodGet, "secret", `{"topic":"test_topic"}`, http.StatusMethodNotAllowed},
+		{"bad body", api.handleUnpin, http.MethodPost, "secret", `{`, http.StatusBadRequest},
+		{"unknown topic", api.handleUnpin, http.MethodPost, "secret", `{"topic":"other"}`, http.StatusNotFound},
+		{"not pinned", api.handleUnpin, http.MethodPost, "secret", `{"topic":"test_topic"}`, http.StatusConflict},
+		{"pin without workers", api.handlePin, http.MethodPost, "secret", `{"topic":"test_topic"}`, http.StatusBadRequest},
+		{"pin out of bounds", api.handlePin, http.MethodPost, "secret", `{"topic":"test_topic","workers":50}`, http.StatusBadRequest},
+		{"resume running topic", api.handleResume, http.MethodPost, "secret", `{"topic":"test_topic"}`, http.StatusConflict},
+		{"invalid config", api.handleConfig, http.MethodPost, "secret", `{"topic":"test_topic","min_workers":0}`, http.StatusBadRequest},
+		{"config for unknown topic", api.handleConfig, http.MethodPost, "secret", `{"topic":"other"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/admin/topics", strings.NewReader(tt.body))
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			api.authorized(http.MethodPost, tt.handler).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d (body %s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"raidhub/lib/env"
+	"raidhub/lib/messaging/processing"
+	"raidhub/lib/monitoring/hermes_metrics"
+	"raidhub/lib/utils/logging"
+	"raidhub/lib/web/bungie"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	budgetRebalanceInterval = 15 * time.Second
+	// budgetFloorShare of the budget is split evenly across topics first, so no topic is starved outright
+	budgetFloorShare = 0.1
+	// defaultBudgetServiceRate stands in for a topic's messages per second per worker until one finishes
+	defaultBudgetServiceRate = 1.0
+)
+
+// budgetPriorityOrder is the order topics' demand is met in once every topic has its floor
+var budgetPriorityOrder = []bungie.Priority{
+	bungie.PriorityCritical,
+	bungie.PriorityHigh,
+	bungie.PriorityNormal,
+	bungie.PriorityLow,
+}
+
+// bungieBudget splits HERMES_BUNGIE_BUDGET across the topics that declare a BungieRequestWeight, so a
+// topic scaling up can't take the Zeus capacity the others run on. Each topic draws from a token bucket
+// sized by its priority and demand, and its TopicManager won't add workers the bucket can't feed.
+type bungieBudget struct {
+	rate float64 // requests per second
+
+	mu     sync.Mutex
+	topics []*topicBudget
+}
+
+// topicBudget is one topic's share of the budget. The limiter hands out messages rather than requests;
+// a message costs weight requests.
+type topicBudget struct {
+	queue    string
+	weight   float64
+	priority bungie.Priority
+	limiter  *rate.Limiter
+
+	// guarded by bungieBudget.mu
+	wantedWorkers int
+	serviceRate   float64 // messages/s one busy worker finishes, not counting time waiting on the bucket
+	count         uint64
+	sum           float64
+	demand        float64 // requests/s
+	allocation    float64 // requests/s
+}
+
+// topicBudgetState is a topic's share of the budget as returned by GET /admin/topics
+type topicBudgetState struct {
+	Weight     float64 `json:"weight"`
+	Priority   string  `json:"priority"`
+	Demand     float64 `json:"demand"`     // requests/s the workers it wants would make
+	Allocation float64 `json:"allocation"` // requests/s it may make
+	MaxWorkers int     `json:"max_workers"`
+}
+
+var budgetLogger = logging.NewLogger("HERMES_BUNGIE_BUDGET")
+
+// hermesBudget is nil when HERMES_BUNGIE_BUDGET is unset, which leaves every topic unthrottled
+var hermesBudget *bungieBudget
+
+// startBungieBudget sets up the budget topics register with and rebalances it until ctx is cancelled.
+// Call before starting topics.
+func startBungieBudget(ctx context.Context) {
+	if env.HermesBungieBudget == 0 {
+		return
+	}
+	hermesBudget = &bungieBudget{rate: float64(env.HermesBungieBudget)}
+	budgetLogger.Info("BUNGIE_BUDGET_ENABLED", map[string]any{
+		"requests_per_second": env.HermesBungieBudget,
+	})
+	go func() {
+		ticker := time.NewTicker(budgetRebalanceInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				hermesBudget.mu.Lock()
+				hermesBudget.rebalance()
+				hermesBudget.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// register gives a topic with a BungieRequestWeight its bucket. Returns nil when there is no budget or
+// the topic doesn't declare a weight.
+func (b *bungieBudget) register(config processing.TopicConfig) *topicBudget {
+	if b == nil || config.BungieRequestWeight <= 0 {
+		return nil
+	}
+	t := &topicBudget{
+		queue:         config.QueueName,
+		weight:        config.BungieRequestWeight,
+		priority:      budgetPriority(config),
+		limiter:       rate.NewLimiter(rate.Inf, 1),
+		wantedWorkers: config.DesiredWorkers,
+		serviceRate:   defaultBudgetServiceRate,
+	}
+	t.count, t.sum = hermes_metrics.ProcessingTotals(t.queue)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.topics = append(b.topics, t)
+	b.rebalance()
+	return t
+}
+
+// update takes a topic's weight and priority from config after a profile switch or an admin change,
+// along with the worker count it now wants, and reallocates the budget
+func (b *bungieBudget) update(t *topicBudget, config processing.TopicConfig, workers int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if config.BungieRequestWeight > 0 {
+		t.weight = config.BungieRequestWeight
+	}
+	t.priority = budgetPriority(config)
+	t.wantedWorkers = workers
+	b.rebalance()
+}
+
+// budgetPriority is the priority class config draws on the budget at, normal when it doesn't set one
+func budgetPriority(config processing.TopicConfig) bungie.Priority {
+	switch config.BungiePriority {
+	case bungie.PriorityCritical, bungie.PriorityHigh, bungie.PriorityLow:
+		return config.BungiePriority
+	}
+	return bungie.PriorityNormal
+}
+
+// rebalance measures each topic's demand and reallocates the budget. Every topic gets an even share of
+// budgetFloorShare, capped at its demand. The rest meets demand one priority class at a time, split in
+// proportion to demand within a class that can't all be met. Whatever is left over is split evenly, so a
+// topic can pick up speed before its demand catches up. Called with mu held.
+func (b *bungieBudget) rebalance() {
+	if len(b.topics) == 0 {
+		return
+	}
+	for _, t := range b.topics {
+		count, sum := hermes_metrics.ProcessingTotals(t.queue)
+		if count > t.count && sum > t.sum {
+			t.serviceRate = float64(count-t.count) / (sum - t.sum)
+		}
+		t.count, t.sum = count, sum
+		t.demand = float64(t.wantedWorkers) * t.serviceRate * t.weight
+		t.allocation = min(t.demand, b.rate*budgetFloorShare/float64(len(b.topics)))
+	}
+
+	remaining := b.rate
+	for _, t := range b.topics {
+		remaining -= t.allocation
+	}
+	for _, priority := range budgetPriorityOrder {
+		var unmet float64
+		for _, t := range b.topics {
+			if t.priority == priority {
+				unmet += t.demand - t.allocation
+			}
+		}
+		if unmet <= 0 || remaining <= 0 {
+			continue
+		}
+		share := min(1, remaining/unmet)
+		for _, t := range b.topics {
+			if t.priority == priority {
+				t.allocation += (t.demand - t.allocation) * share
+			}
+		}
+		remaining -= min(unmet, remaining)
+	}
+
+	spare := max(0, remaining) / float64(len(b.topics))
+	for _, t := range b.topics {
+		t.allocation += spare
+		messagesPerSecond := t.allocation / t.weight
+		t.limiter.SetLimit(rate.Limit(messagesPerSecond))
+		t.limiter.SetBurst(max(1, int(math.Ceil(messagesPerSecond))))
+		hermes_metrics.QueueBungieBudget.WithLabelValues(t.queue, "demand").Set(t.demand)
+		hermes_metrics.QueueBungieBudget.WithLabelValues(t.queue, "allocation").Set(t.allocation)
+	}
+}
+
+// want records how many workers the topic would run if the budget allowed it
+func (b *bungieBudget) want(t *topicBudget, workers int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t.wantedWorkers = workers
+}
+
+// maxWorkers is how many workers the topic's allocation keeps busy
+func (b *bungieBudget) maxWorkers(t *topicBudget) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return t.maxWorkers()
+}
+
+func (t *topicBudget) maxWorkers() int {
+	return max(1, int(t.allocation/(t.serviceRate*t.weight)))
+}
+
+func (b *bungieBudget) state(t *topicBudget) *topicBudgetState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return &topicBudgetState{
+		Weight:     t.weight,
+		Priority:   string(t.priority),
+		Demand:     t.demand,
+		Allocation: t.allocation,
+		MaxWorkers: t.maxWorkers(),
+	}
+}
+
+// fitToBudget reports the worker count the topic wants to the budget and holds a scale-up to the
+// workers its allocation can feed
+func (tm *TopicManager) fitToBudget(shouldScale bool, direction string, currentWorkers, targetWorkers int) (bool, int) {
+	if tm.budget == nil {
+		return shouldScale, targetWorkers
+	}
+	wanted := currentWorkers
+	if shouldScale {
+		wanted = targetWorkers
+	}
+	hermesBudget.want(tm.budget, wanted)
+	if !shouldScale || direction != "up" {
+		return shouldScale, targetWorkers
+	}
+
+	limit := hermesBudget.maxWorkers(tm.budget)
+	if targetWorkers <= limit {
+		return true, targetWorkers
+	}
+	tm.Info("SCALE_UP_LIMITED_BY_BUNGIE_BUDGET", map[string]any{
+		logging.FROM:     currentWorkers,
+		logging.TO:       targetWorkers,
+		"budget_workers": limit,
+	})
+	return limit > currentWorkers, limit
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"raidhub/lib/messaging/processing"
+	"raidhub/lib/monitoring/hermes_metrics"
+	"raidhub/lib/web/bungie"
+
+	"golang.org/x/time/rate"
+)
+
+func addBudgetTopic(b *bungieBudget, queue string, weight float64, priority bungie.Priority, workers int) *topicBudget {
+	t := &topicBudget{
+		queue:         queue,
+		weight:        weight,
+		priority:      priority,
+		limiter:       rate.NewLimiter(rate.Inf, 1),
+		wantedWorkers: workers,
+		serviceRate:   defaultBudgetServiceRate,
+	}
+	t.count, t.sum = hermes_metrics.ProcessingTotals(queue)
+	b.topics = append(b.topics, t)
+	return t
+}
+
+type budgetTopicSpec struct {
+	weight   float64
+	priority bungie.Priority
+	workers  int
+}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestBungieBudgetRebalance(t *testing.T) {
+	tests := []struct {
+		name   string
+		rate   float64
+		topics []budgetTopicSpec
+		want   []float64 // allocation per topic, requests/s
+	}{
+		{
+			name: "higher priority is met first",
+			rate: 100,
+			topics: []budgetTopicSpec{
+				{2, bungie.PriorityCritical, 10},
+				{1, bungie.PriorityLow, 200},
+			},
+			// Floors of 5 each, then critical's remaining 15, then low takes the last 75
+			want: []float64{20, 80},
+		},
+		{
+			name: "one class split in proportion to demand",
+			rate: 100,
+			topics: []budgetTopicSpec{
+				{1, bungie.PriorityNormal, 100},
+				{1, bungie.PriorityNormal, 100},
+			},
+			want: []float64{50, 50},
+		},
+		{
+			name: "spare split evenly",
+			rate: 100,
+			topics: []budgetTopicSpec{
+				{1, bungie.PriorityHigh, 10},
+				{1, bungie.PriorityLow, 30},
+			},
+			want: []float64{40, 60},
+		},
+		{
+			name: "floor holds off a starved topic",
+			rate: 100,
+			topics: []budgetTopicSpec{
+				{1, bungie.PriorityCritical, 500},
+				{1, bungie.PriorityLow, 500},
+			},
+			want: []float64{95, 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &bungieBudget{rate: tt.rate}
+			for i, topic := range tt.topics {
+				addBudgetTopic(b, tt.name+string(rune('a'+i)), topic.weight, topic.priority, topic.workers)
+			}
+			b.rebalance()
+
+			var total float64
+			for i, topic := range b.topics {
+				total += topic.allocation
+				if !approx(topic.allocation, tt.want[i]) {
+					t.Errorf("topic %d allocation = %g, want %g", i, topic.allocation, tt.want[i])
+				}
+				if got, want := float64(topic.limiter.Limit()), topic.allocation/topic.weight; !approx(got, want) {
+					t.Errorf("topic %d limit = %g messages/s, want %g", i, got, want)
+				}
+			}
+			if total > tt.rate+1e-9 {
+				t.Errorf("allocated %g requests/s of a %g budget", total, tt.rate)
+			}
+		})
+	}
+}
+
+func TestBungieBudgetServiceRate(t *testing.T) {
+	b := &bungieBudget{rate: 100}
+	topic := addBudgetTopic(b, "budget_service_rate", 1, bungie.PriorityNormal, 4)
+
+	// Four messages that kept a worker busy for 2s in total: one worker finishes 2 messages/s
+	for range 4 {
+		hermes_metrics.QueueMessageProcessingDuration.WithLabelValues("budget_service_rate").Observe(0.5)
+	}
+	b.rebalance()
+	if !approx(topic.serviceRate, 2) {
+		t.Errorf("service rate = %g, want 2", topic.serviceRate)
+	}
+	if !approx(topic.demand, 8) {
+		t.Errorf("demand = %g, want 8", topic.demand)
+	}
+	// The whole budget is spare for the only topic: 100 requests/s at 2 messages/s per worker
+	if got := topic.maxWorkers(); got != 50 {
+		t.Errorf("maxWorkers() = %d, want 50", got)
+	}
+}
+
+func TestBungieBudgetUpdate(t *testing.T) {
+	b := &bungieBudget{rate: 100}
+	first := addBudgetTopic(b, "budget_update_first", 1, bungie.PriorityCritical, 500)
+	second := addBudgetTopic(b, "budget_update_second", 1, bungie.PriorityLow, 500)
+	b.rebalance()
+	if !approx(second.allocation, 5) {
+		t.Fatalf("low priority allocation = %g, want 5", second.allocation)
+	}
+
+	// A profile switch that raises the second topic's priority and lowers the first's demand
+	b.update(first, processing.TopicConfig{BungieRequestWeight: 1, BungiePriority: bungie.PriorityCritical}, 20)
+	b.update(second, processing.TopicConfig{BungieRequestWeight: 2, BungiePriority: bungie.PriorityHigh}, 500)
+	if second.priority != bungie.PriorityHigh || second.weight != 2 || second.wantedWorkers != 500 {
+		t.Errorf("second topic = %s weight %g wanting %d, want high weight 2 wanting 500", second.priority, second.weight, second.wantedWorkers)
+	}
+	if !approx(first.allocation, 20) || !approx(second.allocation, 80) {
+		t.Errorf("allocations = %g, %g, want 20, 80", first.allocation, second.allocation)
+	}
+
+	b.update(first, processing.TopicConfig{BungieRequestWeight: 1}, 20)
+	if first.priority != bungie.PriorityNormal {
+		t.Errorf("priority without one set = %s, want %s", first.priority, bungie.PriorityNormal)
+	}
+}
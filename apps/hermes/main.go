@@ -14,6 +14,8 @@ import (
 	qw "raidhub/lib/messaging/queue-workers"
 	"raidhub/lib/messaging/rabbit"
 	"raidhub/lib/monitoring"
+	"raidhub/lib/services/bungie_status"
+	"raidhub/lib/services/contest_profile"
 	"raidhub/lib/utils/logging"
 	"sync"
 	"syscall"
@@ -69,6 +71,10 @@ func main() {
 	rabbit.Wait()
 	publishing.Wait()
 
+	bungie_status.Start()
+	contest_profile.Start("Hermes")
+	startBungieBudget(ctx)
+
 	if err := verifyDelayedMessageExchangePlugin(); err != nil {
 		HermesLogger.Fatal("DELAYED_EXCHANGE_PLUGIN_NOT_ACTIVE", err, nil)
 		return
@@ -81,6 +87,7 @@ func main() {
 		qw.CharacterFillTopic(),
 		qw.ClanCrawlTopic(),
 		qw.PgcrCrawlTopic(),
+		qw.PgcrOffloadTopic(),
 		qw.InstanceCheatCheckTopic(),
 		qw.InstanceStoreTopic(),
 		qw.InstanceParticipantRefreshTopic(),
@@ -165,6 +172,8 @@ func main() {
 		mutex.Unlock()
 	}
 
+	registerAdminAPI(topicManagers, *metricsPort)
+
 	// Keep running until cancelled
 	HermesLogger.Info("ALL_TOPICS_STARTED", map[string]any{})
 	<-ctx.Done()
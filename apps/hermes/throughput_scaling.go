@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"raidhub/lib/messaging/processing"
+	"raidhub/lib/messaging/rabbit"
+	"raidhub/lib/monitoring/hermes_metrics"
+	"raidhub/lib/utils/logging"
+	"raidhub/lib/web/bungie"
+)
+
+const (
+	defaultThroughputHeadroom = 0.2
+	queueRatesTimeout         = 5 * time.Second
+
+	// A scale-up that raises throughput by less than this share of the proportional gain means the
+	// workers aren't the bottleneck (usually Bungie is)
+	saturationMinGain = 0.25
+	// A saturated topic is held for this many check intervals, doubling each time it saturates again
+	saturationBackoffChecks    = 6
+	saturationMaxBackoffChecks = 48
+)
+
+// throughputEstimate is what throughput scaling measured over the last check interval
+type throughputEstimate struct {
+	Time          time.Time `json:"time"`
+	ArrivalRate   float64   `json:"arrival_rate"`   // messages/s published to the queue
+	ArrivalSource string    `json:"arrival_source"` // publish_rate, or depth_change when the management API is unreachable
+	Throughput    float64   `json:"throughput"`     // messages/s this process finished
+	ServiceRate   float64   `json:"service_rate"`   // messages/s one busy worker finishes
+	TargetWorkers int       `json:"target_workers"` // before bounds; 0 until a message has finished
+
+	SaturatedAt    int        `json:"saturated_at,omitempty"` // worker ceiling while saturated
+	SaturatedUntil *time.Time `json:"saturated_until,omitempty"`
+}
+
+// scaleProbe is a scale-up whose effect on throughput is checked at the next interval
+type scaleProbe struct {
+	from, to int
+	before   float64 // throughput at from
+}
+
+// throughputState is throughput scaling's view of a topic between checks, guarded by scalingMutex
+type throughputState struct {
+	sampledAt    time.Time
+	count        uint64
+	sum          float64
+	depth        int
+	serviceRate  float64 // kept through intervals where nothing finished
+	ratesFailing bool
+	last         *throughputEstimate
+
+	probe        *scaleProbe
+	ceiling      int // 0 when not saturated
+	ceilingUntil time.Time
+	backoff      time.Duration
+}
+
+// sampleThroughput measures the topic over the interval since the last check. The service rate comes from
+// QueueMessageProcessingDuration and the arrival rate from the management API's publish rate, or from
+// completions plus the change in depth when that is unreachable. Returns nil on the first check, which
+// only sets the baseline.
+func (tm *TopicManager) sampleThroughput(queueDepth int) *throughputEstimate {
+	queueName := tm.topic.Config.QueueName
+	count, sum := hermes_metrics.ProcessingTotals(queueName)
+	ctx, cancel := context.WithTimeout(tm.Context(), queueRatesTimeout)
+	rates, ratesErr := rabbit.GetQueueRates(ctx, queueName)
+	cancel()
+	now := time.Now()
+
+	tm.scalingMutex.Lock()
+	defer tm.scalingMutex.Unlock()
+
+	ts := &tm.throughput
+	if ratesErr != nil && !ts.ratesFailing {
+		tm.Warn("QUEUE_RATES_UNAVAILABLE", ratesErr, map[string]any{
+			logging.REASON: "estimating arrivals from queue depth changes",
+		})
+	} else if ratesErr == nil && ts.ratesFailing {
+		tm.Info("QUEUE_RATES_RECOVERED", nil)
+	}
+	ts.ratesFailing = ratesErr != nil
+
+	prevAt, prevCount, prevSum, prevDepth := ts.sampledAt, ts.count, ts.sum, ts.depth
+	ts.sampledAt, ts.count, ts.sum, ts.depth = now, count, sum, queueDepth
+	elapsed := now.Sub(prevAt).Seconds()
+	if prevAt.IsZero() || count < prevCount || elapsed <= 0 {
+		return nil
+	}
+
+	completed := float64(count - prevCount)
+	if busy := sum - prevSum; completed > 0 && busy > 0 {
+		ts.serviceRate = completed / busy
+	}
+	est := &throughputEstimate{
+		Time:        now,
+		Throughput:  completed / elapsed,
+		ServiceRate: ts.serviceRate,
+	}
+	if ratesErr == nil {
+		est.ArrivalRate, est.ArrivalSource = rates.Publish, "publish_rate"
+	} else {
+		est.ArrivalRate, est.ArrivalSource = max(0, est.Throughput+float64(queueDepth-prevDepth)/elapsed), "depth_change"
+	}
+	est.TargetWorkers = throughputTarget(tm.config.Throughput, est, queueDepth)
+	ts.last = est
+	return est
+}
+
+// throughputTarget is the worker count that keeps up with arrivals plus headroom and meets the topic's
+// drain time and latency targets
+func throughputTarget(cfg *processing.ThroughputScaling, est *throughputEstimate, queueDepth int) int {
+	if est.ServiceRate <= 0 {
+		return 0
+	}
+	headroom := cfg.Headroom
+	if headroom <= 0 {
+		headroom = defaultThroughputHeadroom
+	}
+	workers := est.ArrivalRate * (1 + headroom) / est.ServiceRate
+	if cfg.DrainTime > 0 {
+		workers = max(workers, (est.ArrivalRate+float64(queueDepth)/cfg.DrainTime.Seconds())/est.ServiceRate)
+	}
+	if cfg.Latency > 0 {
+		workers = max(workers, float64(queueDepth)/(cfg.Latency.Seconds()*est.ServiceRate))
+	}
+	return int(math.Ceil(workers))
+}
+
+// shouldScaleForThroughput is shouldScaleWorkers for topics with Throughput set: it moves toward the
+// estimate's target, and backs the topic off when its last scale-up didn't raise throughput
+func (tm *TopicManager) shouldScaleForThroughput(est *throughputEstimate, queueDepth, currentWorkers int, blocked bool) (bool, string, int) {
+	tm.scalingMutex.Lock()
+	defer tm.scalingMutex.Unlock()
+
+	ts := &tm.throughput
+	now := time.Now()
+
+	if probe := ts.probe; probe != nil {
+		ts.probe = nil
+		// Only an interval where every worker had a message waiting and Bungie was up says anything
+		// about the workers that were added
+		if !blocked && queueDepth >= probe.to && currentWorkers == probe.to {
+			expected := probe.before * float64(probe.to-probe.from) / float64(probe.from)
+			if est.Throughput-probe.before < saturationMinGain*expected {
+				tm.saturate(probe, est, now)
+				return true, "down", probe.from
+			}
+			ts.backoff = 0
+		}
+	}
+
+	if ts.ceiling > 0 && !now.Before(ts.ceilingUntil) {
+		tm.Info("THROUGHPUT_SATURATION_EXPIRED", map[string]any{
+			"ceiling": ts.ceiling,
+		})
+		ts.ceiling = 0
+		hermes_metrics.QueueThroughputSaturated.WithLabelValues(tm.config.QueueName).Set(0)
+	}
+	if ts.ceiling > 0 {
+		until := ts.ceilingUntil
+		est.SaturatedAt, est.SaturatedUntil = ts.ceiling, &until
+	}
+
+	// Nothing has finished yet, or workers are waiting on Bungie and the rates say nothing about them
+	if est.TargetWorkers == 0 || blocked {
+		return false, "none", currentWorkers
+	}
+	if now.Sub(tm.scalingState.lastScaleTime) < tm.config.ScaleCooldown {
+		return false, "none", currentWorkers
+	}
+
+	target := min(max(est.TargetWorkers, tm.config.MinWorkers), tm.config.MaxWorkers)
+	if ts.ceiling > 0 {
+		target = min(target, max(ts.ceiling, tm.config.MinWorkers))
+	}
+
+	switch {
+	case target > currentWorkers:
+		tm.scalingState.consecutiveChecksDown = 0
+		tm.scalingState.consecutiveChecksUp++
+		if tm.scalingState.consecutiveChecksUp >= tm.config.ConsecutiveChecksUp {
+			return true, "up", min(target, currentWorkers+tm.config.MaxWorkersPerStep)
+		}
+		return false, "up", currentWorkers
+	case target < currentWorkers:
+		tm.scalingState.consecutiveChecksUp = 0
+		tm.scalingState.consecutiveChecksDown++
+		if tm.scalingState.consecutiveChecksDown >= tm.config.ConsecutiveChecksDown {
+			return true, "down", max(target, currentWorkers-tm.config.MaxWorkersPerStep)
+		}
+		return false, "down", currentWorkers
+	}
+
+	tm.scalingState.consecutiveChecksUp = 0
+	tm.scalingState.consecutiveChecksDown = 0
+	return false, "none", currentWorkers
+}
+
+// saturate caps the topic at the worker count it had before a scale-up that didn't pay off. Called with
+// scalingMutex held.
+func (tm *TopicManager) saturate(probe *scaleProbe, est *throughputEstimate, now time.Time) {
+	ts := &tm.throughput
+	if ts.backoff == 0 {
+		ts.backoff = saturationBackoffChecks * tm.config.ScaleCheckInterval
+	} else {
+		ts.backoff = min(ts.backoff*2, saturationMaxBackoffChecks*tm.config.ScaleCheckInterval)
+	}
+	ts.ceiling, ts.ceilingUntil = probe.from, now.Add(ts.backoff)
+	until := ts.ceilingUntil
+	est.SaturatedAt, est.SaturatedUntil = ts.ceiling, &until
+
+	hermes_metrics.QueueThroughputSaturated.WithLabelValues(tm.config.QueueName).Set(1)
+	tm.Warn("THROUGHPUT_SATURATED", nil, map[string]any{
+		logging.FROM:        probe.from,
+		logging.TO:          probe.to,
+		"throughput_before": probe.before,
+		"throughput_after":  est.Throughput,
+		logging.DURATION:    ts.backoff.String(),
+	})
+}
+
+// blockedOnBungie reports whether a Bungie system the topic depends on is down
+func blockedOnBungie(config processing.TopicConfig) bool {
+	for _, system := range config.BungieSystemDeps {
+		if !bungie.IsSystemAvailable(system) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"raidhub/lib/messaging/processing"
+)
+
+func TestThroughputTarget(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   processing.ThroughputScaling
+		est   throughputEstimate
+		depth int
+		want  int
+	}{
+		{"nothing finished yet", processing.ThroughputScaling{}, throughputEstimate{ArrivalRate: 10}, 0, 0},
+		{"default headroom", processing.ThroughputScaling{}, throughputEstimate{ArrivalRate: 10, ServiceRate: 1}, 0, 12},
+		{"custom headroom", processing.ThroughputScaling{Headroom: 0.5}, throughputEstimate{ArrivalRate: 10, ServiceRate: 1}, 0, 15},
+		{"rounds up", processing.ThroughputScaling{}, throughputEstimate{ArrivalRate: 1, ServiceRate: 3}, 0, 1},
+		{"drain time", processing.ThroughputScaling{DrainTime: time.Minute}, throughputEstimate{ArrivalRate: 10, ServiceRate: 1}, 600, 20},
+		{"drain time met by headroom", processing.ThroughputScaling{DrainTime: time.Hour}, throughputEstimate{ArrivalRate: 10, ServiceRate: 1}, 600, 12},
+		{"latency", processing.ThroughputScaling{Latency: 30 * time.Second}, throughputEstimate{ServiceRate: 2}, 600, 10},
+		{"latency with idle queue", processing.ThroughputScaling{Latency: 30 * time.Second}, throughputEstimate{ArrivalRate: 5, ServiceRate: 1}, 0, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := throughputTarget(&tt.cfg, &tt.est, tt.depth); got != tt.want {
+				t.Errorf("throughputTarget() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func newThroughputTopicManager(t *testing.T) *TopicManager {
+	t.Helper()
+	tm := newTestTopicManager(t, 0)
+	tm.config.Throughput = &processing.ThroughputScaling{}
+	tm.config.MaxWorkers = 20
+	tm.config.ScaleCooldown = 0
+	tm.config.ConsecutiveChecksUp = 1
+	tm.config.ConsecutiveChecksDown = 1
+	return tm
+}
+
+func TestSaturationBackoff(t *testing.T) {
+	tm := newThroughputTopicManager(t)
+	interval := tm.config.ScaleCheckInterval
+
+	// Going from 4 to 8 workers only took throughput from 10 to 11 messages/s
+	saturateOnce := func() (bool, string, int) {
+		tm.throughput.probe = &scaleProbe{from: 4, to: 8, before: 10}
+		return tm.shouldScaleForThroughput(&throughputEstimate{Throughput: 11, TargetWorkers: 16}, 100, 8, false)
+	}
+
+	scale, direction, target := saturateOnce()
+	if !scale || direction != "down" || target != 4 {
+		t.Fatalf("after a scale-up that didn't pay off = (%v, %s, %d), want (true, down, 4)", scale, direction, target)
+	}
+	if tm.throughput.ceiling != 4 || tm.throughput.backoff != saturationBackoffChecks*interval {
+		t.Errorf("ceiling = %d, backoff = %s, want 4, %s", tm.throughput.ceiling, tm.throughput.backoff, saturationBackoffChecks*interval)
+	}
+
+	// Held at the ceiling while it lasts
+	est := &throughputEstimate{Throughput: 10, TargetWorkers: 16}
+	if scale, _, _ := tm.shouldScaleForThroughput(est, 100, 4, false); scale {
+		t.Error("scaled past the saturation ceiling")
+	}
+	if est.SaturatedAt != 4 || est.SaturatedUntil == nil {
+		t.Errorf("estimate saturated at %d until %v, want 4 and a time", est.SaturatedAt, est.SaturatedUntil)
+	}
+
+	// Saturating again doubles the backoff, up to its cap
+	saturateOnce()
+	if want := 2 * saturationBackoffChecks * interval; tm.throughput.backoff != want {
+		t.Errorf("backoff after saturating twice = %s, want %s", tm.throughput.backoff, want)
+	}
+	for range 5 {
+		saturateOnce()
+	}
+	if want := saturationMaxBackoffChecks * interval; tm.throughput.backoff != want {
+		t.Errorf("backoff after saturating repeatedly = %s, want %s", tm.throughput.backoff, want)
+	}
+
+	// Once the ceiling expires the topic scales toward its target again
+	tm.throughput.ceilingUntil = time.Now().Add(-time.Second)
+	scale, direction, target = tm.shouldScaleForThroughput(&throughputEstimate{Throughput: 10, TargetWorkers: 16}, 100, 4, false)
+	if !scale || direction != "up" || target != 14 {
+		t.Errorf("after the ceiling expired = (%v, %s, %d), want (true, up, 14)", scale, direction, target)
+	}
+	if tm.throughput.ceiling != 0 {
+		t.Errorf("ceiling = %d after expiring, want 0", tm.throughput.ceiling)
+	}
+}
+
+func TestScaleProbe(t *testing.T) {
+	tests := []struct {
+		name      string
+		after     float64
+		depth     int
+		current   int
+		blocked   bool
+		saturated bool
+		backoff   time.Duration
+	}{
+		{"throughput rose", 18, 100, 8, false, false, 0},
+		{"throughput flat", 11, 100, 8, false, true, 2 * time.Minute},
+		{"blocked on bungie", 11, 100, 8, true, false, time.Minute},
+		{"queue ran dry", 11, 5, 8, false, false, time.Minute},
+		{"worker count changed", 11, 100, 6, false, false, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := newThroughputTopicManager(t)
+			tm.throughput.backoff = time.Minute
+			tm.throughput.probe = &scaleProbe{from: 4, to: 8, before: 10}
+			tm.shouldScaleForThroughput(&throughputEstimate{Throughput: tt.after, TargetWorkers: 8}, tt.depth, tt.current, tt.blocked)
+
+			if tm.throughput.probe != nil {
+				t.Error("probe wasn't consumed")
+			}
+			if saturated := tm.throughput.ceiling > 0; saturated != tt.saturated {
+				t.Errorf("saturated = %v, want %v", saturated, tt.saturated)
+			}
+			if tm.throughput.backoff != tt.backoff {
+				t.Errorf("backoff = %s, want %s", tm.throughput.backoff, tt.backoff)
+			}
+		})
+	}
+}
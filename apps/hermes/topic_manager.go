@@ -2,13 +2,16 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"raidhub/lib/messaging/processing"
 	"raidhub/lib/messaging/rabbit"
+	"raidhub/lib/messaging/routing"
 	"raidhub/lib/monitoring/hermes_metrics"
+	"raidhub/lib/services/contest_profile"
 	"raidhub/lib/utils"
 	"raidhub/lib/utils/logging"
 	"raidhub/lib/utils/sentry"
@@ -18,7 +21,7 @@ import (
 )
 
 // Shared delayed exchange for all retry messages; queues bind with routing key = queue name
-const delayedExchangeName = "hermes.delayed"
+const delayedExchangeName = routing.DelayedExchange
 
 // verifyDelayedMessageExchangePlugin ensures rabbitmq_delayed_message_exchange is active
 // by declaring the delayed exchange. Fails fast at startup if the plugin is not enabled.
@@ -53,21 +56,39 @@ type scalingState struct {
 	consecutiveChecksDown int
 	cachedQueueDepth      int       // Cached queue depth for fallback
 	cachedQueueDepthTime  time.Time // When cached depth was retrieved
+	lastDecision          *scalingDecision
+}
+
+// scalingDecision is a scaling action the manager took, as reported by the admin API
+type scalingDecision struct {
+	Time       time.Time `json:"time"`
+	Direction  string    `json:"direction"`
+	From       int       `json:"from"`
+	To         int       `json:"to"`
+	QueueDepth int       `json:"queue_depth"`
 }
 
 // TopicManager manages a single topic with self-scaling worker goroutines
 type TopicManager struct {
 	topic  processing.Topic
-	config processing.TopicConfig
+	config processing.TopicConfig // config of the profile in effect; written under both mutex and scalingMutex
 	ctx    context.Context
 	apiWG  *utils.ReadOnlyWaitGroup
 
+	// baseConfig is the topic's normal profile config, which the contest overrides apply to
+	baseConfig processing.TopicConfig
+	contest    bool // the contest profile is in effect, guarded by mutex
+
 	// All fields are private to encapsulate the manager's internal state
 	activeWorkers int
 	workers       map[int]*Worker // Map of worker ID to Worker struct
 	mutex         sync.RWMutex
 	logger        logging.Logger
 
+	// scaleMutex serializes changes to the worker count (scaling, pause, resume, drain), since
+	// scaleToInternal drops mutex while it starts workers. Taken before mutex.
+	scaleMutex sync.Mutex
+
 	// Scaling state for dead zone and cooldown
 	scalingState scalingState
 	scalingMutex sync.Mutex // Separate mutex for scaling state to avoid blocking worker operations
@@ -75,13 +96,25 @@ type TopicManager struct {
 	// Dedicated channel for queue depth checks (reused, thread-safe)
 	depthCheckChannel *amqp.Channel
 	depthChannelMutex sync.RWMutex
+
+	// Operator overrides from the admin API, guarded by mutex. Autoscaling is held while any is set.
+	pinnedWorkers int  // 0 when not pinned
+	paused        bool // no workers are consuming
+	draining      bool // consumers are cancelled and workers are finishing what they were delivered
+	resumeWorkers int  // worker count to restore on resume
+
+	// Rates and saturation for topics with Throughput set, guarded by scalingMutex
+	throughput throughputState
+
+	// budget is the topic's share of the Hermes Bungie budget, nil when it doesn't draw on one
+	budget *topicBudget
 }
 
 func (tm *TopicManager) addTopicFields(fields map[string]any) map[string]any {
 	if fields == nil {
 		fields = make(map[string]any)
 	}
-	fields["topic"] = tm.config.QueueName
+	fields["topic"] = tm.topic.Config.QueueName
 	return fields
 }
 
@@ -104,7 +137,15 @@ func (tm *TopicManager) Error(message string, err error, fields map[string]any)
 
 // GetInitialWorkers returns the initial worker count for this topic
 func (tm *TopicManager) GetInitialWorkers() int {
-	return tm.config.DesiredWorkers
+	return tm.currentConfig().DesiredWorkers
+}
+
+// currentConfig returns a copy of the config of the profile in effect, for callers that hold neither
+// mutex nor scalingMutex
+func (tm *TopicManager) currentConfig() processing.TopicConfig {
+	tm.scalingMutex.Lock()
+	defer tm.scalingMutex.Unlock()
+	return tm.config
 }
 
 func (tm *TopicManager) Context() context.Context {
@@ -175,6 +216,12 @@ func startTopicManager(topic processing.Topic, ctx context.Context) (*TopicManag
 		topicConfig.MinWorkers = 1
 	}
 
+	baseConfig := topicConfig
+	contest := contest_profile.Active()
+	if contest {
+		topicConfig = baseConfig.ForContest()
+	}
+
 	// Get API availability monitor if needed
 	var apiWG *utils.ReadOnlyWaitGroup
 	if len(topicConfig.BungieSystemDeps) > 0 {
@@ -186,12 +233,15 @@ func startTopicManager(topic processing.Topic, ctx context.Context) (*TopicManag
 		activeWorkers: 0,
 		workers:       make(map[int]*Worker),
 		config:        topicConfig,
+		baseConfig:    baseConfig,
+		contest:       contest,
 		logger:        HermesLogger,
 		scalingState: scalingState{
 			lastScaleDirection: "none",
 		},
-		ctx:   ctx,
-		apiWG: apiWG,
+		ctx:    ctx,
+		apiWG:  apiWG,
+		budget: hermesBudget.register(topicConfig),
 	}
 
 	// Start with initial worker count
@@ -206,6 +256,9 @@ func startTopicManager(topic processing.Topic, ctx context.Context) (*TopicManag
 	// Start goroutine to manually cancel all workers when TopicManager context is cancelled
 	go topicManager.handleShutdown()
 
+	// Swap configs when the contest profile switches
+	contest_profile.OnSwitch(topicManager.applyProfile)
+
 	// Start self-scaling monitor
 	go func() {
 		topicManager.monitorSelfScaling()
@@ -216,18 +269,44 @@ func startTopicManager(topic processing.Topic, ctx context.Context) (*TopicManag
 
 // scaleToInitial scales to the target number of workers during initial startup (no logging)
 func (tm *TopicManager) scaleToInitial(targetWorkers int) error {
-	return tm.scaleToInternal(targetWorkers, true)
+	tm.scaleMutex.Lock()
+	defer tm.scaleMutex.Unlock()
+	return tm.scaleToInternal(targetWorkers, true, false)
 }
 
 // scaleTo scales to the target number of workers
 func (tm *TopicManager) scaleTo(targetWorkers int) error {
-	return tm.scaleToInternal(targetWorkers, false)
+	tm.scaleMutex.Lock()
+	defer tm.scaleMutex.Unlock()
+	return tm.scaleToInternal(targetWorkers, false, false)
+}
+
+// autoscaleTo scales to the target number of workers unless the count was held since autoscaling
+// decided on it, in which case it returns errAutoscaleHeld
+func (tm *TopicManager) autoscaleTo(targetWorkers int) error {
+	tm.scaleMutex.Lock()
+	defer tm.scaleMutex.Unlock()
+	return tm.scaleToInternal(targetWorkers, false, true)
+}
+
+// autoscaleHeld reports whether an operator or the contest profile has taken over the worker count.
+// Called with mutex held.
+func (tm *TopicManager) autoscaleHeld() bool {
+	return tm.pinnedWorkers > 0 || tm.paused || tm.draining || (tm.contest && !tm.config.Contest.Autoscale)
 }
 
-// scaleToInternal scales to the target number of workers
-func (tm *TopicManager) scaleToInternal(targetWorkers int, isInitial bool) error {
+// scaleToInternal scales to the target number of workers. A paused or draining topic is left alone;
+// Resume restores its worker count. An autoscale request is dropped when the count is held, checked
+// under the same lock a Pin takes. Called with scaleMutex held.
+func (tm *TopicManager) scaleToInternal(targetWorkers int, isInitial bool, autoscale bool) error {
 	tm.mutex.Lock()
 	defer tm.mutex.Unlock()
+	if autoscale && tm.autoscaleHeld() {
+		return errAutoscaleHeld
+	}
+	if tm.paused || tm.draining {
+		return nil
+	}
 
 	// Ensure we stay within min/max bounds
 	if targetWorkers < tm.config.MinWorkers {
@@ -293,6 +372,7 @@ func (tm *TopicManager) scaleToInternal(targetWorkers int, isInitial bool) error
 // startWorkerGoroutine opens a new RabbitMQ channel, declares queue/bind/consume, and starts Run.
 // The caller must set tm.workers[id] and then call go waitForWorkerLifecycle(worker) so recovery sees the worker in the map.
 func (tm *TopicManager) startWorkerGoroutine(workerID int) (*Worker, error) {
+	config := tm.currentConfig()
 	ch, err := rabbit.Conn.Channel()
 	if err != nil {
 		return nil, err
@@ -300,7 +380,7 @@ func (tm *TopicManager) startWorkerGoroutine(workerID int) (*Worker, error) {
 
 	// Declare queue
 	q, err := ch.QueueDeclare(
-		tm.config.QueueName,
+		config.QueueName,
 		true,  // durable
 		false, // delete when unused
 		false, // exclusive
@@ -313,6 +393,20 @@ func (tm *TopicManager) startWorkerGoroutine(workerID int) (*Worker, error) {
 		return nil, err
 	}
 
+	// Declare the dead letter queue, where workers park messages they give up on
+	_, err = ch.QueueDeclare(
+		routing.DeadLetterQueue(q.Name),
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+
 	// Declare shared delayed exchange for retry messages (idempotent - first caller creates it)
 	err = ch.ExchangeDeclare(
 		delayedExchangeName,
@@ -344,8 +438,8 @@ func (tm *TopicManager) startWorkerGoroutine(workerID int) (*Worker, error) {
 	}
 
 	// Set QoS if needed
-	if tm.config.KeepInReady {
-		prefetch := max(1, tm.config.PrefetchCount)
+	if config.KeepInReady {
+		prefetch := max(1, config.PrefetchCount)
 		err = ch.Qos(prefetch, 0, false)
 		if err != nil {
 			ch.Close()
@@ -353,14 +447,21 @@ func (tm *TopicManager) startWorkerGoroutine(workerID int) (*Worker, error) {
 		}
 	}
 
+	// Publisher confirms, so a message is only acked once its dead letter copy is stored
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	consumerTag := fmt.Sprintf("hermes-%s-%d-%d", q.Name, workerID, time.Now().UnixNano())
 	msgs, err := ch.Consume(
 		q.Name,
-		"",    // consumer
-		false, // auto-ack
-		false, // exclusive
-		false, // no-local
-		false, // no-wait
-		nil,   // args
+		consumerTag, // consumer
+		false,       // auto-ack
+		false,       // exclusive
+		false,       // no-local
+		false,       // no-wait
+		nil,         // args
 	)
 	if err != nil {
 		ch.Close()
@@ -368,14 +469,15 @@ func (tm *TopicManager) startWorkerGoroutine(workerID int) (*Worker, error) {
 	}
 
 	// Create worker context independently - TopicManager will manually cancel it on shutdown
-	workerCtx, workerCancel := context.WithCancelCause(context.Background())
+	// Its Bungie requests carry the topic's priority class to Zeus
+	workerCtx, workerCancel := context.WithCancelCause(bungie.WithPriority(context.Background(), tm.topic.Config.BungiePriority))
 
 	// Create Worker struct for this goroutine
 	// Use the managerConfig which already has the API availability wait group if enabled
 
 	worker := &Worker{
 		ID:                  workerID,
-		QueueName:           tm.config.QueueName,
+		QueueName:           config.QueueName,
 		wg:                  tm.apiWG,
 		Topic:               tm.topic,
 		logger:              HermesLogger,
@@ -386,6 +488,9 @@ func (tm *TopicManager) startWorkerGoroutine(workerID int) (*Worker, error) {
 		processor:           tm.topic.Processor,
 		done:                make(chan struct{}),
 		delayedExchangeName: delayedExchangeName,
+		consumerTag:         consumerTag,
+		retryDelay:          tm.retryDelay,
+		budget:              tm.budget,
 	}
 
 	// Start worker goroutine with panic recovery (caller registers waitForWorkerLifecycle after tm.workers[id] is set)
@@ -405,7 +510,8 @@ func (tm *TopicManager) waitForWorkerLifecycle(w *Worker) {
 		return
 	}
 	// Shutdown or other cancellation: worker stays in map until WaitForWorkersToFinish.
-	if w.Context().Err() != nil || tm.Context().Err() != nil {
+	// A drained worker is removed by the drain.
+	if w.Context().Err() != nil || tm.Context().Err() != nil || w.draining.Load() {
 		tm.mutex.Unlock()
 		return
 	}
@@ -447,6 +553,11 @@ func (tm *TopicManager) waitForWorkerLifecycle(w *Worker) {
 		hermes_metrics.QueueWorkerCount.WithLabelValues(tm.config.QueueName).Set(float64(tm.activeWorkers))
 		return
 	}
+	// The topic was paused or drained while the replacement started
+	if tm.paused || tm.draining {
+		replacement.cancel(errors.New(ADMIN_PAUSED))
+		return
+	}
 
 	tm.workers[w.ID] = replacement
 	tm.activeWorkers++
@@ -459,12 +570,17 @@ func (tm *TopicManager) waitForWorkerLifecycle(w *Worker) {
 	go tm.waitForWorkerLifecycle(replacement)
 }
 
+// errAutoscaleHeld is returned by autoscaleTo when the worker count was held before it could scale
+var errAutoscaleHeld = errors.New("worker count is held")
+
 // monitorSelfScaling monitors queue depth and scales workers with improved dead zone and cooldown logic
 func (tm *TopicManager) monitorSelfScaling() {
-	ticker := time.NewTicker(tm.config.ScaleCheckInterval)
+	ticker := time.NewTicker(tm.currentConfig().ScaleCheckInterval)
 	defer ticker.Stop()
 
 	for range ticker.C {
+		// One snapshot per check, so an admin change or profile switch mid-check doesn't mix configs
+		config := tm.currentConfig()
 		queueDepth, err := tm.getQueueDepthWithRetry()
 		if err != nil {
 			tm.logger.Error("QUEUE_DEPTH_ERROR", err, nil)
@@ -472,7 +588,7 @@ func (tm *TopicManager) monitorSelfScaling() {
 			tm.scalingMutex.Lock()
 			cachedDepth := tm.scalingState.cachedQueueDepth
 			cacheAge := time.Since(tm.scalingState.cachedQueueDepthTime)
-			maxCacheAge := tm.config.ScaleCheckInterval * 2
+			maxCacheAge := config.ScaleCheckInterval * 2
 			tm.scalingMutex.Unlock()
 
 			if cachedDepth > 0 && cacheAge < maxCacheAge {
@@ -495,29 +611,60 @@ func (tm *TopicManager) monitorSelfScaling() {
 
 		tm.mutex.RLock()
 		currentWorkers := tm.activeWorkers
+		held := tm.autoscaleHeld()
 		tm.mutex.RUnlock()
 
 		// Export metrics
-		hermes_metrics.QueueDepth.WithLabelValues(tm.config.QueueName).Set(float64(queueDepth))
-		hermes_metrics.QueueWorkerCount.WithLabelValues(tm.config.QueueName).Set(float64(currentWorkers))
+		hermes_metrics.QueueDepth.WithLabelValues(config.QueueName).Set(float64(queueDepth))
+		hermes_metrics.QueueWorkerCount.WithLabelValues(config.QueueName).Set(float64(currentWorkers))
+
+		// Throughput scaling samples every check, held or not, so each estimate covers one interval
+		var estimate *throughputEstimate
+		if config.Throughput != nil {
+			estimate = tm.sampleThroughput(queueDepth)
+		}
+
+		// An operator has taken over the worker count
+		if held {
+			if tm.budget != nil {
+				hermesBudget.want(tm.budget, currentWorkers)
+			}
+			continue
+		}
 
 		// Check if scaling should happen with dead zone and cooldown
-		shouldScale, direction, targetWorkers := tm.shouldScaleWorkers(queueDepth, currentWorkers)
+		shouldScale, direction, targetWorkers := false, "none", currentWorkers
+		if config.Throughput == nil {
+			shouldScale, direction, targetWorkers = tm.shouldScaleWorkers(queueDepth, currentWorkers)
+		} else if estimate != nil {
+			shouldScale, direction, targetWorkers = tm.shouldScaleForThroughput(estimate, queueDepth, currentWorkers, blockedOnBungie(config))
+		}
+		shouldScale, targetWorkers = tm.fitToBudget(shouldScale, direction, currentWorkers, targetWorkers)
 		if !shouldScale {
 			continue
 		}
 
-		tm.Info("SCALING_WORKERS", map[string]any{
+		scalingFields := map[string]any{
 			logging.QUEUE_DEPTH: queueDepth,
 			logging.FROM:        currentWorkers,
 			logging.TO:          targetWorkers,
 			"direction":         direction,
-		})
+		}
+		if estimate != nil {
+			scalingFields["arrival_rate"] = estimate.ArrivalRate
+			scalingFields["service_rate"] = estimate.ServiceRate
+			scalingFields["throughput"] = estimate.Throughput
+		}
+		err = tm.autoscaleTo(targetWorkers)
+		if errors.Is(err, errAutoscaleHeld) {
+			// Pinned, paused, or switched profile since the check above; the next check sees it
+			continue
+		}
+		tm.Info("SCALING_WORKERS", scalingFields)
 
 		// Record scaling decision metric
-		hermes_metrics.QueueScalingDecisions.WithLabelValues(tm.config.QueueName, direction).Inc()
+		hermes_metrics.QueueScalingDecisions.WithLabelValues(config.QueueName, direction).Inc()
 
-		err = tm.scaleTo(targetWorkers)
 		if err != nil {
 			tm.Warn("SCALING_FAILED", err, map[string]any{
 				"target_workers": targetWorkers,
@@ -530,6 +677,17 @@ func (tm *TopicManager) monitorSelfScaling() {
 			tm.scalingState.lastQueueDepth = queueDepth
 			tm.scalingState.consecutiveChecksUp = 0
 			tm.scalingState.consecutiveChecksDown = 0
+			tm.scalingState.lastDecision = &scalingDecision{
+				Time:       tm.scalingState.lastScaleTime,
+				Direction:  direction,
+				From:       currentWorkers,
+				To:         targetWorkers,
+				QueueDepth: queueDepth,
+			}
+			// Check at the next interval whether the added workers raised throughput
+			if estimate != nil && direction == "up" && estimate.Throughput > 0 && queueDepth >= currentWorkers {
+				tm.throughput.probe = &scaleProbe{from: currentWorkers, to: targetWorkers, before: estimate.Throughput}
+			}
 			tm.scalingMutex.Unlock()
 		}
 	}
@@ -679,7 +837,7 @@ func (tm *TopicManager) getQueueDepth() (int, error) {
 	}
 
 	q, err := ch.QueueDeclare(
-		tm.config.QueueName,
+		tm.topic.Config.QueueName,
 		true,  // durable
 		false, // delete when unused
 		false, // exclusive
@@ -699,6 +857,67 @@ func (tm *TopicManager) getQueueDepth() (int, error) {
 	return q.Messages, nil
 }
 
+// applyProfile swaps in the config of the profile that just took effect and moves the topic to that
+// profile's desired worker count (or its pin). Scaling changes made through the admin API don't carry over.
+func (tm *TopicManager) applyProfile(s contest_profile.Switch) {
+	if tm.Context().Err() != nil {
+		return
+	}
+	config, profile := tm.baseConfig, contest_profile.Normal
+	if s.Active {
+		config, profile = config.ForContest(), contest_profile.Contest
+	}
+
+	tm.mutex.Lock()
+	tm.scalingMutex.Lock()
+	tm.config = config
+	tm.scalingState.consecutiveChecksUp = 0
+	tm.scalingState.consecutiveChecksDown = 0
+	tm.scalingMutex.Unlock()
+	tm.contest = s.Active
+	target := config.DesiredWorkers
+	if tm.pinnedWorkers > 0 {
+		target = tm.pinnedWorkers
+	}
+	current := tm.activeWorkers
+	stopped := tm.paused || tm.draining
+	if stopped {
+		tm.resumeWorkers = target
+	}
+	tm.mutex.Unlock()
+	if tm.budget != nil {
+		hermesBudget.update(tm.budget, config, target)
+	}
+
+	tm.Info("TOPIC_PROFILE_SWITCHED", map[string]any{
+		"profile":      profile,
+		logging.SOURCE: s.Source,
+		logging.FROM:   current,
+		logging.TO:     target,
+		"autoscale":    !s.Active || config.Contest.Autoscale,
+	})
+	if stopped {
+		return
+	}
+	if err := tm.scaleTo(target); err != nil {
+		tm.Warn("SCALING_FAILED", err, map[string]any{
+			"target_workers": target,
+		})
+	}
+}
+
+// retryDelay returns how long a failed message waits before its next attempt under the profile in
+// effect. Reads the config under scalingMutex so workers never wait on the worker map lock.
+func (tm *TopicManager) retryDelay(newRetryCount int) time.Duration {
+	tm.scalingMutex.Lock()
+	delayFn := tm.config.RetryDelay
+	tm.scalingMutex.Unlock()
+	if delayFn == nil {
+		delayFn = processing.ExponentialRetryDelay(time.Second)
+	}
+	return delayFn(newRetryCount)
+}
+
 // handleShutdown watches the TopicManager context and manually cancels all workers when shutdown is requested
 func (tm *TopicManager) handleShutdown() {
 	<-tm.Context().Done()
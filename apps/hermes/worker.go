@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"raidhub/lib/messaging/processing"
+	"raidhub/lib/messaging/routing"
 	"raidhub/lib/monitoring/hermes_metrics"
 	"raidhub/lib/utils"
 	"raidhub/lib/utils/logging"
@@ -17,6 +19,7 @@ import (
 const (
 	WORKER_STOPPING = "WORKER_STOPPING"
 	AUTOSCALE_IN    = "autoscaled_in"
+	ADMIN_PAUSED    = "admin_paused"
 )
 
 // Worker represents a message processing worker with structured logging
@@ -37,6 +40,12 @@ type Worker struct {
 	done                chan struct{}  // Channel that closes when worker is finished
 	currentMsg          *amqp.Delivery // Current message being processed (for retry count tracking)
 	delayedExchangeName string         // Name of the delayed exchange for retry messages
+	consumerTag         string         // Tag of this worker's consumer, for cancelling it on drain
+	draining            atomic.Bool    // Set once the consumer is cancelled; the worker stops when its deliveries run out
+	// Retry delay of the topic's current profile
+	retryDelay func(newRetryCount int) time.Duration
+	// The topic's share of the Hermes Bungie budget, nil when it doesn't draw on one
+	budget *topicBudget
 }
 
 // Run starts the worker and kicks off the polling
@@ -58,6 +67,12 @@ func (w *Worker) Run() {
 			return
 		case msg, ok := <-w.channel:
 			if !ok {
+				if w.draining.Load() {
+					w.Debug(WORKER_STOPPING, map[string]any{
+						logging.REASON: "drained",
+					})
+					return
+				}
 				// Check if this is a natural shutdown (context cancelled) or unexpected channel closure
 				select {
 				case <-w.ctx.Done():
@@ -84,6 +99,14 @@ func (w *Worker) handleMessage(msg amqp.Delivery) {
 		w.wg.Wait()
 	}
 
+	// Wait for the topic's share of the Bungie budget
+	if w.budget != nil {
+		if err := w.budget.limiter.Wait(w.ctx); err != nil {
+			// Stopping; the unacked message goes back to the queue when the channel closes
+			return
+		}
+	}
+
 	err := w.ProcessMessage(msg)
 	if err != nil {
 		retryCount := w.getRetryCount(msg)
@@ -105,7 +128,7 @@ func (w *Worker) handleMessage(msg amqp.Delivery) {
 		// Handle based on error type
 		if processing.IsUnretryableError(err) {
 			w.logUnretryableMessage(msg, err)
-			w.handleUnretryableError(msg)
+			w.handleUnretryableError(msg, retryCount, err)
 		} else {
 			// Increment retry count and republish for retryable errors
 			newRetryCount := retryCount + 1
@@ -151,6 +174,13 @@ func (w *Worker) ScaleIn() {
 	w.cancel(errors.New(AUTOSCALE_IN))
 }
 
+// Drain stops this worker taking new messages. It finishes the ones already delivered to it and then
+// stops; unlike ScaleIn, its context stays live so in-flight work completes.
+func (w *Worker) Drain() error {
+	w.draining.Store(true)
+	return w.amqpChannel.Cancel(w.consumerTag, false)
+}
+
 func (w *Worker) ProcessMessage(message amqp.Delivery) error {
 	// Store current message for retry count tracking in logs
 	w.currentMsg = &message
@@ -169,12 +199,7 @@ func (w *Worker) ProcessMessage(message amqp.Delivery) error {
 }
 
 func (w *Worker) getRetryCount(msg amqp.Delivery) int {
-	if count, ok := msg.Headers["x-retry-count"].(int32); ok && count > 0 {
-		return int(count)
-	} else if count, ok := msg.Headers["x-retry-count"].(int64); ok && count > 0 {
-		return int(count)
-	}
-	return 0
+	return processing.RetryCount(msg)
 }
 
 func (w *Worker) addWorkerFields(fields map[string]any) map[string]any {
@@ -223,12 +248,12 @@ func (w *Worker) shouldDeadLetter(msg amqp.Delivery, retryCount int) bool {
 		retryCount >= w.Topic.Config.MaxRetryCount)
 }
 
-// dropMessage permanently drops messages that exceed retry limits
+// dropMessage moves messages that exceed retry limits to the dead letter queue
 func (w *Worker) dropMessage(msg amqp.Delivery, retryCount int, maxRetries int, processingErr error) {
 	fields := map[string]any{
 		"retry_count":     retryCount,
 		"max_retries":     maxRetries,
-		"action":          "dropping_message",
+		"action":          "dead_lettering_message",
 		"routing_key":     msg.RoutingKey,
 		"delivery_tag":    msg.DeliveryTag,
 		"unretryable_err": processing.IsUnretryableError(processingErr),
@@ -241,10 +266,39 @@ func (w *Worker) dropMessage(msg amqp.Delivery, retryCount int, maxRetries int,
 	}
 	w.Error("MESSAGE_EXCEEDED_MAX_RETRIES", processingErr, fields)
 
-	// Nack with requeue=false to permanently drop the message
-	// This prevents infinite retry loops
-	if err := msg.Nack(false, false); err != nil {
-		w.Fatal("MESSAGE_NACK_ERROR", err, nil)
+	// Taking the message off the queue prevents infinite retry loops
+	w.deadLetter(msg, processing.DeadLetterMaxRetries, retryCount, processingErr)
+}
+
+// deadLetter publishes msg to the topic's dead letter queue, stamped with why it got there, and acks it
+// once the broker confirms the copy. If the copy isn't confirmed, msg goes back on the queue instead.
+func (w *Worker) deadLetter(msg amqp.Delivery, reason string, retryCount int, processingErr error) {
+	confirm, err := w.amqpChannel.PublishWithDeferredConfirmWithContext(w.ctx,
+		"",                                   // default exchange
+		routing.DeadLetterQueue(w.QueueName), // routing key (dead letter queue name)
+		false,                                // mandatory
+		false,                                // immediate
+		processing.DeadLetterPublishing(msg, w.QueueName, reason, retryCount, processingErr),
+	)
+	if err == nil {
+		var confirmed bool
+		if confirmed, err = confirm.WaitContext(w.ctx); err == nil && !confirmed {
+			err = errors.New("broker nacked the dead letter publish")
+		}
+	}
+	if err != nil {
+		w.Error("MESSAGE_DEAD_LETTER_ERROR", err, map[string]any{
+			logging.ACTION: "requeueing_message",
+		})
+		if err := msg.Nack(false, true); err != nil {
+			w.Warn("MESSAGE_NACK_ERROR", err, nil)
+		}
+		return
+	}
+	hermes_metrics.QueueMessagesDeadLettered.WithLabelValues(w.QueueName, reason).Inc()
+
+	if err := msg.Ack(false); err != nil {
+		w.Warn("MESSAGE_ACK_ERROR", err, nil)
 	}
 }
 
@@ -255,11 +309,7 @@ func (w *Worker) republishForRetry(msg amqp.Delivery, newRetryCount int) error {
 	}
 	msg.Headers["x-retry-count"] = int32(newRetryCount)
 
-	delayFn := w.Topic.Config.RetryDelay
-	if delayFn == nil {
-		delayFn = processing.ExponentialRetryDelay(time.Second)
-	}
-	d := delayFn(newRetryCount)
+	d := w.retryDelay(newRetryCount)
 	delayMs := d.Milliseconds()
 	if delayMs < 1000 {
 		delayMs = 1000
@@ -288,12 +338,9 @@ func (w *Worker) republishForRetry(msg amqp.Delivery, newRetryCount int) error {
 }
 
 // handleUnretryableError handles permanent processing failures
-func (w *Worker) handleUnretryableError(msg amqp.Delivery) {
-	// NACK with requeue=false for unretryable errors (permanent failures)
-	// The message will be sent to the dead letter queue if configured
-	if err := msg.Nack(false, false); err != nil {
-		w.Fatal("MESSAGE_NACK_ERROR", err, nil)
-	}
+func (w *Worker) handleUnretryableError(msg amqp.Delivery, retryCount int, processingErr error) {
+	// Unretryable errors (permanent failures) go straight to the dead letter queue
+	w.deadLetter(msg, processing.DeadLetterUnretryable, retryCount, processingErr)
 }
 
 func (w *Worker) logUnretryableMessage(msg amqp.Delivery, err error) {
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"raidhub/lib/monitoring/zeus_metrics"
+	"raidhub/lib/utils/logging"
+)
+
+const (
+	// aimdDecrease is the factor the rate is cut by on a throttle signal
+	aimdDecrease = 0.5
+	// aimdIncrease is the rate added after a full second's worth of successful requests
+	aimdIncrease = 1.0
+	// aimdDecreaseInterval keeps one burst of throttled responses from cutting the rate more than once
+	aimdDecreaseInterval = 2 * time.Second
+	// throttleBodyBytes is how much of an error response is read looking for Bungie throttle codes
+	throttleBodyBytes = 64 << 10
+)
+
+// rateBounds are the floor and ceiling an adaptive limiter moves between, in requests per second
+type rateBounds struct {
+	floor   float64
+	ceiling float64
+}
+
+// adaptiveLimiter is the rate limiter of one source IP for one endpoint class. It halves its rate when
+// Bungie signals throttling and adds to it after sustained success (AIMD). A throttled IP is also
+// benched: round robin skips it until the bench expires.
+type adaptiveLimiter struct {
+	*rate.Limiter
+	ip       string
+	class    string // "stats" or "www"
+	bounds   rateBounds
+	benchFor time.Duration
+	breaker  *circuitBreaker // nil until main attaches one
+	inFlight atomic.Int64    // upstream requests sent and not yet answered
+
+	mu           sync.Mutex
+	rate         float64
+	successes    int
+	lastDecrease time.Time
+	benchedUntil time.Time
+}
+
+func newAdaptiveLimiter(ip, class string, initial float64, burst int, bounds rateBounds, benchFor time.Duration) *adaptiveLimiter {
+	initial = min(max(initial, bounds.floor), bounds.ceiling)
+	l := &adaptiveLimiter{
+		Limiter:  rate.NewLimiter(rate.Limit(initial), burst),
+		ip:       ip,
+		class:    class,
+		bounds:   bounds,
+		benchFor: benchFor,
+		rate:     initial,
+	}
+	zeus_metrics.RateLimit.WithLabelValues(ip, class).Set(initial)
+	return l
+}
+
+// benched reports whether the limiter's IP is out of round robin
+func (l *adaptiveLimiter) benched(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return now.Before(l.benchedUntil)
+}
+
+// observe feeds the outcome of an upstream request into the controller
+func (l *adaptiveLimiter) observe(resp *http.Response, err error) {
+	if err != nil {
+		// transport errors say nothing about Bungie's limits
+		return
+	}
+	if signal, wait := throttleSignal(resp); signal != "" {
+		l.throttled(signal, wait)
+		return
+	}
+	if resp.StatusCode < 500 {
+		l.succeeded()
+	}
+}
+
+func (l *adaptiveLimiter) throttled(signal string, wait time.Duration) {
+	zeus_metrics.ThrottleSignals.WithLabelValues(l.class, signal).Inc()
+
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.successes = 0
+	l.benchedUntil = now.Add(max(wait, l.benchFor))
+	if now.Sub(l.lastDecrease) < aimdDecreaseInterval {
+		return
+	}
+	l.lastDecrease = now
+	previous := l.rate
+	l.setRateLocked(l.rate * aimdDecrease)
+
+	logger.Warn("UPSTREAM_THROTTLED", nil, map[string]any{
+		"ip":           l.ip,
+		"class":        l.class,
+		logging.REASON: signal,
+		logging.FROM:   previous,
+		logging.TO:     l.rate,
+	})
+}
+
+func (l *adaptiveLimiter) succeeded() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.successes++
+	if float64(l.successes) < l.rate || l.rate >= l.bounds.ceiling {
+		return
+	}
+	l.successes = 0
+	l.setRateLocked(l.rate + aimdIncrease)
+}
+
+func (l *adaptiveLimiter) setRateLocked(r float64) {
+	l.rate = min(max(r, l.bounds.floor), l.bounds.ceiling)
+	l.SetLimit(rate.Limit(l.rate))
+	zeus_metrics.RateLimit.WithLabelValues(l.ip, l.class).Set(l.rate)
+}
+
+// throttleSignal reports whether resp tells Zeus to slow down, naming the signal, and how long Bungie
+// asked it to wait. Only error responses are read; a 200 is taken as success without parsing the body.
+func throttleSignal(resp *http.Response) (string, time.Duration) {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return "http_429", time.Duration(seconds) * time.Second
+	}
+	if resp.StatusCode == http.StatusOK {
+		return "", 0
+	}
+	if isCloudflareChallenge(resp) {
+		return "cloudflare_challenge", 0
+	}
+	if !strings.Contains(resp.Header.Get("Content-Type"), "application/json") {
+		return "", 0
+	}
+
+	body, complete := peekBody(resp, throttleBodyBytes)
+	if !complete {
+		return "", 0
+	}
+	envelope, ok := decodeBungieEnvelope(body, resp.Header.Get("Content-Encoding"))
+	if !ok {
+		return "", 0
+	}
+	wait := time.Duration(envelope.ThrottleSeconds) * time.Second
+	if envelope.ErrorCode == bungieDestinyThrottledByGameServer {
+		return "throttled_by_game_server", wait
+	}
+	if envelope.ThrottleSeconds > 0 {
+		return "throttle_seconds", wait
+	}
+	return "", 0
+}
+
+func isCloudflareChallenge(resp *http.Response) bool {
+	if resp.Header.Get("Cf-Mitigated") == "challenge" {
+		return true
+	}
+	return (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusServiceUnavailable) &&
+		strings.EqualFold(resp.Header.Get("Server"), "cloudflare") &&
+		strings.Contains(resp.Header.Get("Content-Type"), "text/html")
+}
+
+// pickLimiter returns the index of the n-th pick in round robin, skipping benched IPs and open
+// circuits. If every IP is benched the first one with a usable circuit is picked, since traffic has to
+// go somewhere. ok is false only when every circuit is open.
+func pickLimiter(limiters []*adaptiveLimiter, n int64) (idx int, ok bool) {
+	start := int(n % int64(len(limiters)))
+	now := time.Now()
+	fallback := -1
+	for i := range limiters {
+		idx := (start + i) % len(limiters)
+		l := limiters[idx]
+		if l.benched(now) {
+			if fallback < 0 && l.breaker.available(now) {
+				fallback = idx
+			}
+			continue
+		}
+		if l.breaker.acquire(now) {
+			return idx, true
+		}
+	}
+	if fallback >= 0 && limiters[fallback].breaker.acquire(now) {
+		return fallback, true
+	}
+	return 0, false
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"raidhub/lib/monitoring/zeus_metrics"
+	"raidhub/lib/utils/logging"
+)
+
+// CIRCUIT_HEADER marks a response Zeus answered itself because every circuit of the endpoint class was open
+const CIRCUIT_HEADER = "X-Zeus-Circuit"
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitHalfOpen
+	circuitOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitHalfOpen:
+		return "half_open"
+	case circuitOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// Upstream outcomes, as counted in a breaker's recent error mix
+const (
+	outcomeOK           = "ok"
+	outcomeClientError  = "client_error"
+	outcomeThrottled    = "throttled"
+	outcomeMaintenance  = "maintenance"
+	outcomeServerError  = "server_error"
+	outcomeNetworkError = "network_error"
+)
+
+// breakerWindow is how many recent outcomes a breaker keeps for /status
+const breakerWindow = 100
+
+// circuitBreaker guards one source IP for one endpoint class. It opens after threshold consecutive
+// network errors or 5xx responses that aren't throttling or maintenance, sends a single probe once cooldown has passed (half-open), and
+// closes again when the probe succeeds.
+type circuitBreaker struct {
+	ip        string
+	class     string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+	probeAt  time.Time // when the half-open probe went out; a probe that never reports is retried after cooldown
+	recent   [breakerWindow]string
+	next     int
+	seen     int
+}
+
+func newCircuitBreaker(ip, class string, threshold int, cooldown time.Duration) *circuitBreaker {
+	zeus_metrics.CircuitState.WithLabelValues(ip, class).Set(float64(circuitClosed))
+	return &circuitBreaker{
+		ip:        ip,
+		class:     class,
+		threshold: max(1, threshold),
+		cooldown:  cooldown,
+	}
+}
+
+// available reports whether acquire would let a request through, without claiming the probe
+func (b *circuitBreaker) available(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case circuitOpen:
+		return now.Sub(b.openedAt) >= b.cooldown
+	case circuitHalfOpen:
+		return now.Sub(b.probeAt) >= b.cooldown
+	default:
+		return true
+	}
+}
+
+// acquire reports whether a request may go through this circuit. An open circuit past its cooldown
+// goes half-open and lets the caller through as the probe.
+func (b *circuitBreaker) acquire(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case circuitOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.transitionLocked(circuitHalfOpen)
+		b.probeAt = now
+		return true
+	case circuitHalfOpen:
+		if now.Sub(b.probeAt) < b.cooldown {
+			return false
+		}
+		b.probeAt = now
+		return true
+	default:
+		return true
+	}
+}
+
+// observe feeds the outcome of an upstream request into the breaker
+func (b *circuitBreaker) observe(resp *http.Response, err error) {
+	if b == nil || errors.Is(err, context.Canceled) {
+		// a caller hanging up says nothing about the upstream
+		return
+	}
+	outcome := classifyOutcome(resp, err)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.recent[b.next] = outcome
+	b.next = (b.next + 1) % breakerWindow
+	b.seen = min(b.seen+1, breakerWindow)
+
+	if outcome != outcomeServerError && outcome != outcomeNetworkError {
+		b.failures = 0
+		if b.state != circuitClosed {
+			b.transitionLocked(circuitClosed)
+		}
+		return
+	}
+	b.failures++
+	if b.state == circuitHalfOpen || (b.state == circuitClosed && b.failures >= b.threshold) {
+		b.openedAt = time.Now()
+		b.transitionLocked(circuitOpen)
+	}
+}
+
+func (b *circuitBreaker) transitionLocked(to circuitState) {
+	from := b.state
+	b.state = to
+	zeus_metrics.CircuitState.WithLabelValues(b.ip, b.class).Set(float64(to))
+	zeus_metrics.CircuitTransitions.WithLabelValues(b.ip, b.class, to.String()).Inc()
+
+	fields := map[string]any{
+		"ip":         b.ip,
+		"class":      b.class,
+		logging.FROM: from.String(),
+		logging.TO:   to.String(),
+		"failures":   b.failures,
+	}
+	if to == circuitOpen {
+		logger.Warn("CIRCUIT_OPENED", errors.New("consecutive upstream failures"), fields)
+	} else {
+		logger.Info("CIRCUIT_STATE_CHANGED", fields)
+	}
+}
+
+func (b *circuitBreaker) current() circuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// breakerStatus is a breaker as reported by /status
+type breakerStatus struct {
+	State               string         `json:"state"`
+	ConsecutiveFailures int            `json:"consecutive_failures"`
+	OpenedAt            *time.Time     `json:"opened_at,omitempty"`
+	Recent              map[string]int `json:"recent"`
+}
+
+func (b *circuitBreaker) status() breakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := breakerStatus{
+		State:               b.state.String(),
+		ConsecutiveFailures: b.failures,
+		Recent:              map[string]int{},
+	}
+	if b.state != circuitClosed {
+		openedAt := b.openedAt
+		s.OpenedAt = &openedAt
+	}
+	for i := range b.seen {
+		s.Recent[b.recent[i]]++
+	}
+	return s
+}
+
+// classifyOutcome sorts an upstream result for the breaker. Throttling is the adaptive limiter's
+// business and SystemDisabled is Bungie answering on purpose, so both count as the upstream being
+// reachable. Bungie sends both as 5xx, so error bodies are read for their ErrorCode.
+func classifyOutcome(resp *http.Response, err error) string {
+	switch {
+	case err != nil:
+		return outcomeNetworkError
+	case resp.StatusCode < 400:
+		return outcomeOK
+	}
+	if signal, _ := throttleSignal(resp); signal != "" {
+		return outcomeThrottled
+	}
+	if resp.StatusCode < 500 {
+		return outcomeClientError
+	}
+	if bungieErrorCode(resp) == bungieSystemDisabled {
+		return outcomeMaintenance
+	}
+	return outcomeServerError
+}
+
+// circuitOpenResponse answers a request when every circuit of its endpoint class is open
+func circuitOpenResponse(r *http.Request) *http.Response {
+	resp := (&bufferedResponse{
+		StatusCode: http.StatusServiceUnavailable,
+		Header:     http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		Body:       []byte("every upstream circuit is open"),
+	}).toResponse(r)
+	resp.Header.Set(CIRCUIT_HEADER, "open")
+	return resp
+}
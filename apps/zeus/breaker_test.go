@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func bungieResponse(status, errorCode int) *http.Response {
+	body := fmt.Sprintf(`{"ErrorCode":%d,"ThrottleSeconds":0,"ErrorStatus":"x","Message":"x"}`, errorCode)
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {"application/json; charset=utf-8"}},
+		Body:       io.NopCloser(bytes.NewBufferString(body)),
+	}
+}
+
+func htmlResponse(status int, header http.Header) *http.Response {
+	header.Set("Content-Type", "text/html")
+	return &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(bytes.NewBufferString("<html></html>")),
+	}
+}
+
+func TestClassifyOutcome(t *testing.T) {
+	tests := []struct {
+		name string
+		resp *http.Response
+		err  error
+		want string
+	}{
+		{"network error", nil, errors.New("connection refused"), outcomeNetworkError},
+		{"success", bungieResponse(http.StatusOK, bungieSuccess), nil, outcomeOK},
+		{"http 429", &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}, nil, outcomeThrottled},
+		{"throttled by game server", bungieResponse(http.StatusInternalServerError, bungieDestinyThrottledByGameServer), nil, outcomeThrottled},
+		{"cloudflare challenge", htmlResponse(http.StatusForbidden, http.Header{"Server": {"cloudflare"}}), nil, outcomeThrottled},
+		{"system disabled", bungieResponse(http.StatusServiceUnavailable, bungieSystemDisabled), nil, outcomeMaintenance},
+		{"bungie server error", bungieResponse(http.StatusInternalServerError, 1), nil, outcomeServerError},
+		{"gateway error", htmlResponse(http.StatusBadGateway, http.Header{}), nil, outcomeServerError},
+		{"not found", bungieResponse(http.StatusNotFound, 1653), nil, outcomeClientError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyOutcome(tt.resp, tt.err); got != tt.want {
+				t.Errorf("classifyOutcome() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyOutcomeLeavesBodyReadable(t *testing.T) {
+	resp := bungieResponse(http.StatusServiceUnavailable, bungieSystemDisabled)
+	classifyOutcome(resp, nil)
+	body, _ := io.ReadAll(resp.Body)
+	if !bytes.Contains(body, []byte(`"ErrorCode":5`)) {
+		t.Errorf("body after classifying = %q, want the Bungie envelope", body)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	const cooldown = time.Minute
+	serverError := func() *http.Response { return bungieResponse(http.StatusInternalServerError, 1) }
+	ok := func() *http.Response { return bungieResponse(http.StatusOK, bungieSuccess) }
+
+	b := newCircuitBreaker("test-ip", "test", 3, cooldown)
+	for range 2 {
+		b.observe(serverError(), nil)
+	}
+	b.observe(ok(), nil)
+	for range 2 {
+		b.observe(serverError(), nil)
+	}
+	if got := b.current(); got != circuitClosed {
+		t.Fatalf("after a success between failures state = %s, want closed", got)
+	}
+
+	b.observe(serverError(), nil)
+	if got := b.current(); got != circuitOpen {
+		t.Fatalf("after 3 consecutive failures state = %s, want open", got)
+	}
+	now := time.Now()
+	if b.acquire(now) {
+		t.Fatal("open circuit let a request through before its cooldown")
+	}
+
+	later := now.Add(cooldown + time.Second)
+	if !b.acquire(later) {
+		t.Fatal("open circuit past its cooldown didn't let the probe through")
+	}
+	if got := b.current(); got != circuitHalfOpen {
+		t.Fatalf("after the probe went out state = %s, want half_open", got)
+	}
+	if b.acquire(later) {
+		t.Fatal("half-open circuit let a second request through")
+	}
+
+	b.observe(serverError(), nil)
+	if got := b.current(); got != circuitOpen {
+		t.Fatalf("after a failed probe state = %s, want open", got)
+	}
+
+	probe := time.Now().Add(cooldown + time.Second)
+	if !b.acquire(probe) {
+		t.Fatal("reopened circuit didn't probe again after its cooldown")
+	}
+	b.observe(ok(), nil)
+	if got := b.current(); got != circuitClosed {
+		t.Fatalf("after a successful probe state = %s, want closed", got)
+	}
+}
+
+func TestCircuitBreakerIgnoresThrottlingAndMaintenance(t *testing.T) {
+	b := newCircuitBreaker("test-ip", "test", 2, time.Minute)
+	for range 5 {
+		b.observe(bungieResponse(http.StatusInternalServerError, bungieDestinyThrottledByGameServer), nil)
+		b.observe(bungieResponse(http.StatusServiceUnavailable, bungieSystemDisabled), nil)
+		b.observe(nil, context.Canceled)
+	}
+	if got := b.current(); got != circuitClosed {
+		t.Errorf("state = %s, want closed", got)
+	}
+	status := b.status()
+	if status.Recent[outcomeThrottled] != 5 || status.Recent[outcomeMaintenance] != 5 {
+		t.Errorf("recent = %v, want 5 throttled and 5 maintenance", status.Recent)
+	}
+}
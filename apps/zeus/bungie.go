@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Bungie ErrorCodes Zeus looks at. Kept here rather than importing lib/web/bungie, which sets up
+// clients that point back at Zeus.
+const (
+	bungieSuccess                      = 1
+	bungieSystemDisabled               = 5
+	bungieDestinyThrottledByGameServer = 1672
+)
+
+// bungieEnvelope is the part of every Bungie platform response Zeus cares about
+type bungieEnvelope struct {
+	ErrorCode       int `json:"ErrorCode"`
+	ThrottleSeconds int `json:"ThrottleSeconds"`
+}
+
+// decodeBungieEnvelope reads the ErrorCode and ThrottleSeconds of a response body as Bungie sent it.
+// Zeus passes the caller's Accept-Encoding through, so the body may be gzip compressed.
+func decodeBungieEnvelope(body []byte, contentEncoding string) (bungieEnvelope, bool) {
+	var envelope bungieEnvelope
+	if strings.EqualFold(contentEncoding, "gzip") {
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return envelope, false
+		}
+		defer reader.Close()
+		if body, err = io.ReadAll(reader); err != nil {
+			return envelope, false
+		}
+	} else if contentEncoding != "" {
+		return envelope, false
+	}
+
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return envelope, false
+	}
+	return envelope, true
+}
+
+// bungieErrorCode reads the ErrorCode of a JSON error response, leaving the body for the caller. 0 when
+// the response isn't a Bungie envelope.
+func bungieErrorCode(resp *http.Response) int {
+	if !strings.Contains(resp.Header.Get("Content-Type"), "application/json") {
+		return 0
+	}
+	body, complete := peekBody(resp, throttleBodyBytes)
+	if !complete {
+		return 0
+	}
+	envelope, ok := decodeBungieEnvelope(body, resp.Header.Get("Content-Encoding"))
+	if !ok {
+		return 0
+	}
+	return envelope.ErrorCode
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// peekBody reads up to limit bytes of resp's body and puts them back in front of the rest, so the
+// proxy still sends the whole body. complete is false if the body was longer than limit or failed.
+func peekBody(resp *http.Response, limit int64) (body []byte, complete bool) {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil || int64(len(body)) > limit {
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return body, false
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return body, true
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"raidhub/lib/env"
+	"raidhub/lib/monitoring/zeus_metrics"
+	"raidhub/lib/utils/logging"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// CACHE_STATUS_HEADER tells the caller whether a cacheable response came from the cache
+	CACHE_STATUS_HEADER = "X-Zeus-Cache"
+	// cacheMaxBodyBytes keeps large responses out of the cache
+	cacheMaxBodyBytes = 1 << 20
+	cacheRedisPrefix  = "zeus:cache:"
+	cacheRedisTimeout = 250 * time.Millisecond
+)
+
+// cacheRule caches successful GET responses for paths matching pattern for ttl
+type cacheRule struct {
+	name    string
+	pattern *regexp.Regexp
+	ttl     time.Duration
+}
+
+// cacheRules are the idempotent www.bungie.net endpoints worth caching. Anything else, including every
+// PGCR, always goes upstream.
+var cacheRules = []cacheRule{
+	{"members_of_group", regexp.MustCompile(`^/Platform/GroupV2/\d+/Members/$`), 5 * time.Minute},
+	{"group", regexp.MustCompile(`^/Platform/GroupV2/\d+/$`), 10 * time.Minute},
+	{"groups_for_member", regexp.MustCompile(`^/Platform/GroupV2/User/\d+/\d+/0/1/$`), 10 * time.Minute},
+	{"common_settings", regexp.MustCompile(`^/Platform/Settings/$`), time.Hour},
+	{"manifest", regexp.MustCompile(`^/Platform/Destiny2/Manifest/$`), 5 * time.Minute},
+	{"profile", regexp.MustCompile(`^/Platform/Destiny2/\d+/Profile/\d+/$`), time.Minute},
+	{"linked_profiles", regexp.MustCompile(`^/Platform/Destiny2/\d+/Profile/\d+/LinkedProfiles/$`), 10 * time.Minute},
+}
+
+// matchCacheRule returns the rule covering r, or nil if r must go upstream. Requests carrying a user's
+// OAuth token are never cached.
+func matchCacheRule(r *http.Request) *cacheRule {
+	if r.Method != http.MethodGet || r.Header.Get("Authorization") != "" {
+		return nil
+	}
+	for i := range cacheRules {
+		if cacheRules[i].pattern.MatchString(r.URL.Path) {
+			return &cacheRules[i]
+		}
+	}
+	return nil
+}
+
+// cacheDirectives reads the request's Cache-Control header. no-cache skips the lookup but stores the
+// fresh response; no-store leaves the cache out entirely.
+func cacheDirectives(h http.Header) (noCache bool, noStore bool) {
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-cache":
+			noCache = true
+		case "no-store":
+			noStore = true
+		}
+	}
+	return noCache, noStore
+}
+
+// cacheKey identifies a response. Gzip and plain bodies are kept apart, since Zeus passes the
+// caller's Accept-Encoding through and stores whatever Bungie sent back.
+func cacheKey(rule *cacheRule, r *http.Request) string {
+	encoding := "identity"
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		encoding = "gzip"
+	}
+	return fmt.Sprintf("%s %s?%s %s", rule.name, r.URL.Path, r.URL.RawQuery, encoding)
+}
+
+type cachedResponse struct {
+	bufferedResponse
+	StoredAt  time.Time `json:"stored_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (e *cachedResponse) toResponse(r *http.Request) *http.Response {
+	resp := e.bufferedResponse.toResponse(r)
+	resp.Header.Set("Age", strconv.Itoa(int(time.Since(e.StoredAt).Seconds())))
+	resp.Header.Set(CACHE_STATUS_HEADER, "HIT")
+	return resp
+}
+
+type cacheEntry struct {
+	key      string
+	response *cachedResponse
+}
+
+// responseCache is an LRU of upstream responses, optionally backed by Redis so several Zeus
+// instances share it and it survives restarts
+type responseCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List // front is the most recently used
+	redis      *redis.Client
+}
+
+func newResponseCache(maxEntries int, redisBacked bool) *responseCache {
+	c := &responseCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+	if redisBacked {
+		// A client of its own rather than lib/database/redis, whose init exits the process when Redis
+		// can't be reached. An unreachable Redis only costs cache hits here.
+		c.redis = redis.NewClient(&redis.Options{
+			Addr:     env.RedisHost + ":" + env.RedisPort,
+			Password: env.RedisPassword,
+		})
+	}
+	return c
+}
+
+// get returns the live response stored under key, looking in Redis when memory misses
+func (c *responseCache) get(ctx context.Context, key string) (*cachedResponse, bool) {
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		if time.Now().Before(entry.response.ExpiresAt) {
+			c.order.MoveToFront(el)
+			c.mu.Unlock()
+			return entry.response, true
+		}
+		c.removeLocked(el)
+	}
+	c.mu.Unlock()
+
+	if c.redis == nil {
+		return nil, false
+	}
+	ctx, cancel := context.WithTimeout(ctx, cacheRedisTimeout)
+	defer cancel()
+	data, err := c.redis.Get(ctx, redisCacheKey(key)).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			logger.Warn("CACHE_REDIS_READ_FAILED", err, nil)
+		}
+		return nil, false
+	}
+	var response cachedResponse
+	if err := json.Unmarshal(data, &response); err != nil || !time.Now().Before(response.ExpiresAt) {
+		return nil, false
+	}
+	c.put(key, &response)
+	return &response, true
+}
+
+// set stores response under key in memory and, if configured, in Redis
+func (c *responseCache) set(ctx context.Context, key string, response *cachedResponse) {
+	c.put(key, response)
+	if c.redis == nil {
+		return
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, cacheRedisTimeout)
+	defer cancel()
+	if err := c.redis.Set(ctx, redisCacheKey(key), data, time.Until(response.ExpiresAt)).Err(); err != nil {
+		logger.Warn("CACHE_REDIS_WRITE_FAILED", err, nil)
+	}
+}
+
+func (c *responseCache) put(key string, response *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*cacheEntry).response = response
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, response: response})
+	for c.order.Len() > c.maxEntries {
+		c.removeLocked(c.order.Back())
+	}
+	zeus_metrics.CacheEntries.Set(float64(c.order.Len()))
+}
+
+func (c *responseCache) removeLocked(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+	zeus_metrics.CacheEntries.Set(float64(c.order.Len()))
+}
+
+func redisCacheKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return cacheRedisPrefix + hex.EncodeToString(sum[:])
+}
+
+// store caches resp if it is a successful Bungie response and returns a response the proxy can still
+// read the body of. Bungie errors, including throttled responses, are never cached.
+func (c *responseCache) store(r *http.Request, rule *cacheRule, key string, resp *http.Response) *http.Response {
+	resp.Header.Set(CACHE_STATUS_HEADER, "MISS")
+	if resp.StatusCode != http.StatusOK {
+		return resp
+	}
+
+	body, complete := peekBody(resp, cacheMaxBodyBytes)
+	if !complete {
+		return resp
+	}
+	if envelope, ok := decodeBungieEnvelope(body, resp.Header.Get("Content-Encoding")); !ok ||
+		envelope.ErrorCode != bungieSuccess || envelope.ThrottleSeconds > 0 {
+		return resp
+	}
+
+	header := resp.Header.Clone()
+	header.Del("Set-Cookie")
+	header.Del(CACHE_STATUS_HEADER)
+	now := time.Now()
+	c.set(r.Context(), key, &cachedResponse{
+		bufferedResponse: bufferedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     header,
+			Body:       body,
+		},
+		StoredAt:  now,
+		ExpiresAt: now.Add(rule.ttl),
+	})
+	zeus_metrics.CacheRequests.WithLabelValues(rule.name, "store").Inc()
+	return resp
+}
+
+// lookup serves r from the cache when it can. It returns the rule and key the upstream response
+// should be stored under, or a nil rule when it must not be stored.
+func (c *responseCache) lookup(r *http.Request) (*http.Response, *cacheRule, string) {
+	rule := matchCacheRule(r)
+	if rule == nil {
+		return nil, nil, ""
+	}
+	noCache, noStore := cacheDirectives(r.Header)
+	if noStore {
+		zeus_metrics.CacheRequests.WithLabelValues(rule.name, "bypass").Inc()
+		return nil, nil, ""
+	}
+
+	key := cacheKey(rule, r)
+	if noCache {
+		zeus_metrics.CacheRequests.WithLabelValues(rule.name, "bypass").Inc()
+		return nil, rule, key
+	}
+	if response, ok := c.get(r.Context(), key); ok {
+		zeus_metrics.CacheRequests.WithLabelValues(rule.name, "hit").Inc()
+		logger.Debug("CACHE_HIT", map[string]any{
+			logging.ENDPOINT: r.URL.String(),
+			"rule":           rule.name,
+		})
+		return response.toResponse(r), nil, ""
+	}
+	zeus_metrics.CacheRequests.WithLabelValues(rule.name, "miss").Inc()
+	return nil, rule, key
+}
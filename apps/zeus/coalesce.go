@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"raidhub/lib/monitoring/zeus_metrics"
+)
+
+// COALESCED_HEADER marks a response fanned out from another caller's upstream request
+const COALESCED_HEADER = "X-Zeus-Coalesced"
+
+// coalesceIgnoredParams are markers callers add to bust Bungie's cache on a retry. They don't change
+// what is being asked for, so they are left out when matching requests.
+var coalesceIgnoredParams = []string{"retry", "malformed_retry"}
+
+// inflightCall is an upstream GET other identical requests are waiting on
+type inflightCall struct {
+	done    chan struct{}
+	waiters int
+	// shared is the response to fan out; nil when the upstream call failed or the body was too large
+	shared *bufferedResponse
+}
+
+// coalescer collapses concurrent identical GETs into one upstream call
+type coalescer struct {
+	mu         sync.Mutex
+	calls      map[string]*inflightCall
+	maxBody    int64
+	maxWaiters int
+}
+
+func newCoalescer(maxBody int64, maxWaiters int) *coalescer {
+	return &coalescer{
+		calls:      make(map[string]*inflightCall),
+		maxBody:    maxBody,
+		maxWaiters: maxWaiters,
+	}
+}
+
+// coalesceKey identifies requests that can share one upstream call
+func coalesceKey(r *http.Request) string {
+	query := r.URL.Query()
+	for _, param := range coalesceIgnoredParams {
+		query.Del(param)
+	}
+	encoding := "identity"
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		encoding = "gzip"
+	}
+	return fmt.Sprintf("%s %s?%s %s", r.Host, r.URL.Path, query.Encode(), encoding)
+}
+
+// do runs upstream for r, unless an identical request is already in flight, in which case it waits
+// for that one and returns a copy of its response. A waiter whose leader failed, or whose response was
+// too large to share, makes its own call. Requests carrying a user's OAuth token always make their own
+// call, since their response is scoped to that user.
+func (c *coalescer) do(r *http.Request, upstream func() (*http.Response, error)) (*http.Response, error) {
+	if r.Method != http.MethodGet || r.Header.Get("Authorization") != "" {
+		return upstream()
+	}
+	key := coalesceKey(r)
+
+	c.mu.Lock()
+	if call, ok := c.calls[key]; ok {
+		if call.waiters >= c.maxWaiters {
+			c.mu.Unlock()
+			zeus_metrics.CoalescedRequests.WithLabelValues("over_cap").Inc()
+			return upstream()
+		}
+		call.waiters++
+		c.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		}
+		if call.shared == nil {
+			zeus_metrics.CoalescedRequests.WithLabelValues("fallthrough").Inc()
+			return upstream()
+		}
+		zeus_metrics.CoalescedRequests.WithLabelValues("collapsed").Inc()
+		resp := call.shared.toResponse(r)
+		resp.Header.Set(COALESCED_HEADER, "1")
+		return resp, nil
+	}
+	call := &inflightCall{done: make(chan struct{})}
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	resp, err := upstream()
+	if err == nil {
+		if body, complete := peekBody(resp, c.maxBody); complete {
+			call.shared = &bufferedResponse{
+				StatusCode: resp.StatusCode,
+				Header:     resp.Header.Clone(),
+				Body:       body,
+			}
+		}
+	}
+
+	c.mu.Lock()
+	delete(c.calls, key)
+	c.mu.Unlock()
+	close(call.done)
+	return resp, err
+}
+
+// bufferedResponse is a response held in memory so it can be served more than once
+type bufferedResponse struct {
+	StatusCode int         `json:"status"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+}
+
+func (b *bufferedResponse) toResponse(r *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", b.StatusCode, http.StatusText(b.StatusCode)),
+		StatusCode:    b.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        b.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(b.Body)),
+		ContentLength: int64(len(b.Body)),
+		Request:       r,
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// leaderInFlight starts an upstream call for url that blocks until release is closed, and returns once
+// the coalescer has registered it
+func leaderInFlight(c *coalescer, url string, release chan struct{}) {
+	started := make(chan struct{})
+	go c.do(httptest.NewRequest(http.MethodGet, url, nil), func() (*http.Response, error) {
+		close(started)
+		<-release
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(bytes.NewBufferString("{}"))}, nil
+	})
+	<-started
+}
+
+func TestCoalescerSharesIdenticalGets(t *testing.T) {
+	c := newCoalescer(1<<20, 10)
+	release := make(chan struct{})
+	const url = "http://bungie.net/Platform/Destiny2/Manifest/?retry=2"
+	leaderInFlight(c, url, release)
+
+	var calls atomic.Int32
+	done := make(chan *http.Response)
+	go func() {
+		resp, _ := c.do(httptest.NewRequest(http.MethodGet, "http://bungie.net/Platform/Destiny2/Manifest/", nil), func() (*http.Response, error) {
+			calls.Add(1)
+			return nil, nil
+		})
+		done <- resp
+	}()
+	// let the waiter join the call before the leader finishes
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	resp := <-done
+	if calls.Load() != 0 {
+		t.Fatal("waiter made its own upstream call")
+	}
+	if resp == nil || resp.Header.Get(COALESCED_HEADER) != "1" {
+		t.Fatalf("waiter response = %v, want the leader's response marked coalesced", resp)
+	}
+}
+
+func TestCoalescerSkipsAuthorizedRequests(t *testing.T) {
+	c := newCoalescer(1<<20, 10)
+	release := make(chan struct{})
+	defer close(release)
+	const url = "http://bungie.net/Platform/User/GetMembershipsForCurrentUser/"
+	leaderInFlight(c, url, release)
+
+	r := httptest.NewRequest(http.MethodGet, url, nil)
+	r.Header.Set("Authorization", "Bearer someone-else")
+	var calls atomic.Int32
+	done := make(chan struct{})
+	go func() {
+		c.do(r, func() (*http.Response, error) {
+			calls.Add(1)
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody}, nil
+		})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("authorized request waited on another caller's call")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("authorized request made %d upstream calls, want its own", calls.Load())
+	}
+}
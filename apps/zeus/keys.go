@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"raidhub/lib/monitoring/zeus_metrics"
+	"raidhub/lib/utils/logging"
+)
+
+// ZEUS_TOKEN_HEADER carries the caller's client token, as sent by lib/web/bungie
+const ZEUS_TOKEN_HEADER = "X-Zeus-Token"
+
+// Bungie ErrorCodes that are about the API key rather than the request
+const (
+	bungieThrottleLimitExceeded                       = 36
+	bungieThrottleLimitExceededMinutes                = 37
+	bungieThrottleLimitExceededMomentarily            = 38
+	bungieThrottleLimitExceededSeconds                = 39
+	bungiePerEndpointRequestThrottleExceeded          = 51
+	bungiePerApplicationThrottleExceeded              = 52
+	bungiePerApplicationAnonymousThrottleExceeded     = 53
+	bungiePerApplicationAuthenticatedThrottleExceeded = 54
+	bungieApiInvalidOrExpiredKey                      = 2101
+	bungieApiKeyMissingFromRequest                    = 2102
+	bungieOriginHeaderDoesNotMatchKey                 = 2103
+)
+
+// keyThrottleQuarantine is the least time a key throttled by Bungie sits out
+const keyThrottleQuarantine = time.Minute
+
+// apiKey is one upstream Bungie API key with its own rate limiters next to the per-IP ones
+type apiKey struct {
+	name    string // used in logs and metrics in place of the key
+	value   string
+	statsRl *rate.Limiter
+	wwwRl   *rate.Limiter
+
+	mu               sync.Mutex
+	quarantinedUntil time.Time
+}
+
+func (k *apiKey) limiter(endpointType string) *rate.Limiter {
+	if endpointType == "stats" {
+		return k.statsRl
+	}
+	return k.wwwRl
+}
+
+func (k *apiKey) quarantined(now time.Time) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return now.Before(k.quarantinedUntil)
+}
+
+func (k *apiKey) quarantine(reason string, d time.Duration) {
+	k.mu.Lock()
+	until := time.Now().Add(d)
+	extended := until.After(k.quarantinedUntil)
+	if extended {
+		k.quarantinedUntil = until
+	}
+	k.mu.Unlock()
+	if !extended {
+		return
+	}
+
+	zeus_metrics.APIKeyQuarantines.WithLabelValues(k.name, reason).Inc()
+	logger.Warn("API_KEY_QUARANTINED", nil, map[string]any{
+		"key":            k.name,
+		logging.REASON:   reason,
+		logging.DURATION: d.String(),
+	})
+}
+
+// keyPool rotates requests through the upstream API keys, skipping quarantined ones
+type keyPool struct {
+	keys              []*apiKey
+	n                 atomic.Int64
+	invalidQuarantine time.Duration
+}
+
+// newKeyPool builds a pool from a comma-separated key list, falling back to a single key when it is empty
+func newKeyPool(keyList string, fallback string, statsRate, wwwRate float64, invalidQuarantine time.Duration) *keyPool {
+	var values []string
+	for _, v := range strings.Split(keyList, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 && fallback != "" {
+		values = []string{fallback}
+	}
+
+	p := &keyPool{invalidQuarantine: invalidQuarantine}
+	for i, v := range values {
+		p.keys = append(p.keys, &apiKey{
+			name:    fmt.Sprintf("key%d", i),
+			value:   v,
+			statsRl: keyLimiter(statsRate),
+			wwwRl:   keyLimiter(wwwRate),
+		})
+	}
+	return p
+}
+
+// keyLimiter allows perSecond requests with a second's worth of burst, or everything when perSecond is 0
+func keyLimiter(perSecond float64) *rate.Limiter {
+	if perSecond <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Limit(perSecond), max(1, int(perSecond)))
+}
+
+// pick returns the next key in rotation that is not quarantined. If every key is quarantined the
+// plain rotation pick is used, since sending nothing at all helps nobody.
+func (p *keyPool) pick() *apiKey {
+	if len(p.keys) == 0 {
+		return nil
+	}
+	start := int(p.n.Add(1) % int64(len(p.keys)))
+	now := time.Now()
+	for i := range p.keys {
+		k := p.keys[(start+i)%len(p.keys)]
+		if !k.quarantined(now) {
+			return k
+		}
+	}
+	return p.keys[start]
+}
+
+// observe quarantines k if resp is a key-level error. Only error responses are read.
+func (p *keyPool) observe(k *apiKey, resp *http.Response) {
+	if resp.StatusCode == http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "application/json") {
+		return
+	}
+	body, complete := peekBody(resp, throttleBodyBytes)
+	if !complete {
+		return
+	}
+	envelope, ok := decodeBungieEnvelope(body, resp.Header.Get("Content-Encoding"))
+	if !ok {
+		return
+	}
+
+	switch envelope.ErrorCode {
+	case bungieApiInvalidOrExpiredKey, bungieApiKeyMissingFromRequest, bungieOriginHeaderDoesNotMatchKey:
+		k.quarantine("invalid_key", p.invalidQuarantine)
+	case bungieThrottleLimitExceeded, bungieThrottleLimitExceededMinutes, bungieThrottleLimitExceededMomentarily,
+		bungieThrottleLimitExceededSeconds, bungiePerEndpointRequestThrottleExceeded, bungiePerApplicationThrottleExceeded,
+		bungiePerApplicationAnonymousThrottleExceeded, bungiePerApplicationAuthenticatedThrottleExceeded:
+		k.quarantine("key_throttled", max(time.Duration(envelope.ThrottleSeconds)*time.Second, keyThrottleQuarantine))
+	}
+}
+
+// clientTokens maps internal client tokens to client names. Callers authenticate with these, never
+// with the upstream keys.
+type clientTokens map[string]string
+
+// parseClientTokens reads a comma-separated name:token list
+func parseClientTokens(list string) (clientTokens, error) {
+	tokens := clientTokens{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, token, ok := strings.Cut(entry, ":")
+		if !ok || name == "" || token == "" {
+			return nil, fmt.Errorf("client token entry %q is not name:token", entry)
+		}
+		tokens[token] = name
+	}
+	return tokens, nil
+}
+
+// authenticate returns the name of the client that sent r, and whether it may use the upstream key
+// pool. With no tokens configured, callers are checked against legacyKey (BUNGIE_API_KEY) the way Zeus
+// did before client tokens: a caller sending it as x-api-key gets the pool as "anonymous", and any other
+// caller is forwarded with its own key as "unkeyed". ok is false for a caller with an unknown token.
+func (c clientTokens) authenticate(r *http.Request, legacyKey string) (name string, pooled bool, ok bool) {
+	if len(c) == 0 {
+		sent := r.Header.Get("x-api-key")
+		if legacyKey != "" && subtle.ConstantTimeCompare([]byte(sent), []byte(legacyKey)) == 1 {
+			return "anonymous", true, true
+		}
+		return "unkeyed", false, true
+	}
+	sent := r.Header.Get(ZEUS_TOKEN_HEADER)
+	for token, name := range c {
+		if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1 {
+			return name, true, true
+		}
+	}
+	return "", false, false
+}
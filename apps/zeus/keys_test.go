@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientTokensAuthenticate(t *testing.T) {
+	const legacyKey = "bungie-key"
+	clients, err := parseClientTokens("atlas:atlas-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		clients    clientTokens
+		header     http.Header
+		wantName   string
+		wantPooled bool
+		wantOK     bool
+	}{
+		{"known token", clients, http.Header{ZEUS_TOKEN_HEADER: {"atlas-token"}}, "atlas", true, true},
+		{"unknown token", clients, http.Header{ZEUS_TOKEN_HEADER: {"nope"}}, "", false, false},
+		{"api key with tokens configured", clients, http.Header{"X-Api-Key": {legacyKey}}, "", false, false},
+		{"no tokens, matching api key", nil, http.Header{"X-Api-Key": {legacyKey}}, "anonymous", true, true},
+		{"no tokens, other api key", nil, http.Header{"X-Api-Key": {"someone-else"}}, "unkeyed", false, true},
+		{"no tokens, no api key", nil, http.Header{}, "unkeyed", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{Header: tt.header}
+			name, pooled, ok := tt.clients.authenticate(r, legacyKey)
+			if name != tt.wantName || pooled != tt.wantPooled || ok != tt.wantOK {
+				t.Errorf("authenticate() = (%q, %v, %v), want (%q, %v, %v)", name, pooled, ok, tt.wantName, tt.wantPooled, tt.wantOK)
+			}
+		})
+	}
+}
@@ -17,9 +17,8 @@ import (
 	"sync/atomic"
 	"time"
 
-	"golang.org/x/time/rate"
-
 	"raidhub/lib/env"
+	"raidhub/lib/monitoring/zeus_metrics"
 	"raidhub/lib/utils/logging"
 )
 
@@ -34,16 +33,47 @@ var (
 	dev           = flag.Bool("dev", false, "disable round robin for development (single transport)")
 	ipv6interface = flag.String("interface", DEFAULT_INTERFACE, "ipv6 interface")
 	ipv6n         = flag.Int("v6_n", 16, "number of sequential ipv6 addresses")
-	securityKey   = ""
+	cacheEnabled  = flag.Bool("cache", false, "serve idempotent www.bungie.net GETs from a response cache")
+	cacheSize     = flag.Int("cache_size", 10000, "max number of responses the cache holds in memory")
+	cacheRedis    = flag.Bool("cache_redis", false, "back the response cache with Redis, shared by every Zeus instance")
+	statsFloor    = flag.Float64("stats_floor", 5, "lowest per-IP stats.bungie.net rate (req/s) throttling can push Zeus down to")
+	statsCeiling  = flag.Float64("stats_ceiling", 60, "highest per-IP stats.bungie.net rate (req/s) Zeus probes up to")
+	wwwFloor      = flag.Float64("www_floor", 2, "lowest per-IP www.bungie.net rate (req/s) throttling can push Zeus down to")
+	wwwCeiling    = flag.Float64("www_ceiling", 20, "highest per-IP www.bungie.net rate (req/s) Zeus probes up to")
+	benchFor      = flag.Duration("bench", 30*time.Second, "how long a throttled IP is left out of round robin")
+	keyStatsRate  = flag.Float64("key_stats_rate", 0, "per-API-key stats.bungie.net rate (req/s), 0 for no per-key limit")
+	keyWwwRate    = flag.Float64("key_www_rate", 0, "per-API-key www.bungie.net rate (req/s), 0 for no per-key limit")
+	keyQuarantine = flag.Duration("key_quarantine", 10*time.Minute, "how long an API key Bungie rejects as invalid is left out of rotation")
+	coalesce      = flag.Bool("coalesce", true, "collapse concurrent identical GETs into a single upstream request")
+	coalesceBody  = flag.Int64("coalesce_max_body", 4<<20, "largest response body (bytes) fanned out to coalesced requests")
+	coalesceMax   = flag.Int("coalesce_max_waiters", 100, "most requests that can wait on one upstream request")
+	schedSlots    = flag.Int("sched_slots", 2, "requests per IP let through to the rate limiters at once; the rest queue by priority")
+	schedQueue    = flag.Int("sched_queue", 5000, "most requests queued per endpoint class before the lowest priority is shed")
+	breakerFails  = flag.Int("breaker_failures", 5, "consecutive network errors or 5xx that open an IP's circuit")
+	breakerCool   = flag.Duration("breaker_cooldown", 30*time.Second, "how long an open circuit waits before sending a probe")
+	recordDir     = flag.String("record", "", "record upstream responses to this directory")
+	replayDir     = flag.String("replay", "", "serve recorded responses from this directory instead of going upstream")
+	replayLatency = flag.Duration("replay_latency", 0, "latency added to every replayed response")
+	replayJitter  = flag.Duration("replay_jitter", 0, "random latency of up to this much added on top of --replay_latency")
+	replayFail    = flag.Float64("replay_fail_rate", 0, "fraction of replayed requests answered with an injected 503")
+	replayMiss    = flag.String("replay_miss", replayMiss404, "what to do without a recording: 404, 503, or passthrough")
 	logger        = logging.NewLogger("zeus")
 )
 
 type transport struct {
-	nW      int64
-	nS      int64
-	rt      []http.RoundTripper
-	statsRl []*rate.Limiter
-	wwwRl   []*rate.Limiter
+	nW        int64
+	nS        int64
+	rt        []http.RoundTripper
+	statsRl   []*adaptiveLimiter
+	wwwRl     []*adaptiveLimiter
+	cache     *responseCache // nil unless --cache is set
+	keys      *keyPool
+	clients   clientTokens
+	coalescer *coalescer // nil when --coalesce=false
+	statsSch  *fairScheduler
+	wwwSch    *fairScheduler
+	recorder  *recorder // nil unless --record is set
+	replayer  *replayer // nil unless --replay is set
 }
 
 var proxyTransport = &transport{}
@@ -72,8 +102,22 @@ func main() {
 	// Start metrics worker goroutine
 	go metricsWorker()
 
-	// Get security key from environment for API key forwarding
-	securityKey = env.BungieAPIKey
+	// Upstream API keys, and the tokens callers authenticate with in their place
+	proxyTransport.keys = newKeyPool(env.ZeusAPIKeys, env.BungieAPIKey, *keyStatsRate, *keyWwwRate, *keyQuarantine)
+	clients, err := parseClientTokens(env.ZeusClientTokens)
+	if err != nil {
+		logger.Fatal("INVALID_ZEUS_CLIENT_TOKENS", err, nil)
+	}
+	proxyTransport.clients = clients
+	if len(clients) == 0 {
+		logger.Warn("CLIENT_AUTH_DISABLED", errors.New("ZEUS_CLIENT_TOKENS is not set"), map[string]any{
+			logging.ACTION: "pooling_keys_for_callers_sending_bungie_api_key",
+		})
+	}
+	logger.Info("API_KEY_POOL_READY", map[string]any{
+		"keys":    len(proxyTransport.keys.keys),
+		"clients": len(clients),
+	})
 	// Initialize transport with IPv6 support if available, otherwise use default
 	// In dev mode, use single transport (no round robin). In production, use multiple transports.
 	numIPs := 1
@@ -81,6 +125,17 @@ func main() {
 		numIPs = *ipv6n
 	}
 
+	statsBounds := rateBounds{floor: *statsFloor, ceiling: *statsCeiling}
+	wwwBounds := rateBounds{floor: *wwwFloor, ceiling: *wwwCeiling}
+	if statsBounds.floor <= 0 || statsBounds.floor > statsBounds.ceiling || wwwBounds.floor <= 0 || wwwBounds.floor > wwwBounds.ceiling {
+		logger.Fatal("INVALID_RATE_BOUNDS", errors.New("rate floors must be positive and no higher than their ceilings"), map[string]any{
+			"stats_floor":   statsBounds.floor,
+			"stats_ceiling": statsBounds.ceiling,
+			"www_floor":     wwwBounds.floor,
+			"www_ceiling":   wwwBounds.ceiling,
+		})
+	}
+
 	if env.ZeusIPV6 != "" && numIPs > 1 {
 		// Production mode with IPv6: create multiple transports for round robin
 		addr := netip.MustParseAddr(env.ZeusIPV6)
@@ -99,8 +154,8 @@ func main() {
 			proxyTransport.rt = append(proxyTransport.rt, rt)
 
 			// Initialize rate limiters per IP (always enabled)
-			proxyTransport.statsRl = append(proxyTransport.statsRl, rate.NewLimiter(rate.Every(time.Second/40), 90))
-			proxyTransport.wwwRl = append(proxyTransport.wwwRl, rate.NewLimiter(rate.Every(time.Second/12), 25))
+			proxyTransport.statsRl = append(proxyTransport.statsRl, newAdaptiveLimiter(addr.String(), "stats", 40, 90, statsBounds, *benchFor))
+			proxyTransport.wwwRl = append(proxyTransport.wwwRl, newAdaptiveLimiter(addr.String(), "www", 12, 25, wwwBounds, *benchFor))
 			addr = addr.Next()
 		}
 		logger.Info("IPV6_LOAD_BALANCING_ENABLED", map[string]any{
@@ -123,8 +178,8 @@ func main() {
 			return d.DialContext(ctx, network, addr)
 		}
 		proxyTransport.rt = append(proxyTransport.rt, rt)
-		proxyTransport.statsRl = append(proxyTransport.statsRl, rate.NewLimiter(rate.Every(time.Second/40), 90))
-		proxyTransport.wwwRl = append(proxyTransport.wwwRl, rate.NewLimiter(rate.Every(time.Second/8), 20))
+		proxyTransport.statsRl = append(proxyTransport.statsRl, newAdaptiveLimiter(addr.String(), "stats", 40, 90, statsBounds, *benchFor))
+		proxyTransport.wwwRl = append(proxyTransport.wwwRl, newAdaptiveLimiter(addr.String(), "www", 8, 20, wwwBounds, *benchFor))
 		logger.Info("IPV6_SINGLE_TRANSPORT_MODE", map[string]any{
 			"interface":   *ipv6interface,
 			"round_robin": false,
@@ -132,13 +187,63 @@ func main() {
 	} else {
 		// No IPv6: use default transport (single transport)
 		proxyTransport.rt = append(proxyTransport.rt, http.DefaultTransport)
-		proxyTransport.statsRl = append(proxyTransport.statsRl, rate.NewLimiter(rate.Every(time.Second/40), 90))
-		proxyTransport.wwwRl = append(proxyTransport.wwwRl, rate.NewLimiter(rate.Every(time.Second/12), 25))
+		proxyTransport.statsRl = append(proxyTransport.statsRl, newAdaptiveLimiter("default", "stats", 40, 90, statsBounds, *benchFor))
+		proxyTransport.wwwRl = append(proxyTransport.wwwRl, newAdaptiveLimiter("default", "www", 12, 25, wwwBounds, *benchFor))
 		logger.Info("USING_DEFAULT_TRANSPORT", map[string]any{
 			"round_robin": false,
 		})
 	}
 
+	for _, l := range append(append([]*adaptiveLimiter{}, proxyTransport.statsRl...), proxyTransport.wwwRl...) {
+		l.breaker = newCircuitBreaker(l.ip, l.class, *breakerFails, *breakerCool)
+	}
+
+	proxyTransport.statsSch = newFairScheduler("stats", *schedSlots*len(proxyTransport.statsRl), *schedQueue)
+	proxyTransport.wwwSch = newFairScheduler("www", *schedSlots*len(proxyTransport.wwwRl), *schedQueue)
+
+	if *coalesce {
+		proxyTransport.coalescer = newCoalescer(*coalesceBody, *coalesceMax)
+	}
+
+	if *recordDir != "" && *replayDir != "" {
+		logger.Fatal("INVALID_RECORD_REPLAY_FLAGS", errors.New("--record and --replay are mutually exclusive"), nil)
+	}
+	if *recordDir != "" {
+		proxyTransport.recorder = &recorder{dir: *recordDir}
+		logger.Info("RECORDING_ENABLED", map[string]any{
+			logging.PATH: *recordDir,
+		})
+	}
+	if *replayDir != "" {
+		if *replayMiss != replayMiss404 && *replayMiss != replayMiss503 && *replayMiss != replayMissPassthrough {
+			logger.Fatal("INVALID_REPLAY_MISS_POLICY", errors.New("--replay_miss must be 404, 503, or passthrough"), map[string]any{
+				"replay_miss": *replayMiss,
+			})
+		}
+		proxyTransport.replayer = &replayer{
+			dir:      *replayDir,
+			latency:  *replayLatency,
+			jitter:   *replayJitter,
+			failRate: *replayFail,
+			miss:     *replayMiss,
+		}
+		logger.Info("REPLAY_ENABLED", map[string]any{
+			logging.PATH:  *replayDir,
+			"latency":     replayLatency.String(),
+			"jitter":      replayJitter.String(),
+			"fail_rate":   *replayFail,
+			"miss_policy": *replayMiss,
+		})
+	}
+
+	if *cacheEnabled {
+		proxyTransport.cache = newResponseCache(*cacheSize, *cacheRedis)
+		logger.Info("RESPONSE_CACHE_ENABLED", map[string]any{
+			"size":  *cacheSize,
+			"redis": *cacheRedis,
+		})
+	}
+
 	// Create a custom error logger that formats httputil errors properly
 	httputilLogger := log.New(&httputilLogWriter{logger: logger}, "[httputil] ", log.LstdFlags)
 
@@ -184,7 +289,17 @@ func main() {
 		},
 	}
 
-	mainHandler := http.HandlerFunc(rp.ServeHTTP)
+	// Zeus answers its own health endpoints; everything else is proxied
+	mainHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			proxyTransport.serveHealth(w, r)
+		case "/status":
+			proxyTransport.serveStatus(w, r)
+		default:
+			rp.ServeHTTP(w, r)
+		}
+	})
 	logger.Info("SERVICE_READY", map[string]any{
 		"port": *port,
 	})
@@ -195,60 +310,152 @@ func main() {
 }
 
 func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
-	var rl *rate.Limiter
-	var n int64
-	var rt http.RoundTripper
 	var endpointType string
-	startTime := time.Now()
-	var rateLimiterWait time.Duration
+	var sch *fairScheduler
 
 	if strings.Contains(r.URL.Path, "Destiny2/Stats/PostGameCarnageReport") {
-		n = atomic.AddInt64(&t.nS, 1)
 		r.Host = "stats.bungie.net"
 		endpointType = "stats"
-		if len(t.statsRl) > 0 {
-			// In dev mode, always use the first rate limiter (single transport)
-			// In production, round robin through rate limiters
-			rl = t.statsRl[n%int64(len(t.statsRl))]
-		}
+		sch = t.statsSch
 	} else {
-		n = atomic.AddInt64(&t.nW, 1)
 		r.Host = "www.bungie.net"
 		endpointType = "www"
-		if len(t.wwwRl) > 0 {
-			// In dev mode, always use the first rate limiter (single transport)
-			// In production, round robin through rate limiters
-			rl = t.wwwRl[n%int64(len(t.wwwRl))]
-		}
+		sch = t.wwwSch
 	}
 
-	// Forward API key if security key is provided
-	if securityKey != "" && r.Header.Get("x-api-key") == securityKey {
-		r.Header.Set("x-api-key", securityKey)
-		r.Header.Add("x-forwarded-for", securityKey)
-	} else if securityKey != "" {
-		// Only log warning if security key is configured but not provided
+	// Callers authenticate with their own client token; the upstream key comes from the pool
+	client, pooled, ok := t.clients.authenticate(r, env.BungieAPIKey)
+	if !ok {
+		logger.Warn("SECURITY_CHECK_FAILED", errors.New("unknown client token"), map[string]any{
+			logging.HOST:   r.Host,
+			logging.PATH:   r.URL.Path,
+			logging.METHOD: r.Method,
+		})
+		return unauthorizedResponse(r), nil
+	}
+	if !pooled {
 		logger.Warn("SECURITY_CHECK_FAILED", errors.New("api key mismatch"), map[string]any{
 			logging.HOST:   r.Host,
 			logging.PATH:   r.URL.Path,
 			logging.METHOD: r.Method,
-			"x_api_key":    r.Header.Get("x-api-key"),
 		})
 	}
+	zeus_metrics.ClientRequests.WithLabelValues(client, endpointType).Inc()
+	r.Header.Del(ZEUS_TOKEN_HEADER)
+	if pooled {
+		r.Header.Del("x-api-key")
+	}
+	priority := parsePriority(r)
+	r.Header.Del(PRIORITY_HEADER)
+
+	// Replay answers from disk ahead of everything else, so runs are the same whatever is cached
+	if t.replayer != nil {
+		replayKey, err := recordingKey(r)
+		if err != nil {
+			return nil, err
+		}
+		if resp, err := t.replayer.replay(r, replayKey); resp != nil || err != nil {
+			return resp, err
+		}
+	}
+
+	// Serve from the cache before spending any of the rate limit
+	// Callers forwarded on their own key don't share answers with the pool
+	var rule *cacheRule
+	var storeKey string
+	if t.cache != nil && pooled {
+		var cached *http.Response
+		if cached, rule, storeKey = t.cache.lookup(r); cached != nil {
+			return cached, nil
+		}
+	}
+
+	if t.coalescer == nil || !pooled {
+		return t.forward(r, endpointType, sch, priority, pooled, rule, storeKey)
+	}
+	return t.coalescer.do(r, func() (*http.Response, error) {
+		return t.forward(r, endpointType, sch, priority, pooled, rule, storeKey)
+	})
+}
+
+// pick returns the next IP in round robin for endpointType, skipping throttled IPs and open circuits.
+// In dev mode there is only the one.
+func (t *transport) pick(endpointType string) (int, *adaptiveLimiter, bool) {
+	limiters, n := t.wwwRl, &t.nW
+	if endpointType == "stats" {
+		limiters, n = t.statsRl, &t.nS
+	}
+	idx, ok := pickLimiter(limiters, atomic.AddInt64(n, 1))
+	if !ok {
+		return 0, nil, false
+	}
+	return idx, limiters[idx], true
+}
+
+// forward waits for r's turn in the scheduler, sends it upstream through the next healthy IP with the
+// next API key in rotation (or the caller's own key when not pooled), feeds the outcome back into the limiters and breakers, and stores it in
+// the cache when rule says so
+func (t *transport) forward(r *http.Request, endpointType string, sch *fairScheduler, priority priorityClass, pooled bool, rule *cacheRule, storeKey string) (*http.Response, error) {
+	admitted, err := sch.acquire(r.Context(), priority)
+	if err != nil {
+		return nil, err
+	}
+	if !admitted {
+		return shedResponse(r), nil
+	}
+	released := false
+	release := func() {
+		if !released {
+			released = true
+			sch.release()
+		}
+	}
+	defer release()
+
+	idx, rl, ok := t.pick(endpointType)
+	if !ok {
+		zeus_metrics.CircuitRejections.WithLabelValues(endpointType).Inc()
+		return circuitOpenResponse(r), nil
+	}
+
+	startTime := time.Now()
+	var rateLimiterWait time.Duration
+
+	var key *apiKey
+	if pooled {
+		key = t.keys.pick()
+	}
+	if key != nil {
+		r.Header.Set("x-api-key", key.value)
+		r.Header.Add("x-forwarded-for", key.value)
+	}
 
 	// Measure rate limiter wait time
-	if rl != nil {
+	rateLimiterStart := time.Now()
+	if err := rl.Wait(r.Context()); err != nil {
+		// Context canceled or deadline exceeded - return error
+		return nil, err
+	}
+	rateLimiterWait = time.Since(rateLimiterStart)
+	if key != nil {
 		rateLimiterStart := time.Now()
-		if err := rl.Wait(r.Context()); err != nil {
-			// Context canceled or deadline exceeded - return error
+		if err := key.limiter(endpointType).Wait(r.Context()); err != nil {
 			return nil, err
 		}
-		rateLimiterWait = time.Since(rateLimiterStart)
+		rateLimiterWait += time.Since(rateLimiterStart)
 	}
+	// the slot only covers the wait for a token; the round trip itself is not scheduled
+	release()
 
-	// In dev mode, always use the first transport (no round robin)
-	// In production, round robin through transports
-	rt = t.rt[n%int64(len(t.rt))]
+	// The transport goes with the rate limiter picked above, so both belong to the same IP
+	rt := t.rt[idx%len(t.rt)]
+
+	var recordKey string
+	if t.recorder != nil {
+		if recordKey, err = recordingKey(r); err != nil {
+			return nil, err
+		}
+	}
 
 	logger.Debug("FORWARDING_REQUEST", map[string]any{
 		logging.METHOD:   r.Method,
@@ -257,7 +464,9 @@ func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
 	})
 
 	// Make the actual request
+	rl.inFlight.Add(1)
 	resp, err := rt.RoundTrip(r)
+	rl.inFlight.Add(-1)
 	duration := time.Since(startTime)
 
 	// Determine status code for metrics
@@ -279,9 +488,31 @@ func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
 		logger.Warn("METRICS_CHANNEL_FULL", errors.New("unable to process zeus metrics"), nil)
 	}
 
+	rl.observe(resp, err)
+	rl.breaker.observe(resp, err)
+	if key != nil && err == nil {
+		t.keys.observe(key, resp)
+	}
+
+	if rule != nil && err == nil {
+		resp = t.cache.store(r, rule, storeKey, resp)
+	}
+	if t.recorder != nil && err == nil {
+		resp = t.recorder.record(r, recordKey, resp)
+	}
+
 	return resp, err
 }
 
+// unauthorizedResponse answers a caller without a valid client token without going upstream
+func unauthorizedResponse(r *http.Request) *http.Response {
+	return (&bufferedResponse{
+		StatusCode: http.StatusUnauthorized,
+		Header:     http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		Body:       []byte(http.StatusText(http.StatusUnauthorized)),
+	}).toResponse(r)
+}
+
 // httputilLogWriter adapts our structured logger to work with httputil.ReverseProxy
 type httputilLogWriter struct {
 	logger logging.Logger
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"raidhub/lib/monitoring/zeus_metrics"
+	"raidhub/lib/utils/logging"
+)
+
+const (
+	// PRIORITY_HEADER carries the caller's priority class, as sent by lib/web/bungie
+	PRIORITY_HEADER = "X-Zeus-Priority"
+	// SHED_HEADER marks a response Zeus answered itself because it was too busy to queue the request
+	SHED_HEADER = "X-Zeus-Shed"
+)
+
+// priorityClass is a scheduling class, ordered from most to least important
+type priorityClass int
+
+const (
+	priorityCritical priorityClass = iota
+	priorityHigh
+	priorityNormal
+	priorityLow
+	numPriorityClasses
+)
+
+var priorityNames = [numPriorityClasses]string{"critical", "high", "normal", "low"}
+
+// priorityWeights are each class's share of admissions while every class has requests waiting
+var priorityWeights = [numPriorityClasses]float64{8, 4, 2, 1}
+
+func (p priorityClass) String() string {
+	return priorityNames[p]
+}
+
+// parsePriority reads r's priority header. Callers that send none, or an unknown class, are normal.
+func parsePriority(r *http.Request) priorityClass {
+	name := r.Header.Get(PRIORITY_HEADER)
+	for p, n := range priorityNames {
+		if n == name {
+			return priorityClass(p)
+		}
+	}
+	return priorityNormal
+}
+
+// queuedRequest is a request waiting for one of the scheduler's slots
+type queuedRequest struct {
+	finish   float64 // virtual finish time; the lowest across the queue heads is admitted next
+	enqueued time.Time
+	ready    chan bool // receives true when admitted, false when shed
+}
+
+// fairScheduler admits requests to the rate limiters of one endpoint class with weighted fair
+// queueing. Only slots requests wait on the limiters at once; the rest queue per priority class. A
+// class with weight w is admitted w times as often as a class with weight 1 while both have requests
+// waiting, and no class starves. When the queues are full the lowest class waiting is shed first.
+type fairScheduler struct {
+	endpointType string
+	slots        int
+	maxQueued    int
+
+	mu          sync.Mutex
+	inUse       int
+	queued      int
+	queues      [numPriorityClasses][]*queuedRequest
+	lastFinish  [numPriorityClasses]float64
+	virtualTime float64
+}
+
+func newFairScheduler(endpointType string, slots, maxQueued int) *fairScheduler {
+	return &fairScheduler{
+		endpointType: endpointType,
+		slots:        max(1, slots),
+		maxQueued:    maxQueued,
+	}
+}
+
+// acquire waits until r may go on to the rate limiters. It returns false when r was shed, and an error
+// when the caller gave up first. A successful acquire must be followed by release.
+func (s *fairScheduler) acquire(ctx context.Context, class priorityClass) (bool, error) {
+	s.mu.Lock()
+	if s.inUse < s.slots && s.queued == 0 {
+		s.inUse++
+		s.mu.Unlock()
+		zeus_metrics.SchedulerWait.WithLabelValues(s.endpointType, class.String()).Observe(0)
+		return true, nil
+	}
+	if s.queued >= s.maxQueued && !s.shedBelowLocked(class) {
+		s.mu.Unlock()
+		s.shed(class)
+		return false, nil
+	}
+
+	q := &queuedRequest{
+		finish:   max(s.virtualTime, s.lastFinish[class]) + 1/priorityWeights[class],
+		enqueued: time.Now(),
+		ready:    make(chan bool, 1),
+	}
+	s.lastFinish[class] = q.finish
+	s.queues[class] = append(s.queues[class], q)
+	s.queued++
+	zeus_metrics.SchedulerQueued.WithLabelValues(s.endpointType, class.String()).Inc()
+	s.mu.Unlock()
+
+	select {
+	case admitted := <-q.ready:
+		if !admitted {
+			s.shed(class)
+			return false, nil
+		}
+		zeus_metrics.SchedulerWait.WithLabelValues(s.endpointType, class.String()).Observe(float64(time.Since(q.enqueued).Milliseconds()))
+		return true, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		if s.removeLocked(class, q) {
+			s.mu.Unlock()
+			return false, ctx.Err()
+		}
+		s.mu.Unlock()
+		// admitted or shed while giving up; a slot handed over must be passed on
+		if <-q.ready {
+			s.release()
+		}
+		return false, ctx.Err()
+	}
+}
+
+// release frees a slot, handing it straight to the next request in fair order
+func (s *fairScheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next, class := s.nextLocked()
+	if next == nil {
+		s.inUse--
+		return
+	}
+	s.queues[class] = s.queues[class][1:]
+	s.queued--
+	s.virtualTime = next.finish
+	zeus_metrics.SchedulerQueued.WithLabelValues(s.endpointType, class.String()).Dec()
+	next.ready <- true
+}
+
+// nextLocked returns the queue head with the lowest virtual finish time
+func (s *fairScheduler) nextLocked() (*queuedRequest, priorityClass) {
+	var next *queuedRequest
+	var nextClass priorityClass
+	for class := range numPriorityClasses {
+		if len(s.queues[class]) == 0 {
+			continue
+		}
+		if head := s.queues[class][0]; next == nil || head.finish < next.finish {
+			next, nextClass = head, class
+		}
+	}
+	return next, nextClass
+}
+
+// shedBelowLocked makes room for a request of class by shedding the newest request of the lowest
+// class waiting below it. It reports false when nothing waiting is less important.
+func (s *fairScheduler) shedBelowLocked(class priorityClass) bool {
+	for victim := numPriorityClasses - 1; victim > class; victim-- {
+		queue := s.queues[victim]
+		if len(queue) == 0 {
+			continue
+		}
+		q := queue[len(queue)-1]
+		s.queues[victim] = queue[:len(queue)-1]
+		s.queued--
+		zeus_metrics.SchedulerQueued.WithLabelValues(s.endpointType, victim.String()).Dec()
+		q.ready <- false
+		return true
+	}
+	return false
+}
+
+func (s *fairScheduler) removeLocked(class priorityClass, q *queuedRequest) bool {
+	for i, waiting := range s.queues[class] {
+		if waiting == q {
+			s.queues[class] = append(s.queues[class][:i], s.queues[class][i+1:]...)
+			s.queued--
+			zeus_metrics.SchedulerQueued.WithLabelValues(s.endpointType, class.String()).Dec()
+			return true
+		}
+	}
+	return false
+}
+
+func (s *fairScheduler) shed(class priorityClass) {
+	zeus_metrics.SchedulerShed.WithLabelValues(s.endpointType, class.String()).Inc()
+	logger.Debug("REQUEST_SHED", map[string]any{
+		"class":        s.endpointType,
+		"priority":     class.String(),
+		logging.REASON: "queue_full",
+		"queue_max":    s.maxQueued,
+	})
+}
+
+// shedResponse answers a shed request without going upstream. Callers treat it like any other
+// unavailable response and retry with backoff.
+func shedResponse(r *http.Request) *http.Response {
+	resp := (&bufferedResponse{
+		StatusCode: http.StatusServiceUnavailable,
+		Header:     http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		Body:       []byte("Zeus is saturated; request shed"),
+	}).toResponse(r)
+	resp.Header.Set("Retry-After", "1")
+	resp.Header.Set(SHED_HEADER, "1")
+	return resp
+}
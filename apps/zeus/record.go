@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"raidhub/lib/utils/logging"
+)
+
+const (
+	// REPLAY_HEADER tells the caller how replay mode answered: HIT, MISS, or FAIL (injected)
+	REPLAY_HEADER = "X-Zeus-Replay"
+	// recordMaxBodyBytes keeps runaway bodies off disk; the manifest index is well under this
+	recordMaxBodyBytes = 64 << 20
+	// recordMaxRequestBodyBytes is how much of a request body is hashed into its recording key
+	recordMaxRequestBodyBytes = 1 << 20
+)
+
+// Replay miss policies: what replay mode does with a request it has no recording for
+const (
+	replayMiss404         = "404"
+	replayMiss503         = "503"
+	replayMissPassthrough = "passthrough"
+)
+
+// recording is one upstream response on disk. The request fields are only there to make the files
+// readable; lookups go by the file name.
+type recording struct {
+	Key        string    `json:"key"`
+	Method     string    `json:"method"`
+	Host       string    `json:"host"`
+	Path       string    `json:"path"`
+	Query      string    `json:"query,omitempty"`
+	RecordedAt time.Time `json:"recorded_at"`
+	bufferedResponse
+}
+
+// recordingKey normalizes a request so retries and reordered query parameters find the same
+// recording. Request bodies are hashed in, so different POSTs to one path are kept apart.
+func recordingKey(r *http.Request) (string, error) {
+	query := r.URL.Query()
+	for _, param := range coalesceIgnoredParams {
+		query.Del(param)
+	}
+	path := strings.ToLower(r.URL.Path)
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	key := fmt.Sprintf("%s %s %s?%s", r.Method, r.Host, path, query.Encode())
+
+	if r.Body == nil || r.Body == http.NoBody {
+		return key, nil
+	}
+	// Only a prefix is hashed, and it goes back in front of the unread rest so the whole body is still
+	// proxied. Bodies that only differ past the prefix share a recording.
+	body, err := io.ReadAll(io.LimitReader(r.Body, recordMaxRequestBodyBytes))
+	if err != nil {
+		return "", err
+	}
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if len(body) == 0 {
+		return key, nil
+	}
+	sum := sha256.Sum256(body)
+	return key + " " + hex.EncodeToString(sum[:8]), nil
+}
+
+// recordingPath is where the recording for key lives under dir, grouped by host
+func recordingPath(dir, host, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, host, hex.EncodeToString(sum[:])+".json")
+}
+
+// recorder writes upstream responses to disk, one file per normalized request
+type recorder struct {
+	dir string
+}
+
+// record saves resp under r's key and returns a response the proxy can still read the body of.
+// Throttled and server error responses are not recorded, since replaying them would only reproduce
+// a bad moment upstream; failure injection covers that instead.
+func (rec *recorder) record(r *http.Request, key string, resp *http.Response) *http.Response {
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || isCloudflareChallenge(resp) {
+		return resp
+	}
+	body, complete := peekBody(resp, recordMaxBodyBytes)
+	if !complete {
+		return resp
+	}
+
+	// Recordings are stored decoded so they replay to callers whatever their Accept-Encoding
+	header := resp.Header.Clone()
+	if strings.EqualFold(header.Get("Content-Encoding"), "gzip") {
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return resp
+		}
+		decoded, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return resp
+		}
+		body = decoded
+		header.Del("Content-Encoding")
+	}
+	for _, h := range []string{"Content-Length", "Set-Cookie", "Date", CACHE_STATUS_HEADER, COALESCED_HEADER} {
+		header.Del(h)
+	}
+
+	data, err := json.MarshalIndent(recording{
+		Key:        key,
+		Method:     r.Method,
+		Host:       r.Host,
+		Path:       r.URL.Path,
+		Query:      r.URL.RawQuery,
+		RecordedAt: time.Now().UTC(),
+		bufferedResponse: bufferedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     header,
+			Body:       body,
+		},
+	}, "", "  ")
+	if err != nil {
+		return resp
+	}
+
+	path := recordingPath(rec.dir, r.Host, key)
+	if err := writeFileAtomic(path, data); err != nil {
+		logger.Warn("RECORDING_WRITE_FAILED", err, map[string]any{
+			logging.PATH: path,
+		})
+		return resp
+	}
+	logger.Debug("RESPONSE_RECORDED", map[string]any{
+		logging.ENDPOINT: r.URL.String(),
+		logging.PATH:     path,
+	})
+	return resp
+}
+
+// writeFileAtomic writes data through a temporary file so a concurrent replay never reads half of it
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".recording-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// replayer answers requests from recordings without touching the network
+type replayer struct {
+	dir      string
+	latency  time.Duration
+	jitter   time.Duration
+	failRate float64
+	miss     string
+}
+
+// replay returns the recorded response for r. It returns nil when there is no recording and the miss
+// policy is passthrough, in which case the request goes upstream as usual.
+func (rep *replayer) replay(r *http.Request, key string) (*http.Response, error) {
+	if err := rep.wait(r.Context()); err != nil {
+		return nil, err
+	}
+
+	if rep.failRate > 0 && rand.Float64() < rep.failRate {
+		return replayResponse(r, http.StatusServiceUnavailable, "FAIL", "injected failure"), nil
+	}
+
+	data, err := os.ReadFile(recordingPath(rep.dir, r.Host, key))
+	if err == nil {
+		var rec recording
+		if err = json.Unmarshal(data, &rec); err == nil {
+			resp := rec.bufferedResponse.toResponse(r)
+			resp.Header.Set(REPLAY_HEADER, "HIT")
+			return resp, nil
+		}
+	}
+	if !os.IsNotExist(err) {
+		logger.Warn("RECORDING_READ_FAILED", err, map[string]any{
+			logging.ENDPOINT: r.URL.String(),
+		})
+	}
+
+	logger.Debug("REPLAY_MISS", map[string]any{
+		logging.METHOD:   r.Method,
+		logging.ENDPOINT: r.URL.String(),
+		"key":            key,
+	})
+	switch rep.miss {
+	case replayMissPassthrough:
+		return nil, nil
+	case replayMiss503:
+		return replayResponse(r, http.StatusServiceUnavailable, "MISS", "no recording"), nil
+	default:
+		return replayResponse(r, http.StatusNotFound, "MISS", "no recording"), nil
+	}
+}
+
+// wait sleeps for the configured latency, returning early if the caller gives up
+func (rep *replayer) wait(ctx context.Context) error {
+	d := rep.latency
+	if rep.jitter > 0 {
+		d += rand.N(rep.jitter)
+	}
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func replayResponse(r *http.Request, status int, result string, message string) *http.Response {
+	resp := (&bufferedResponse{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		Body:       []byte(message),
+	}).toResponse(r)
+	resp.Header.Set(REPLAY_HEADER, result)
+	return resp
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecordingKeyKeepsWholeBody(t *testing.T) {
+	body := bytes.Repeat([]byte("a"), recordMaxRequestBodyBytes+10)
+	r := httptest.NewRequest("POST", "https://www.bungie.net/Platform/Destiny2/Actions/", bytes.NewReader(body))
+
+	key, err := recordingKey(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxied, err := io.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(proxied, body) {
+		t.Errorf("proxied body is %d bytes, want all %d", len(proxied), len(body))
+	}
+
+	// Retries of the same request find the same recording
+	again := httptest.NewRequest("POST", "https://www.bungie.net/Platform/Destiny2/Actions/", bytes.NewReader(body))
+	if retryKey, err := recordingKey(again); err != nil || retryKey != key {
+		t.Errorf("retry key = (%q, %v), want %q", retryKey, err, key)
+	}
+}
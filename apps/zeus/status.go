@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+var startedAt = time.Now()
+
+// Overall health, as reported by /healthz and /status
+const (
+	healthOK       = "ok"       // every circuit closed
+	healthDegraded = "degraded" // some circuits open, every endpoint class still has a way out
+	healthDown     = "down"     // every circuit of an endpoint class is open
+)
+
+type limiterStatus struct {
+	Rate         float64       `json:"rate"`
+	Tokens       float64       `json:"tokens"`
+	BenchedUntil *time.Time    `json:"benched_until,omitempty"`
+	InFlight     int64         `json:"in_flight"`
+	Breaker      breakerStatus `json:"breaker"`
+}
+
+type transportStatus struct {
+	IP    string        `json:"ip"`
+	Stats limiterStatus `json:"stats"`
+	WWW   limiterStatus `json:"www"`
+}
+
+type zeusStatus struct {
+	Status     string            `json:"status"`
+	Uptime     string            `json:"uptime"`
+	Transports []transportStatus `json:"transports"`
+}
+
+func (l *adaptiveLimiter) status(now time.Time) limiterStatus {
+	l.mu.Lock()
+	s := limiterStatus{Rate: l.rate}
+	if now.Before(l.benchedUntil) {
+		benchedUntil := l.benchedUntil
+		s.BenchedUntil = &benchedUntil
+	}
+	l.mu.Unlock()
+	s.Tokens = l.TokensAt(now)
+	s.InFlight = l.inFlight.Load()
+	s.Breaker = l.breaker.status()
+	return s
+}
+
+// health sums up the breakers of every transport
+func (t *transport) health(now time.Time) string {
+	health := healthOK
+	for _, limiters := range [][]*adaptiveLimiter{t.statsRl, t.wwwRl} {
+		usable := 0
+		for _, l := range limiters {
+			if l.breaker.current() != circuitClosed {
+				health = healthDegraded
+			}
+			if l.breaker.available(now) {
+				usable++
+			}
+		}
+		if usable == 0 {
+			return healthDown
+		}
+	}
+	return health
+}
+
+// serveHealth answers /healthz: 200 while every endpoint class has a usable circuit, 503 otherwise
+func (t *transport) serveHealth(w http.ResponseWriter, r *http.Request) {
+	health := t.health(time.Now())
+	status := http.StatusOK
+	if health == healthDown {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, map[string]string{"status": health})
+}
+
+// serveStatus answers /status with the limiter, breaker, and in-flight state of every transport
+func (t *transport) serveStatus(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	s := zeusStatus{
+		Status: t.health(now),
+		Uptime: now.Sub(startedAt).Round(time.Second).String(),
+	}
+	// statsRl and wwwRl are built in pairs, one of each per IP
+	for i := range min(len(t.statsRl), len(t.wwwRl)) {
+		s.Transports = append(s.Transports, transportStatus{
+			IP:    t.statsRl[i].ip,
+			Stats: t.statsRl[i].status(now),
+			WWW:   t.wwwRl[i].status(now),
+		})
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Debug("STATUS_WRITE_FAILED", map[string]any{"error": err.Error()})
+	}
+}
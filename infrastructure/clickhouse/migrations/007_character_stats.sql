@@ -0,0 +1,14 @@
+-- Every extended value, medal, and weapon value per character, one entry per value.
+-- Mirrors extended.instance_character_stat in Postgres; kind is 'stat', 'medal', or 'weapon' and
+-- weapon_hash is 0 outside of weapon values. Rows inserted before this column existed start out
+-- empty; tools/backfill-extended-stats --clickhouse fills them from raw.pgcr.
+
+ALTER TABLE instance
+    ADD COLUMN IF NOT EXISTS character_stats Nested(
+        membership_id Int64,
+        character_id Int64,
+        weapon_hash UInt32,
+        kind LowCardinality(String),
+        name LowCardinality(String),
+        value Float64
+    );
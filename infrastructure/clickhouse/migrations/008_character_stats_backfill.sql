@@ -0,0 +1,18 @@
+-- Staging table for tools/backfill-extended-stats --clickhouse. Each batch of character stats is
+-- loaded here and copied onto instance.character_stats with an ALTER TABLE ... UPDATE mutation.
+-- Mutations don't fire the materialized views on instance, where re-inserting the rows would
+-- count them a second time.
+
+CREATE TABLE IF NOT EXISTS character_stats_backfill
+(
+    instance_id Int64,
+    character_stats Nested(
+        membership_id Int64,
+        character_id Int64,
+        weapon_hash UInt32,
+        kind LowCardinality(String),
+        name LowCardinality(String),
+        value Float64
+    )
+)
+ENGINE = Join(ANY, LEFT, instance_id);
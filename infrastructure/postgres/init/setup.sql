@@ -13,7 +13,7 @@ GRANT ALL PRIVILEGES ON DATABASE raidhub TO CURRENT_USER;
 
 -- Set default session parameters
 ALTER DATABASE raidhub SET timezone TO 'UTC';
-ALTER DATABASE raidhub SET search_path TO "public","core","definitions","clan","flagging","leaderboard","extended","raw","cache","subscriptions";
+ALTER DATABASE raidhub SET search_path TO "public","core","definitions","clan","flagging","leaderboard","extended","raw","cache","subscriptions","atlas";
 
 -- Create public schemas
 CREATE SCHEMA IF NOT EXISTS "core";
@@ -25,6 +25,7 @@ CREATE SCHEMA IF NOT EXISTS "raw";
 CREATE SCHEMA IF NOT EXISTS "flagging";
 CREATE SCHEMA IF NOT EXISTS "cache";
 CREATE SCHEMA IF NOT EXISTS "subscriptions";
+CREATE SCHEMA IF NOT EXISTS "atlas";
 
 -- Create readonly user (ignore if already exists) - hardcoded as readonly with password 'password'
 DO $$
@@ -45,6 +46,7 @@ GRANT USAGE ON SCHEMA "extended" TO readonly;
 GRANT USAGE ON SCHEMA "raw" TO readonly;
 GRANT USAGE ON SCHEMA "flagging" TO readonly;
 GRANT USAGE ON SCHEMA "subscriptions" TO readonly;
+GRANT USAGE ON SCHEMA "atlas" TO readonly;
 
 -- Set default privileges for future tables
 ALTER DEFAULT PRIVILEGES IN SCHEMA "core" GRANT SELECT ON TABLES TO readonly;
@@ -55,6 +57,7 @@ ALTER DEFAULT PRIVILEGES IN SCHEMA "extended" GRANT SELECT ON TABLES TO readonly
 ALTER DEFAULT PRIVILEGES IN SCHEMA "raw" GRANT SELECT ON TABLES TO readonly;
 ALTER DEFAULT PRIVILEGES IN SCHEMA "flagging" GRANT SELECT ON TABLES TO readonly;
 ALTER DEFAULT PRIVILEGES IN SCHEMA "subscriptions" GRANT SELECT ON TABLES TO readonly;
+ALTER DEFAULT PRIVILEGES IN SCHEMA "atlas" GRANT SELECT ON TABLES TO readonly;
 
 -- =============================================================================
 -- MIGRATION TRACKING
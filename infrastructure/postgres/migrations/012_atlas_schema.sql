@@ -0,0 +1,26 @@
+-- RaidHub Services - Atlas Schema Migration
+-- Crawler state owned by Atlas (cursor checkpoints survive restarts and deploys)
+
+-- =============================================================================
+-- SCHEMA CREATION
+-- =============================================================================
+
+CREATE SCHEMA IF NOT EXISTS "atlas";
+
+-- =============================================================================
+-- ATLAS TABLES
+-- =============================================================================
+
+-- One row per crawler. Atlas upserts this periodically and on shutdown.
+-- "cursor" is the last id handed to a worker; "low_water_mark" is the smallest id
+-- that was handed out but not yet resolved, so resuming from it never skips an id.
+CREATE TABLE "atlas"."crawl_checkpoint" (
+    "crawler" TEXT NOT NULL PRIMARY KEY,
+    "cursor" BIGINT NOT NULL,
+    "low_water_mark" BIGINT NOT NULL,
+    "pending_offload_ids" BIGINT[] NOT NULL DEFAULT '{}',
+    "updated_at" TIMESTAMPTZ(3) NOT NULL DEFAULT NOW()
+);
+
+GRANT USAGE ON SCHEMA "atlas" TO readonly;
+GRANT SELECT ON "atlas"."crawl_checkpoint" TO readonly;
@@ -0,0 +1,30 @@
+-- RaidHub Services - Missed PGCR Ledger Migration
+-- Replaces the MISSED_PGCR_LOG_FILE_PATH append-only file with a shared ledger that any
+-- component can write to and process-missed-pgcrs can claim from, regardless of host.
+
+-- =============================================================================
+-- MISSED PGCR LEDGER
+-- =============================================================================
+
+-- One row per missed instance. Writers upsert: a repeat miss bumps "attempts" and "last_seen_at"
+-- and puts the row back to pending. process-missed-pgcrs claims pending rows with
+-- FOR UPDATE SKIP LOCKED, so concurrent runs never work on the same instance.
+CREATE TABLE "atlas"."missed_pgcr" (
+    "instance_id" BIGINT NOT NULL PRIMARY KEY,
+    "reason" TEXT NOT NULL,
+    "source" TEXT NOT NULL,
+    "attempts" INTEGER NOT NULL DEFAULT 1,
+    "first_seen_at" TIMESTAMPTZ(3) NOT NULL DEFAULT NOW(),
+    "last_seen_at" TIMESTAMPTZ(3) NOT NULL DEFAULT NOW(),
+    "status" TEXT NOT NULL DEFAULT 'pending',
+    "claimed_at" TIMESTAMPTZ(3),
+    "resolved_at" TIMESTAMPTZ(3),
+    CONSTRAINT "missed_pgcr_reason_chk" CHECK ("reason" IN ('not_found', 'malformed', 'external_error', 'blocked')),
+    CONSTRAINT "missed_pgcr_status_chk" CHECK ("status" IN ('pending', 'claimed', 'resolved', 'abandoned'))
+);
+
+-- Claim order is by instance id; only unresolved rows are ever scanned
+CREATE INDEX "idx_missed_pgcr_unresolved" ON "atlas"."missed_pgcr" ("instance_id")
+    WHERE "status" IN ('pending', 'claimed');
+
+GRANT SELECT ON "atlas"."missed_pgcr" TO readonly;
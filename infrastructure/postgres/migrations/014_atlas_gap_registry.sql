@@ -0,0 +1,37 @@
+-- RaidHub Services - Atlas Gap Registry Migration
+-- Gaps Atlas skips over are kept as ranges instead of being expanded into the missed PGCR ledger,
+-- so a backfill worker can sweep them later and report how much of each gap held real raids.
+
+-- =============================================================================
+-- GAP REGISTRY
+-- =============================================================================
+
+-- One row per skipped range [start_id, end_id). "cursor" is the next id the backfill sweeps; the
+-- counters say how the ids before it resolved. Backfill workers claim rows with FOR UPDATE SKIP LOCKED,
+-- stamping "claimed_by", and refresh "claimed_at" as they go, so a crashed sweep is picked up again once
+-- it goes stale. Progress is only written by the current claimant.
+CREATE TABLE "atlas"."gap" (
+    "gap_id" BIGSERIAL NOT NULL PRIMARY KEY,
+    "start_id" BIGINT NOT NULL,
+    "end_id" BIGINT NOT NULL,
+    "detected_at" TIMESTAMPTZ(3) NOT NULL DEFAULT NOW(),
+    "method" TEXT NOT NULL,
+    "status" TEXT NOT NULL DEFAULT 'pending',
+    "cursor" BIGINT NOT NULL,
+    "raids" BIGINT NOT NULL DEFAULT 0,
+    "non_raids" BIGINT NOT NULL DEFAULT 0,
+    "not_found" BIGINT NOT NULL DEFAULT 0,
+    "errors" BIGINT NOT NULL DEFAULT 0,
+    "claimed_by" TEXT,
+    "claimed_at" TIMESTAMPTZ(3),
+    "completed_at" TIMESTAMPTZ(3),
+    CONSTRAINT "gap_range_chk" CHECK ("start_id" < "end_id"),
+    CONSTRAINT "gap_cursor_chk" CHECK ("cursor" BETWEEN "start_id" AND "end_id"),
+    CONSTRAINT "gap_method_chk" CHECK ("method" IN ('binary_search', 'control_api', 'manual')),
+    CONSTRAINT "gap_status_chk" CHECK ("status" IN ('pending', 'backfilling', 'complete'))
+);
+
+CREATE INDEX "idx_gap_unfinished" ON "atlas"."gap" ("start_id")
+    WHERE "status" <> 'complete';
+
+GRANT SELECT ON "atlas"."gap" TO readonly;
@@ -0,0 +1,58 @@
+-- RaidHub Services - Activity Instance Schema Migration
+-- Storage for PGCRs of accepted non-raid activity modes (PGCR_ACCEPTED_MODES), starting with dungeons.
+-- Raids keep using "instance"; these tables have no foreign key into the raid definitions and
+-- nothing downstream of raids (sherpas, player_stats, leaderboards, cheat checks) reads them.
+
+-- =============================================================================
+-- ACTIVITY INSTANCE TABLES
+-- =============================================================================
+
+CREATE TABLE "core"."activity_instance" (
+    "instance_id" BIGINT NOT NULL PRIMARY KEY,
+    "mode" INTEGER NOT NULL,
+    "hash" BIGINT NOT NULL,
+    "score" INT NOT NULL DEFAULT 0,
+    "flawless" BOOLEAN,
+    "completed" BOOLEAN NOT NULL,
+    "fresh" BOOLEAN,
+    "player_count" INTEGER NOT NULL,
+    "date_started" TIMESTAMPTZ(0) NOT NULL,
+    "date_completed" TIMESTAMPTZ(0) NOT NULL,
+    "duration" INTEGER NOT NULL,
+    "platform_type" INTEGER NOT NULL,
+    "skull_hashes" BIGINT[]
+);
+
+CREATE INDEX "idx_activity_instance_mode_hash" ON "core"."activity_instance"("mode", "hash", "date_completed");
+
+CREATE TABLE "core"."activity_instance_player" (
+    "instance_id" BIGINT NOT NULL,
+    "membership_id" BIGINT NOT NULL,
+    "completed" BOOLEAN NOT NULL,
+    "time_played_seconds" INTEGER NOT NULL DEFAULT 0,
+    CONSTRAINT "activity_instance_player_pkey" PRIMARY KEY ("instance_id","membership_id"),
+    CONSTRAINT "activity_instance_player_instance_id_fkey" FOREIGN KEY ("instance_id") REFERENCES "core"."activity_instance"("instance_id") ON DELETE RESTRICT ON UPDATE NO ACTION,
+    CONSTRAINT "activity_instance_player_membership_id_fkey" FOREIGN KEY ("membership_id") REFERENCES "core"."player"("membership_id") ON DELETE RESTRICT ON UPDATE NO ACTION
+);
+CREATE INDEX "idx_activity_instance_player_membership_id" ON "core"."activity_instance_player"("membership_id");
+
+CREATE TABLE "extended"."activity_instance_character" (
+    "instance_id" BIGINT NOT NULL,
+    "membership_id" BIGINT NOT NULL,
+    "character_id" BIGINT NOT NULL,
+    "class_hash" BIGINT,
+    "emblem_hash" BIGINT,
+    "completed" BOOLEAN NOT NULL,
+    "score" INTEGER NOT NULL DEFAULT 0,
+    "kills" INTEGER NOT NULL DEFAULT 0,
+    "assists" INTEGER NOT NULL DEFAULT 0,
+    "deaths" INTEGER NOT NULL DEFAULT 0,
+    "precision_kills" INTEGER NOT NULL DEFAULT 0,
+    "super_kills" INTEGER NOT NULL DEFAULT 0,
+    "grenade_kills" INTEGER NOT NULL DEFAULT 0,
+    "melee_kills" INTEGER NOT NULL DEFAULT 0,
+    "time_played_seconds" INTEGER NOT NULL DEFAULT 0,
+    "start_seconds" INTEGER NOT NULL DEFAULT 0,
+    CONSTRAINT "activity_instance_character_pkey" PRIMARY KEY ("instance_id","membership_id","character_id"),
+    CONSTRAINT "activity_instance_character_player_fkey" FOREIGN KEY ("instance_id","membership_id") REFERENCES "core"."activity_instance_player"("instance_id","membership_id") ON DELETE RESTRICT ON UPDATE NO ACTION
+);
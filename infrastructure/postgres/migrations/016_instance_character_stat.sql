@@ -0,0 +1,26 @@
+-- RaidHub Services - Extended Character Stats Migration
+-- Every extended value Bungie reports for a character in a raid PGCR: medals, ability kills, and the
+-- per-weapon values, not only the handful of columns on instance_character and instance_character_weapon.
+-- Stored as one row per value so new keys from Bungie need no migration. Historical instances are filled
+-- from raw.pgcr by tools/backfill-extended-stats.
+
+-- =============================================================================
+-- EXTENDED CHARACTER STAT TABLE
+-- =============================================================================
+
+CREATE TABLE "extended"."instance_character_stat" (
+    "instance_id" BIGINT NOT NULL,
+    "membership_id" BIGINT NOT NULL,
+    "character_id" BIGINT NOT NULL,
+    -- 0 for the character's own extended values and medals
+    "weapon_hash" BIGINT NOT NULL DEFAULT 0,
+    "kind" TEXT NOT NULL,
+    "name" TEXT NOT NULL,
+    "value" DOUBLE PRECISION NOT NULL,
+    CONSTRAINT "instance_character_stat_pkey" PRIMARY KEY ("instance_id","membership_id","character_id","weapon_hash","name"),
+    CONSTRAINT "instance_character_stat_kind_check" CHECK ("kind" IN ('stat', 'medal', 'weapon')),
+    CONSTRAINT "instance_character_stat_fkey" FOREIGN KEY ("instance_id","membership_id","character_id") REFERENCES "extended"."instance_character"("instance_id","membership_id","character_id") ON DELETE RESTRICT ON UPDATE NO ACTION
+);
+
+CREATE INDEX "instance_character_stat_idx_membership_id" ON "extended"."instance_character_stat"("membership_id");
+CREATE INDEX "instance_character_stat_idx_kind_name" ON "extended"."instance_character_stat"("kind", "name");
@@ -0,0 +1,40 @@
+-- RaidHub Services - Bungie System Availability Migration
+-- History of Bungie API systems (as reported by the Settings endpoint) going down and coming back,
+-- so outages can be looked up and measured after the fact.
+
+-- =============================================================================
+-- SCHEMA CREATION
+-- =============================================================================
+
+CREATE SCHEMA IF NOT EXISTS "monitoring";
+
+-- =============================================================================
+-- BUNGIE SYSTEM AVAILABILITY
+-- =============================================================================
+
+-- Current state of each system. Every Hermes and Atlas process runs its own availability monitor;
+-- a process only records a transition when it flips this row, so each transition is stored (and
+-- alerted on) once however many processes saw it.
+CREATE TABLE "monitoring"."bungie_system" (
+    "system" TEXT NOT NULL PRIMARY KEY,
+    "available" BOOLEAN NOT NULL,
+    "since" TIMESTAMPTZ(3) NOT NULL,
+    "source" TEXT NOT NULL
+);
+
+-- One row per transition. "previous_duration" is how long the system had been in the state it left.
+CREATE TABLE "monitoring"."bungie_system_transition" (
+    "transition_id" BIGSERIAL NOT NULL PRIMARY KEY,
+    "system" TEXT NOT NULL,
+    "available" BOOLEAN NOT NULL,
+    "at" TIMESTAMPTZ(3) NOT NULL,
+    "source" TEXT NOT NULL,
+    "previous_duration" INTERVAL,
+    CONSTRAINT "bungie_system_transition_source_chk" CHECK ("source" IN ('settings', 'system_disabled_signal', 'fail_open'))
+);
+
+CREATE INDEX "idx_bungie_system_transition_system_at" ON "monitoring"."bungie_system_transition" ("system", "at" DESC);
+
+GRANT USAGE ON SCHEMA "monitoring" TO readonly;
+GRANT SELECT ON "monitoring"."bungie_system" TO readonly;
+GRANT SELECT ON "monitoring"."bungie_system_transition" TO readonly;
@@ -2,10 +2,13 @@ package dto
 
 import (
 	"time"
+
+	"raidhub/lib/web/bungie"
 )
 
 type Instance struct {
 	InstanceId      int64            `json:"instanceId"`
+	Mode            int              `json:"mode"` // 0 on messages from before modes were tracked, which were all raids
 	Hash            uint32           `json:"hash"`
 	Completed       bool             `json:"completed"`
 	Flawless        *bool            `json:"flawless"`
@@ -20,6 +23,11 @@ type Instance struct {
 	SkullHashes     []uint32         `json:"skullHashes"`
 }
 
+// IsRaid reports whether the instance is a raid rather than another accepted activity mode
+func (i *Instance) IsRaid() bool {
+	return i.Mode == 0 || i.Mode == bungie.ModeRaid
+}
+
 type InstancePlayer struct {
 	Finished          bool                `json:"finished"`
 	TimePlayedSeconds int                 `json:"timePlayedSeconds"`
@@ -45,10 +53,14 @@ type InstanceCharacter struct {
 	StartSeconds      int                       `json:"startSeconds"`
 	TimePlayedSeconds int                       `json:"timePlayedSeconds"`
 	Weapons           []InstanceCharacterWeapon `json:"weapons"`
+	ExtendedStats     map[string]float64        `json:"extendedStats,omitempty"` // every extended value that is not a medal
+	Medals            map[string]float64        `json:"medals,omitempty"`
 }
 
 type InstanceCharacterWeapon struct {
 	WeaponHash     uint32 `json:"weaponHash"`
 	Kills          int    `json:"kills"`
 	PrecisionKills int    `json:"precisionKills"`
+	// Stats holds every value Bungie reports for the weapon, including the kill types above
+	Stats map[string]float64 `json:"stats,omitempty"`
 }
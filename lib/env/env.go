@@ -2,8 +2,10 @@ package env
 
 import (
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -21,6 +23,7 @@ var (
 	RabbitMQUser     string
 	RabbitMQPassword string
 	RabbitMQPort     string
+	RabbitMQUIPort   string // management API, for queue message rates
 
 	// ClickHouse
 	ClickHouseHost     string
@@ -43,8 +46,12 @@ var (
 
 	// API
 	BungieAPIKey string
-	ZeusAPIKeys  string
+	ZeusAPIKeys  string // comma-separated Bungie API keys Zeus rotates through; BungieAPIKey alone when empty
 	ZeusIPV6     string
+	// ZeusClientTokens is the comma-separated name:token list Zeus accepts from callers. Empty leaves Zeus open.
+	ZeusClientTokens string
+	// ZeusClientToken is the token this process sends to Zeus
+	ZeusClientToken string
 
 	// Webhooks (optional)
 	AtlasWebhookURL      string
@@ -54,6 +61,10 @@ var (
 	NemesisWebhookURL    string
 	GMReportWebhookURL   string
 	GMReportWebhookAuth  string
+	// BungieStatusWebhookURL receives alerts when a Bungie API system goes down or comes back. Optional.
+	BungieStatusWebhookURL string
+	// ContestWebhookURL receives an alert each time a service switches to or from the contest profile. Optional.
+	ContestWebhookURL string
 	// SubscriptionHTTPWebhookSecret is sent as X-RaidHub-Key on http_callback POSTs.
 	// Optional at process start; subscription delivery enforces it when posting http_callback.
 	SubscriptionHTTPWebhookSecret string
@@ -62,11 +73,41 @@ var (
 	// SubscriptionDestDisableAfterConsecutiveFailures sets subscriptions.destination is_active false after this many recorded failures (default 10). See RecordDestinationDeliveryOutcome.
 	SubscriptionDestDisableAfterConsecutiveFailures int
 
+	// AtlasControlToken is the bearer token for the Atlas control API on the metrics port.
+	// Optional; the control API is not served when unset.
+	AtlasControlToken string
+
+	// HermesAdminToken is the bearer token for the Hermes admin API on the metrics port.
+	// Optional; the admin API is not served when unset.
+	HermesAdminToken string
+
+	// HermesBungieBudget is the Bungie requests per second shared by the Hermes topics that declare a
+	// BungieRequestWeight (default 0, no budget)
+	HermesBungieBudget int
+
+	// BungieSettingsFailOpenMinutes unblocks every Bungie system after the Settings endpoint has been
+	// unreachable this long (default 10). 0 keeps systems blocked until Settings answers again.
+	BungieSettingsFailOpenMinutes int
+
+	// BungieSchemaCheckEvery compares 1 in this many Bungie responses of each operation against the types
+	// they decode into, to catch schema drift (default 0, off). Offending payloads are kept under
+	// BungieSchemaSampleDir.
+	BungieSchemaCheckEvery int
+	BungieSchemaSampleDir  string
+
+	// PGCRAcceptedModes are the activity modes the PGCR pipeline turns into instances.
+	// Raids (4) are always accepted; anything else is listed in PGCR_ACCEPTED_MODES, e.g. "4,82" for dungeons.
+	PGCRAcceptedModes []int
+
+	// IsContestWeekend runs Hermes and Atlas on the contest profile for the life of the process.
+	// ContestWeekendStart and ContestWeekendEnd (RFC 3339) switch it on and off on a schedule instead.
+	IsContestWeekend    bool
+	ContestWeekendStart time.Time
+	ContestWeekendEnd   time.Time
+
 	// Other
-	IsContestWeekend      bool
-	MissedPGCRLogFilePath string
-	EnvPath               string
-	LogLevel              string
+	EnvPath  string
+	LogLevel string
 
 	// Prometheus API (for querying metrics, not the exporter)
 	PrometheusPort string
@@ -91,6 +132,10 @@ var (
 
 var envIssues []string
 
+// malformedEnv lists variables that are set but can't be parsed, where running on the zero value
+// would silently change behavior
+var malformedEnv []string
+
 func init() {
 
 	envPaths := []string{".env"}
@@ -122,6 +167,7 @@ func init() {
 	RabbitMQUser = getEnvWithDefault("RABBITMQ_USER", "dev")
 	RabbitMQPassword = getEnvWithDefault("RABBITMQ_PASSWORD", "password")
 	RabbitMQPort = requireEnv("RABBITMQ_PORT")
+	RabbitMQUIPort = getEnvWithDefault("RABBITMQ_UI_PORT", "15672")
 
 	// ClickHouse (defaults: user=default, password=, db=default)
 	ClickHouseHost = getHostEnv("CLICKHOUSE_HOST")
@@ -140,6 +186,8 @@ func init() {
 	ZeusPort = getHostEnv("ZEUS_PORT")
 	ZeusAPIKeys = getEnv("ZEUS_API_KEYS")
 	ZeusIPV6 = getEnvWithDefault("ZEUS_IPV6", "")
+	ZeusClientTokens = getEnv("ZEUS_CLIENT_TOKENS")
+	ZeusClientToken = getEnv("ZEUS_CLIENT_TOKEN")
 
 	// API
 	BungieAPIKey = requireEnv("BUNGIE_API_KEY")
@@ -148,15 +196,28 @@ func init() {
 	AtlasWebhookURL = getEnv("ATLAS_WEBHOOK_URL")
 	HadesWebhookURL = getEnv("HADES_WEBHOOK_URL")
 	CheatCheckWebhookURL = getEnv("CHEAT_CHECK_WEBHOOK_URL")
+	BungieStatusWebhookURL = getEnv("BUNGIE_STATUS_WEBHOOK_URL")
+	ContestWebhookURL = getEnv("CONTEST_WEBHOOK_URL")
 	AlertsRoleID = getEnv("DISCORD_ALERTS_ROLE_ID")
 
 	SubscriptionHTTPWebhookSecret = getEnv("SUBSCRIPTION_HTTP_WEBHOOK_SECRET")
 	SubscriptionWebhookRelayURL = getEnv("SUBSCRIPTION_WEBHOOK_RELAY_URL")
 	SubscriptionDestDisableAfterConsecutiveFailures = getEnvIntPositiveWithDefault("SUBSCRIPTION_DEST_DISABLE_AFTER_CONSECUTIVE_FAILURES", 10)
 
+	AtlasControlToken = getEnv("ATLAS_CONTROL_TOKEN")
+	HermesAdminToken = getEnv("HERMES_ADMIN_TOKEN")
+	HermesBungieBudget = getEnvIntNonNegativeWithDefault("HERMES_BUNGIE_BUDGET", 0)
+
+	BungieSettingsFailOpenMinutes = getEnvIntNonNegativeWithDefault("BUNGIE_SETTINGS_FAIL_OPEN_MINUTES", 10)
+	BungieSchemaCheckEvery = getEnvIntNonNegativeWithDefault("BUNGIE_SCHEMA_CHECK_EVERY", 0)
+	BungieSchemaSampleDir = getEnvWithDefault("BUNGIE_SCHEMA_SAMPLE_DIR", filepath.Join(os.TempDir(), "raidhub-bungie-schema"))
+
+	PGCRAcceptedModes = getEnvIntList("PGCR_ACCEPTED_MODES", []int{4})
+
 	// Config
 	IsContestWeekend = getEnv("IS_CONTEST_WEEKEND") == "true"
-	MissedPGCRLogFilePath = requireEnv("MISSED_PGCR_LOG_FILE_PATH")
+	ContestWeekendStart = getEnvTime("CONTEST_WEEKEND_START")
+	ContestWeekendEnd = getEnvTime("CONTEST_WEEKEND_END")
 	LogLevel = getEnv("LOG_LEVEL")
 	// Prometheus API (required)
 	PrometheusHost = getEnv("PROMETHEUS_HOST")
@@ -182,6 +243,9 @@ func init() {
 	if len(envIssues) > 0 {
 		panic("required environment variables are not set: " + strings.Join(envIssues, ", "))
 	}
+	if len(malformedEnv) > 0 {
+		panic("environment variables are malformed: " + strings.Join(malformedEnv, ", "))
+	}
 }
 
 func getEnv(key string) string {
@@ -215,6 +279,50 @@ func getEnvIntPositiveWithDefault(key string, defaultValue int) int {
 	return n
 }
 
+func getEnvIntNonNegativeWithDefault(key string, defaultValue int) int {
+	s := getEnv(key)
+	if s == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return defaultValue
+	}
+	return n
+}
+
+// getEnvIntList parses a comma separated list of integers, falling back to defaultValue if any entry is not one
+func getEnvIntList(key string, defaultValue []int) []int {
+	s := getEnv(key)
+	if s == "" {
+		return defaultValue
+	}
+	var values []int
+	for _, part := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return defaultValue
+		}
+		values = append(values, n)
+	}
+	return values
+}
+
+// getEnvTime parses an RFC 3339 timestamp, returning the zero time if it is unset. A malformed value
+// fails startup rather than leaving the schedule it sets switched off.
+func getEnvTime(key string) time.Time {
+	s := getEnv(key)
+	if s == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		malformedEnv = append(malformedEnv, key+" (want RFC 3339, e.g. 2026-03-07T17:00:00Z)")
+		return time.Time{}
+	}
+	return t
+}
+
 func getHostEnv(key string) string {
 	return getEnvWithDefault(key, "localhost")
 }
@@ -0,0 +1,27 @@
+package messages
+
+import "time"
+
+// PGCROffloadInitialDelay is how long an offloaded instance waits before its first pgcr_offload attempt
+const PGCROffloadInitialDelay = 15 * time.Second
+
+// PGCROffloadPendingKey is a Redis sorted set of instance ids offloaded by Atlas that pgcr_offload
+// has not resolved yet (score = unix time of the offload). Atlas reads its size as the offload backlog.
+const PGCROffloadPendingKey = "atlas:offload:pending"
+
+// PGCROffloadMessage matches lib/messaging/queue-workers/pgcr_offload.go
+type PGCROffloadMessage struct {
+	InstanceId  int64     `json:"instanceId,string"`
+	OffloadedAt time.Time `json:"offloadedAt"`
+	// Attempts made so far, and how many of them came back malformed (each one busts Bungie's cache)
+	Attempts         int `json:"attempts,omitempty"`
+	MalformedRetries int `json:"malformedRetries,omitempty"`
+}
+
+// NewPGCROffloadMessage creates a new PGCR offload message
+func NewPGCROffloadMessage(instanceId int64, offloadedAt time.Time) PGCROffloadMessage {
+	return PGCROffloadMessage{
+		InstanceId:  instanceId,
+		OffloadedAt: offloadedAt,
+	}
+}
@@ -0,0 +1,77 @@
+package processing
+
+import (
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Headers stamped on a message when it is moved to a dead letter queue
+const (
+	DeadLetterQueueHeader      = "x-dlq-queue"       // the queue the message was consumed from
+	DeadLetterRoutingKeyHeader = "x-dlq-routing-key" // the routing key it was delivered with
+	DeadLetterExchangeHeader   = "x-dlq-exchange"    // the exchange it was delivered through ("" for the default exchange)
+	DeadLetterReasonHeader     = "x-dlq-reason"
+	DeadLetterErrorHeader      = "x-dlq-error" // the error of the final attempt
+	DeadLetterRetryHeader      = "x-dlq-retry-count"
+	DeadLetterAtHeader         = "x-dlq-at"
+)
+
+// Why a message was dead lettered
+const (
+	DeadLetterMaxRetries  = "max_retries"
+	DeadLetterUnretryable = "unretryable"
+)
+
+// DeadLetterPublishing is message as it is published to the dead letter queue of queue
+func DeadLetterPublishing(message amqp.Delivery, queue string, reason string, retryCount int, err error) amqp.Publishing {
+	headers := amqp.Table{}
+	for k, v := range message.Headers {
+		headers[k] = v
+	}
+	delete(headers, "x-delay")
+	headers[DeadLetterQueueHeader] = queue
+	headers[DeadLetterRoutingKeyHeader] = message.RoutingKey
+	headers[DeadLetterExchangeHeader] = message.Exchange
+	headers[DeadLetterReasonHeader] = reason
+	headers[DeadLetterRetryHeader] = int32(retryCount)
+	headers[DeadLetterAtHeader] = time.Now().UTC().Format(time.RFC3339)
+	if err != nil {
+		headers[DeadLetterErrorHeader] = err.Error()
+	}
+
+	return amqp.Publishing{
+		Headers:      headers,
+		ContentType:  message.ContentType,
+		Body:         message.Body,
+		DeliveryMode: amqp.Persistent,
+		Priority:     message.Priority,
+		MessageId:    message.MessageId,
+		Timestamp:    message.Timestamp,
+	}
+}
+
+// ReplayPublishing is a dead lettered message as it is published back to its source queue, with the
+// dead letter headers dropped and its retry count reset. It returns the source queue, which is empty
+// when the message was not dead lettered by Hermes.
+func ReplayPublishing(message amqp.Delivery) (string, amqp.Publishing) {
+	queue, _ := message.Headers[DeadLetterQueueHeader].(string)
+	headers := amqp.Table{}
+	for k, v := range message.Headers {
+		if strings.HasPrefix(k, "x-dlq-") || k == "x-retry-count" || k == "x-delay" || k == "x-death" {
+			continue
+		}
+		headers[k] = v
+	}
+
+	return queue, amqp.Publishing{
+		Headers:      headers,
+		ContentType:  message.ContentType,
+		Body:         message.Body,
+		DeliveryMode: message.DeliveryMode,
+		Priority:     message.Priority,
+		MessageId:    message.MessageId,
+		Timestamp:    message.Timestamp,
+	}
+}
@@ -0,0 +1,84 @@
+package processing
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestDeadLetterPublishing(t *testing.T) {
+	message := amqp.Delivery{
+		Headers:     amqp.Table{"x-retry-count": int32(3), "x-delay": int64(8000), "trace": "abc"},
+		Exchange:    "delayed",
+		RoutingKey:  "instance_store",
+		ContentType: "application/json",
+		Body:        []byte(`{"instanceId":"1"}`),
+		MessageId:   "m-1",
+	}
+	parked := DeadLetterPublishing(message, "instance_store", DeadLetterMaxRetries, 3, errors.New("db down"))
+
+	want := amqp.Table{
+		"x-retry-count":            int32(3),
+		"trace":                    "abc",
+		DeadLetterQueueHeader:      "instance_store",
+		DeadLetterRoutingKeyHeader: "instance_store",
+		DeadLetterExchangeHeader:   "delayed",
+		DeadLetterReasonHeader:     DeadLetterMaxRetries,
+		DeadLetterRetryHeader:      int32(3),
+		DeadLetterErrorHeader:      "db down",
+	}
+	for k, v := range want {
+		if parked.Headers[k] != v {
+			t.Errorf("header %s = %v, want %v", k, parked.Headers[k], v)
+		}
+	}
+	if _, ok := parked.Headers["x-delay"]; ok {
+		t.Error("dead lettered message kept its x-delay header")
+	}
+	if _, err := time.Parse(time.RFC3339, parked.Headers[DeadLetterAtHeader].(string)); err != nil {
+		t.Errorf("%s header: %v", DeadLetterAtHeader, err)
+	}
+	if parked.DeliveryMode != amqp.Persistent {
+		t.Errorf("delivery mode = %d, want persistent", parked.DeliveryMode)
+	}
+	if string(parked.Body) != string(message.Body) || parked.MessageId != message.MessageId {
+		t.Errorf("body %s / message id %s changed when dead lettering", parked.Body, parked.MessageId)
+	}
+	if _, ok := message.Headers[DeadLetterQueueHeader]; ok {
+		t.Error("DeadLetterPublishing modified the delivery's headers")
+	}
+}
+
+func TestReplayPublishing(t *testing.T) {
+	source := amqp.Delivery{
+		Headers:     amqp.Table{"x-retry-count": int32(5), "trace": "abc"},
+		Exchange:    "delayed",
+		RoutingKey:  "instance_store",
+		ContentType: "application/json",
+		Body:        []byte(`{"instanceId":"1"}`),
+	}
+	parked := DeadLetterPublishing(source, "instance_store", DeadLetterUnretryable, 5, errors.New("bad payload"))
+	parked.Headers["x-death"] = []any{amqp.Table{"count": int64(1)}}
+
+	queue, replay := ReplayPublishing(amqp.Delivery{
+		Headers:      parked.Headers,
+		ContentType:  parked.ContentType,
+		Body:         parked.Body,
+		DeliveryMode: parked.DeliveryMode,
+	})
+	if queue != "instance_store" {
+		t.Errorf("queue = %q, want instance_store", queue)
+	}
+	if len(replay.Headers) != 1 || replay.Headers["trace"] != "abc" {
+		t.Errorf("replayed headers = %v, want only trace", replay.Headers)
+	}
+	if string(replay.Body) != string(source.Body) || replay.ContentType != source.ContentType {
+		t.Errorf("replayed body %s (%s), want %s (%s)", replay.Body, replay.ContentType, source.Body, source.ContentType)
+	}
+
+	if queue, _ := ReplayPublishing(amqp.Delivery{Body: []byte("{}")}); queue != "" {
+		t.Errorf("queue of a message Hermes didn't dead letter = %q, want empty", queue)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"strconv"
 	"time"
 
+	"raidhub/lib/web/bungie"
+
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
@@ -108,6 +110,17 @@ func ParseInt64(worker WorkerInterface, data []byte) (int64, error) {
 	return value, nil
 }
 
+// RetryCount returns how many times a message has already been retried (the x-retry-count header).
+// The first delivery of a message has a retry count of 0.
+func RetryCount(message amqp.Delivery) int {
+	if count, ok := message.Headers["x-retry-count"].(int32); ok && count > 0 {
+		return int(count)
+	} else if count, ok := message.Headers["x-retry-count"].(int64); ok && count > 0 {
+		return int(count)
+	}
+	return 0
+}
+
 // TopicConfig defines the configuration for a topic
 type TopicConfig struct {
 	QueueName             string
@@ -121,17 +134,61 @@ type TopicConfig struct {
 	ScaleUpPercent        float64
 	ScaleDownPercent      float64
 	ScaleCheckInterval    time.Duration
-	ScaleCooldown         time.Duration // Minimum time between scaling decisions
-	MaxWorkersPerStep     int           // Maximum workers to add/remove per scaling action
-	MinWorkersPerStep     int           // Minimum workers to add/remove per scaling action
-	ConsecutiveChecksUp   int           // Consecutive checks above threshold before scaling up
-	ConsecutiveChecksDown int           // Consecutive checks below threshold before scaling down
-	BungieSystemDeps      []string      // Which API systems must be available for the topic to scale
-	MaxRetryCount         int           // Maximum number of retries before sending to DLQ (0 = unlimited)
+	ScaleCooldown         time.Duration   // Minimum time between scaling decisions
+	MaxWorkersPerStep     int             // Maximum workers to add/remove per scaling action
+	MinWorkersPerStep     int             // Minimum workers to add/remove per scaling action
+	ConsecutiveChecksUp   int             // Consecutive checks above threshold before scaling up
+	ConsecutiveChecksDown int             // Consecutive checks below threshold before scaling down
+	BungieSystemDeps      []string        // Which API systems must be available for the topic to scale
+	BungiePriority        bungie.Priority // Zeus priority class of the topic's Bungie requests (empty keeps the client's default)
+	BungieRequestWeight   float64         // Bungie requests a message makes on average; topics with a weight share HERMES_BUNGIE_BUDGET
+	MaxRetryCount         int             // Maximum number of retries before sending to DLQ (0 = unlimited)
 	// RetryDelay returns how long to wait before the next delivery attempt after a failure.
 	// newRetryCount is 1-based (the value written to x-retry-count when republishing).
 	// Use ExponentialRetryDelay for the standard doubling backoff from a base duration.
 	RetryDelay func(newRetryCount int) time.Duration
+
+	// Throughput scales the topic on its arrival and processing rates instead of ScaleUpThreshold and
+	// ScaleDownThreshold. Nil keeps the queue depth thresholds.
+	Throughput *ThroughputScaling
+
+	// Contest replaces parts of this config while the contest profile is in effect
+	Contest ContestOverrides
+}
+
+// ThroughputScaling sizes a topic to keep up with the rate messages arrive at, plus whatever it takes to
+// meet the topic's targets for its backlog. With neither target set, the topic only keeps up with arrivals.
+type ThroughputScaling struct {
+	DrainTime time.Duration // work off the current backlog within this, on top of new arrivals
+	Latency   time.Duration // a message published now waits at most this long for a worker
+	Headroom  float64       // spare capacity over the arrival rate (default 0.2)
+}
+
+// ContestOverrides are a topic's settings for contest weekends. Zero fields keep the topic's normal value.
+type ContestOverrides struct {
+	MinWorkers     int
+	MaxWorkers     int
+	DesiredWorkers int
+	// Autoscale keeps autoscaling on during the contest; otherwise the topic is held at DesiredWorkers
+	Autoscale  bool
+	RetryDelay func(newRetryCount int) time.Duration
+}
+
+// ForContest returns the config with its contest overrides applied
+func (c TopicConfig) ForContest() TopicConfig {
+	if c.Contest.MinWorkers > 0 {
+		c.MinWorkers = c.Contest.MinWorkers
+	}
+	if c.Contest.MaxWorkers > 0 {
+		c.MaxWorkers = c.Contest.MaxWorkers
+	}
+	if c.Contest.DesiredWorkers > 0 {
+		c.DesiredWorkers = c.Contest.DesiredWorkers
+	}
+	if c.Contest.RetryDelay != nil {
+		c.RetryDelay = c.Contest.RetryDelay
+	}
+	return c
 }
 
 const (
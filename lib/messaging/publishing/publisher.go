@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"raidhub/lib/messaging/rabbit"
+	"raidhub/lib/messaging/routing"
 	"raidhub/lib/monitoring/global_metrics"
 	"raidhub/lib/utils/logging"
 	"raidhub/lib/utils/network"
@@ -18,6 +20,9 @@ import (
 var (
 	channel *amqp.Channel
 	logger  = logging.NewLogger("PUBLISHING_SERVICE")
+
+	delayedExchangeOnce sync.Once
+	delayedExchangeErr  error
 )
 
 const (
@@ -171,3 +176,66 @@ func PublishInt64Message(ctx context.Context, queueName string, value int64) err
 		},
 	})
 }
+
+// declareDelayedExchange declares the shared delayed exchange once per process. Publishing to an
+// exchange that does not exist closes the channel, so this must succeed before any delayed publish.
+// The arguments must match the declaration in apps/hermes/topic_manager.go.
+func declareDelayedExchange() error {
+	delayedExchangeOnce.Do(func() {
+		delayedExchangeErr = channel.ExchangeDeclare(
+			routing.DelayedExchange,
+			"x-delayed-message",
+			true,  // durable
+			false, // auto-deleted
+			false, // internal
+			false, // no-wait
+			amqp.Table{"x-delayed-type": "direct"},
+		)
+	})
+	return delayedExchangeErr
+}
+
+// PublishDelayedJSONMessage publishes a JSON message that is delivered to the specified queue after delay.
+// The message goes through the shared delayed exchange, so the queue must be bound to it (all Hermes queues are).
+func PublishDelayedJSONMessage(ctx context.Context, queueName string, body any, delay time.Duration) error {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		global_metrics.PublishingOperations.WithLabelValues(queueName, ERROR).Inc()
+		logger.Error("PUBLISH_MARSHAL_FAILED", err, map[string]any{
+			logging.QUEUE: queueName,
+		})
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	if err := declareDelayedExchange(); err != nil {
+		global_metrics.PublishingOperations.WithLabelValues(queueName, ERROR).Inc()
+		logger.Error("DELAYED_EXCHANGE_DECLARE_FAILED", err, map[string]any{
+			logging.QUEUE: queueName,
+		})
+		return fmt.Errorf("failed to declare delayed exchange: %w", err)
+	}
+
+	publishMsg := amqp.Publishing{
+		ContentType:  "application/json",
+		Body:         jsonBody,
+		DeliveryMode: amqp.Persistent,
+		Headers: amqp.Table{
+			"x-retry-count": int32(0),
+			"x-delay":       delay.Milliseconds(),
+		},
+	}
+	err = retry.WithRetry(ctx, publishingRetryConfig, func(attempt int) error {
+		return channel.PublishWithContext(ctx, routing.DelayedExchange, queueName, false, false, publishMsg)
+	})
+
+	if err != nil {
+		global_metrics.PublishingOperations.WithLabelValues(queueName, ERROR).Inc()
+		logger.Error("PUBLISH_FAILED", err, map[string]any{
+			logging.QUEUE: queueName,
+		})
+	} else {
+		global_metrics.PublishingOperations.WithLabelValues(queueName, SUCCESS).Inc()
+	}
+
+	return err
+}
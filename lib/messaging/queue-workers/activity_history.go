@@ -7,6 +7,7 @@ import (
 	"raidhub/lib/messaging/routing"
 	"raidhub/lib/services/player"
 	"raidhub/lib/utils/logging"
+	"raidhub/lib/web/bungie"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -25,8 +26,19 @@ func ActivityHistoryTopic() processing.Topic {
 		ScaleUpPercent:     0.2,
 		ScaleDownPercent:   0.1,
 		BungieSystemDeps:   []string{"Destiny2", "Activities", "D2Profiles"},
+		BungiePriority:     bungie.PriorityLow,
 		MaxRetryCount:      3,
 		RetryDelay:         processing.ExponentialRetryDelay(time.Second),
+		// Bungie requests per message (a few history pages for each character), drawn from HERMES_BUNGIE_BUDGET
+		BungieRequestWeight: 6,
+		Throughput: &processing.ThroughputScaling{
+			DrainTime: 30 * time.Minute,
+		},
+		Contest: processing.ContestOverrides{
+			MinWorkers:     3,
+			MaxWorkers:     30,
+			DesiredWorkers: 10,
+		},
 	}, processActivityHistory)
 }
 
@@ -27,6 +27,14 @@ func CharacterFillTopic() processing.Topic {
 		BungieSystemDeps:   []string{"Destiny2", "D2Characters"},
 		MaxRetryCount:      4, // Character data is useful but not critical
 		RetryDelay:         processing.ExponentialRetryDelay(5 * time.Minute),
+		// Bungie requests per message (one character), drawn from HERMES_BUNGIE_BUDGET
+		BungieRequestWeight: 1,
+		Contest: processing.ContestOverrides{
+			MinWorkers:     3,
+			MaxWorkers:     20,
+			DesiredWorkers: 8,
+			RetryDelay:     processing.ExponentialRetryDelay(2 * time.Minute),
+		},
 	}, processCharacterFill)
 }
 
@@ -7,6 +7,7 @@ import (
 	"raidhub/lib/messaging/routing"
 	"raidhub/lib/services/clan"
 	"raidhub/lib/utils/logging"
+	"raidhub/lib/web/bungie"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -25,8 +26,14 @@ func ClanCrawlTopic() processing.Topic {
 		ScaleUpPercent:     0.2,
 		ScaleDownPercent:   0.1,
 		BungieSystemDeps:   []string{"Groups", "Clans", "Destiny2"},
+		BungiePriority:     bungie.PriorityLow,
 		MaxRetryCount:      5,
 		RetryDelay:         processing.ExponentialRetryDelay(time.Second),
+		// Bungie requests per message (one group), drawn from HERMES_BUNGIE_BUDGET
+		BungieRequestWeight: 1,
+		Contest: processing.ContestOverrides{
+			DesiredWorkers: 2,
+		},
 	}, processClanCrawl)
 }
 
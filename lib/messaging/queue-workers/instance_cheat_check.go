@@ -26,6 +26,9 @@ func InstanceCheatCheckTopic() processing.Topic {
 		ScaleDownPercent:   0.1,
 		MaxRetryCount:      5,
 		RetryDelay:         processing.ExponentialRetryDelay(time.Second),
+		Contest: processing.ContestOverrides{
+			DesiredWorkers: 2,
+		},
 	}, processInstanceCheatCheck)
 }
 
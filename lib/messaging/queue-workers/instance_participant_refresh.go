@@ -11,6 +11,7 @@ import (
 	"raidhub/lib/messaging/routing"
 	"raidhub/lib/services/subscriptions"
 	"raidhub/lib/utils/logging"
+	"raidhub/lib/web/bungie"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -28,8 +29,15 @@ func InstanceParticipantRefreshTopic() processing.Topic {
 		ScaleUpPercent:     0.2,
 		ScaleDownPercent:   0.1,
 		BungieSystemDeps:   []string{"Destiny2", "D2Profiles", "Groups", "Clans"},
+		BungiePriority:     bungie.PriorityHigh,
 		MaxRetryCount:      10,
 		RetryDelay:         processing.ExponentialRetryDelay(2 * time.Minute),
+		// Bungie requests per message (a profile and clan lookup for each participant), drawn from HERMES_BUNGIE_BUDGET
+		BungieRequestWeight: 8,
+		Contest: processing.ContestOverrides{
+			MinWorkers:     6,
+			DesiredWorkers: 12,
+		},
 	}, processInstanceParticipantRefresh)
 }
 
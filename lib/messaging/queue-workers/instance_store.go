@@ -7,6 +7,7 @@ import (
 	"raidhub/lib/messaging/processing"
 	"raidhub/lib/messaging/routing"
 	"raidhub/lib/services/instance_storage"
+	"raidhub/lib/services/missed_pgcr"
 	"raidhub/lib/utils/logging"
 
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -27,6 +28,14 @@ func InstanceStoreTopic() processing.Topic {
 		ScaleDownPercent:   0.1,
 		MaxRetryCount:      3, // We write to a dlq anyways, so we don't need to retry
 		RetryDelay:         processing.ExponentialRetryDelay(time.Second),
+		Throughput: &processing.ThroughputScaling{
+			DrainTime: 10 * time.Minute,
+		},
+		Contest: processing.ContestOverrides{
+			MinWorkers:     4,
+			MaxWorkers:     32,
+			DesiredWorkers: 16,
+		},
 	}, processInstanceStore)
 }
 
@@ -45,7 +54,7 @@ func processInstanceStore(worker processing.WorkerInterface, message amqp.Delive
 	// Store the PGCR using the orchestrator
 	_, _, err = instance_storage.StorePGCR(worker.Context(), &msg.Instance, &msg.PGCR)
 	if err != nil {
-		instance_storage.WriteMissedLog(msg.Instance.InstanceId)
+		missed_pgcr.Log(worker.Context(), msg.Instance.InstanceId, missed_pgcr.ReasonExternalError, missed_pgcr.SourceInstanceStore)
 		return nil
 	}
 	worker.Debug("INSTANCE_STORE_MESSAGE_PROCESSED", map[string]any{logging.INSTANCE_ID: msg.Instance.InstanceId})
@@ -7,9 +7,10 @@ import (
 	"raidhub/lib/messaging/processing"
 	"raidhub/lib/messaging/publishing"
 	"raidhub/lib/messaging/routing"
-	"raidhub/lib/services/instance_storage"
+	"raidhub/lib/services/missed_pgcr"
 	"raidhub/lib/services/pgcr_processing"
 	"raidhub/lib/utils/logging"
+	"raidhub/lib/web/bungie"
 	"strconv"
 	"sync"
 	"time"
@@ -39,8 +40,13 @@ func PgcrBlockedTopic() processing.Topic {
 		ScaleUpPercent:     0.2,
 		ScaleDownPercent:   0.1,
 		BungieSystemDeps:   []string{"Destiny2"},
+		BungiePriority:     bungie.PriorityLow,
 		MaxRetryCount:      25, // Designed for retries, but still need a limit
 		RetryDelay:         processing.ExponentialRetryDelay(time.Second),
+		Contest: processing.ContestOverrides{
+			MinWorkers:     50,
+			DesiredWorkers: 200,
+		},
 	}, processPgcrBlocked)
 }
 
@@ -88,6 +94,7 @@ func processPgcrBlocked(worker processing.WorkerInterface, message amqp.Delivery
 		if result == pgcr_processing.NonRaid {
 			// Successfully confirmed it's not a raid - mark as processed
 			markPgcrSuccess(instanceId)
+			resolveMissedPgcr(worker, instanceId)
 			worker.Info("CONFIRMED_NON_RAID", fields)
 			return nil
 		} else if result == pgcr_processing.Success {
@@ -101,6 +108,7 @@ func processPgcrBlocked(worker processing.WorkerInterface, message amqp.Delivery
 				worker.Error("FAILED_TO_PUBLISH_PGCR_FOR_STORAGE", publishErr, fields)
 				return publishErr
 			}
+			resolveMissedPgcr(worker, instanceId)
 			return nil
 		} else if result == pgcr_processing.InsufficientPrivileges {
 			// Still blocked - check if floodgates have opened
@@ -148,7 +156,7 @@ func processPgcrBlocked(worker processing.WorkerInterface, message amqp.Delivery
 		// If we've failed too many times, give up
 		if errCount > 3 {
 			worker.Warn("GIVING_UP_ON_BLOCKED_PGCR", nil, fields)
-			instance_storage.WriteMissedLog(instanceId)
+			missed_pgcr.Log(worker.Context(), instanceId, missed_pgcr.ReasonForResult(result), missed_pgcr.SourcePGCRBlockedRetry)
 			return nil
 		}
 
@@ -166,6 +174,16 @@ func processPgcrBlocked(worker processing.WorkerInterface, message amqp.Delivery
 	}
 }
 
+// resolveMissedPgcr marks the instance as resolved in the missed PGCR ledger, in case
+// process-missed-pgcrs handed it to this queue
+func resolveMissedPgcr(worker processing.WorkerInterface, instanceId int64) {
+	if err := missed_pgcr.Resolve(worker.Context(), instanceId); err != nil {
+		worker.Warn("FAILED_TO_RESOLVE_MISSED_PGCR", err, map[string]any{
+			logging.INSTANCE_ID: instanceId,
+		})
+	}
+}
+
 // markPgcrSuccess records that a PGCR was successfully processed (floodgates opened)
 func markPgcrSuccess(instanceId int64) {
 	pgcrSuccess.Store(instanceId, time.Now())
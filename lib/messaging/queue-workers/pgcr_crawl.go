@@ -8,9 +8,10 @@ import (
 	"raidhub/lib/messaging/publishing"
 	"raidhub/lib/messaging/routing"
 	"raidhub/lib/services/instance"
-	"raidhub/lib/services/instance_storage"
+	"raidhub/lib/services/missed_pgcr"
 	"raidhub/lib/services/pgcr_processing"
 	"raidhub/lib/utils/logging"
+	"raidhub/lib/web/bungie"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -29,8 +30,13 @@ func PgcrCrawlTopic() processing.Topic {
 		ScaleUpPercent:     0.2,
 		ScaleDownPercent:   0.1,
 		BungieSystemDeps:   []string{"Destiny2"},
+		BungiePriority:     bungie.PriorityNormal,
 		MaxRetryCount:      20, // Critical - main functionality
 		RetryDelay:         processing.ExponentialRetryDelay(time.Second),
+		Contest: processing.ContestOverrides{
+			MinWorkers:     2,
+			DesiredWorkers: 5,
+		},
 	}, processPgcrCrawl)
 }
 
@@ -71,7 +77,7 @@ func processPgcrCrawl(worker processing.WorkerInterface, message amqp.Delivery)
 			worker.Error("FAILED_TO_PUBLISH_PGCR_FOR_STORAGE", publishErr, map[string]any{
 				logging.INSTANCE_ID: instanceId,
 			})
-			instance_storage.WriteMissedLog(instanceId)
+			missed_pgcr.Log(worker.Context(), instanceId, missed_pgcr.ReasonExternalError, missed_pgcr.SourcePGCRCrawl)
 			return publishErr
 		}
 		worker.Info("PGCR_CRAWL_SUCCESS", map[string]any{
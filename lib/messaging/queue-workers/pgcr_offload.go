@@ -0,0 +1,240 @@
+package queueworkers
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	rdb "raidhub/lib/database/redis"
+	"raidhub/lib/env"
+	"raidhub/lib/messaging/messages"
+	"raidhub/lib/messaging/processing"
+	"raidhub/lib/messaging/publishing"
+	"raidhub/lib/messaging/routing"
+	"raidhub/lib/services/missed_pgcr"
+	"raidhub/lib/services/pgcr_processing"
+	"raidhub/lib/utils/logging"
+	"raidhub/lib/web/bungie"
+	"raidhub/lib/web/discord"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// pgcrOffloadAttempts is the number of attempts before an instance is given up on as missed
+	pgcrOffloadAttempts = 6
+	// pgcrOffloadExternalErrorBackoff is the wait before re-fetching after a Bungie or network error
+	pgcrOffloadExternalErrorBackoff = 10 * time.Second
+)
+
+var (
+	// Unresolved instance alerts go to the Atlas channel, since Atlas is the one that offloaded them
+	offloadAlerting        = discord.NewDiscordAlerting(env.AtlasWebhookURL, nil)
+	offloadAlertingLimiter = rate.NewLimiter(rate.Every(time.Minute), 1)
+)
+
+// PgcrOffloadTopic creates a new PGCR offload topic
+// Atlas offloads instances it could not resolve quickly; each failed attempt is republished through the
+// delayed exchange on the same schedule Atlas used in memory, carrying its attempt counts
+func PgcrOffloadTopic() processing.Topic {
+	return processing.NewTopic(processing.TopicConfig{
+		QueueName:          routing.PGCROffload,
+		MinWorkers:         1,
+		MaxWorkers:         50,
+		DesiredWorkers:     2,
+		KeepInReady:        true,
+		PrefetchCount:      1,
+		ScaleUpThreshold:   100,
+		ScaleDownThreshold: 10,
+		ScaleUpPercent:     0.2,
+		ScaleDownPercent:   0.1,
+		BungieSystemDeps:   []string{"Destiny2"},
+		BungiePriority:     bungie.PriorityHigh,
+		MaxRetryCount:      4, // The processor schedules its own attempts; this only bounds publish failures
+		RetryDelay:         pgcrOffloadRetryDelay,
+		Contest: processing.ContestOverrides{
+			DesiredWorkers: 10,
+			Autoscale:      true,
+		},
+	}, processPgcrOffload)
+}
+
+// pgcrOffloadRetryDelay waits i*(2i + rand(5i)) seconds after failed attempt i
+func pgcrOffloadRetryDelay(attempt int) time.Duration {
+	i := max(attempt, 1)
+	return time.Duration(i*(2*i+rand.Intn(5*i))) * time.Second
+}
+
+// processPgcrOffload makes one attempt at resolving an offloaded instance
+func processPgcrOffload(worker processing.WorkerInterface, message amqp.Delivery) error {
+	request, err := processing.ParseJSONUnretryable[messages.PGCROffloadMessage](worker, message.Body)
+	if err != nil {
+		return err
+	}
+
+	instanceId := request.InstanceId
+	attempt := request.Attempts + 1
+	malformedRetries := request.MalformedRetries
+	fields := map[string]any{
+		logging.INSTANCE_ID: instanceId,
+		logging.ATTEMPT:     attempt,
+	}
+
+	for {
+		result, instance, pgcr := pgcr_processing.FetchAndProcessPGCR(worker.Context(), instanceId, malformedRetries)
+
+		switch result {
+		case pgcr_processing.NonRaid:
+			resolveOffload(worker, instanceId)
+			return nil
+
+		case pgcr_processing.Success:
+			storeMessage := messages.NewPGCRStoreMessage(instance, pgcr)
+			if publishErr := publishing.PublishJSONMessage(worker.Context(), routing.InstanceStore, storeMessage); publishErr != nil {
+				worker.Warn("FAILED_TO_PUBLISH_PGCR_STORE_MESSAGE", publishErr, fields)
+				return publishErr
+			}
+			worker.Debug("PGCR_QUEUED_FOR_STORAGE", map[string]any{
+				logging.INSTANCE_ID: instanceId,
+				logging.ATTEMPT:     attempt,
+				logging.DURATION:    fmt.Sprintf("%dms", time.Since(request.OffloadedAt).Milliseconds()),
+			})
+			resolveOffload(worker, instanceId)
+			return nil
+
+		case pgcr_processing.InsufficientPrivileges:
+			if publishErr := publishing.PublishInt64Message(worker.Context(), routing.PGCRRetry, instanceId); publishErr != nil {
+				worker.Error("FAILED_TO_PUBLISH_TO_RETRY_QUEUE", publishErr, fields)
+				return publishErr
+			}
+			resolveOffload(worker, instanceId)
+			return nil
+
+		case pgcr_processing.SystemDisabled:
+			// Does not count as an attempt
+			select {
+			case <-worker.Context().Done():
+				return worker.Context().Err()
+			case <-time.After(60 * time.Second):
+			}
+			continue
+
+		case pgcr_processing.ExternalError:
+			// Does not count as an attempt
+			select {
+			case <-worker.Context().Done():
+				return worker.Context().Err()
+			case <-time.After(pgcrOffloadExternalErrorBackoff):
+			}
+			continue
+
+		case pgcr_processing.BadFormat:
+			// Counts as an attempt, but is retried straight away with Bungie's cache busted
+			malformedRetries++
+			if attempt < pgcrOffloadAttempts {
+				attempt++
+				fields[logging.ATTEMPT] = attempt
+				continue
+			}
+		}
+
+		// NotFound, BadFormat on the last attempt, or anything unexpected counts as a failed attempt
+		return failPgcrOffloadAttempt(worker, request, attempt, malformedRetries, result)
+	}
+}
+
+// failPgcrOffloadAttempt gives up on the instance after the last attempt, otherwise schedules the next
+// attempt through the delayed exchange. A publish failure is returned so Hermes redelivers this one.
+func failPgcrOffloadAttempt(worker processing.WorkerInterface, request messages.PGCROffloadMessage, attempt, malformedRetries int, result pgcr_processing.PGCRResult) error {
+	instanceId := request.InstanceId
+	fields := map[string]any{
+		logging.INSTANCE_ID: instanceId,
+		logging.ATTEMPT:     attempt,
+		"result":            result,
+		logging.DURATION:    fmt.Sprintf("%dms", time.Since(request.OffloadedAt).Milliseconds()),
+	}
+
+	if attempt == 3 {
+		go sendUnresolvedInstanceWarning(instanceId, request.OffloadedAt)
+	}
+
+	if attempt >= pgcrOffloadAttempts {
+		// Into the ledger before it leaves the backlog, so a crash in between can't lose it
+		missed_pgcr.Log(worker.Context(), instanceId, missed_pgcr.ReasonForResult(result), missed_pgcr.SourcePGCROffload)
+		clearOffloadBacklog(worker, instanceId)
+		worker.Warn("MISSED_PGCR", nil, fields)
+		sendUnresolvedInstanceAlert(instanceId, request.OffloadedAt)
+		return nil
+	}
+
+	next := request
+	next.Attempts = attempt
+	next.MalformedRetries = malformedRetries
+	if err := publishing.PublishDelayedJSONMessage(worker.Context(), routing.PGCROffload, next, pgcrOffloadRetryDelay(attempt)); err != nil {
+		worker.Warn("FAILED_TO_SCHEDULE_OFFLOAD_ATTEMPT", err, fields)
+		return err
+	}
+	worker.Debug("PGCR_OFFLOAD_ATTEMPT_FAILED", fields)
+	return nil
+}
+
+// resolveOffload removes an instance from the offload backlog Atlas reports, and marks any missed
+// PGCR ledger entry another component wrote for it as resolved
+func resolveOffload(worker processing.WorkerInterface, instanceId int64) {
+	clearOffloadBacklog(worker, instanceId)
+	if err := missed_pgcr.Resolve(worker.Context(), instanceId); err != nil {
+		worker.Warn("FAILED_TO_RESOLVE_MISSED_PGCR", err, map[string]any{
+			logging.INSTANCE_ID: instanceId,
+		})
+	}
+}
+
+// clearOffloadBacklog removes an instance from the offload backlog. Atlas keeps the instance in its
+// checkpoint until it is gone from there.
+func clearOffloadBacklog(worker processing.WorkerInterface, instanceId int64) {
+	if err := rdb.Client.ZRem(worker.Context(), messages.PGCROffloadPendingKey, instanceId).Err(); err != nil {
+		worker.Warn("FAILED_TO_RESOLVE_OFFLOAD_BACKLOG", err, map[string]any{
+			logging.INSTANCE_ID: instanceId,
+		})
+	}
+}
+
+func sendUnresolvedInstanceAlert(instanceId int64, offloadedAt time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if offloadAlertingLimiter.Wait(ctx) != nil {
+		return
+	}
+
+	webhook := discord.Webhook{
+		Embeds: []discord.Embed{{
+			Title:     "Unresolved Instance",
+			Color:     discord.ColorRed,
+			Fields:    unresolvedInstanceFields(instanceId, offloadedAt),
+			Timestamp: time.Now().Format(time.RFC3339),
+			Footer:    discord.CommonFooter,
+		}},
+	}
+	offloadAlerting.SendCustom(&webhook, "", nil)
+}
+
+func sendUnresolvedInstanceWarning(instanceId int64, offloadedAt time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if offloadAlertingLimiter.Wait(ctx) != nil {
+		return
+	}
+	offloadAlerting.SendWarning("Unresolved Instance (Warning)", unresolvedInstanceFields(instanceId, offloadedAt), "", nil)
+}
+
+func unresolvedInstanceFields(instanceId int64, offloadedAt time.Time) []discord.Field {
+	return []discord.Field{{
+		Name:  "Instance Id",
+		Value: fmt.Sprintf("`%d`", instanceId),
+	}, {
+		Name:  "Time Elapsed",
+		Value: discord.FormatDuration(time.Since(offloadedAt).Seconds()),
+	}}
+}
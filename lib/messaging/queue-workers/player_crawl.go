@@ -34,6 +34,15 @@ func PlayerCrawlTopic() processing.Topic {
 		BungieSystemDeps:      []string{"Destiny2", "D2Profiles", "Activities"},
 		MaxRetryCount:         5, // Reduced from 12 to prevent exponential retry amplification
 		RetryDelay:            processing.ExponentialRetryDelay(5 * time.Minute),
+		// Bungie requests per message (one profile and one activity history page), drawn from HERMES_BUNGIE_BUDGET
+		BungieRequestWeight: 2,
+		Contest: processing.ContestOverrides{
+			MinWorkers:     20,
+			MaxWorkers:     100,
+			DesiredWorkers: 40,
+			Autoscale:      true,
+			RetryDelay:     processing.ExponentialRetryDelay(2 * time.Minute),
+		},
 	}, processPlayerCrawl)
 }
 
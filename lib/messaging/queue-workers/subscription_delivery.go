@@ -46,6 +46,10 @@ func SubscriptionDeliveryTopic() processing.Topic {
 		// 17 failed attempts max: 10×5s delay, then 5 steps ramping to 60s, then 2×30m, then drop.
 		MaxRetryCount: 17,
 		RetryDelay:    subscriptionDeliveryRetryDelay,
+		Contest: processing.ContestOverrides{
+			DesiredWorkers: 6,
+			Autoscale:      true,
+		},
 	}, processSubscriptionDelivery)
 }
 
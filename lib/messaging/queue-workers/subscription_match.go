@@ -30,6 +30,10 @@ func SubscriptionMatchTopic() processing.Topic {
 		ScaleDownPercent:   0.1,
 		MaxRetryCount:      10,
 		RetryDelay:         processing.ExponentialRetryDelay(2 * time.Minute),
+		Contest: processing.ContestOverrides{
+			DesiredWorkers: 4,
+			Autoscale:      true,
+		},
 	}, processSubscriptionMatch)
 }
 
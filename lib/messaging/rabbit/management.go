@@ -0,0 +1,73 @@
+package rabbit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"raidhub/lib/env"
+)
+
+// QueueRates are a queue's message rates in messages per second, averaged by the management plugin
+// over the last minute
+type QueueRates struct {
+	Publish float64 // messages published to the queue
+	Deliver float64 // messages delivered to consumers
+	Ack     float64 // messages consumers acked
+}
+
+var managementClient = &http.Client{Timeout: 5 * time.Second}
+
+type rateDetails struct {
+	Rate    float64  `json:"rate"`
+	AvgRate *float64 `json:"avg_rate"`
+}
+
+func (d rateDetails) value() float64 {
+	if d.AvgRate != nil {
+		return *d.AvgRate
+	}
+	return d.Rate
+}
+
+type queueStatsResponse struct {
+	MessageStats struct {
+		PublishDetails    rateDetails `json:"publish_details"`
+		DeliverGetDetails rateDetails `json:"deliver_get_details"`
+		AckDetails        rateDetails `json:"ack_details"`
+	} `json:"message_stats"`
+}
+
+// GetQueueRates reads queue's message rates from the management API on RABBITMQ_UI_PORT. A queue that
+// hasn't seen traffic yet reports zero rates.
+func GetQueueRates(ctx context.Context, queue string) (QueueRates, error) {
+	endpoint := fmt.Sprintf("http://%s:%s/api/queues/%%2F/%s?msg_rates_age=60&msg_rates_incr=5",
+		env.RabbitMQHost, env.RabbitMQUIPort, url.PathEscape(queue))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return QueueRates{}, err
+	}
+	req.SetBasicAuth(env.RabbitMQUser, env.RabbitMQPassword)
+
+	resp, err := managementClient.Do(req)
+	if err != nil {
+		return QueueRates{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return QueueRates{}, fmt.Errorf("rabbitmq management api returned status %d for queue %s", resp.StatusCode, queue)
+	}
+
+	var stats queueStatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return QueueRates{}, err
+	}
+	return QueueRates{
+		Publish: stats.MessageStats.PublishDetails.value(),
+		Deliver: stats.MessageStats.DeliverGetDetails.value(),
+		Ack:     stats.MessageStats.AckDetails.value(),
+	}, nil
+}
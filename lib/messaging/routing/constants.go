@@ -1,5 +1,9 @@
 package routing
 
+// DelayedExchange is the shared delayed exchange (rabbitmq_delayed_message_exchange) used for retries
+// and delayed publishes; every Hermes queue is bound to it with routing key = queue name
+const DelayedExchange = "hermes.delayed"
+
 // Queue routing constants for all async processing
 const (
 	// Player data processing queues
@@ -9,8 +13,9 @@ const (
 	ClanCrawl     = "clan_crawl"
 
 	// PGCR processing queues
-	PGCRRetry = "pgcr_blocked_retry"
-	PGCRCrawl = "pgcr_crawl"
+	PGCRRetry   = "pgcr_blocked_retry"
+	PGCRCrawl   = "pgcr_crawl"
+	PGCROffload = "pgcr_offload"
 
 	// Instance data processing queues
 	InstanceStore      = "instance_store"
@@ -21,3 +26,27 @@ const (
 	SubscriptionMatch          = "subscription_match"
 	SubscriptionDelivery       = "subscription_delivery"
 )
+
+// Queues lists every Hermes queue
+var Queues = []string{
+	PlayerCrawl,
+	ActivityCrawl,
+	CharacterFill,
+	ClanCrawl,
+	PGCRRetry,
+	PGCRCrawl,
+	PGCROffload,
+	InstanceStore,
+	InstanceCheatCheck,
+	InstanceParticipantRefresh,
+	SubscriptionMatch,
+	SubscriptionDelivery,
+}
+
+// DeadLetterSuffix names a queue's dead letter queue, where Hermes parks messages it gave up on
+const DeadLetterSuffix = ".dlq"
+
+// DeadLetterQueue returns the name of queue's dead letter queue
+func DeadLetterQueue(queue string) string {
+	return queue + DeadLetterSuffix
+}
@@ -10,6 +10,13 @@ var ActiveWorkers = prometheus.NewGauge(
 	},
 )
 
+// OffloadBacklog is the number of offloaded instances that have not been resolved by pgcr_offload yet
+var OffloadBacklog = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "atlas_offload_backlog",
+	},
+)
+
 var PGCRC_CRAWL_SUMMARY_DIMENSIONS = []string{"status", "attempts"}
 
 var PGCRCrawlStatus = prometheus.NewCounterVec(
@@ -19,14 +26,17 @@ var PGCRCrawlStatus = prometheus.NewCounterVec(
 	PGCRC_CRAWL_SUMMARY_DIMENSIONS,
 )
 
+// PGCRCrawlLagBuckets are the lag histogram bounds, shared with Atlas's in-process scaling signals
+var PGCRCrawlLagBuckets = []float64{
+	5, 10, 15, 20, 25, 30, 35, 40, 45, 60,
+	90, 300, 1800,
+	7200, 14400, 21600, 28800, 36000, 43200, 57600, 72000, 86400, 172800, 259200,
+}
+
 var PGCRCrawlLag = prometheus.NewHistogramVec(
 	prometheus.HistogramOpts{
-		Name: "pgcr_crawl_summary_lag_seconds",
-		Buckets: []float64{
-			5, 10, 15, 20, 25, 30, 35, 40, 45, 60,
-			90, 300, 1800,
-			7200, 14400, 21600, 28800, 36000, 43200, 57600, 72000, 86400, 172800, 259200,
-		},
+		Name:    "pgcr_crawl_summary_lag_seconds",
+		Buckets: PGCRCrawlLagBuckets,
 	},
 	PGCRC_CRAWL_SUMMARY_DIMENSIONS,
 )
@@ -34,6 +44,7 @@ var PGCRCrawlLag = prometheus.NewHistogramVec(
 // Register registers all Atlas-specific metrics with Prometheus
 func Register() {
 	prometheus.MustRegister(ActiveWorkers)
+	prometheus.MustRegister(OffloadBacklog)
 	prometheus.MustRegister(PGCRCrawlStatus)
 	prometheus.MustRegister(PGCRCrawlLag)
 }
@@ -63,6 +63,49 @@ var SubscriptionDeliverySends = prometheus.NewCounterVec(
 	[]string{"channel_type", StatusDimension},
 )
 
+// Bungie API system availability, as seen by the availability monitor of each process
+var BungieSystemAvailable = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "bungie_system_available",
+		Help: "1 while a Bungie API system (Destiny2, D2Profiles, ...) is available, 0 while workers are blocked on it",
+	},
+	[]string{"system"},
+)
+
+var BungieSystemOutageDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "bungie_system_outage_seconds",
+		Help:    "How long a Bungie API system was unavailable, observed when it comes back",
+		Buckets: []float64{60, 300, 900, 1800, 3600, 7200, 14400, 28800, 86400},
+	},
+	[]string{"system"},
+)
+
+var BungieSystemTransitions = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "bungie_system_transitions_total",
+		Help: "Bungie API system state changes by new state and what caused them",
+	},
+	[]string{"system", "state", "source"}, // state: "available", "unavailable"; source: "settings", "system_disabled_signal", "fail_open"
+)
+
+// Bungie response schema drift, from the sampled checks in lib/web/bungie
+var BungieSchemaChecks = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "bungie_schema_checks_total",
+		Help: "Bungie responses compared against the types they decode into",
+	},
+	[]string{OperationDimension},
+)
+
+var BungieSchemaDrift = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "bungie_schema_drift_total",
+		Help: "Checked Bungie responses with a field our types don't match, by field path and kind",
+	},
+	[]string{OperationDimension, "kind", "field"}, // kind: "unknown", "missing", "null", "type"
+)
+
 // RegisterGlobalMetrics registers all metrics that can be exported by any app
 func RegisterGlobalMetrics() {
 	prometheus.MustRegister(GetPostGameCarnageReportRequest)
@@ -71,4 +114,9 @@ func RegisterGlobalMetrics() {
 	prometheus.MustRegister(InstanceStorageOperationDuration)
 	prometheus.MustRegister(PublishingOperations)
 	prometheus.MustRegister(SubscriptionDeliverySends)
+	prometheus.MustRegister(BungieSystemAvailable)
+	prometheus.MustRegister(BungieSystemOutageDuration)
+	prometheus.MustRegister(BungieSystemTransitions)
+	prometheus.MustRegister(BungieSchemaChecks)
+	prometheus.MustRegister(BungieSchemaDrift)
 }
@@ -2,6 +2,7 @@ package hermes_metrics
 
 import (
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 const QUEUE_NAME_DIMENSION = "queue_name"
@@ -40,6 +41,14 @@ var QueueMessageProcessingDuration = prometheus.NewHistogramVec(
 	[]string{QUEUE_NAME_DIMENSION},
 )
 
+var QueueMessagesDeadLettered = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "queue_messages_dead_lettered_total",
+		Help: "Total number of messages moved to a queue's dead letter queue",
+	},
+	[]string{QUEUE_NAME_DIMENSION, "reason"}, // reason: "max_retries", "unretryable"
+)
+
 var QueueScalingDecisions = prometheus.NewCounterVec(
 	prometheus.CounterOpts{
 		Name: "queue_scaling_decisions_total",
@@ -48,6 +57,22 @@ var QueueScalingDecisions = prometheus.NewCounterVec(
 	[]string{QUEUE_NAME_DIMENSION, "direction"}, // direction: "up", "down"
 )
 
+var QueueThroughputSaturated = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "queue_throughput_saturated",
+		Help: "1 while throughput scaling holds a queue's workers down because adding workers stopped raising throughput",
+	},
+	[]string{QUEUE_NAME_DIMENSION},
+)
+
+var QueueBungieBudget = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "queue_bungie_budget_requests_per_second",
+		Help: "Bungie requests per second a queue wants and is allocated from the Hermes Bungie budget",
+	},
+	[]string{QUEUE_NAME_DIMENSION, "kind"}, // kind: "demand", "allocation"
+)
+
 var FloodgatesRecent = prometheus.NewGauge(
 	prometheus.GaugeOpts{
 		Name: "floodgates_recent_pgcr",
@@ -60,6 +85,21 @@ func Register() {
 	prometheus.MustRegister(QueueDepth)
 	prometheus.MustRegister(QueueMessagesProcessed)
 	prometheus.MustRegister(QueueMessageProcessingDuration)
+	prometheus.MustRegister(QueueMessagesDeadLettered)
 	prometheus.MustRegister(QueueScalingDecisions)
+	prometheus.MustRegister(QueueThroughputSaturated)
+	prometheus.MustRegister(QueueBungieBudget)
 	prometheus.MustRegister(FloodgatesRecent)
 }
+
+// ProcessingTotals returns how many messages of queue this process has finished and the seconds spent
+// on them, read from QueueMessageProcessingDuration
+func ProcessingTotals(queue string) (uint64, float64) {
+	var m dto.Metric
+	observer := QueueMessageProcessingDuration.WithLabelValues(queue)
+	metric, ok := observer.(prometheus.Metric)
+	if !ok || metric.Write(&m) != nil || m.Histogram == nil {
+		return 0, 0
+	}
+	return m.Histogram.GetSampleCount(), m.Histogram.GetSampleSum()
+}
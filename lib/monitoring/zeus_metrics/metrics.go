@@ -7,6 +7,15 @@ import (
 const (
 	ZEUS_ENDPOINT_TYPE_DIMENSION = "endpoint_type"
 	ZEUS_STATUS_DIMENSION        = "status"
+	ZEUS_CACHE_RULE_DIMENSION    = "rule"
+	ZEUS_CACHE_RESULT_DIMENSION  = "result"
+	ZEUS_IP_DIMENSION            = "ip"
+	ZEUS_SIGNAL_DIMENSION        = "signal"
+	ZEUS_KEY_DIMENSION           = "key"
+	ZEUS_REASON_DIMENSION        = "reason"
+	ZEUS_CLIENT_DIMENSION        = "client"
+	ZEUS_PRIORITY_DIMENSION      = "priority"
+	ZEUS_STATE_DIMENSION         = "state"
 )
 
 var RequestCount = prometheus.NewCounterVec(
@@ -35,9 +44,126 @@ var RateLimiterWaitTime = prometheus.NewHistogramVec(
 	[]string{ZEUS_ENDPOINT_TYPE_DIMENSION},
 )
 
+var CacheRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "zeus_cache_requests_total",
+		Help: "Cacheable requests seen by the Zeus response cache",
+	},
+	[]string{ZEUS_CACHE_RULE_DIMENSION, ZEUS_CACHE_RESULT_DIMENSION}, // result: "hit", "miss", "bypass", "store"
+)
+
+var CacheEntries = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "zeus_cache_entries",
+		Help: "Responses held in memory by the Zeus response cache",
+	},
+)
+
+var RateLimit = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "zeus_rate_limit",
+		Help: "Current adaptive rate limit in requests per second",
+	},
+	[]string{ZEUS_IP_DIMENSION, ZEUS_ENDPOINT_TYPE_DIMENSION},
+)
+
+var ThrottleSignals = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "zeus_throttle_signals_total",
+		Help: "Upstream responses telling Zeus to slow down",
+	},
+	[]string{ZEUS_ENDPOINT_TYPE_DIMENSION, ZEUS_SIGNAL_DIMENSION}, // signal: "http_429", "throttled_by_game_server", "throttle_seconds", "cloudflare_challenge"
+)
+
+var APIKeyQuarantines = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "zeus_api_key_quarantines_total",
+		Help: "Times an upstream API key was taken out of rotation",
+	},
+	[]string{ZEUS_KEY_DIMENSION, ZEUS_REASON_DIMENSION}, // key: pool position ("key0"), never the key; reason: "invalid_key", "key_throttled"
+)
+
+var ClientRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "zeus_client_requests_total",
+		Help: "Authenticated requests per Zeus client",
+	},
+	[]string{ZEUS_CLIENT_DIMENSION, ZEUS_ENDPOINT_TYPE_DIMENSION},
+)
+
+var CoalescedRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "zeus_coalesced_requests_total",
+		Help: "Requests that found an identical request already in flight",
+	},
+	[]string{ZEUS_CACHE_RESULT_DIMENSION}, // result: "collapsed", "fallthrough" (leader failed or body too large), "over_cap"
+)
+
+var SchedulerQueued = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "zeus_scheduler_queued",
+		Help: "Requests waiting in the Zeus scheduler for a turn at the rate limiters",
+	},
+	[]string{ZEUS_ENDPOINT_TYPE_DIMENSION, ZEUS_PRIORITY_DIMENSION}, // priority: "critical", "high", "normal", "low"
+)
+
+var SchedulerWait = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "zeus_scheduler_wait_ms",
+		Help:    "Time requests spent queued in the Zeus scheduler in milliseconds",
+		Buckets: []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000},
+	},
+	[]string{ZEUS_ENDPOINT_TYPE_DIMENSION, ZEUS_PRIORITY_DIMENSION},
+)
+
+var SchedulerShed = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "zeus_scheduler_shed_total",
+		Help: "Requests Zeus turned away because its scheduler queues were full",
+	},
+	[]string{ZEUS_ENDPOINT_TYPE_DIMENSION, ZEUS_PRIORITY_DIMENSION},
+)
+
+var CircuitState = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "zeus_circuit_state",
+		Help: "Circuit breaker state per source IP: 0 closed, 1 half-open, 2 open",
+	},
+	[]string{ZEUS_IP_DIMENSION, ZEUS_ENDPOINT_TYPE_DIMENSION},
+)
+
+var CircuitTransitions = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "zeus_circuit_transitions_total",
+		Help: "Circuit breaker state changes per source IP",
+	},
+	[]string{ZEUS_IP_DIMENSION, ZEUS_ENDPOINT_TYPE_DIMENSION, ZEUS_STATE_DIMENSION}, // state: the state entered, "closed", "half_open", "open"
+)
+
+var CircuitRejections = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "zeus_circuit_rejections_total",
+		Help: "Requests answered with a 503 because every circuit of the endpoint class was open",
+	},
+	[]string{ZEUS_ENDPOINT_TYPE_DIMENSION},
+)
+
 // Register registers all Zeus-specific metrics with Prometheus
 func Register() {
 	prometheus.MustRegister(RequestCount)
 	prometheus.MustRegister(RequestDuration)
 	prometheus.MustRegister(RateLimiterWaitTime)
+	prometheus.MustRegister(CacheRequests)
+	prometheus.MustRegister(CacheEntries)
+	prometheus.MustRegister(RateLimit)
+	prometheus.MustRegister(ThrottleSignals)
+	prometheus.MustRegister(APIKeyQuarantines)
+	prometheus.MustRegister(ClientRequests)
+	prometheus.MustRegister(CoalescedRequests)
+	prometheus.MustRegister(SchedulerQueued)
+	prometheus.MustRegister(SchedulerWait)
+	prometheus.MustRegister(SchedulerShed)
+	prometheus.MustRegister(CircuitState)
+	prometheus.MustRegister(CircuitTransitions)
+	prometheus.MustRegister(CircuitRejections)
 }
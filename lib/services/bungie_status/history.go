@@ -0,0 +1,138 @@
+package bungie_status
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"raidhub/lib/database/postgres"
+	"raidhub/lib/env"
+	"raidhub/lib/utils/logging"
+	"raidhub/lib/web/bungie"
+	"raidhub/lib/web/discord"
+)
+
+var logger = logging.NewLogger("BUNGIE_STATUS_SERVICE")
+
+const recordTimeout = 10 * time.Second
+
+// Start records every Bungie system transition this process sees in monitoring.bungie_system and
+// alerts on it. Every Hermes and Atlas process watches the API on its own, so a transition is only
+// recorded and alerted on by the first process to flip the system's row. Call after postgres.Wait().
+func Start() {
+	var alerting *discord.DiscordAlerting
+	if env.BungieStatusWebhookURL != "" {
+		alerting = discord.NewDiscordAlerting(env.BungieStatusWebhookURL, logger)
+	}
+
+	bungie.OnSystemTransition(func(t bungie.SystemTransition) {
+		ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+		defer cancel()
+
+		previous, recorded, err := record(ctx, t)
+		if err != nil {
+			logger.Warn("BUNGIE_SYSTEM_TRANSITION_RECORD_FAILED", err, map[string]any{
+				logging.SYSTEM: t.System,
+				logging.SOURCE: t.Source,
+			})
+			return
+		}
+		if recorded && alerting != nil {
+			alert(alerting, t, previous)
+		}
+	})
+}
+
+// record applies t to the system's row. It returns how long the system had been in its previous state,
+// and false when the row already showed t or showed a later transition.
+func record(ctx context.Context, t bungie.SystemTransition) (*time.Duration, bool, error) {
+	tx, err := postgres.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	var available bool
+	var since time.Time
+	err = tx.QueryRowContext(ctx, `
+		SELECT available, since FROM monitoring.bungie_system WHERE system = $1 FOR UPDATE
+	`, t.System).Scan(&available, &since)
+	if err == sql.ErrNoRows {
+		// First time anyone has seen this system. Only an outage is news.
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO monitoring.bungie_system (system, available, since, source)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (system) DO NOTHING
+		`, t.System, t.Available, t.At, t.Source)
+		if err != nil {
+			return nil, false, err
+		}
+		if !t.Available {
+			if err = insertTransition(ctx, tx, t, nil); err != nil {
+				return nil, false, err
+			}
+		}
+		return nil, !t.Available, tx.Commit()
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	if available == t.Available || t.At.Before(since) {
+		return nil, false, nil
+	}
+
+	previous := t.At.Sub(since)
+	_, err = tx.ExecContext(ctx, `
+		UPDATE monitoring.bungie_system SET available = $2, since = $3, source = $4 WHERE system = $1
+	`, t.System, t.Available, t.At, t.Source)
+	if err != nil {
+		return nil, false, err
+	}
+	if err = insertTransition(ctx, tx, t, &previous); err != nil {
+		return nil, false, err
+	}
+	return &previous, true, tx.Commit()
+}
+
+func insertTransition(ctx context.Context, tx *sql.Tx, t bungie.SystemTransition, previous *time.Duration) error {
+	var previousSeconds *float64
+	if previous != nil {
+		seconds := previous.Seconds()
+		previousSeconds = &seconds
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO monitoring.bungie_system_transition (system, available, at, source, previous_duration)
+		VALUES ($1, $2, $3, $4, $5::float8 * INTERVAL '1 second')
+	`, t.System, t.Available, t.At, t.Source, previousSeconds)
+	return err
+}
+
+func alert(alerting *discord.DiscordAlerting, t bungie.SystemTransition, previous *time.Duration) {
+	fields := []discord.Field{
+		{Name: "System", Value: t.System, Inline: true},
+		{Name: "Source", Value: t.Source, Inline: true},
+	}
+	logFields := map[string]any{
+		logging.SYSTEM: t.System,
+		logging.SOURCE: t.Source,
+	}
+
+	if !t.Available {
+		if previous != nil {
+			fields = append(fields, discord.Field{Name: "Up For", Value: discord.FormatDuration(previous.Seconds()), Inline: true})
+		}
+		alerting.SendWarning(fmt.Sprintf("Bungie %s is down", t.System), fields, "BUNGIE_SYSTEM_DOWN_ALERT", logFields)
+		return
+	}
+
+	title := fmt.Sprintf("Bungie %s is back", t.System)
+	if t.Source == bungie.AvailabilitySourceFailOpen {
+		title = fmt.Sprintf("Bungie %s unblocked while Settings is unreachable", t.System)
+	}
+	if previous != nil {
+		fields = append(fields, discord.Field{Name: "Down For", Value: discord.FormatDuration(previous.Seconds()), Inline: true})
+		logFields[logging.DURATION] = previous.String()
+	}
+	alerting.SendInfo(title, fields, "BUNGIE_SYSTEM_UP_ALERT", logFields)
+}
@@ -0,0 +1,171 @@
+package contest_profile
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"raidhub/lib/env"
+	"raidhub/lib/utils/logging"
+	"raidhub/lib/web/discord"
+)
+
+// Profile names
+const (
+	Normal  = "normal"
+	Contest = "contest"
+)
+
+// What put the current profile in effect
+const (
+	SourceDefault  = "default"  // no contest configured
+	SourceEnv      = "env"      // IS_CONTEST_WEEKEND
+	SourceSchedule = "schedule" // CONTEST_WEEKEND_START / CONTEST_WEEKEND_END
+)
+
+// Switch is the contest profile turning on or off
+type Switch struct {
+	Active bool
+	Source string
+	At     time.Time
+}
+
+var logger = logging.NewLogger("CONTEST_PROFILE")
+
+var (
+	mu        sync.Mutex
+	active    bool
+	observers []func(Switch)
+	startOnce sync.Once
+)
+
+func init() {
+	active, _ = scheduled(time.Now())
+}
+
+// scheduled returns whether the contest profile should be on at now, and why
+func scheduled(now time.Time) (bool, string) {
+	if env.IsContestWeekend {
+		return true, SourceEnv
+	}
+	start, end := env.ContestWeekendStart, env.ContestWeekendEnd
+	if start.IsZero() || end.IsZero() {
+		return false, SourceDefault
+	}
+	return !now.Before(start) && now.Before(end), SourceSchedule
+}
+
+// Active reports whether the contest profile is in effect
+func Active() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return active
+}
+
+// Name returns the profile in effect
+func Name() string {
+	if Active() {
+		return Contest
+	}
+	return Normal
+}
+
+// OnSwitch registers fn to be called, in registration order, each time the profile switches. The profile
+// in effect at startup is not a switch; read it with Active.
+func OnSwitch(fn func(Switch)) {
+	mu.Lock()
+	defer mu.Unlock()
+	observers = append(observers, fn)
+}
+
+// Start logs the profile in effect and, when a contest window is scheduled, follows it: each switch is
+// passed to the OnSwitch observers and alerted to CONTEST_WEBHOOK_URL on behalf of service.
+func Start(service string) {
+	startOnce.Do(func() {
+		start, end := env.ContestWeekendStart, env.ContestWeekendEnd
+		on, why := scheduled(time.Now())
+		profile := Normal
+		if on {
+			profile = Contest
+		}
+		logger.Info("OPERATING_PROFILE", map[string]any{
+			"service":      service,
+			"profile":      profile,
+			logging.SOURCE: why,
+		})
+		if env.IsContestWeekend || (start.IsZero() && end.IsZero()) {
+			return
+		}
+		if start.IsZero() || end.IsZero() || !end.After(start) {
+			logger.Warn("CONTEST_SCHEDULE_INVALID", nil, map[string]any{
+				"start":        start,
+				"end":          end,
+				logging.REASON: "CONTEST_WEEKEND_START and CONTEST_WEEKEND_END must both be RFC 3339 timestamps, start before end",
+			})
+			return
+		}
+
+		var alerting *discord.DiscordAlerting
+		if env.ContestWebhookURL != "" {
+			alerting = discord.NewDiscordAlerting(env.ContestWebhookURL, logger)
+		}
+		go follow(service, start, end, alerting)
+	})
+}
+
+// follow sleeps until each edge of the contest window and switches the profile there
+func follow(service string, start, end time.Time, alerting *discord.DiscordAlerting) {
+	for {
+		var next time.Time
+		now := time.Now()
+		switch {
+		case now.Before(start):
+			next = start
+		case now.Before(end):
+			next = end
+		default:
+			return
+		}
+		time.Sleep(time.Until(next))
+
+		on, why := scheduled(time.Now())
+		set(service, on, why, alerting)
+	}
+}
+
+func set(service string, on bool, why string, alerting *discord.DiscordAlerting) {
+	mu.Lock()
+	if active == on {
+		mu.Unlock()
+		return
+	}
+	active = on
+	s := Switch{Active: on, Source: why, At: time.Now()}
+	notify := append([]func(Switch){}, observers...)
+	mu.Unlock()
+
+	alert(service, s, alerting)
+	for _, fn := range notify {
+		fn(s)
+	}
+}
+
+func alert(service string, s Switch, alerting *discord.DiscordAlerting) {
+	profile, key := Normal, "CONTEST_PROFILE_OFF"
+	if s.Active {
+		profile, key = Contest, "CONTEST_PROFILE_ON"
+	}
+	logFields := map[string]any{
+		"service":      service,
+		"profile":      profile,
+		logging.SOURCE: s.Source,
+	}
+	if alerting == nil {
+		logger.Info(key, logFields)
+		return
+	}
+	alerting.SendInfo(fmt.Sprintf("%s switched to the %s profile", service, profile), []discord.Field{
+		{Name: "Source", Value: s.Source, Inline: true},
+		{Name: "Contest Window", Value: fmt.Sprintf("<t:%d> - <t:%d>", env.ContestWeekendStart.Unix(), env.ContestWeekendEnd.Unix()), Inline: true},
+	}, key, logFields)
+}
@@ -0,0 +1,217 @@
+package gap_registry
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"raidhub/lib/database/postgres"
+)
+
+// Method is how a gap was detected
+type Method string
+
+const (
+	MethodBinarySearch Method = "binary_search" // gap checker confirmed a gap and searched for the next block
+	MethodControlAPI   Method = "control_api"   // an operator triggered the search through the Atlas control API
+	MethodManual       Method = "manual"
+)
+
+// Status is where a gap is in its backfill
+type Status string
+
+const (
+	StatusPending     Status = "pending"
+	StatusBackfilling Status = "backfilling"
+	StatusComplete    Status = "complete"
+)
+
+// ErrClaimLost means another sweep took the gap over after the claim went stale
+var ErrClaimLost = errors.New("gap is claimed by another sweep")
+
+// Counts is how the swept ids of a gap resolved
+type Counts struct {
+	Raids    int64 `json:"raids"`
+	NonRaids int64 `json:"non_raids"`
+	NotFound int64 `json:"not_found"`
+	Errors   int64 `json:"errors"`
+}
+
+func (c Counts) Total() int64 {
+	return c.Raids + c.NonRaids + c.NotFound + c.Errors
+}
+
+// Add returns the sum of both counts
+func (c Counts) Add(o Counts) Counts {
+	return Counts{
+		Raids:    c.Raids + o.Raids,
+		NonRaids: c.NonRaids + o.NonRaids,
+		NotFound: c.NotFound + o.NotFound,
+		Errors:   c.Errors + o.Errors,
+	}
+}
+
+// Gap is a range of instance ids [StartId, EndId) the crawler skipped over
+type Gap struct {
+	GapId       int64      `json:"gap_id"`
+	StartId     int64      `json:"start_id"`
+	EndId       int64      `json:"end_id"`
+	DetectedAt  time.Time  `json:"detected_at"`
+	Method      Method     `json:"method"`
+	Status      Status     `json:"status"`
+	Cursor      int64      `json:"cursor"` // next id the backfill sweeps
+	Counts      Counts     `json:"counts"`
+	ClaimedBy   string     `json:"claimed_by,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// Size is the number of ids in the gap
+func (g *Gap) Size() int64 {
+	return g.EndId - g.StartId
+}
+
+// Share is the fraction of the swept ids that resolved to n
+func (g *Gap) Share(n int64) float64 {
+	total := g.Counts.Total()
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+const gapColumns = `gap_id, start_id, end_id, detected_at, method, status, cursor,
+	raids, non_raids, not_found, errors, claimed_by, completed_at`
+
+func scanGap(row interface{ Scan(...any) error }) (*Gap, error) {
+	var g Gap
+	var claimedBy sql.NullString
+	var completedAt sql.NullTime
+	err := row.Scan(&g.GapId, &g.StartId, &g.EndId, &g.DetectedAt, &g.Method, &g.Status, &g.Cursor,
+		&g.Counts.Raids, &g.Counts.NonRaids, &g.Counts.NotFound, &g.Counts.Errors, &claimedBy, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+	g.ClaimedBy = claimedBy.String
+	if completedAt.Valid {
+		g.CompletedAt = &completedAt.Time
+	}
+	return &g, nil
+}
+
+// Record registers the range [from, to) as a gap. Empty ranges are ignored and return nil.
+func Record(ctx context.Context, from, to int64, method Method) (*Gap, error) {
+	if to <= from {
+		return nil, nil
+	}
+	return scanGap(postgres.DB.QueryRowContext(ctx, `
+		INSERT INTO atlas.gap (start_id, end_id, method, cursor)
+		VALUES ($1, $2, $3, $1)
+		RETURNING `+gapColumns,
+		from, to, method))
+}
+
+// Claim takes the oldest unfinished gap nobody is working on and marks it as backfilling by owner. Gaps
+// whose claim was last refreshed longer ago than staleAfter are taken over, so a crashed sweep does not
+// strand them. Returns nil when there is nothing to claim.
+func Claim(ctx context.Context, owner string, staleAfter time.Duration) (*Gap, error) {
+	g, err := scanGap(postgres.DB.QueryRowContext(ctx, `
+		UPDATE atlas.gap g SET
+			status = 'backfilling',
+			claimed_by = $2,
+			claimed_at = NOW()
+		FROM (
+			SELECT gap_id FROM atlas.gap
+			WHERE status = 'pending'
+				OR (status = 'backfilling' AND claimed_at < NOW() - make_interval(secs => $1))
+			ORDER BY start_id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		) claimable
+		WHERE g.gap_id = claimable.gap_id
+		RETURNING g.gap_id, g.start_id, g.end_id, g.detected_at, g.method, g.status, g.cursor,
+			g.raids, g.non_raids, g.not_found, g.errors, g.claimed_by, g.completed_at
+	`, staleAfter.Seconds(), owner))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return g, err
+}
+
+// Advance moves the cursor of a gap claimed by owner to cursor, adds the counts of the ids swept since the
+// last call, and refreshes the claim. Once the cursor reaches the end the gap is complete. Returns
+// ErrClaimLost if owner no longer holds the claim.
+func Advance(ctx context.Context, gapId int64, owner string, cursor int64, delta Counts) (*Gap, error) {
+	g, err := scanGap(postgres.DB.QueryRowContext(ctx, `
+		UPDATE atlas.gap SET
+			cursor = $2,
+			raids = raids + $3,
+			non_raids = non_raids + $4,
+			not_found = not_found + $5,
+			errors = errors + $6,
+			claimed_at = NOW(),
+			status = CASE WHEN $2 >= end_id THEN 'complete' ELSE status END,
+			completed_at = CASE WHEN $2 >= end_id THEN NOW() ELSE completed_at END
+		WHERE gap_id = $1 AND claimed_by = $7 AND status = 'backfilling'
+		RETURNING `+gapColumns,
+		gapId, cursor, delta.Raids, delta.NonRaids, delta.NotFound, delta.Errors, owner))
+	if err == sql.ErrNoRows {
+		return nil, ErrClaimLost
+	}
+	return g, err
+}
+
+// Refresh keeps a claim by owner from going stale while its sweep is not making progress. Returns
+// ErrClaimLost if owner no longer holds the claim.
+func Refresh(ctx context.Context, gapId int64, owner string) error {
+	res, err := postgres.DB.ExecContext(ctx, `
+		UPDATE atlas.gap SET
+			claimed_at = NOW()
+		WHERE gap_id = $1 AND claimed_by = $2 AND status = 'backfilling'
+	`, gapId, owner)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrClaimLost
+	}
+	return nil
+}
+
+// Release hands a gap claimed by owner back so it can be claimed right away
+func Release(ctx context.Context, gapId int64, owner string) error {
+	_, err := postgres.DB.ExecContext(ctx, `
+		UPDATE atlas.gap SET
+			status = 'pending',
+			claimed_by = NULL,
+			claimed_at = NULL
+		WHERE gap_id = $1 AND claimed_by = $2 AND status = 'backfilling'
+	`, gapId, owner)
+	return err
+}
+
+// List returns the most recently detected gaps, newest first
+func List(ctx context.Context, limit int) ([]*Gap, error) {
+	rows, err := postgres.DB.QueryContext(ctx, `
+		SELECT `+gapColumns+`
+		FROM atlas.gap
+		ORDER BY detected_at DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var gaps []*Gap
+	for rows.Next() {
+		g, err := scanGap(rows)
+		if err != nil {
+			return nil, err
+		}
+		gaps = append(gaps, g)
+	}
+	return gaps, rows.Err()
+}
@@ -0,0 +1,187 @@
+package gap_registry
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"raidhub/lib/database/postgres"
+	"raidhub/lib/env"
+)
+
+// requirePostgres skips the test unless the database from .env is up and migrated, as it is in CI
+func requirePostgres(t *testing.T) {
+	t.Helper()
+	db, err := sql.Open("postgres", fmt.Sprintf("host=%s port=%s user=%s dbname=%s password=%s sslmode=disable connect_timeout=2",
+		env.PostgresHost, env.PostgresPort, env.PostgresUser, env.PostgresDB, env.PostgresPassword))
+	if err != nil {
+		t.Skipf("postgres unavailable: %v", err)
+	}
+	defer db.Close()
+	var table sql.NullString
+	if err := db.QueryRow(`SELECT to_regclass('atlas.gap')::TEXT`).Scan(&table); err != nil {
+		t.Skipf("postgres unavailable: %v", err)
+	}
+	if !table.Valid {
+		t.Skip("atlas.gap is not migrated")
+	}
+	postgres.Wait()
+}
+
+// recordTestGap registers a gap of size ids below every real instance id, so it is claimed first
+func recordTestGap(t *testing.T, size int64) *Gap {
+	t.Helper()
+	start := -time.Now().UnixNano()
+	gap, err := Record(context.Background(), start, start+size, MethodManual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		postgres.DB.Exec(`DELETE FROM atlas.gap WHERE gap_id = $1`, gap.GapId)
+	})
+	return gap
+}
+
+func TestCounts(t *testing.T) {
+	a := Counts{Raids: 1, NonRaids: 2, NotFound: 3, Errors: 4}
+	b := Counts{Raids: 10, NotFound: 5}
+	if got, want := a.Add(b), (Counts{Raids: 11, NonRaids: 2, NotFound: 8, Errors: 4}); got != want {
+		t.Errorf("Add() = %+v, want %+v", got, want)
+	}
+	if got := a.Total(); got != 10 {
+		t.Errorf("Total() = %d, want 10", got)
+	}
+
+	gap := &Gap{StartId: 100, EndId: 150, Counts: a}
+	if got := gap.Size(); got != 50 {
+		t.Errorf("Size() = %d, want 50", got)
+	}
+	if got := gap.Share(gap.Counts.NotFound); got != 0.3 {
+		t.Errorf("Share() = %g, want 0.3", got)
+	}
+	if got := (&Gap{}).Share(0); got != 0 {
+		t.Errorf("Share() of an unswept gap = %g, want 0", got)
+	}
+}
+
+func TestRecordEmptyRange(t *testing.T) {
+	gap, err := Record(context.Background(), 10, 10, MethodManual)
+	if gap != nil || err != nil {
+		t.Errorf("Record() of an empty range = (%v, %v), want (nil, nil)", gap, err)
+	}
+}
+
+func TestClaimAndAdvance(t *testing.T) {
+	requirePostgres(t)
+	ctx := context.Background()
+	recorded := recordTestGap(t, 100)
+	if recorded.Status != StatusPending || recorded.Cursor != recorded.StartId {
+		t.Fatalf("recorded gap = %+v, want pending with its cursor at the start", recorded)
+	}
+
+	claimed, err := Claim(ctx, "sweep-a", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed == nil || claimed.GapId != recorded.GapId || claimed.Status != StatusBackfilling || claimed.ClaimedBy != "sweep-a" {
+		t.Fatalf("Claim() = %+v, want gap %d backfilling by sweep-a", claimed, recorded.GapId)
+	}
+
+	// A claimed gap isn't handed out again while the claim is fresh
+	if other, err := Claim(ctx, "sweep-b", time.Hour); err != nil {
+		t.Fatal(err)
+	} else if other != nil {
+		if other.GapId == recorded.GapId {
+			t.Error("claimed the same gap twice")
+		}
+		Release(ctx, other.GapId, "sweep-b")
+	}
+
+	delta := Counts{Raids: 2, NotFound: 48}
+	advanced, err := Advance(ctx, recorded.GapId, "sweep-a", recorded.StartId+50, delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if advanced.Cursor != recorded.StartId+50 || advanced.Counts != delta || advanced.Status != StatusBackfilling {
+		t.Errorf("gap after sweeping half = %+v", advanced)
+	}
+
+	done, err := Advance(ctx, recorded.GapId, "sweep-a", recorded.EndId, Counts{NotFound: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done.Status != StatusComplete || done.CompletedAt == nil || done.Counts.NotFound != 98 {
+		t.Errorf("gap after sweeping all of it = %+v, want complete with 98 not found", done)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	requirePostgres(t)
+	ctx := context.Background()
+	recorded := recordTestGap(t, 10)
+
+	claimed, err := Claim(ctx, "sweep-a", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed == nil || claimed.GapId != recorded.GapId {
+		t.Fatalf("Claim() = %+v, want gap %d", claimed, recorded.GapId)
+	}
+	if err := Release(ctx, recorded.GapId, "sweep-a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Released gaps can be claimed again straight away
+	again, err := Claim(ctx, "sweep-b", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == nil || again.GapId != recorded.GapId {
+		t.Errorf("Claim() after release = %+v, want gap %d", again, recorded.GapId)
+	}
+}
+
+func TestStaleClaimTakenOver(t *testing.T) {
+	requirePostgres(t)
+	ctx := context.Background()
+	recorded := recordTestGap(t, 10)
+
+	if claimed, err := Claim(ctx, "sweep-a", time.Hour); err != nil {
+		t.Fatal(err)
+	} else if claimed == nil || claimed.GapId != recorded.GapId {
+		t.Fatalf("Claim() = %+v, want gap %d", claimed, recorded.GapId)
+	}
+	if err := Refresh(ctx, recorded.GapId, "sweep-a"); err != nil {
+		t.Fatalf("Refresh() by the claimant = %v", err)
+	}
+
+	// With no grace period the claim is stale straight away
+	takeover, err := Claim(ctx, "sweep-b", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if takeover == nil || takeover.GapId != recorded.GapId || takeover.ClaimedBy != "sweep-b" {
+		t.Fatalf("Claim() of a stale gap = %+v, want gap %d claimed by sweep-b", takeover, recorded.GapId)
+	}
+
+	// The old claimant can no longer write progress, refresh, or release the gap
+	if _, err := Advance(ctx, recorded.GapId, "sweep-a", recorded.EndId, Counts{NotFound: 10}); err != ErrClaimLost {
+		t.Errorf("Advance() by the old claimant = %v, want ErrClaimLost", err)
+	}
+	if err := Refresh(ctx, recorded.GapId, "sweep-a"); err != ErrClaimLost {
+		t.Errorf("Refresh() by the old claimant = %v, want ErrClaimLost", err)
+	}
+	if err := Release(ctx, recorded.GapId, "sweep-a"); err != nil {
+		t.Fatal(err)
+	}
+
+	advanced, err := Advance(ctx, recorded.GapId, "sweep-b", recorded.StartId+5, Counts{NotFound: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if advanced.Status != StatusBackfilling || advanced.Cursor != recorded.StartId+5 {
+		t.Errorf("gap after the new claimant swept half = %+v", advanced)
+	}
+}
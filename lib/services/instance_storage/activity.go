@@ -0,0 +1,153 @@
+package instance_storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"raidhub/lib/dto"
+	"raidhub/lib/messaging/publishing"
+	"raidhub/lib/messaging/routing"
+	"raidhub/lib/monitoring/global_metrics"
+	"raidhub/lib/services/player"
+	"raidhub/lib/utils/logging"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// storeActivityPGCR stores an instance of an accepted non-raid mode in the activity_instance tables.
+// The raw PGCR has already been written in tx. Raid-only work is left out: there are no activity
+// definitions for these hashes, so no player_stats, sherpas, leaderboards, ClickHouse, cheat checks,
+// or subscriptions.
+func storeActivityPGCR(ctx context.Context, tx *sql.Tx, inst *dto.Instance, rawIsNew bool, startTime time.Time) (*time.Duration, bool, error) {
+	isDuplicate, err := insertActivityInstance(tx, inst)
+	if err != nil {
+		logger.Warn(ERROR_STORING_INSTANCE_DATA, err, nil)
+		return nil, false, err
+	}
+	if isDuplicate && !rawIsNew {
+		tx.Rollback()
+		logger.Debug(DUPLICATE_INSTANCE, map[string]any{
+			logging.INSTANCE_ID: inst.InstanceId,
+		})
+		return nil, false, nil
+	}
+
+	var playerCrawlRequests []int64
+	if !isDuplicate {
+		for _, playerActivity := range inst.Players {
+			if err := storeActivityPlayerData(tx, inst, playerActivity); err != nil {
+				logger.Warn(ERROR_STORING_INSTANCE_DATA, err, nil)
+				return nil, false, err
+			}
+			if playerActivity.Player.MembershipType == nil || *playerActivity.Player.MembershipType == 0 {
+				playerCrawlRequests = append(playerCrawlRequests, playerActivity.Player.MembershipId)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Warn(FAILED_TO_COMMIT_TRANSACTION, err, nil)
+		global_metrics.InstanceStorageOperations.WithLabelValues("commit_transaction", "error").Inc()
+		return nil, false, err
+	}
+	global_metrics.InstanceStorageOperations.WithLabelValues("commit_transaction", "success").Inc()
+
+	for _, membershipId := range playerCrawlRequests {
+		publishing.PublishJSONMessage(ctx, routing.PlayerCrawl, membershipId)
+	}
+
+	lag := time.Since(inst.DateCompleted)
+	global_metrics.InstanceStorageOperations.WithLabelValues("store_activity_pgcr", "success").Inc()
+	global_metrics.InstanceStorageOperationDuration.WithLabelValues("store_activity_pgcr", "success").Observe(time.Since(startTime).Seconds())
+	logger.Info(STORED_NEW_ACTIVITY_INSTANCE, map[string]any{
+		logging.INSTANCE_ID: inst.InstanceId,
+		logging.LAG:         lag,
+		"mode":              inst.Mode,
+		"hash":              inst.Hash,
+	})
+	return &lag, true, nil
+}
+
+// insertActivityInstance inserts the instance row, reporting whether it already existed
+func insertActivityInstance(tx *sql.Tx, inst *dto.Instance) (bool, error) {
+	_, err := tx.Exec(`INSERT INTO "activity_instance" (
+		"instance_id",
+		"mode",
+		"hash",
+		"flawless",
+		"completed",
+		"fresh",
+		"player_count",
+		"date_started",
+		"date_completed",
+		"platform_type",
+		"duration",
+		"score",
+		"skull_hashes"
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`, inst.InstanceId, inst.Mode, inst.Hash,
+		inst.Flawless, inst.Completed, inst.Fresh, inst.PlayerCount,
+		inst.DateStarted, inst.DateCompleted, inst.MembershipType, inst.DurationSeconds, inst.Score, pq.Array(inst.SkullHashes))
+
+	if err != nil {
+		pqErr, ok := err.(*pq.Error)
+		if ok && (pqErr.Code == "23505") {
+			return true, nil // isDuplicate = true
+		}
+		return false, fmt.Errorf("inserting activity instance %d: %w", inst.InstanceId, err)
+	}
+	return false, nil
+}
+
+// storeActivityPlayerData stores a player and their characters for an activity instance
+func storeActivityPlayerData(tx *sql.Tx, inst *dto.Instance, playerActivity dto.InstancePlayer) error {
+	if _, err := player.UpsertPlayer(tx, &playerActivity.Player); err != nil {
+		return fmt.Errorf("inserting player %d for activity instance %d: %w", playerActivity.Player.MembershipId, inst.InstanceId, err)
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO "activity_instance_player" (
+			"instance_id",
+			"membership_id",
+			"completed",
+			"time_played_seconds"
+		)
+		VALUES ($1, $2, $3, $4);`,
+		inst.InstanceId, playerActivity.Player.MembershipId,
+		playerActivity.Finished, playerActivity.TimePlayedSeconds)
+	if err != nil {
+		return fmt.Errorf("inserting activity_instance_player for instance %d, membership %d: %w", inst.InstanceId, playerActivity.Player.MembershipId, err)
+	}
+
+	for _, character := range playerActivity.Characters {
+		_, err := tx.Exec(`
+			INSERT INTO "activity_instance_character" (
+				"instance_id",
+				"membership_id",
+				"character_id",
+				"class_hash",
+				"emblem_hash",
+				"completed",
+				"score",
+				"kills",
+				"assists",
+				"deaths",
+				"precision_kills",
+				"super_kills",
+				"grenade_kills",
+				"melee_kills",
+				"time_played_seconds",
+				"start_seconds"
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16);`,
+			inst.InstanceId, playerActivity.Player.MembershipId,
+			character.CharacterId, character.ClassHash, character.EmblemHash, character.Completed, character.Score,
+			character.Kills, character.Assists, character.Deaths, character.PrecisionKills, character.SuperKills,
+			character.GrenadeKills, character.MeleeKills, character.TimePlayedSeconds, character.StartSeconds)
+		if err != nil {
+			return fmt.Errorf("inserting activity_instance_character for instance %d, membership %d, character %d: %w",
+				inst.InstanceId, playerActivity.Player.MembershipId, character.CharacterId, err)
+		}
+	}
+	return nil
+}
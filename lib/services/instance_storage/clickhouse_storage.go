@@ -5,6 +5,8 @@ import (
 
 	"raidhub/lib/database/clickhouse"
 	"raidhub/lib/dto"
+
+	clickhousego "github.com/ClickHouse/clickhouse-go/v2"
 )
 
 // StoreToClickHouse stores the instance data to ClickHouse as one row per instance
@@ -37,6 +39,7 @@ func StoreToClickHouse(inst *dto.Instance) error {
 	}
 
 	players := buildPlayersMaps(inst.Players)
+	characterStats := buildCharacterStatsMaps(inst.Players)
 
 	batch, err := conn.PrepareBatch(ctx, "INSERT INTO instance")
 	if err != nil {
@@ -57,6 +60,7 @@ func StoreToClickHouse(inst *dto.Instance) error {
 		uint32(inst.DurationSeconds),
 		int32(inst.Score),
 		players,
+		characterStats,
 	)
 	if err != nil {
 		return err
@@ -64,6 +68,44 @@ func StoreToClickHouse(inst *dto.Instance) error {
 	return batch.Send()
 }
 
+// BackfillCharacterStatsToClickHouse fills the character_stats column of instances stored before it
+// existed. The stats are staged in the character_stats_backfill Join table and copied over with a
+// mutation rather than re-inserted, since an insert into instance would be counted again by its
+// materialized views. Instances that already have character stats are left alone.
+func BackfillCharacterStatsToClickHouse(players map[int64][]dto.InstancePlayer) error {
+	conn := clickhouse.DB
+	ctx := context.Background()
+
+	if err := conn.Exec(ctx, "TRUNCATE TABLE character_stats_backfill"); err != nil {
+		return err
+	}
+
+	batch, err := conn.PrepareBatch(ctx, "INSERT INTO character_stats_backfill")
+	if err != nil {
+		return err
+	}
+	defer batch.Abort()
+
+	for instanceId, pl := range players {
+		if err := batch.Append(instanceId, buildCharacterStatsMaps(pl)); err != nil {
+			return err
+		}
+	}
+	if err := batch.Send(); err != nil {
+		return err
+	}
+
+	// Wait for the mutation so the next batch doesn't truncate the staging table under it
+	ctx = clickhousego.Context(ctx, clickhousego.WithSettings(clickhousego.Settings{
+		"mutations_sync": 1,
+	}))
+	return conn.Exec(ctx, `
+		ALTER TABLE instance
+		UPDATE character_stats = joinGet('character_stats_backfill', 'character_stats', instance_id)
+		WHERE instance_id IN (SELECT instance_id FROM character_stats_backfill)
+			AND empty(character_stats)`)
+}
+
 func boolToUInt8(v bool) uint8 {
 	if v {
 		return 1
@@ -123,3 +165,31 @@ func buildPlayersMaps(pl []dto.InstancePlayer) []map[string]interface{} {
 	}
 	return out
 }
+
+// buildCharacterStatsMaps returns one map per extended value, medal, and weapon value for the
+// character_stats Nested column, the same rows StoreCharacterStats writes to Postgres.
+func buildCharacterStatsMaps(pl []dto.InstancePlayer) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0)
+	add := func(membershipId, characterId int64, weaponHash uint32, kind string, stats map[string]float64) {
+		for name, value := range stats {
+			out = append(out, map[string]interface{}{
+				"membership_id": membershipId,
+				"character_id":  characterId,
+				"weapon_hash":   weaponHash,
+				"kind":          kind,
+				"name":          name,
+				"value":         value,
+			})
+		}
+	}
+	for _, p := range pl {
+		for _, c := range p.Characters {
+			add(p.Player.MembershipId, c.CharacterId, 0, StatKindStat, c.ExtendedStats)
+			add(p.Player.MembershipId, c.CharacterId, 0, StatKindMedal, c.Medals)
+			for _, w := range c.Weapons {
+				add(p.Player.MembershipId, c.CharacterId, w.WeaponHash, StatKindWeapon, w.Stats)
+			}
+		}
+	}
+	return out
+}
@@ -4,6 +4,7 @@ package instance_storage
 const (
 	STORED_INSTANCE                = "STORED_INSTANCE"
 	STORED_NEW_INSTANCE            = "STORED_NEW_INSTANCE"
+	STORED_NEW_ACTIVITY_INSTANCE   = "STORED_NEW_ACTIVITY_INSTANCE"
 	FOUND_DUPLICATE_INSTANCE       = "FOUND_DUPLICATE_INSTANCE"
 	DUPLICATE_INSTANCE             = "DUPLICATE_INSTANCE"
 	DUPLICATE_RAW_PGCR             = "DUPLICATE_RAW_PGCR"
@@ -0,0 +1,63 @@
+package instance_storage
+
+import (
+	"database/sql"
+	"fmt"
+	"raidhub/lib/dto"
+
+	"github.com/lib/pq"
+)
+
+// Kinds of rows in instance_character_stat
+const (
+	StatKindStat   = "stat"
+	StatKindMedal  = "medal"
+	StatKindWeapon = "weapon"
+)
+
+// StoreCharacterStats writes every extended value, medal, and weapon value of a character as rows of
+// instance_character_stat. The instance_character row must already exist. Rows that are already there
+// are left alone, so storing the same character twice is safe.
+func StoreCharacterStats(tx *sql.Tx, instanceId int64, membershipId int64, character dto.InstanceCharacter) error {
+	var weaponHashes []int64
+	var kinds, names []string
+	var values []float64
+	add := func(weaponHash uint32, kind string, stats map[string]float64) {
+		for name, value := range stats {
+			weaponHashes = append(weaponHashes, int64(weaponHash))
+			kinds = append(kinds, kind)
+			names = append(names, name)
+			values = append(values, value)
+		}
+	}
+
+	add(0, StatKindStat, character.ExtendedStats)
+	add(0, StatKindMedal, character.Medals)
+	for _, weapon := range character.Weapons {
+		add(weapon.WeaponHash, StatKindWeapon, weapon.Stats)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO "instance_character_stat" (
+			"instance_id",
+			"membership_id",
+			"character_id",
+			"weapon_hash",
+			"kind",
+			"name",
+			"value"
+		)
+		SELECT $1, $2, $3, s.weapon_hash, s.kind, s.name, s.value
+		FROM unnest($4::bigint[], $5::text[], $6::text[], $7::float8[]) AS s(weapon_hash, kind, name, value)
+		ON CONFLICT DO NOTHING;`,
+		instanceId, membershipId, character.CharacterId,
+		pq.Array(weaponHashes), pq.Array(kinds), pq.Array(names), pq.Array(values))
+	if err != nil {
+		return fmt.Errorf("inserting instance_character_stat for instance %d, membership %d, character %d: %w",
+			instanceId, membershipId, character.CharacterId, err)
+	}
+	return nil
+}
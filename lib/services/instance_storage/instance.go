@@ -243,6 +243,10 @@ func storeCharacterData(tx *sql.Tx, inst *dto.Instance, playerActivity dto.Insta
 			return nil, err
 		}
 
+		if err := StoreCharacterStats(tx, inst.InstanceId, playerActivity.Player.MembershipId, character); err != nil {
+			return nil, err
+		}
+
 		if character.ClassHash == nil {
 			characterRequests = append(characterRequests, messages.NewCharacterFillMessage(
 				playerActivity.Player.MembershipId,
@@ -39,6 +39,11 @@ func StorePGCR(ctx context.Context, inst *dto.Instance, raw *bungie.DestinyPostG
 		return nil, false, err
 	}
 
+	// Accepted non-raid modes have their own tables and none of the raid side effects
+	if !inst.IsRaid() {
+		return storeActivityPGCR(ctx, tx, inst, rawIsNew, startTime)
+	}
+
 	// 2. Store instance data (instance domain) - within same transaction
 	sideEffects, instanceIsNew, err := Store(tx, inst)
 	if err != nil {
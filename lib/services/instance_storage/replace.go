@@ -108,40 +108,47 @@ func ReplacePGCR(ctx context.Context, inst *dto.Instance, raw *bungie.DestinyPos
 }
 
 // ClearInstance clears an instance and all related data from the database
-// Clears in order: instance_character_weapon -> instance_character -> instance_player -> instance -> pgcr
+// Clears in order: instance_character_stat -> instance_character_weapon -> instance_character -> instance_player -> instance -> pgcr
 // This is used to clear existing data before replacing with new data
 // Returns error if clearing fails
 func clearInstance(tx *sql.Tx, instanceID int64) error {
 	// Delete in order to respect foreign key constraints
-	// 1. Delete instance_character_weapon
-	_, err := tx.Exec(`DELETE FROM extended.instance_character_weapon WHERE instance_id = $1`, instanceID)
+	// 1. Delete instance_character_stat
+	_, err := tx.Exec(`DELETE FROM extended.instance_character_stat WHERE instance_id = $1`, instanceID)
+	if err != nil {
+		logger.Warn("FAILED_TO_DELETE_INSTANCE_CHARACTER_STAT", err, map[string]any{logging.INSTANCE_ID: instanceID})
+		return err
+	}
+
+	// 2. Delete instance_character_weapon
+	_, err = tx.Exec(`DELETE FROM extended.instance_character_weapon WHERE instance_id = $1`, instanceID)
 	if err != nil {
 		logger.Warn("FAILED_TO_DELETE_INSTANCE_CHARACTER_WEAPON", err, map[string]any{logging.INSTANCE_ID: instanceID})
 		return err
 	}
 
-	// 2. Delete instance_character
+	// 3. Delete instance_character
 	_, err = tx.Exec(`DELETE FROM extended.instance_character WHERE instance_id = $1`, instanceID)
 	if err != nil {
 		logger.Warn("FAILED_TO_DELETE_INSTANCE_CHARACTER", err, map[string]any{logging.INSTANCE_ID: instanceID})
 		return err
 	}
 
-	// 3. Delete instance_player
+	// 4. Delete instance_player
 	_, err = tx.Exec(`DELETE FROM core.instance_player WHERE instance_id = $1`, instanceID)
 	if err != nil {
 		logger.Warn("FAILED_TO_DELETE_INSTANCE_PLAYER", err, map[string]any{logging.INSTANCE_ID: instanceID})
 		return err
 	}
 
-	// 4. Delete instance
+	// 5. Delete instance
 	_, err = tx.Exec(`DELETE FROM core.instance WHERE instance_id = $1`, instanceID)
 	if err != nil {
 		logger.Warn("FAILED_TO_DELETE_INSTANCE", err, map[string]any{logging.INSTANCE_ID: instanceID})
 		return err
 	}
 
-	// 5. Delete raw pgcr
+	// 6. Delete raw pgcr
 	_, err = tx.Exec(`DELETE FROM raw.pgcr WHERE instance_id = $1`, instanceID)
 	if err != nil {
 		logger.Warn("FAILED_TO_DELETE_RAW_PGCR", err, map[string]any{logging.INSTANCE_ID: instanceID})
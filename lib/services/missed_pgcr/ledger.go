@@ -0,0 +1,187 @@
+package missed_pgcr
+
+import (
+	"context"
+	"time"
+
+	"raidhub/lib/database/postgres"
+	"raidhub/lib/services/pgcr_processing"
+	"raidhub/lib/utils/logging"
+
+	"github.com/lib/pq"
+)
+
+var logger = logging.NewLogger("MISSED_PGCR_SERVICE")
+
+// Reason is why an instance could not be resolved
+type Reason string
+
+const (
+	ReasonNotFound      Reason = "not_found"
+	ReasonMalformed     Reason = "malformed"
+	ReasonExternalError Reason = "external_error"
+	ReasonBlocked       Reason = "blocked"
+)
+
+// Source is the component that gave up on an instance
+type Source string
+
+const (
+	SourceAtlas              Source = "atlas"
+	SourceGapChecker         Source = "gap_checker"
+	SourceGapBackfill        Source = "gap_backfill"
+	SourcePGCROffload        Source = "pgcr_offload"
+	SourcePGCRBlockedRetry   Source = "pgcr_blocked_retry"
+	SourcePGCRCrawl          Source = "pgcr_crawl"
+	SourceInstanceStore      Source = "instance_store"
+	SourceProcessMissedPGCRs Source = "process_missed_pgcrs"
+)
+
+// Entry is a claimed ledger row
+type Entry struct {
+	InstanceId  int64
+	Reason      Reason
+	Source      Source
+	Attempts    int
+	FirstSeenAt time.Time
+	LastSeenAt  time.Time
+}
+
+// ReasonForResult maps a failed PGCR fetch result to a ledger reason
+func ReasonForResult(result pgcr_processing.PGCRResult) Reason {
+	switch result {
+	case pgcr_processing.NotFound:
+		return ReasonNotFound
+	case pgcr_processing.BadFormat:
+		return ReasonMalformed
+	case pgcr_processing.InsufficientPrivileges:
+		return ReasonBlocked
+	default:
+		return ReasonExternalError
+	}
+}
+
+// Record adds an instance to the ledger, or bumps its attempt count if it is already there.
+// Either way the instance goes back to pending. Returns the attempt count after the write.
+func Record(ctx context.Context, instanceId int64, reason Reason, source Source) (int, error) {
+	var attempts int
+	err := postgres.DB.QueryRowContext(ctx, `
+		INSERT INTO atlas.missed_pgcr (instance_id, reason, source)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (instance_id) DO UPDATE SET
+			reason = EXCLUDED.reason,
+			source = EXCLUDED.source,
+			attempts = missed_pgcr.attempts + 1,
+			last_seen_at = NOW(),
+			status = 'pending',
+			claimed_at = NULL,
+			resolved_at = NULL
+		RETURNING attempts
+	`, instanceId, reason, source).Scan(&attempts)
+	return attempts, err
+}
+
+// RecordRange adds every instance in [from, to) to the ledger in one statement
+func RecordRange(ctx context.Context, from, to int64, reason Reason, source Source) error {
+	if to <= from {
+		return nil
+	}
+	_, err := postgres.DB.ExecContext(ctx, `
+		INSERT INTO atlas.missed_pgcr (instance_id, reason, source)
+		SELECT id, $3, $4 FROM generate_series($1::BIGINT, $2::BIGINT - 1) AS id
+		ON CONFLICT (instance_id) DO UPDATE SET
+			reason = EXCLUDED.reason,
+			source = EXCLUDED.source,
+			attempts = missed_pgcr.attempts + 1,
+			last_seen_at = NOW(),
+			status = 'pending',
+			claimed_at = NULL,
+			resolved_at = NULL
+	`, from, to, reason, source)
+	return err
+}
+
+// Log records a missed instance and logs instead of returning on failure. For writers on a hot path
+// that have nothing better to do with the error.
+func Log(ctx context.Context, instanceId int64, reason Reason, source Source) {
+	if _, err := Record(ctx, instanceId, reason, source); err != nil {
+		logger.Warn("FAILED_TO_RECORD_MISSED_PGCR", err, map[string]any{
+			logging.INSTANCE_ID: instanceId,
+			logging.REASON:      reason,
+			"source":            source,
+		})
+	}
+}
+
+// Claim marks up to limit pending instances last seen before seenBefore as claimed and returns them,
+// lowest id first. Rows claimed longer ago than staleAfter are treated as pending again, so a crashed
+// run does not strand them. Concurrent claimers skip each other's rows.
+func Claim(ctx context.Context, limit int, staleAfter time.Duration, seenBefore time.Time) ([]Entry, error) {
+	rows, err := postgres.DB.QueryContext(ctx, `
+		UPDATE atlas.missed_pgcr m SET
+			status = 'claimed',
+			claimed_at = NOW()
+		FROM (
+			SELECT instance_id FROM atlas.missed_pgcr
+			WHERE (status = 'pending'
+				OR (status = 'claimed' AND claimed_at < NOW() - make_interval(secs => $2)))
+				AND last_seen_at < $3
+			ORDER BY instance_id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		) claimable
+		WHERE m.instance_id = claimable.instance_id
+		RETURNING m.instance_id, m.reason, m.source, m.attempts, m.first_seen_at, m.last_seen_at
+	`, limit, staleAfter.Seconds(), seenBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.InstanceId, &e.Reason, &e.Source, &e.Attempts, &e.FirstSeenAt, &e.LastSeenAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Resolve marks instances as resolved. Ids that are not in the ledger are ignored.
+func Resolve(ctx context.Context, instanceIds ...int64) error {
+	if len(instanceIds) == 0 {
+		return nil
+	}
+	_, err := postgres.DB.ExecContext(ctx, `
+		UPDATE atlas.missed_pgcr SET
+			status = 'resolved',
+			claimed_at = NULL,
+			resolved_at = NOW()
+		WHERE instance_id = ANY($1) AND status <> 'resolved'
+	`, pq.Array(instanceIds))
+	return err
+}
+
+// Release puts a claimed instance back to pending without counting an attempt
+func Release(ctx context.Context, instanceId int64) error {
+	_, err := postgres.DB.ExecContext(ctx, `
+		UPDATE atlas.missed_pgcr SET
+			status = 'pending',
+			claimed_at = NULL
+		WHERE instance_id = $1 AND status = 'claimed'
+	`, instanceId)
+	return err
+}
+
+// Abandon stops an instance from being claimed again
+func Abandon(ctx context.Context, instanceId int64) error {
+	_, err := postgres.DB.ExecContext(ctx, `
+		UPDATE atlas.missed_pgcr SET
+			status = 'abandoned',
+			claimed_at = NULL
+		WHERE instance_id = $1
+	`, instanceId)
+	return err
+}
@@ -0,0 +1,187 @@
+package missed_pgcr
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"raidhub/lib/database/postgres"
+	"raidhub/lib/env"
+	"raidhub/lib/services/pgcr_processing"
+)
+
+// requirePostgres skips the test unless the database from .env is up and migrated, as it is in CI
+func requirePostgres(t *testing.T) {
+	t.Helper()
+	db, err := sql.Open("postgres", fmt.Sprintf("host=%s port=%s user=%s dbname=%s password=%s sslmode=disable connect_timeout=2",
+		env.PostgresHost, env.PostgresPort, env.PostgresUser, env.PostgresDB, env.PostgresPassword))
+	if err != nil {
+		t.Skipf("postgres unavailable: %v", err)
+	}
+	defer db.Close()
+	var table sql.NullString
+	if err := db.QueryRow(`SELECT to_regclass('atlas.missed_pgcr')::TEXT`).Scan(&table); err != nil {
+		t.Skipf("postgres unavailable: %v", err)
+	}
+	if !table.Valid {
+		t.Skip("atlas.missed_pgcr is not migrated")
+	}
+	postgres.Wait()
+}
+
+// testInstanceIds are negative so the test's rows are claimed ahead of any real ones and can't collide
+// with them
+func testInstanceIds(t *testing.T, n int) []int64 {
+	t.Helper()
+	base := -time.Now().UnixNano()
+	ids := make([]int64, n)
+	for i := range ids {
+		ids[i] = base + int64(i)
+	}
+	t.Cleanup(func() {
+		postgres.DB.Exec(`DELETE FROM atlas.missed_pgcr WHERE instance_id BETWEEN $1 AND $2`, ids[0], ids[n-1])
+	})
+	return ids
+}
+
+func TestReasonForResult(t *testing.T) {
+	tests := []struct {
+		result pgcr_processing.PGCRResult
+		want   Reason
+	}{
+		{pgcr_processing.NotFound, ReasonNotFound},
+		{pgcr_processing.BadFormat, ReasonMalformed},
+		{pgcr_processing.InsufficientPrivileges, ReasonBlocked},
+		{pgcr_processing.ExternalError, ReasonExternalError},
+		{pgcr_processing.RateLimited, ReasonExternalError},
+	}
+	for _, tt := range tests {
+		if got := ReasonForResult(tt.result); got != tt.want {
+			t.Errorf("ReasonForResult(%v) = %q, want %q", tt.result, got, tt.want)
+		}
+	}
+}
+
+func TestRecordCountsAttempts(t *testing.T) {
+	requirePostgres(t)
+	ctx := context.Background()
+	id := testInstanceIds(t, 1)[0]
+
+	for want := 1; want <= 3; want++ {
+		attempts, err := Record(ctx, id, ReasonNotFound, SourceAtlas)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if attempts != want {
+			t.Errorf("attempts after recording %d times = %d, want %d", want, attempts, want)
+		}
+	}
+}
+
+func TestClaim(t *testing.T) {
+	requirePostgres(t)
+	ctx := context.Background()
+	ids := testInstanceIds(t, 3)
+	for _, id := range ids {
+		if _, err := Record(ctx, id, ReasonExternalError, SourcePGCROffload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seenBefore := time.Now().Add(time.Second)
+
+	claimed, err := Claim(ctx, 2, time.Hour, seenBefore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 2 || claimed[0].InstanceId != ids[0] || claimed[1].InstanceId != ids[1] {
+		t.Fatalf("first claim = %+v, want %d and %d", claimed, ids[0], ids[1])
+	}
+	if claimed[0].Reason != ReasonExternalError || claimed[0].Source != SourcePGCROffload || claimed[0].Attempts != 1 {
+		t.Errorf("claimed entry = %+v", claimed[0])
+	}
+
+	// Claimed rows aren't handed out again until they go stale
+	next, err := Claim(ctx, 1, time.Hour, seenBefore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(next) != 1 || next[0].InstanceId != ids[2] {
+		t.Fatalf("second claim = %+v, want %d", next, ids[2])
+	}
+
+	// Released rows come back straight away
+	if err := Release(ctx, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := Resolve(ctx, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := Abandon(ctx, ids[2]); err != nil {
+		t.Fatal(err)
+	}
+	again, err := Claim(ctx, 1, time.Hour, seenBefore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 1 || again[0].InstanceId != ids[0] {
+		t.Errorf("claim after release = %+v, want %d", again, ids[0])
+	}
+	for id, want := range map[int64]string{ids[1]: "resolved", ids[2]: "abandoned"} {
+		if got := ledgerStatus(t, id); got != want {
+			t.Errorf("status of %d = %s, want %s", id, got, want)
+		}
+	}
+}
+
+func ledgerStatus(t *testing.T, id int64) string {
+	t.Helper()
+	var status string
+	if err := postgres.DB.QueryRow(`SELECT status FROM atlas.missed_pgcr WHERE instance_id = $1`, id).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestClaimSkipsRecentlySeen(t *testing.T) {
+	requirePostgres(t)
+	ctx := context.Background()
+	id := testInstanceIds(t, 1)[0]
+	seenBefore := time.Now().Add(-time.Minute)
+	if _, err := Record(ctx, id, ReasonNotFound, SourceAtlas); err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, err := Claim(ctx, 1, time.Hour, seenBefore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range claimed {
+		if e.InstanceId == id {
+			t.Errorf("claimed an instance seen after the run started")
+		} else {
+			// Someone else's row; hand it straight back
+			Release(ctx, e.InstanceId)
+		}
+	}
+}
+
+func TestRecordReopensResolved(t *testing.T) {
+	requirePostgres(t)
+	ctx := context.Background()
+	id := testInstanceIds(t, 1)[0]
+	if _, err := Record(ctx, id, ReasonNotFound, SourceAtlas); err != nil {
+		t.Fatal(err)
+	}
+	if err := Resolve(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Record(ctx, id, ReasonMalformed, SourceInstanceStore); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ledgerStatus(t, id); got != "pending" {
+		t.Errorf("status after a repeat miss = %s, want pending", got)
+	}
+}
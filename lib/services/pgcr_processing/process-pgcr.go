@@ -5,8 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"raidhub/lib/dto"
+	"raidhub/lib/env"
 	"raidhub/lib/utils/logging"
 	"raidhub/lib/web/bungie"
+	"strings"
 	"time"
 )
 
@@ -17,7 +19,7 @@ type PGCRResult int
 // PGCRResult is the result of the PGCR processing
 const (
 	Success                PGCRResult = 1
-	NonRaid                PGCRResult = 2
+	NonRaid                PGCRResult = 2 // the activity mode is not in PGCR_ACCEPTED_MODES
 	NotFound               PGCRResult = 3
 	SystemDisabled         PGCRResult = 4
 	InsufficientPrivileges PGCRResult = 5
@@ -28,15 +30,34 @@ const (
 	RateLimited   PGCRResult = 10
 )
 
+// acceptedModes are the activity modes turned into instances. Raids are always accepted.
+var acceptedModes = func() map[int]bool {
+	modes := map[int]bool{bungie.ModeRaid: true}
+	for _, mode := range env.PGCRAcceptedModes {
+		modes[mode] = true
+	}
+	return modes
+}()
+
+// IsAcceptedMode reports whether PGCRs of an activity mode are stored
+func IsAcceptedMode(mode int) bool {
+	return acceptedModes[mode]
+}
+
 // From an id, fetch the PGCR and process it into an Instance, returning the result, the instance, and the raw PGCR
 func FetchAndProcessPGCR(ctx context.Context, instanceID int64, malformedRetryCount int) (PGCRResult, *dto.Instance, *bungie.DestinyPostGameCarnageReport) {
 	result, rawPGCR := FetchPGCR(ctx, instanceID, malformedRetryCount)
 	if result != Success {
 		return result, nil, nil
 	}
+	return ProcessPGCR(instanceID, rawPGCR)
+}
 
-	// Check if this is a raid activity
-	if rawPGCR.ActivityDetails.Mode != bungie.ModeRaid {
+// ProcessPGCR turns a fetched PGCR into an Instance, returning NonRaid for activities we don't store and
+// BadFormat for malformed ones
+func ProcessPGCR(instanceID int64, rawPGCR *bungie.DestinyPostGameCarnageReport) (PGCRResult, *dto.Instance, *bungie.DestinyPostGameCarnageReport) {
+	// Check if this is an activity we store
+	if !IsAcceptedMode(rawPGCR.ActivityDetails.Mode) {
 		return NonRaid, nil, rawPGCR
 	}
 
@@ -110,6 +131,7 @@ func parsePGCRToInstance(report *bungie.DestinyPostGameCarnageReport) (*dto.Inst
 
 	result := dto.Instance{
 		InstanceId: report.ActivityDetails.InstanceId,
+		Mode:       report.ActivityDetails.Mode,
 		Hash:       report.ActivityDetails.DirectorActivityHash,
 		// assigned later
 		Fresh:           nil,
@@ -179,15 +201,7 @@ func parsePGCRToInstance(report *bungie.DestinyPostGameCarnageReport) (*dto.Inst
 				character.SuperKills = getStat(entry.Extended.Values, "weaponKillsSuper")
 				character.GrenadeKills = getStat(entry.Extended.Values, "weaponKillsGrenade")
 				character.MeleeKills = getStat(entry.Extended.Values, "weaponKillsMelee")
-
-				for _, weapon := range entry.Extended.Weapons {
-					processedWeapon := dto.InstanceCharacterWeapon{
-						WeaponHash: weapon.ReferenceId,
-					}
-					processedWeapon.Kills = getStat(weapon.Values, "uniqueWeaponKills")
-					processedWeapon.PrecisionKills = getStat(weapon.Values, "uniqueWeaponPrecisionKills")
-					character.Weapons = append(character.Weapons, processedWeapon)
-				}
+				ApplyExtendedStats(&character, entry.Extended)
 			}
 
 			processedPlayerActivity.Characters = append(processedPlayerActivity.Characters, character)
@@ -268,6 +282,33 @@ func getStat(values map[string]bungie.DestinyHistoricalStatsValue, key string) i
 	}
 }
 
+// ApplyExtendedStats copies every extended value and medal of an entry onto the character, along with
+// every value of each weapon it used
+func ApplyExtendedStats(character *dto.InstanceCharacter, extended *bungie.DestinyPostGameCarnageReportExtendedData) {
+	character.ExtendedStats = make(map[string]float64, len(extended.Values))
+	character.Medals = make(map[string]float64)
+	for key, stat := range extended.Values {
+		if strings.HasPrefix(key, "medal") {
+			character.Medals[key] = float64(stat.Basic.Value)
+		} else {
+			character.ExtendedStats[key] = float64(stat.Basic.Value)
+		}
+	}
+
+	for _, weapon := range extended.Weapons {
+		processedWeapon := dto.InstanceCharacterWeapon{
+			WeaponHash: weapon.ReferenceId,
+			Stats:      make(map[string]float64, len(weapon.Values)),
+		}
+		processedWeapon.Kills = getStat(weapon.Values, "uniqueWeaponKills")
+		processedWeapon.PrecisionKills = getStat(weapon.Values, "uniqueWeaponPrecisionKills")
+		for key, stat := range weapon.Values {
+			processedWeapon.Stats[key] = float64(stat.Basic.Value)
+		}
+		character.Weapons = append(character.Weapons, processedWeapon)
+	}
+}
+
 func calculatePlayerTimePlayedSeconds(characters []bungie.DestinyPostGameCarnageReportEntry) int {
 	activityDurationSeconds := getStat(characters[0].Values, "activityDurationSeconds")
 	timeline := make([]int, activityDurationSeconds+1)
@@ -5,10 +5,30 @@ import (
 	"sync"
 	"time"
 
+	"raidhub/lib/env"
+	"raidhub/lib/monitoring/global_metrics"
 	"raidhub/lib/utils"
 	"raidhub/lib/utils/logging"
 )
 
+// What caused a system to change state
+const (
+	AvailabilitySourceSettings = "settings"               // the Settings endpoint reported it
+	AvailabilitySourceSignal   = "system_disabled_signal" // a worker got SystemDisabled from the API
+	AvailabilitySourceFailOpen = "fail_open"              // the Settings endpoint was unreachable for too long
+)
+
+// SystemTransition is a system becoming available or unavailable as seen by this process
+type SystemTransition struct {
+	System    string
+	Available bool
+	Source    string
+	At        time.Time
+	// Previous is how long the system was in the state it left, or 0 when this process never saw it
+	// enter that state (the blocked state every monitor starts in)
+	Previous time.Duration
+}
+
 var (
 	globalMonitor       *globalAPIMonitor
 	globalMonitorLock   sync.Once
@@ -23,6 +43,15 @@ type globalAPIMonitor struct {
 	updateChan    chan string   // Channel to signal immediate system updates
 	newSystemChan chan struct{} // Channel to signal that a new system was registered
 	updateMutex   sync.Mutex    // Mutex to ensure only one API request at a time
+
+	// Settings outage tracking, guarded by updateMutex
+	failOpenAfter        time.Duration // 0 keeps systems blocked for as long as Settings is unreachable
+	settingsFailingSince time.Time
+	failedOpen           bool
+
+	transitions chan SystemTransition
+	observersMu sync.RWMutex
+	observers   []func(SystemTransition)
 }
 
 // systemMonitor tracks availability for a specific system
@@ -30,6 +59,7 @@ type systemMonitor struct {
 	systemName string
 	monitorWG  sync.WaitGroup
 	available  bool
+	since      time.Time // when available last changed; zero until the first transition
 	mu         sync.RWMutex
 }
 
@@ -42,8 +72,11 @@ func getGlobalMonitor() *globalAPIMonitor {
 			stopChan:      make(chan struct{}),
 			updateChan:    make(chan string, 100),  // Buffered channel for immediate signals
 			newSystemChan: make(chan struct{}, 10), // Buffered channel for new system registrations
+			failOpenAfter: time.Duration(env.BungieSettingsFailOpenMinutes) * time.Minute,
+			transitions:   make(chan SystemTransition, 100),
 		}
 		go globalMonitor.monitor()
+		go globalMonitor.dispatchTransitions()
 	})
 	return globalMonitor
 }
@@ -74,6 +107,7 @@ func (gm *globalAPIMonitor) getSystemMonitor(systemName string) *APIAvailability
 	}
 	// Start with workers blocked
 	monitor.monitorWG.Add(1)
+	global_metrics.BungieSystemAvailable.WithLabelValues(systemName).Set(0)
 
 	gm.systems[systemName] = monitor
 
@@ -135,8 +169,17 @@ func (gm *globalAPIMonitor) updateAllSystems() {
 			logging.ERROR_STATUS:      result.BungieErrorStatus,
 			logging.STATUS_CODE:       result.HttpStatusCode,
 		})
+		gm.settingsCheckFailed(err)
 		return
 	}
+	if gm.failedOpen {
+		globalMonitorLogger.Info("BUNGIE_SETTINGS_REACHABLE", map[string]any{
+			logging.ACTION:   "resuming_settings_checks",
+			logging.DURATION: time.Since(gm.settingsFailingSince).Round(time.Second).String(),
+		})
+	}
+	gm.settingsFailingSince = time.Time{}
+	gm.failedOpen = false
 
 	// Update all registered systems
 	gm.mu.RLock()
@@ -147,6 +190,32 @@ func (gm *globalAPIMonitor) updateAllSystems() {
 	}
 }
 
+// settingsCheckFailed fails every system open once the Settings endpoint has been unreachable for
+// failOpenAfter. Blocking everything because the status page is down would stop all work on an API
+// that is most likely fine; workers still back off on their own errors.
+func (gm *globalAPIMonitor) settingsCheckFailed(err error) {
+	now := time.Now()
+	if gm.settingsFailingSince.IsZero() {
+		gm.settingsFailingSince = now
+	}
+	if gm.failOpenAfter <= 0 || now.Sub(gm.settingsFailingSince) < gm.failOpenAfter {
+		return
+	}
+	if !gm.failedOpen {
+		gm.failedOpen = true
+		globalMonitorLogger.Warn("BUNGIE_SETTINGS_UNREACHABLE_FAILING_OPEN", err, map[string]any{
+			logging.ACTION:   "unblocking_workers",
+			logging.DURATION: now.Sub(gm.settingsFailingSince).Round(time.Second).String(),
+		})
+	}
+
+	gm.mu.RLock()
+	defer gm.mu.RUnlock()
+	for _, monitor := range gm.systems {
+		gm.setAvailability(monitor, true, AvailabilitySourceFailOpen)
+	}
+}
+
 // blockSystemImmediately blocks workers for a system without making an API call
 // This is called when a SystemDisabled error is detected from the API
 func (gm *globalAPIMonitor) blockSystemImmediately(systemName string) {
@@ -158,20 +227,7 @@ func (gm *globalAPIMonitor) blockSystemImmediately(systemName string) {
 		return
 	}
 
-	monitor.mu.Lock()
-	wasAvailable := monitor.available
-	monitor.available = false // Block the system
-	monitor.mu.Unlock()
-
-	// Only update wait group if transitioning from available to disabled
-	if wasAvailable {
-		globalMonitorLogger.Info("BUNGIE_API_DISABLED", map[string]any{
-			logging.ACTION: "blocking_workers",
-			logging.SYSTEM: monitor.systemName,
-			logging.SOURCE: "system_disabled_signal",
-		})
-		monitor.monitorWG.Add(1)
-	}
+	gm.setAvailability(monitor, false, AvailabilitySourceSignal)
 }
 
 // updateSystemState updates a single system's state
@@ -181,27 +237,99 @@ func (gm *globalAPIMonitor) updateSystemState(monitor *systemMonitor, systems ma
 		isAPIDisabled = !system.Enabled
 	}
 
+	gm.setAvailability(monitor, !isAPIDisabled, AvailabilitySourceSettings)
+}
+
+// setAvailability moves a system to available, unblocking or blocking its workers, and reports the
+// transition. It does nothing if the system is already there.
+func (gm *globalAPIMonitor) setAvailability(monitor *systemMonitor, available bool, source string) {
+	now := time.Now()
 	monitor.mu.Lock()
-	wasAvailable := monitor.available
-	monitor.available = !isAPIDisabled
+	if monitor.available == available {
+		monitor.mu.Unlock()
+		return
+	}
+	monitor.available = available
+	previousSince := monitor.since
+	monitor.since = now
 	monitor.mu.Unlock()
 
-	// If API status changed, update the wait group
-	if wasAvailable && isAPIDisabled {
+	// Only update the wait group on a transition
+	if available {
+		globalMonitorLogger.Info("BUNGIE_API_ENABLED", map[string]any{
+			logging.ACTION: "unblocking_workers",
+			logging.SYSTEM: monitor.systemName,
+			logging.SOURCE: source,
+		})
+		monitor.monitorWG.Done()
+	} else {
 		globalMonitorLogger.Info("BUNGIE_API_DISABLED", map[string]any{
 			logging.ACTION: "blocking_workers",
 			logging.SYSTEM: monitor.systemName,
+			logging.SOURCE: source,
 		})
 		monitor.monitorWG.Add(1)
-	} else if !wasAvailable && !isAPIDisabled {
-		globalMonitorLogger.Info("BUNGIE_API_ENABLED", map[string]any{
-			logging.ACTION: "unblocking_workers",
+	}
+
+	transition := SystemTransition{
+		System:    monitor.systemName,
+		Available: available,
+		Source:    source,
+		At:        now,
+	}
+	if !previousSince.IsZero() {
+		transition.Previous = now.Sub(previousSince)
+	}
+
+	state := "unavailable"
+	availableValue := 0.0
+	if available {
+		state = "available"
+		availableValue = 1
+		if transition.Previous > 0 {
+			global_metrics.BungieSystemOutageDuration.WithLabelValues(monitor.systemName).Observe(transition.Previous.Seconds())
+		}
+	}
+	global_metrics.BungieSystemAvailable.WithLabelValues(monitor.systemName).Set(availableValue)
+	global_metrics.BungieSystemTransitions.WithLabelValues(monitor.systemName, state, source).Inc()
+
+	select {
+	case gm.transitions <- transition:
+	default:
+		globalMonitorLogger.Warn("BUNGIE_SYSTEM_TRANSITION_DROPPED", nil, map[string]any{
 			logging.SYSTEM: monitor.systemName,
+			logging.SOURCE: source,
 		})
-		monitor.monitorWG.Done()
 	}
 }
 
+// dispatchTransitions hands transitions to the observers one at a time, in the order they happened
+func (gm *globalAPIMonitor) dispatchTransitions() {
+	for {
+		select {
+		case transition := <-gm.transitions:
+			gm.observersMu.RLock()
+			observers := gm.observers
+			gm.observersMu.RUnlock()
+			for _, observe := range observers {
+				observe(transition)
+			}
+		case <-gm.stopChan:
+			return
+		}
+	}
+}
+
+// OnSystemTransition registers fn to be called with every system transition this process sees. Calls
+// are made one at a time off the monitor goroutine, so fn may block briefly (to write to a database)
+// without holding up availability checks.
+func OnSystemTransition(fn func(SystemTransition)) {
+	gm := getGlobalMonitor()
+	gm.observersMu.Lock()
+	defer gm.observersMu.Unlock()
+	gm.observers = append(gm.observers, fn)
+}
+
 // GetReadOnlyWaitGroup returns a read-only wrapper of the internal wait group
 func (m *APIAvailabilityMonitor) GetReadOnlyWaitGroup() *utils.ReadOnlyWaitGroup {
 	return utils.NewReadOnlyWaitGroup(&m.system.monitorWG)
@@ -212,6 +340,21 @@ func (m *APIAvailabilityMonitor) IsRunning() bool {
 	return globalMonitor != nil
 }
 
+// IsSystemAvailable reports whether workers waiting on systemName are currently let through. Systems
+// no worker has registered for are reported unavailable.
+func IsSystemAvailable(systemName string) bool {
+	gm := getGlobalMonitor()
+	gm.mu.RLock()
+	monitor, exists := gm.systems[systemName]
+	gm.mu.RUnlock()
+	if !exists {
+		return false
+	}
+	monitor.mu.RLock()
+	defer monitor.mu.RUnlock()
+	return monitor.available
+}
+
 // SignalSystemDisabled triggers an immediate check for system disabled status
 // This should be called when a worker receives a SystemDisabled error from Bungie API
 func SignalSystemDisabled(systemName string) {
@@ -1,6 +1,7 @@
 package bungie
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -9,6 +10,7 @@ import (
 	"maps"
 	"net/http"
 	netUrl "net/url"
+	"reflect"
 	"regexp"
 	"strings"
 	"time"
@@ -33,6 +35,9 @@ type BungieClient struct {
 	scheme     string
 	host       string
 	apiKey     string
+	zeusToken  string // identifies this process to Zeus, which holds the upstream API keys
+	// defaultPriority is sent to Zeus for requests whose context carries no Priority
+	defaultPriority Priority
 }
 
 func makeNonStandardHttpResult[T any](statusCode int) BungieHttpResult[T] {
@@ -97,7 +102,21 @@ func (e *BungieResponseParseError) isKnownHTMLErrorPage() bool {
 }
 
 func get[T any](ctx context.Context, c *BungieClient, url netUrl.URL, operation string, params map[string]any) (BungieHttpResult[T], error) {
-	// Wraps the get in 2 layers of retry:
+	return request[T](ctx, c, http.MethodGet, url, nil, operation, params)
+}
+
+// post sends body as JSON. Bungie's POST endpoints used here are reads (searches), so they are retried
+// the same way as GETs.
+func post[T any](ctx context.Context, c *BungieClient, url netUrl.URL, body any, operation string, params map[string]any) (BungieHttpResult[T], error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return makeNonStandardHttpResult[T](0), fmt.Errorf("%s: marshalling request body: %w", operation, err)
+	}
+	return request[T](ctx, c, http.MethodPost, url, payload, operation, params)
+}
+
+func request[T any](ctx context.Context, c *BungieClient, method string, url netUrl.URL, body []byte, operation string, params map[string]any) (BungieHttpResult[T], error) {
+	// Wraps the request in 2 layers of retry:
 	// Inner layer retries timeout and connection errors (excludes BungieError instances)
 	// Outer layer retries Cloudflare errors
 	return retry.WithRetryForResult(ctx, network.CloudflareRetryConfig(clientLogger, params), func(attempt int) (BungieHttpResult[T], error) {
@@ -108,26 +127,39 @@ func get[T any](ctx context.Context, c *BungieClient, url netUrl.URL, operation
 			url.RawQuery = queryValues.Encode()
 		}
 		return retry.WithRetryForResult(ctx, BungieRetryConfig(), func(_ int) (BungieHttpResult[T], error) {
-			return getInternal[T](ctx, c, url.String(), operation, params)
+			return requestInternal[T](ctx, c, method, url.String(), body, operation, params)
 		})
 	})
 }
 
-func getInternal[T any](ctx context.Context, c *BungieClient, url string, operation string, params map[string]any) (BungieHttpResult[T], error) {
+func requestInternal[T any](ctx context.Context, c *BungieClient, method string, url string, body []byte, operation string, params map[string]any) (BungieHttpResult[T], error) {
 	startTime := time.Now()
 
 	fields := map[string]any{
 		logging.OPERATION: operation,
 		logging.ENDPOINT:  url,
+		logging.METHOD:    method,
 	}
 	maps.Copy(fields, params)
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
 	if err != nil {
 		clientLogger.Error("BUNGIE_REQUEST_CREATE_FAILED", err, fields)
 		return makeNonStandardHttpResult[T](0), err
 	}
-	req.Header.Set("X-API-KEY", c.apiKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set(ZeusPriorityHeader, string(c.priority(ctx)))
+	if c.zeusToken != "" {
+		req.Header.Set(ZeusTokenHeader, c.zeusToken)
+	} else {
+		req.Header.Set("X-API-KEY", c.apiKey)
+	}
 
 	resp, err := c.httpClient.Do(req)
 	duration := time.Since(startTime).Milliseconds()
@@ -174,7 +206,7 @@ func getInternal[T any](ctx context.Context, c *BungieClient, url string, operat
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		error_response, err := decodeResponse[BungieError](resp)
+		error_response, err := decodeResponse[BungieError](resp, operation)
 		if err != nil {
 			// If we can't decode the error response as JSON (e.g., unexpected EOF, malformed JSON),
 			// treat it as a parse error similar to non-JSON responses rather than a critical error.
@@ -201,7 +233,7 @@ func getInternal[T any](ctx context.Context, c *BungieClient, url string, operat
 		return result, error_response
 	}
 
-	response, err := decodeResponse[BungieResponse[T]](resp)
+	response, err := decodeResponse[BungieResponse[T]](resp, operation)
 	if err != nil {
 		fields["error"] = err.Error()
 		fields[logging.DURATION] = fmt.Sprintf("%dms", duration)
@@ -239,11 +271,25 @@ func getInternal[T any](ctx context.Context, c *BungieClient, url string, operat
 	return result, nil
 }
 
-func decodeResponse[T any](resp *http.Response) (*T, error) {
+// decodeResponse decodes a JSON body into T. When schema checks are on, a sample of each operation's
+// bodies is also compared against T for schema drift, including bodies T fails to decode.
+func decodeResponse[T any](resp *http.Response, operation string) (*T, error) {
 	var data T
 	defer resp.Body.Close()
-	decoder := json.NewDecoder(resp.Body)
-	if err := decoder.Decode(&data); err != nil {
+	if !schemaChecks.shouldCheck(operation) {
+		decoder := json.NewDecoder(resp.Body)
+		if err := decoder.Decode(&data); err != nil {
+			return nil, err
+		}
+		return &data, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	go schemaChecks.check(operation, reflect.TypeFor[T](), body)
+	if err := json.Unmarshal(body, &data); err != nil {
 		return nil, err
 	}
 	return &data, nil
@@ -427,3 +473,63 @@ func (c *BungieClient) GetActivityHistoryPage(ctx context.Context, membershipTyp
 		"page":                  page,
 	})
 }
+
+// SearchByGlobalNamePost lists Bungie accounts whose Bungie name starts with prefix, 20 per page
+func (c *BungieClient) SearchByGlobalNamePost(ctx context.Context, prefix string, page int) (BungieHttpResult[UserSearchResponse], error) {
+	url := c.makeURL(fmt.Sprintf("/Platform/User/Search/GlobalName/%d/", page), nil)
+	return post[UserSearchResponse](ctx, c, url, UserSearchPrefixRequest{DisplayNamePrefix: prefix}, "search_by_global_name", map[string]any{
+		"prefix": prefix,
+		"page":   page,
+	})
+}
+
+// SearchDestinyPlayerByBungieName finds the Destiny memberships of an exact Bungie name. Pass
+// MembershipTypeAll to search every platform.
+func (c *BungieClient) SearchDestinyPlayerByBungieName(ctx context.Context, membershipType int, displayName string, displayNameCode int) (BungieHttpResult[[]UserInfoCard], error) {
+	url := c.makeURL(fmt.Sprintf("/Platform/Destiny2/SearchDestinyPlayerByBungieName/%d/", membershipType), nil)
+	body := ExactSearchRequest{DisplayName: displayName, DisplayNameCode: displayNameCode}
+	return post[[]UserInfoCard](ctx, c, url, body, "search_destiny_player_by_bungie_name", map[string]any{
+		logging.MEMBERSHIP_TYPE: membershipType,
+		"display_name":          displayName,
+		"display_name_code":     displayNameCode,
+	})
+}
+
+// GetGroupByName returns the group with exactly this name
+func (c *BungieClient) GetGroupByName(ctx context.Context, groupName string, groupType int) (BungieHttpResult[GroupResponse], error) {
+	url := c.makeURL(fmt.Sprintf("/Platform/GroupV2/Name/%s/%d/", groupName, groupType), nil)
+	// Clan names can contain slashes, which have to stay inside the one path segment
+	url.RawPath = fmt.Sprintf("/Platform/GroupV2/Name/%s/%d/", netUrl.PathEscape(groupName), groupType)
+	return get[GroupResponse](ctx, c, url, "get_group_by_name", map[string]any{
+		"group_name": groupName,
+		"group_type": groupType,
+	})
+}
+
+// GroupSearch lists groups matching query, for clans whose exact name isn't known
+func (c *BungieClient) GroupSearch(ctx context.Context, query GroupQuery) (BungieHttpResult[GroupSearchResponse], error) {
+	url := c.makeURL("/Platform/GroupV2/Search/", nil)
+	return post[GroupSearchResponse](ctx, c, url, query, "group_search", map[string]any{
+		"group_name": query.Name,
+		"group_type": query.GroupType,
+		"page":       query.CurrentPage,
+	})
+}
+
+// GetClanWeeklyRewardState returns the clan's weekly engram milestone, including which rewards have been earned
+func (c *BungieClient) GetClanWeeklyRewardState(ctx context.Context, groupId int64) (BungieHttpResult[DestinyMilestone], error) {
+	url := c.makeURL(fmt.Sprintf("/Platform/Destiny2/Clan/%d/WeeklyRewardState/", groupId), nil)
+	return get[DestinyMilestone](ctx, c, url, "get_clan_weekly_reward_state", map[string]any{
+		logging.GROUP_ID: groupId,
+	})
+}
+
+// GetAggregateActivityStats returns a character's lifetime stats for every activity it has played
+func (c *BungieClient) GetAggregateActivityStats(ctx context.Context, membershipType int, membershipId int64, characterId int64) (BungieHttpResult[DestinyAggregateActivityResults], error) {
+	url := c.makeURL(fmt.Sprintf("/Platform/Destiny2/%d/Account/%d/Character/%d/Stats/AggregateActivityStats/", membershipType, membershipId, characterId), nil)
+	return get[DestinyAggregateActivityResults](ctx, c, url, "get_aggregate_activity_stats", map[string]any{
+		logging.MEMBERSHIP_TYPE: membershipType,
+		logging.MEMBERSHIP_ID:   membershipId,
+		logging.CHARACTER_ID:    characterId,
+	})
+}
@@ -19,8 +19,9 @@ const (
 )
 
 const (
-	ModeRaid  = 4
-	ModeStory = 2
+	ModeRaid    = 4
+	ModeStory   = 2
+	ModeDungeon = 82
 )
 
 // Bungie membership type constants
@@ -31,8 +32,12 @@ const (
 	MembershipTypeSteam  = 3
 	MembershipTypeStadia = 5
 	MembershipTypeEpic   = 6
+	MembershipTypeAll    = -1 // Searches across every platform
 )
 
+// GroupTypeClan is the GroupType of Destiny clans
+const GroupTypeClan = 1
+
 // AllViableMembershipTypes lists platform types we actively try when resolving a profile
 var AllViableMembershipTypes = []int{
 	MembershipTypePSN,
@@ -0,0 +1,15 @@
+package fakebungie
+
+import "time"
+
+// Clock is the time source a Stream answers against
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock is the wall clock, for serving a Stream to a live Atlas
+var SystemClock Clock = systemClock{}
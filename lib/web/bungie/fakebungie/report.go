@@ -0,0 +1,96 @@
+package fakebungie
+
+import (
+	"strconv"
+	"time"
+
+	"raidhub/lib/web/bungie"
+)
+
+const (
+	fakeMembershipIdBase = 4611686018400000000
+	fakeCharacterIdBase  = 2305843009200000000
+)
+
+// Report builds the PGCR served for an id. Only OutcomeFound and the malformed outcomes carry a report.
+// Player count and duration are derived from the id so the same id always looks the same.
+func (s *Stream) Report(id int64, outcome Outcome) *bungie.DestinyPostGameCarnageReport {
+	players := int(2 + id%5)
+	durationSeconds := 600 + id%3000
+	started := s.CompletedAt(id).Add(-time.Duration(durationSeconds) * time.Second).UTC().Truncate(time.Second)
+
+	mode := bungie.ModeRaid
+	if !s.IsRaid(id) {
+		mode = bungie.ModeStory
+	}
+
+	entries := make([]bungie.DestinyPostGameCarnageReportEntry, 0, players)
+	for i := range players {
+		entry := bungie.DestinyPostGameCarnageReportEntry{
+			Player: bungie.DestinyPostGameCarnageReportPlayer{
+				DestinyUserInfo: bungie.DestinyUserInfo{
+					MembershipType:            bungie.MembershipTypeSteam,
+					MembershipId:              fakeMembershipIdBase + (id%1_000_000)*10 + int64(i),
+					ApplicableMembershipTypes: []int{bungie.MembershipTypeSteam},
+				},
+				CharacterLevel: 100,
+				LightLevel:     2000,
+			},
+			CharacterId: fakeCharacterIdBase + (id%1_000_000)*10 + int64(i),
+			Values: map[string]bungie.DestinyHistoricalStatsValue{
+				"playerCount":             stat(int64(players)),
+				"activityDurationSeconds": stat(durationSeconds),
+				"timePlayedSeconds":       stat(durationSeconds),
+				"startSeconds":            stat(0),
+				"completed":               stat(1),
+				"completionReason":        stat(0),
+				"kills":                   stat(100 + id%200),
+				"deaths":                  stat(id % 7),
+				"assists":                 stat(id % 50),
+				"score":                   stat(0),
+				"teamScore":               stat(0),
+			},
+			Extended: &bungie.DestinyPostGameCarnageReportExtendedData{
+				Values: map[string]bungie.DestinyHistoricalStatsValue{
+					"precisionKills":     stat(id % 60),
+					"weaponKillsSuper":   stat(id % 10),
+					"weaponKillsGrenade": stat(id % 20),
+					"weaponKillsMelee":   stat(id % 15),
+				},
+				Weapons: []bungie.DestinyHistoricalWeaponStats{},
+			},
+		}
+		if outcome == OutcomeMissingExtended {
+			entry.Extended = nil
+		}
+		entries = append(entries, entry)
+	}
+	if outcome == OutcomeEntryCountMismatch {
+		entries = entries[:players-1]
+	}
+
+	startedFromBeginning := id%4 != 0
+	startingPhaseIndex := 0
+	return &bungie.DestinyPostGameCarnageReport{
+		ActivityDetails: bungie.DestinyHistoricalStatsActivity{
+			InstanceId:           id,
+			Mode:                 mode,
+			Modes:                []int{mode},
+			MembershipType:       bungie.MembershipTypeSteam,
+			DirectorActivityHash: s.scenario.ActivityHash,
+		},
+		Period:                          started.Format(time.RFC3339),
+		StartingPhaseIndex:              &startingPhaseIndex,
+		ActivityWasStartedFromBeginning: &startedFromBeginning,
+		Entries:                         entries,
+	}
+}
+
+func stat(value int64) bungie.DestinyHistoricalStatsValue {
+	return bungie.DestinyHistoricalStatsValue{
+		Basic: bungie.DestinyHistoricalStatsValuePair{
+			Value:        float32(value),
+			DisplayValue: strconv.FormatInt(value, 10),
+		},
+	}
+}
@@ -0,0 +1,92 @@
+package fakebungie
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"raidhub/lib/web/bungie"
+)
+
+// Server serves a Stream over the parts of the Bungie API Atlas touches: the PGCR endpoint and the
+// common settings the API availability monitor polls. Point ZEUS_HOST and ZEUS_PORT at it.
+type Server struct {
+	stream *Stream
+	mux    *http.ServeMux
+}
+
+func NewServer(stream *Stream) *Server {
+	s := &Server{
+		stream: stream,
+		mux:    http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET /Platform/Destiny2/Stats/PostGameCarnageReport/{id}/", s.handlePGCR)
+	s.mux.HandleFunc("GET /Platform/Settings/", s.handleSettings)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// RoundTrip answers a request in process, so the Server can be a client's transport without a listener
+func (s *Server) RoundTrip(r *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, r)
+	resp := recorder.Result()
+	resp.Request = r
+	return resp, nil
+}
+
+func (s *Server) handlePGCR(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, bungie.InvalidParameters, "InvalidParameters")
+		return
+	}
+	malformedRetry, _ := strconv.Atoi(r.URL.Query().Get("malformed_retry"))
+
+	switch outcome := s.stream.Outcome(id, malformedRetry); outcome {
+	case OutcomeNotFound:
+		writeError(w, http.StatusNotFound, bungie.PGCRNotFound, "DestinyPGCRNotFound")
+	case OutcomeThrottled:
+		writeError(w, http.StatusInternalServerError, bungie.DestinyThrottledByGameServer, "DestinyThrottledByGameServer")
+	case OutcomeSystemDisabled:
+		writeError(w, http.StatusServiceUnavailable, bungie.SystemDisabled, "SystemDisabled")
+	case OutcomeBlocked:
+		writeError(w, http.StatusUnauthorized, bungie.InsufficientPrivileges, "InsufficientPrivileges")
+	default:
+		writeSuccess(w, s.stream.Report(id, outcome))
+	}
+}
+
+func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
+	writeSuccess(w, bungie.CoreSettingsConfiguration{
+		Systems: map[string]bungie.CoreSystem{
+			"Destiny2": {Enabled: !s.stream.SystemDisabled()},
+		},
+	})
+}
+
+func writeSuccess[T any](w http.ResponseWriter, response T) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(bungie.BungieResponse[T]{
+		ErrorCode:   bungie.Success,
+		ErrorStatus: "Success",
+		Message:     "Ok",
+		Response:    response,
+	})
+}
+
+func writeError(w http.ResponseWriter, status int, errorCode int, errorStatus string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(bungie.BungieError{
+		ErrorCode:   errorCode,
+		ErrorStatus: errorStatus,
+		Message:     errorStatus,
+		MessageData: map[string]any{},
+	})
+}
@@ -0,0 +1,267 @@
+package fakebungie
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+)
+
+// IdRange is the half-open instance id range [From, To)
+type IdRange struct {
+	From int64
+	To   int64
+}
+
+func (r IdRange) Contains(id int64) bool {
+	return id >= r.From && id < r.To
+}
+
+// Window is a span of time relative to Scenario.Start
+type Window struct {
+	From time.Duration
+	To   time.Duration
+}
+
+// Scenario describes the synthetic instance id stream a Stream serves
+type Scenario struct {
+	// Start is when HeadId is the newest instance
+	Start time.Time
+	// HeadId is the newest instance at Start. Everything below it already exists.
+	HeadId int64
+	// HeadRate is how many new instance ids appear each second. Ids past the head 404.
+	HeadRate float64
+	// Gaps are id ranges Bungie skipped. They 404 forever and the head jumps over them instantly.
+	Gaps []IdRange
+	// RaidEvery makes every nth instance a raid and the rest some other activity. 0 or 1 makes every instance a raid.
+	RaidEvery int64
+	// MissingExtendedEvery serves every nth instance with no extended data on any entry
+	MissingExtendedEvery int64
+	// EntryCountMismatchEvery serves every nth instance with one entry fewer than its playerCount stat
+	EntryCountMismatchEvery int64
+	// MalformedHealsAfter is the malformed_retry value from which malformed instances are served whole.
+	// 0 means they never heal.
+	MalformedHealsAfter int
+	// ThrottleFraction is the fraction of requests answered with DestinyThrottledByGameServer
+	ThrottleFraction float64
+	// SystemDisabled are windows during which every request is answered with SystemDisabled
+	SystemDisabled []Window
+	// Blocked are id ranges answered with InsufficientPrivileges
+	Blocked []IdRange
+	// ActivityHash is the directorActivityHash stamped on raid PGCRs
+	ActivityHash uint32
+	// Seed makes throttling reproducible
+	Seed int64
+}
+
+// Outcome is how the fake answers a single PGCR request
+type Outcome int
+
+const (
+	OutcomeFound Outcome = iota
+	OutcomeNotFound
+	OutcomeMissingExtended
+	OutcomeEntryCountMismatch
+	OutcomeThrottled
+	OutcomeSystemDisabled
+	OutcomeBlocked
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeFound:
+		return "found"
+	case OutcomeNotFound:
+		return "not_found"
+	case OutcomeMissingExtended:
+		return "missing_extended"
+	case OutcomeEntryCountMismatch:
+		return "entry_count_mismatch"
+	case OutcomeThrottled:
+		return "throttled"
+	case OutcomeSystemDisabled:
+		return "system_disabled"
+	case OutcomeBlocked:
+		return "blocked"
+	default:
+		return fmt.Sprintf("outcome(%d)", int(o))
+	}
+}
+
+// Stream decides what every instance id looks like at any point in time.
+// Everything except throttling is a pure function of the id and the clock.
+type Stream struct {
+	scenario Scenario
+	clock    Clock
+	gaps     []IdRange // sorted and merged
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func NewStream(scenario Scenario, clock Clock) (*Stream, error) {
+	if scenario.HeadRate <= 0 {
+		return nil, fmt.Errorf("head rate must be positive, got %f", scenario.HeadRate)
+	}
+	if scenario.ThrottleFraction < 0 || scenario.ThrottleFraction > 1 {
+		return nil, fmt.Errorf("throttle fraction must be between 0 and 1, got %f", scenario.ThrottleFraction)
+	}
+	for _, r := range append(slices.Clone(scenario.Gaps), scenario.Blocked...) {
+		if r.To <= r.From {
+			return nil, fmt.Errorf("invalid id range [%d, %d)", r.From, r.To)
+		}
+	}
+	for _, w := range scenario.SystemDisabled {
+		if w.To <= w.From {
+			return nil, fmt.Errorf("invalid window [%s, %s)", w.From, w.To)
+		}
+	}
+
+	return &Stream{
+		scenario: scenario,
+		clock:    clock,
+		gaps:     mergeRanges(scenario.Gaps),
+		rng:      rand.New(rand.NewSource(scenario.Seed)),
+	}, nil
+}
+
+func mergeRanges(ranges []IdRange) []IdRange {
+	sorted := slices.Clone(ranges)
+	slices.SortFunc(sorted, func(a, b IdRange) int {
+		if a.From < b.From {
+			return -1
+		} else if a.From > b.From {
+			return 1
+		}
+		return 0
+	})
+	var merged []IdRange
+	for _, r := range sorted {
+		if n := len(merged); n > 0 && r.From <= merged[n-1].To {
+			merged[n-1].To = max(merged[n-1].To, r.To)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+func (s *Stream) Scenario() Scenario {
+	return s.scenario
+}
+
+// InGap reports whether Bungie skipped the id
+func (s *Stream) InGap(id int64) bool {
+	for _, g := range s.gaps {
+		if g.Contains(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// gapIdsIn counts skipped ids in the closed range [lo, hi]
+func (s *Stream) gapIdsIn(lo, hi int64) int64 {
+	count := int64(0)
+	for _, g := range s.gaps {
+		from, to := max(g.From, lo), min(g.To-1, hi)
+		if to >= from {
+			count += to - from + 1
+		}
+	}
+	return count
+}
+
+// assigned is how many real instances separate id from the head at Start, negative below it
+func (s *Stream) assigned(id int64) int64 {
+	head := s.scenario.HeadId
+	if id >= head {
+		return id - head - s.gapIdsIn(head+1, id)
+	}
+	return -(head - id - s.gapIdsIn(id+1, head))
+}
+
+// CompletedAt is when the instance finished, which is also when it starts resolving
+func (s *Stream) CompletedAt(id int64) time.Time {
+	seconds := float64(s.assigned(id)) / s.scenario.HeadRate
+	return s.scenario.Start.Add(time.Duration(seconds * float64(time.Second)))
+}
+
+// Head is the newest instance id that resolves right now
+func (s *Stream) Head() int64 {
+	elapsed := s.clock.Now().Sub(s.scenario.Start).Seconds()
+	n := int64(math.Floor(s.scenario.HeadRate * elapsed))
+	id := s.scenario.HeadId + n
+	if n <= 0 {
+		return id
+	}
+	for _, g := range s.gaps {
+		if g.To <= s.scenario.HeadId+1 {
+			continue
+		}
+		if g.From > id {
+			break
+		}
+		id += g.To - max(g.From, s.scenario.HeadId+1)
+	}
+	return id
+}
+
+// Exists reports whether the id resolves right now
+func (s *Stream) Exists(id int64) bool {
+	return !s.InGap(id) && !s.CompletedAt(id).After(s.clock.Now())
+}
+
+func (s *Stream) IsRaid(id int64) bool {
+	return s.scenario.RaidEvery <= 1 || id%s.scenario.RaidEvery == 0
+}
+
+// SystemDisabled reports whether the Destiny2 system is disabled right now
+func (s *Stream) SystemDisabled() bool {
+	elapsed := s.clock.Now().Sub(s.scenario.Start)
+	for _, w := range s.scenario.SystemDisabled {
+		if elapsed >= w.From && elapsed < w.To {
+			return true
+		}
+	}
+	return false
+}
+
+// Outcome decides how a request for the id is answered right now. malformedRetry is the
+// malformed_retry query parameter Atlas sends to bust Bungie's cache.
+func (s *Stream) Outcome(id int64, malformedRetry int) Outcome {
+	if s.SystemDisabled() {
+		return OutcomeSystemDisabled
+	}
+	if s.throttled() {
+		return OutcomeThrottled
+	}
+	if !s.Exists(id) {
+		return OutcomeNotFound
+	}
+	for _, r := range s.scenario.Blocked {
+		if r.Contains(id) {
+			return OutcomeBlocked
+		}
+	}
+	if s.scenario.MalformedHealsAfter == 0 || malformedRetry < s.scenario.MalformedHealsAfter {
+		if every := s.scenario.MissingExtendedEvery; every > 0 && id%every == 0 {
+			return OutcomeMissingExtended
+		}
+		if every := s.scenario.EntryCountMismatchEvery; every > 0 && id%every == 0 {
+			return OutcomeEntryCountMismatch
+		}
+	}
+	return OutcomeFound
+}
+
+func (s *Stream) throttled() bool {
+	if s.scenario.ThrottleFraction == 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rng.Float64() < s.scenario.ThrottleFraction
+}
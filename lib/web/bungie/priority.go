@@ -0,0 +1,35 @@
+package bungie
+
+import "context"
+
+// Priority is the class Zeus schedules a request in. When Zeus is saturated, lower classes wait
+// longer and are shed first.
+type Priority string
+
+const (
+	PriorityCritical Priority = "critical" // PGCR crawling at the head
+	PriorityHigh     Priority = "high"     // work someone is waiting on, like subscriptions
+	PriorityNormal   Priority = "normal"
+	PriorityLow      Priority = "low" // background crawls and backfills
+)
+
+// ZeusPriorityHeader carries a request's Priority to Zeus
+const ZeusPriorityHeader = "X-Zeus-Priority"
+
+type priorityKey struct{}
+
+// WithPriority tags every Bungie request made with ctx with p, overriding the client's default
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	if p == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// priority returns the priority ctx was tagged with, or the client's default
+func (c *BungieClient) priority(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return c.defaultPriority
+}
@@ -0,0 +1,340 @@
+package bungie
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"raidhub/lib/env"
+	"raidhub/lib/monitoring/global_metrics"
+	"raidhub/lib/utils/logging"
+)
+
+// Kinds of schema drift
+const (
+	DriftUnknownField = "unknown" // Bungie sent a field our struct doesn't have
+	DriftMissingField = "missing" // a required field of our struct wasn't sent
+	DriftNullField    = "null"    // Bungie sent null for a field that can't hold it, which decodes to the zero value
+	DriftTypeMismatch = "type"    // Bungie sent a different JSON type than the field holds
+)
+
+// schemaSamplesPerOperation is how many offending payloads are kept on disk for each operation
+const schemaSamplesPerOperation = 10
+
+// SchemaDrift is one difference between a Bungie payload and the struct it decodes into. Field is the
+// JSON path, with [] for array elements and * for map values.
+type SchemaDrift struct {
+	Field string `json:"field"`
+	Kind  string `json:"kind"`
+}
+
+// schemaSample is an offending payload as written to disk
+type schemaSample struct {
+	Operation string          `json:"operation"`
+	CheckedAt time.Time       `json:"checked_at"`
+	Drift     []SchemaDrift   `json:"drift"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// schemaChecker compares a sample of decoded responses against the types they decode into, so a field
+// Bungie adds, renames, or nulls shows up in metrics before it turns into BadFormat errors
+type schemaChecker struct {
+	every uint64 // check 1 in every responses of each operation; 0 turns checking off
+	dir   string
+
+	mu       sync.Mutex
+	counts   map[string]uint64
+	samples  map[string]int
+	reported map[string]bool
+}
+
+var schemaChecks = &schemaChecker{
+	every:    uint64(env.BungieSchemaCheckEvery),
+	dir:      env.BungieSchemaSampleDir,
+	counts:   make(map[string]uint64),
+	samples:  make(map[string]int),
+	reported: make(map[string]bool),
+}
+
+var schemaLogger = logging.NewLogger("BUNGIE_SCHEMA")
+
+// shouldCheck reports whether this response of operation is one of the sample
+func (s *schemaChecker) shouldCheck(operation string) bool {
+	if s.every == 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.counts[operation]
+	s.counts[operation] = n + 1
+	return n%s.every == 0
+}
+
+// check diffs payload against t, counting what it finds and keeping the payload if anything is off
+func (s *schemaChecker) check(operation string, t reflect.Type, payload []byte) {
+	var raw any
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return
+	}
+	global_metrics.BungieSchemaChecks.WithLabelValues(operation).Inc()
+
+	found := make(map[SchemaDrift]bool)
+	diffSchema(t, raw, "", false, found)
+	if len(found) == 0 {
+		return
+	}
+	drift := make([]SchemaDrift, 0, len(found))
+	for d := range found {
+		drift = append(drift, d)
+		global_metrics.BungieSchemaDrift.WithLabelValues(operation, d.Kind, d.Field).Inc()
+	}
+	sort.Slice(drift, func(i, j int) bool {
+		return drift[i].Field < drift[j].Field
+	})
+
+	path := s.keepSample(operation, drift, payload)
+
+	s.mu.Lock()
+	var fresh []SchemaDrift
+	for _, d := range drift {
+		key := operation + " " + d.Kind + " " + d.Field
+		if !s.reported[key] {
+			s.reported[key] = true
+			fresh = append(fresh, d)
+		}
+	}
+	s.mu.Unlock()
+	for _, d := range fresh {
+		schemaLogger.Warn("BUNGIE_SCHEMA_DRIFT", nil, map[string]any{
+			logging.OPERATION: operation,
+			"field":           d.Field,
+			"kind":            d.Kind,
+			logging.PATH:      path,
+		})
+	}
+}
+
+// keepSample writes an offending payload over the oldest of the operation's samples
+func (s *schemaChecker) keepSample(operation string, drift []SchemaDrift, payload []byte) string {
+	if s.dir == "" {
+		return ""
+	}
+	s.mu.Lock()
+	slot := s.samples[operation] % schemaSamplesPerOperation
+	s.samples[operation]++
+	s.mu.Unlock()
+
+	data, err := json.MarshalIndent(schemaSample{
+		Operation: operation,
+		CheckedAt: time.Now().UTC(),
+		Drift:     drift,
+		Payload:   payload,
+	}, "", "  ")
+	if err != nil {
+		return ""
+	}
+	dir := filepath.Join(s.dir, sanitizeOperation(operation))
+	path := filepath.Join(dir, fmt.Sprintf("%d.json", slot))
+	if err := os.MkdirAll(dir, 0o755); err == nil {
+		err = os.WriteFile(path, data, 0o644)
+	}
+	if err != nil {
+		schemaLogger.Warn("BUNGIE_SCHEMA_SAMPLE_WRITE_FAILED", err, map[string]any{
+			logging.PATH: path,
+		})
+		return ""
+	}
+	return path
+}
+
+func sanitizeOperation(operation string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, operation)
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// diffSchema walks a decoded JSON value alongside the type it was decoded into
+func diffSchema(t reflect.Type, v any, path string, asString bool, found map[SchemaDrift]bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if reflect.PointerTo(t).Implements(jsonUnmarshalerType) || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		// decodes itself; there is nothing to compare against
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			found[SchemaDrift{path, DriftTypeMismatch}] = true
+			return
+		}
+		fields := cachedSchemaFields(t)
+		seen := make(map[string]bool, len(obj))
+		for key, value := range obj {
+			fieldPath := joinSchemaPath(path, key)
+			field, ok := fields[strings.ToLower(key)]
+			if !ok {
+				found[SchemaDrift{fieldPath, DriftUnknownField}] = true
+				continue
+			}
+			seen[strings.ToLower(key)] = true
+			if value == nil {
+				if !nullable(field.typ) {
+					found[SchemaDrift{fieldPath, DriftNullField}] = true
+				}
+				continue
+			}
+			diffSchema(field.typ, value, fieldPath, field.asString, found)
+		}
+		for name, field := range fields {
+			if !seen[name] && !field.optional {
+				found[SchemaDrift{joinSchemaPath(path, field.name), DriftMissingField}] = true
+			}
+		}
+	case reflect.Map:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			found[SchemaDrift{path, DriftTypeMismatch}] = true
+			return
+		}
+		for _, value := range obj {
+			if value != nil {
+				diffSchema(t.Elem(), value, path+".*", false, found)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return // []byte is a base64 string
+		}
+		arr, ok := v.([]any)
+		if !ok {
+			found[SchemaDrift{path, DriftTypeMismatch}] = true
+			return
+		}
+		for _, value := range arr {
+			if value != nil {
+				diffSchema(t.Elem(), value, path+"[]", false, found)
+			}
+		}
+	case reflect.String:
+		if _, ok := v.(string); !ok {
+			found[SchemaDrift{path, DriftTypeMismatch}] = true
+		}
+	case reflect.Bool:
+		_, ok := v.(bool)
+		if asString {
+			_, ok = v.(string)
+		}
+		if !ok {
+			found[SchemaDrift{path, DriftTypeMismatch}] = true
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		_, ok := v.(float64)
+		if asString {
+			_, ok = v.(string)
+		}
+		if !ok {
+			found[SchemaDrift{path, DriftTypeMismatch}] = true
+		}
+	}
+}
+
+func joinSchemaPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func nullable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+		return true
+	}
+	return false
+}
+
+// schemaField is a struct field as encoding/json sees it
+type schemaField struct {
+	name     string
+	typ      reflect.Type
+	asString bool
+	// optional fields (pointers and omitempty) are not reported when Bungie leaves them out
+	optional bool
+}
+
+var schemaFieldCache sync.Map // reflect.Type -> map[string]schemaField
+
+// cachedSchemaFields returns t's JSON fields keyed by lowercased name, since encoding/json matches
+// keys case-insensitively
+func cachedSchemaFields(t reflect.Type) map[string]schemaField {
+	if fields, ok := schemaFieldCache.Load(t); ok {
+		return fields.(map[string]schemaField)
+	}
+	fields := make(map[string]schemaField)
+	collectSchemaFields(t, fields)
+	schemaFieldCache.Store(t, fields)
+	return fields
+}
+
+// collectSchemaFields adds t's fields that aren't in fields yet. Fields of embedded structs come after
+// t's own, which win on a name clash.
+func collectSchemaFields(t reflect.Type, fields map[string]schemaField) {
+	var embedded []reflect.Type
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			inner := f.Type
+			if inner.Kind() == reflect.Pointer {
+				inner = inner.Elem()
+			}
+			if inner.Kind() == reflect.Struct {
+				embedded = append(embedded, inner)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		key := strings.ToLower(name)
+		if _, ok := fields[key]; ok {
+			continue
+		}
+		fields[key] = schemaField{
+			name:     name,
+			typ:      f.Type,
+			asString: strings.Contains(opts, "string"),
+			optional: f.Type.Kind() == reflect.Pointer || strings.Contains(opts, "omitempty"),
+		}
+	}
+	for _, inner := range embedded {
+		collectSchemaFields(inner, fields)
+	}
+}
@@ -7,11 +7,25 @@ import (
 	"time"
 )
 
+// ZeusTokenHeader carries a caller's Zeus client token
+const ZeusTokenHeader = "X-Zeus-Token"
+
 var (
 	PGCRClient *BungieClient
 	Client     *BungieClient
 )
 
+// NewClient creates a client that sends its requests to host through httpClient. Tests use it to point
+// the package clients at a fake Bungie.
+func NewClient(httpClient *http.Client, host string, defaultPriority Priority) *BungieClient {
+	return &BungieClient{
+		scheme:          "http",
+		httpClient:      httpClient,
+		host:            host,
+		defaultPriority: defaultPriority,
+	}
+}
+
 func init() {
 	clientLogger.Info("BUNGIE_CLIENT_INITIALIZED", map[string]any{
 		"host": env.ZeusHost,
@@ -22,15 +36,19 @@ func init() {
 	}
 	zeusURL := fmt.Sprintf("%s:%s", env.ZeusHost, env.ZeusPort)
 	Client = &BungieClient{
-		scheme:     "http",
-		httpClient: httpClient,
-		host:       zeusURL,
-		apiKey:     env.BungieAPIKey,
+		scheme:          "http",
+		httpClient:      httpClient,
+		host:            zeusURL,
+		apiKey:          env.BungieAPIKey,
+		zeusToken:       env.ZeusClientToken,
+		defaultPriority: PriorityNormal,
 	}
 	PGCRClient = &BungieClient{
-		scheme:     "http",
-		httpClient: httpClient,
-		host:       zeusURL,
-		apiKey:     env.BungieAPIKey,
+		scheme:          "http",
+		httpClient:      httpClient,
+		host:            zeusURL,
+		apiKey:          env.BungieAPIKey,
+		zeusToken:       env.ZeusClientToken,
+		defaultPriority: PriorityNormal,
 	}
 }
@@ -6,11 +6,12 @@ import (
 )
 
 type BungieResponse[T any] struct {
-	ErrorCode       int    `json:"ErrorCode"`
-	Message         string `json:"Message"`
-	ErrorStatus     string `json:"ErrorStatus"`
-	ThrottleSeconds int    `json:"ThrottleSeconds"`
-	Response        T      `json:"Response"`
+	ErrorCode       int            `json:"ErrorCode"`
+	Message         string         `json:"Message"`
+	ErrorStatus     string         `json:"ErrorStatus"`
+	ThrottleSeconds int            `json:"ThrottleSeconds"`
+	MessageData     map[string]any `json:"MessageData"`
+	Response        T              `json:"Response"`
 }
 
 type BungieError struct {
@@ -225,3 +226,86 @@ type CoreSettingsConfiguration struct {
 type CoreSystem struct {
 	Enabled bool `json:"enabled"`
 }
+
+// UserInfoCard is a Destiny membership as returned by the name searches
+type UserInfoCard struct {
+	DestinyUserInfo
+	CrossSaveOverride int  `json:"crossSaveOverride"`
+	IsPublic          bool `json:"isPublic"`
+}
+
+// UserSearchPrefixRequest is the body of User.SearchByGlobalNamePost
+type UserSearchPrefixRequest struct {
+	DisplayNamePrefix string `json:"displayNamePrefix"`
+}
+
+type UserSearchResponse struct {
+	SearchResults []UserSearchResponseDetail `json:"searchResults"`
+	Page          int                        `json:"page"`
+	HasMore       bool                       `json:"hasMore"`
+}
+
+type UserSearchResponseDetail struct {
+	BungieGlobalDisplayName     string         `json:"bungieGlobalDisplayName"`
+	BungieGlobalDisplayNameCode *int           `json:"bungieGlobalDisplayNameCode"`
+	BungieNetMembershipId       *int64         `json:"bungieNetMembershipId,string"`
+	DestinyMemberships          []UserInfoCard `json:"destinyMemberships"`
+}
+
+// ExactSearchRequest is the body of Destiny2.SearchDestinyPlayerByBungieName
+type ExactSearchRequest struct {
+	DisplayName     string `json:"displayName"`
+	DisplayNameCode int    `json:"displayNameCode"`
+}
+
+// GroupQuery is the body of GroupV2.GroupSearch
+type GroupQuery struct {
+	Name         string `json:"name"`
+	GroupType    int    `json:"groupType"`
+	CreationDate int    `json:"creationDate"` // 0 for all time
+	SortBy       int    `json:"sortBy"`       // 0 name, 1 date, 2 popularity, 3 id
+	ItemsPerPage int    `json:"itemsPerPage"`
+	CurrentPage  int    `json:"currentPage"`
+}
+
+type GroupSearchResponse struct {
+	Results []GroupV2Card `json:"results"`
+	HasMore bool          `json:"hasMore"`
+}
+
+type GroupV2Card struct {
+	GroupId     int64                        `json:"groupId,string"`
+	Name        string                       `json:"name"`
+	GroupType   int                          `json:"groupType"`
+	Motto       string                       `json:"motto"`
+	MemberCount int                          `json:"memberCount"`
+	ClanInfo    GroupV2ClanInfoAndInvestment `json:"clanInfo"`
+}
+
+// DestinyMilestone is the Response of Destiny2.GetClanWeeklyRewardState
+type DestinyMilestone struct {
+	MilestoneHash uint32                           `json:"milestoneHash"`
+	Rewards       []DestinyMilestoneRewardCategory `json:"rewards"`
+	StartDate     *time.Time                       `json:"startDate"`
+	EndDate       *time.Time                       `json:"endDate"`
+}
+
+type DestinyMilestoneRewardCategory struct {
+	RewardCategoryHash uint32                        `json:"rewardCategoryHash"`
+	Entries            []DestinyMilestoneRewardEntry `json:"entries"`
+}
+
+type DestinyMilestoneRewardEntry struct {
+	RewardEntryHash uint32 `json:"rewardEntryHash"`
+	Earned          bool   `json:"earned"`
+	Redeemed        bool   `json:"redeemed"`
+}
+
+type DestinyAggregateActivityResults struct {
+	Activities []DestinyAggregateActivityStats `json:"activities"`
+}
+
+type DestinyAggregateActivityStats struct {
+	ActivityHash uint32                                 `json:"activityHash"`
+	Values       map[string]DestinyHistoricalStatsValue `json:"values"`
+}
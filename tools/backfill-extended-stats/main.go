@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"raidhub/lib/database/clickhouse"
+	"raidhub/lib/database/postgres"
+	"raidhub/lib/dto"
+	"raidhub/lib/services/instance_storage"
+	"raidhub/lib/services/pgcr_processing"
+	"raidhub/lib/utils/logging"
+	"raidhub/lib/web/bungie"
+)
+
+var logger = logging.NewLogger("backfill-extended-stats")
+
+type rawPGCR struct {
+	instanceId int64
+	data       []byte
+}
+
+// BackfillExtendedStats re-derives the extended values, medals, and weapon values of stored raid
+// instances from raw.pgcr and writes them to instance_character_stat, or with --clickhouse to the
+// character_stats column of the ClickHouse instance table. Instances that already have stats are
+// skipped, so the tool can be stopped and rerun over the same range.
+func BackfillExtendedStats() {
+	from := flag.Int64("from", 0, "first instance id to backfill")
+	to := flag.Int64("to", math.MaxInt64, "last instance id to backfill")
+	batchSize := flag.Int("batch", 500, "number of raw PGCRs to read at a time")
+	numWorkers := flag.Int("workers", 4, "number of workers to spawn")
+	toClickHouse := flag.Bool("clickhouse", false, "fill instance.character_stats in ClickHouse instead of Postgres, one mutation per batch")
+
+	logging.ParseFlags()
+
+	postgres.Wait()
+
+	logger.Info("BACKFILL_STARTING", map[string]any{
+		logging.FROM:         *from,
+		logging.TO:           *to,
+		logging.WORKER_COUNT: *numWorkers,
+		"clickhouse":         *toClickHouse,
+	})
+
+	if *toClickHouse {
+		clickhouse.Wait()
+		backfillClickHouse(*from, *to, *batchSize)
+		return
+	}
+
+	var stored, failed atomic.Int64
+	ch := make(chan rawPGCR)
+	var wg sync.WaitGroup
+	wg.Add(*numWorkers)
+	for range *numWorkers {
+		go func() {
+			defer wg.Done()
+			for pgcr := range ch {
+				if err := backfillInstance(pgcr); err != nil {
+					logger.Warn("FAILED_TO_BACKFILL_INSTANCE", err, map[string]any{
+						logging.INSTANCE_ID: pgcr.instanceId,
+					})
+					failed.Add(1)
+				} else {
+					stored.Add(1)
+				}
+			}
+		}()
+	}
+
+	cursor := *from - 1
+	for {
+		batch, err := readBatch(cursor, *to, *batchSize, true)
+		if err != nil {
+			logger.Error("FAILED_TO_READ_RAW_PGCRS", err, map[string]any{logging.FROM: cursor})
+			break
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for _, pgcr := range batch {
+			ch <- pgcr
+		}
+		cursor = batch[len(batch)-1].instanceId
+
+		logger.Info("BACKFILL_PROGRESS", map[string]any{
+			logging.INSTANCE_ID: cursor,
+			"stored":            stored.Load(),
+			"failed":            failed.Load(),
+		})
+	}
+	close(ch)
+	wg.Wait()
+
+	logger.Info("BACKFILL_COMPLETE", map[string]any{
+		logging.INSTANCE_ID: cursor,
+		"stored":            stored.Load(),
+		"failed":            failed.Load(),
+	})
+}
+
+// backfillClickHouse fills the character_stats column of the ClickHouse instance table a batch at a
+// time. The mutation skips instances whose column is already filled, so every raid in the range is
+// read regardless of what Postgres holds.
+func backfillClickHouse(from, to int64, batchSize int) {
+	var stored, failed int64
+	cursor := from - 1
+	for {
+		batch, err := readBatch(cursor, to, batchSize, false)
+		if err != nil {
+			logger.Error("FAILED_TO_READ_RAW_PGCRS", err, map[string]any{logging.FROM: cursor})
+			break
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		players := make(map[int64][]dto.InstancePlayer, len(batch))
+		for _, pgcr := range batch {
+			pl, err := readPlayers(pgcr)
+			if err != nil {
+				logger.Warn("FAILED_TO_BACKFILL_INSTANCE", err, map[string]any{
+					logging.INSTANCE_ID: pgcr.instanceId,
+				})
+				failed++
+				continue
+			}
+			players[pgcr.instanceId] = pl
+		}
+		if err := instance_storage.BackfillCharacterStatsToClickHouse(players); err != nil {
+			logger.Warn("FAILED_TO_BACKFILL_BATCH", err, map[string]any{
+				logging.FROM:  batch[0].instanceId,
+				logging.TO:    batch[len(batch)-1].instanceId,
+				logging.COUNT: len(players),
+			})
+			failed += int64(len(players))
+		} else {
+			stored += int64(len(players))
+		}
+		cursor = batch[len(batch)-1].instanceId
+
+		logger.Info("BACKFILL_PROGRESS", map[string]any{
+			logging.INSTANCE_ID: cursor,
+			"stored":            stored,
+			"failed":            failed,
+		})
+	}
+
+	logger.Info("BACKFILL_COMPLETE", map[string]any{
+		logging.INSTANCE_ID: cursor,
+		"stored":            stored,
+		"failed":            failed,
+	})
+}
+
+// readBatch returns the next raw PGCRs of raid instances after cursor, only those without extended
+// stats in Postgres when skipStored is set
+func readBatch(cursor, to int64, limit int, skipStored bool) ([]rawPGCR, error) {
+	rows, err := postgres.DB.Query(`
+		SELECT p.instance_id, p.data
+		FROM raw.pgcr p
+		JOIN core.instance i USING (instance_id)
+		WHERE p.instance_id > $1 AND p.instance_id <= $2
+			AND (NOT $4 OR NOT EXISTS (
+				SELECT 1 FROM extended.instance_character_stat s WHERE s.instance_id = p.instance_id
+			))
+		ORDER BY p.instance_id
+		LIMIT $3`, cursor, to, limit, skipStored)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []rawPGCR
+	for rows.Next() {
+		var pgcr rawPGCR
+		if err := rows.Scan(&pgcr.instanceId, &pgcr.data); err != nil {
+			return nil, err
+		}
+		batch = append(batch, pgcr)
+	}
+	return batch, rows.Err()
+}
+
+// backfillInstance decodes one raw PGCR and stores the stats of every character in it
+func backfillInstance(pgcr rawPGCR) error {
+	players, err := readPlayers(pgcr)
+	if err != nil {
+		return err
+	}
+
+	tx, err := postgres.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, player := range players {
+		for _, character := range player.Characters {
+			err := instance_storage.StoreCharacterStats(tx, pgcr.instanceId, player.Player.MembershipId, character)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// readPlayers decodes one raw PGCR into its players, with only the extended stats of each character
+// filled in
+func readPlayers(pgcr rawPGCR) ([]dto.InstancePlayer, error) {
+	data, err := decompress(pgcr.data)
+	if err != nil {
+		return nil, err
+	}
+	var report bungie.DestinyPostGameCarnageReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("unmarshalling raw pgcr: %w", err)
+	}
+
+	var players []dto.InstancePlayer
+	index := make(map[int64]int)
+	for _, entry := range report.Entries {
+		if entry.Extended == nil {
+			continue
+		}
+		character := dto.InstanceCharacter{CharacterId: entry.CharacterId}
+		pgcr_processing.ApplyExtendedStats(&character, entry.Extended)
+
+		membershipId := entry.Player.DestinyUserInfo.MembershipId
+		i, ok := index[membershipId]
+		if !ok {
+			i = len(players)
+			index[membershipId] = i
+			players = append(players, dto.InstancePlayer{Player: dto.PlayerInfo{MembershipId: membershipId}})
+		}
+		players[i].Characters = append(players[i].Characters, character)
+	}
+	return players, nil
+}
+
+// decompress returns the JSON of a raw PGCR, which older rows hold gzip compressed
+func decompress(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		return data, nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing raw pgcr: %w", err)
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func main() {
+	flushSentry, recoverSentry := logger.InitSentry()
+	defer flushSentry()
+	defer recoverSentry()
+
+	BackfillExtendedStats()
+}
@@ -0,0 +1,257 @@
+// dlq inspects and empties the dead letter queues Hermes parks messages in when it gives up on them
+// (<queue>.dlq). Each message carries the final error, retry count, and original routing key in
+// x-dlq-* headers.
+//
+// Usage:
+//
+//	./bin/dlq list
+//	./bin/dlq peek [--n=<number>] [--error=<substring>] <queue>
+//	./bin/dlq purge [--error=<substring>] <queue>
+//	./bin/dlq replay [--n=<number>] [--error=<substring>] <queue>
+//
+// <queue> is a Hermes queue (player_crawl) or its dead letter queue (player_crawl.dlq). Replayed
+// messages go back to the queue they were dead lettered from with their retry count reset. Messages
+// that don't match --error, or are past --n, stay in the dead letter queue in their original order.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"raidhub/lib/messaging/processing"
+	"raidhub/lib/messaging/rabbit"
+	"raidhub/lib/messaging/routing"
+	"raidhub/lib/utils/logging"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var logger = logging.NewLogger("dlq")
+
+const publishTimeout = 10 * time.Second
+
+func main() {
+	logging.ParseFlags()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		usage()
+	}
+	command := args[0]
+
+	fs := flag.NewFlagSet("dlq "+command, flag.ExitOnError)
+	n := fs.Int("n", 0, "stop after this many matching messages (0 = all; peek defaults to 10)")
+	errorFilter := fs.String("error", "", "only messages whose final error contains this substring")
+	fs.Parse(args[1:])
+
+	rabbit.Wait()
+
+	if command == "list" {
+		list()
+		return
+	}
+
+	if fs.NArg() != 1 {
+		usage()
+	}
+	queue := routing.DeadLetterQueue(strings.TrimSuffix(fs.Arg(0), routing.DeadLetterSuffix))
+	matches := func(msg amqp.Delivery) bool {
+		message, _ := msg.Headers[processing.DeadLetterErrorHeader].(string)
+		return strings.Contains(message, *errorFilter)
+	}
+
+	switch command {
+	case "peek":
+		limit := *n
+		if limit == 0 {
+			limit = 10
+		}
+		peek(queue, limit, matches)
+	case "purge":
+		if *errorFilter == "" && *n == 0 {
+			purgeAll(queue)
+			return
+		}
+		count := sweep(queue, *n, matches, func(ch *amqp.Channel, msg amqp.Delivery) error {
+			return nil
+		})
+		fmt.Printf("purged %d messages from %s\n", count, queue)
+	case "replay":
+		count := sweep(queue, *n, matches, replay)
+		fmt.Printf("replayed %d messages from %s\n", count, queue)
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dlq list | peek|purge|replay [--n=<number>] [--error=<substring>] <queue>")
+	os.Exit(2)
+}
+
+// list prints the depth of every Hermes dead letter queue
+func list() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "QUEUE\tMESSAGES")
+	for _, source := range routing.Queues {
+		queue := routing.DeadLetterQueue(source)
+		depth := "-" // not declared yet; Hermes declares it when the topic first starts
+		if q, err := inspect(queue); err == nil {
+			depth = fmt.Sprint(q.Messages)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", queue, depth)
+	}
+	w.Flush()
+}
+
+// inspect reads queue's depth without creating it. A passive declare of a missing queue closes the
+// channel, so each check gets a channel of its own.
+func inspect(queue string) (amqp.Queue, error) {
+	ch, err := rabbit.Conn.Channel()
+	if err != nil {
+		logger.Fatal("ERROR_CREATING_CHANNEL", err, nil)
+	}
+	defer ch.Close()
+	return ch.QueueDeclarePassive(queue, true, false, false, false, nil)
+}
+
+// peek prints up to limit matching messages. Every message is returned to the queue when the
+// channel closes, since none are acked.
+func peek(queue string, limit int, matches func(amqp.Delivery) bool) {
+	q, err := inspect(queue)
+	if err != nil {
+		logger.Fatal("QUEUE_NOT_FOUND", err, map[string]any{"queue": queue})
+	}
+	ch, err := rabbit.Conn.Channel()
+	if err != nil {
+		logger.Fatal("ERROR_CREATING_CHANNEL", err, nil)
+	}
+	defer ch.Close()
+
+	shown := 0
+	for range q.Messages {
+		msg, ok, err := ch.Get(queue, false)
+		if err != nil {
+			logger.Fatal("ERROR_READING_MESSAGE", err, map[string]any{"queue": queue})
+		}
+		if !ok {
+			break
+		}
+		if !matches(msg) {
+			continue
+		}
+		printMessage(msg)
+		shown++
+		if shown >= limit {
+			break
+		}
+	}
+	fmt.Printf("%d of %d messages shown\n", shown, q.Messages)
+}
+
+func printMessage(msg amqp.Delivery) {
+	fmt.Printf("--- %s\n", msg.Headers[processing.DeadLetterAtHeader])
+	for _, header := range []string{
+		processing.DeadLetterQueueHeader,
+		processing.DeadLetterRoutingKeyHeader,
+		processing.DeadLetterExchangeHeader,
+		processing.DeadLetterReasonHeader,
+		processing.DeadLetterRetryHeader,
+		processing.DeadLetterErrorHeader,
+	} {
+		fmt.Printf("%s: %v\n", header, msg.Headers[header])
+	}
+	body := string(msg.Body)
+	if len(body) > 2000 {
+		body = body[:2000] + "..."
+	}
+	fmt.Printf("body: %s\n\n", body)
+}
+
+func purgeAll(queue string) {
+	ch, err := rabbit.Conn.Channel()
+	if err != nil {
+		logger.Fatal("ERROR_CREATING_CHANNEL", err, nil)
+	}
+	defer ch.Close()
+	count, err := ch.QueuePurge(queue, false)
+	if err != nil {
+		logger.Fatal("ERROR_PURGING_QUEUE", err, map[string]any{"queue": queue})
+	}
+	fmt.Printf("purged %d messages from %s\n", count, queue)
+}
+
+// sweep runs handle on each matching message in queue, up to limit (0 = no limit), and acks it once
+// handle succeeds. Everything else is left unacked, so it goes back to the queue in order when the
+// channel closes.
+func sweep(queue string, limit int, matches func(amqp.Delivery) bool, handle func(*amqp.Channel, amqp.Delivery) error) int {
+	q, err := inspect(queue)
+	if err != nil {
+		logger.Fatal("QUEUE_NOT_FOUND", err, map[string]any{"queue": queue})
+	}
+	ch, err := rabbit.Conn.Channel()
+	if err != nil {
+		logger.Fatal("ERROR_CREATING_CHANNEL", err, nil)
+	}
+	defer ch.Close()
+	if err := ch.Confirm(false); err != nil {
+		logger.Fatal("ERROR_ENABLING_CONFIRMS", err, nil)
+	}
+
+	handled := 0
+	for range q.Messages {
+		if limit > 0 && handled >= limit {
+			break
+		}
+		msg, ok, err := ch.Get(queue, false)
+		if err != nil {
+			logger.Fatal("ERROR_READING_MESSAGE", err, map[string]any{"queue": queue})
+		}
+		if !ok {
+			break
+		}
+		if !matches(msg) {
+			continue
+		}
+		if err := handle(ch, msg); err != nil {
+			logger.Error("ERROR_HANDLING_MESSAGE", err, map[string]any{
+				"queue":      queue,
+				"message_id": msg.MessageId,
+			})
+			continue
+		}
+		if err := msg.Ack(false); err != nil {
+			logger.Fatal("MESSAGE_ACK_ERROR", err, nil)
+		}
+		handled++
+	}
+	return handled
+}
+
+// replay publishes msg back to its source queue and waits for the broker to confirm it
+func replay(ch *amqp.Channel, msg amqp.Delivery) error {
+	source, publishing := processing.ReplayPublishing(msg)
+	if source == "" {
+		return errors.New("message has no x-dlq-queue header")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	confirmation, err := ch.PublishWithDeferredConfirmWithContext(ctx, "", source, false, false, publishing)
+	if err != nil {
+		return err
+	}
+	ok, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("broker nacked the publish to %s", source)
+	}
+	return nil
+}
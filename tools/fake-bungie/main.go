@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"raidhub/lib/database/postgres"
+	"raidhub/lib/env"
+	"raidhub/lib/services/instance"
+	"raidhub/lib/utils/logging"
+	"raidhub/lib/web/bungie/fakebungie"
+)
+
+var logger = logging.NewLogger("fake-bungie")
+
+var (
+	port                    = flag.Int("port", 0, "port to listen on (defaults to ZEUS_PORT so Atlas needs no changes)")
+	head                    = flag.Int64("head", -1, "newest instance id at startup (-1 uses the latest instance in Postgres)")
+	rate                    = flag.Float64("rate", 40, "new instance ids per second")
+	raidEvery               = flag.Int64("raid-every", 25, "every nth instance is a raid")
+	missingExtendedEvery    = flag.Int64("missing-extended-every", 997, "every nth instance has no extended data (0 disables)")
+	entryCountMismatchEvery = flag.Int64("entry-count-mismatch-every", 1499, "every nth instance has fewer entries than its playerCount (0 disables)")
+	malformedHealsAfter     = flag.Int("malformed-heals-after", 2, "malformed_retry value from which malformed instances are served whole (0 never heals)")
+	throttle                = flag.Float64("throttle", 0.005, "fraction of requests answered with DestinyThrottledByGameServer")
+	gaps                    = flag.String("gaps", "", "id ranges Bungie skipped, as offsets from --head: 20000:40000,90000:95000")
+	blocked                 = flag.String("blocked", "", "id ranges answered with InsufficientPrivileges, as offsets from --head: -5000:-3000")
+	disabled                = flag.String("disabled", "", "windows answered with SystemDisabled, as offsets from startup: 10m:15m,1h:1h20m")
+	activityHash            = flag.Uint("activity-hash", 0, "directorActivityHash on raid PGCRs")
+	seed                    = flag.Int64("seed", 1, "seed for throttling")
+)
+
+func main() {
+	logging.ParseFlags()
+
+	flushSentry, recoverSentry := logger.InitSentry()
+	defer flushSentry()
+	defer recoverSentry()
+
+	if *port == 0 {
+		var err error
+		if *port, err = strconv.Atoi(env.ZeusPort); err != nil {
+			logger.Fatal("INVALID_ZEUS_PORT", err, map[string]any{
+				"port": env.ZeusPort,
+			})
+		}
+	}
+
+	if *head == -1 {
+		postgres.Wait()
+		var err error
+		if *head, err = instance.GetLatestInstanceId(0); err != nil {
+			logger.Fatal("FAILED_TO_GET_LATEST_INSTANCE_ID", err, nil)
+		}
+	}
+
+	gapRanges, err := parseIdRanges(*gaps, *head)
+	if err != nil {
+		logger.Fatal("INVALID_FLAG_VALUE", err, map[string]any{"gaps": *gaps})
+	}
+	blockedRanges, err := parseIdRanges(*blocked, *head)
+	if err != nil {
+		logger.Fatal("INVALID_FLAG_VALUE", err, map[string]any{"blocked": *blocked})
+	}
+	disabledWindows, err := parseWindows(*disabled)
+	if err != nil {
+		logger.Fatal("INVALID_FLAG_VALUE", err, map[string]any{"disabled": *disabled})
+	}
+
+	stream, err := fakebungie.NewStream(fakebungie.Scenario{
+		Start:                   time.Now(),
+		HeadId:                  *head,
+		HeadRate:                *rate,
+		Gaps:                    gapRanges,
+		RaidEvery:               *raidEvery,
+		MissingExtendedEvery:    *missingExtendedEvery,
+		EntryCountMismatchEvery: *entryCountMismatchEvery,
+		MalformedHealsAfter:     *malformedHealsAfter,
+		ThrottleFraction:        *throttle,
+		SystemDisabled:          disabledWindows,
+		Blocked:                 blockedRanges,
+		ActivityHash:            uint32(*activityHash),
+		Seed:                    *seed,
+	}, fakebungie.SystemClock)
+	if err != nil {
+		logger.Fatal("INVALID_SCENARIO", err, nil)
+	}
+
+	logger.Info("FAKE_BUNGIE_LISTENING", map[string]any{
+		logging.PORT: *port,
+		"head":       *head,
+		"rate":       *rate,
+		"gaps":       len(gapRanges),
+		"blocked":    len(blockedRanges),
+		"disabled":   len(disabledWindows),
+	})
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", *port), fakebungie.NewServer(stream)); err != nil {
+		logger.Fatal("FAKE_BUNGIE_SERVER_FAILED", err, nil)
+	}
+}
+
+// parseIdRanges parses from:to pairs of offsets from head into absolute id ranges
+func parseIdRanges(value string, head int64) ([]fakebungie.IdRange, error) {
+	var ranges []fakebungie.IdRange
+	for _, pair := range splitPairs(value) {
+		from, err := strconv.ParseInt(pair[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		to, err := strconv.ParseInt(pair[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, fakebungie.IdRange{From: head + from, To: head + to})
+	}
+	return ranges, nil
+}
+
+// parseWindows parses from:to pairs of durations
+func parseWindows(value string) ([]fakebungie.Window, error) {
+	var windows []fakebungie.Window
+	for _, pair := range splitPairs(value) {
+		from, err := time.ParseDuration(pair[0])
+		if err != nil {
+			return nil, err
+		}
+		to, err := time.ParseDuration(pair[1])
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, fakebungie.Window{From: from, To: to})
+	}
+	return windows, nil
+}
+
+func splitPairs(value string) [][2]string {
+	var pairs [][2]string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		from, to, _ := strings.Cut(item, ":")
+		pairs = append(pairs, [2]string{from, to})
+	}
+	return pairs
+}
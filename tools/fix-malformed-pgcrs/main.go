@@ -13,6 +13,7 @@ import (
 	"raidhub/lib/services/instance_storage"
 	"raidhub/lib/services/pgcr_processing"
 	"raidhub/lib/utils/logging"
+	"raidhub/lib/web/bungie"
 )
 
 var logger = logging.NewLogger("fix-malformed-pgcrs")
@@ -148,6 +149,9 @@ func readInstanceIDsFromFile(filePath string) ([]int64, error) {
 	return instanceIDs, nil
 }
 
+// fetchCtx tags the tool's Bungie requests as background work, so Zeus serves the live crawl first
+var fetchCtx = bungie.WithPriority(context.Background(), bungie.PriorityLow)
+
 func worker(ch chan int64, successes chan int64, failures chan int64, skipped chan int64, wg *sync.WaitGroup, maxRetries int) {
 	defer wg.Done()
 
@@ -157,9 +161,9 @@ func worker(ch chan int64, successes chan int64, failures chan int64, skipped ch
 
 		for errors <= maxRetries && !processed {
 			// Fetch and process the PGCR
-			result, instance, pgcr := pgcr_processing.FetchAndProcessPGCR(context.Background(), instanceID, 0)
+			result, instance, pgcr := pgcr_processing.FetchAndProcessPGCR(fetchCtx, instanceID, 0)
 
-			if result == pgcr_processing.NonRaid {
+			if result == pgcr_processing.NonRaid || (result == pgcr_processing.Success && !instance.IsRaid()) {
 				// Not a raid, skip it
 				logger.Debug("PGCR_NOT_A_RAID", map[string]any{logging.INSTANCE_ID: instanceID})
 				skipped <- instanceID
@@ -6,12 +6,16 @@ import (
 	"raidhub/lib/services/instance"
 	"raidhub/lib/services/pgcr_processing"
 	"raidhub/lib/utils/logging"
+	"raidhub/lib/web/bungie"
 )
 
 const cheatCheckVersion = ""
 
 var logger = logging.NewLogger("FLAG_RESTRICTED_TOOL")
 
+// fetchCtx tags the tool's Bungie requests as background work, so Zeus serves the live crawl first
+var fetchCtx = bungie.WithPriority(context.Background(), bungie.PriorityLow)
+
 func main() {
 	flushSentry, recoverSentry := logger.InitSentry()
 	defer flushSentry()
@@ -28,7 +32,7 @@ func main() {
 
 	for _, instanceId := range instanceIds {
 
-		result, _, _ := pgcr_processing.FetchAndProcessPGCR(context.Background(), instanceId, 0)
+		result, _, _ := pgcr_processing.FetchAndProcessPGCR(fetchCtx, instanceId, 0)
 		total++
 
 		switch result {
@@ -38,7 +42,7 @@ func main() {
 			logger.Info("INSTANCE_NOT_RESTRICTED", map[string]any{"instance_id": instanceId})
 		default:
 			logger.Info("INSTANCE_UNEXPECTED_RESULT", map[string]any{"instance_id": instanceId, "result": result})
-			result, _, _ = pgcr_processing.FetchAndProcessPGCR(context.Background(), instanceId, 0)
+			result, _, _ = pgcr_processing.FetchAndProcessPGCR(fetchCtx, instanceId, 0)
 		}
 
 		if result == pgcr_processing.InsufficientPrivileges {
@@ -37,7 +37,8 @@ func LeaderboardClanCrawl() {
 		"purpose":       "leaderboard_maintenance",
 	})
 
-	ctx, cancel := context.WithCancel(context.Background())
+	// A background crawl: Zeus lets live work go ahead of it when it is busy
+	ctx, cancel := context.WithCancel(bungie.WithPriority(context.Background(), bungie.PriorityLow))
 	defer cancel()
 
 	postgres.Wait()
@@ -470,7 +471,7 @@ func processClan(ctx context.Context, tx *sql.Tx, upsertClan, insertMember *sql.
 
 func fetchClanMembersPage(ctx context.Context, groupId int64, page int) ([]bungie.GroupMember, bool, error) {
 	for attempt := range 4 {
-		result, err := bungie.Client.GetMembersOfGroup(context.Background(), groupId, page)
+		result, err := bungie.Client.GetMembersOfGroup(ctx, groupId, page)
 
 		if result.BungieErrorCode == bungie.GroupNotFound {
 			return nil, false, nil
@@ -1,13 +1,9 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"flag"
 	"fmt"
-	"os"
-	"path/filepath"
-	"strconv"
 	"sync"
 	"time"
 
@@ -17,8 +13,10 @@ import (
 	"raidhub/lib/messaging/routing"
 	"raidhub/lib/services/instance"
 	"raidhub/lib/services/instance_storage"
+	"raidhub/lib/services/missed_pgcr"
 	"raidhub/lib/services/pgcr_processing"
 	"raidhub/lib/utils/logging"
+	"raidhub/lib/web/bungie"
 	"raidhub/lib/web/discord"
 
 	"slices"
@@ -33,257 +31,237 @@ var (
 	workerMaxRetries int
 )
 
+type outcomeStatus int
+
+const (
+	outcomeResolved outcomeStatus = iota // stored, non-raid, already stored, or handed to pgcr_blocked_retry
+	outcomeStored                        // stored by this run
+	outcomeFailed                        // still missing
+	outcomeDeferred                      // newer than the latest stored instance, left for a later run
+)
+
+type outcome struct {
+	instanceId int64
+	status     outcomeStatus
+	reason     missed_pgcr.Reason
+}
+
 // ProcessMissedPGCRs is the command function for processing missed PGCRs
 func ProcessMissedPGCRs() {
 	fs := flag.NewFlagSet("process-missed-pgcrs", flag.ExitOnError)
-	gap := fs.Bool("gap", false, "process gaps in the missed log")
+	gap := fs.Bool("gap", false, "also process every id around each claimed batch, not just the missed ones")
 	force := fs.Bool("force", false, "force processing all PGCRs, ignoring database recency check")
 	numWorkers := fs.Int("workers", 1, "number of workers to spawn")
 	retries := fs.Int("retries", 5, "number of retries for each PGCR")
+	batchSize := fs.Int("batch", 1000, "number of missed PGCRs to claim from the ledger at a time")
+	maxAttempts := fs.Int("max-attempts", 10, "abandon a missed PGCR once it has been recorded this many times")
+	staleAfter := fs.Duration("stale-after", time.Hour, "reclaim missed PGCRs claimed longer ago than this by a run that did not finish")
 	fs.Parse(flag.Args())
 
 	hadesAlerting := discord.NewDiscordAlerting(env.HadesWebhookURL, logger)
 
-	// missedLogPath is where new missed PGCRs are accumulated
-	missedLogPath := env.MissedPGCRLogFilePath
-	logDir := filepath.Dir(missedLogPath)
-	// processingLogPath is where we temporarily store logs to process
-	processingLogPath := filepath.Join(logDir, filepath.Base(missedLogPath)+".temp")
-
-	_, err := os.Stat(processingLogPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// Check if missedLogPath exists before trying to move it
-			_, err = os.Stat(missedLogPath)
-			if err == nil {
-				// missedLogPath exists, move it to processingLogPath for processing
-				err = moveFile(missedLogPath, processingLogPath)
-				if err != nil {
-					logger.Fatal("ERROR_MOVING_FILE", err, map[string]any{})
-				}
-			} else if !os.IsNotExist(err) {
-				// Some other error checking missedLogPath
-				logger.Fatal("ERROR_CHECKING_MISSED_LOG_PATH", err, map[string]any{})
-			} else {
-				// missedLogPath doesn't exist, nothing to process - just create empty missedLogPath and exit
-				if err := os.MkdirAll(logDir, 0755); err != nil {
-					logger.Fatal("ERROR_CREATING_LOG_DIRECTORY", err, map[string]any{})
-				}
-				missedLogFile, err := createFile(missedLogPath)
-				if err != nil {
-					logger.Fatal("ERROR_CREATING_MISSED_LOG_FILE", err, map[string]any{})
-				}
-				missedLogFile.Close()
-				logger.Info("NO_MISSED_PGCRS_TO_PROCESS", map[string]any{})
-				return
-			}
-			// After moving missedLogPath to processingLogPath, we don't create a new missedLogPath yet
-			// It will be created at the end after processing completes, so that any failed PGCRs
-			// written during processing are preserved
-		} else {
-			logger.Fatal("ERROR_STAT_PROCESSING_LOG_PATH", err, map[string]any{})
-		}
-	}
-
-	logFile, err := os.Open(processingLogPath)
-	if err != nil {
-		logger.Fatal("ERROR_OPENING_PROCESSING_LOG_FILE", err, map[string]any{})
-	}
-	defer logFile.Close()
-
-	logger.Info("READING_MISSED_PGCRS", map[string]any{logging.PATH: processingLogPath})
-
 	// Wait for PostgreSQL connection to be ready
 	postgres.Wait()
 
-	// Create a map to store unique numbers
-	uniqueNumbers := make(map[int64]bool)
+	ctx := context.Background()
 
-	// Read the file line by line
-	scanner := bufio.NewScanner(logFile)
-	minN := int64(0)
-	maxN := int64(0)
-	for scanner.Scan() {
-		line := scanner.Text()
-		number, err := strconv.ParseInt(line, 10, 64)
+	var latestId int64
+	if !*force {
+		var err error
+		latestId, err = instance.GetLatestInstanceId(5_000)
 		if err != nil {
-			logger.Warn("MISSED_PGCR_LINE_PARSE_ERROR", err, map[string]any{
-				"raw":          line,
-				logging.REASON: "invalid_integer",
-			})
-			continue
-		}
-		uniqueNumbers[number] = true
-		if minN == 0 {
-			minN = number
-		} else {
-			minN = min(minN, number)
-		}
-		maxN = max(maxN, number)
-	}
-
-	if *gap && (maxN-minN > 200_000) {
-		logger.Error("GAP_TOO_LARGE", nil, map[string]any{logging.MAX: maxN, logging.MIN: minN})
-	}
-
-	if *gap && minN > 0 && maxN > 0 {
-		logger.Debug("FOUND_UNIQUE_NUMBERS_IN_FILE", map[string]any{logging.COUNT: len(uniqueNumbers), logging.MIN: minN, logging.MAX: maxN})
-		for i := minN - 1000; i <= maxN+1000; i++ {
-			uniqueNumbers[i] = true
+			logger.Fatal("ERROR_GETTING_LATEST_INSTANCE_ID", err, map[string]any{})
 		}
+	} else {
+		latestId = 0 // Set to 0 when forcing, worker will skip the comparison
 	}
 
-	if err := scanner.Err(); err != nil {
-		logger.Warn("DATABASE_QUERY_ERROR", err, map[string]any{})
-		logger.Fatal("ERROR_SCANNING_FILE", err, map[string]any{})
-	}
+	// Set global worker state
+	workerLatestId = latestId
+	workerForce = *force
+	workerMaxRetries = *retries
 
-	// postgres.DB is initialized in init()
 	stmnt, err := postgres.DB.Prepare("SELECT instance_id FROM instance INNER JOIN pgcr USING (instance_id) WHERE instance_id = $1 LIMIT 1;")
 	if err != nil {
-		logger.Error("ERROR_PREPARING_STATEMENT", err, map[string]any{})
+		logger.Fatal("ERROR_PREPARING_STATEMENT", err, map[string]any{})
 	}
 	defer stmnt.Close()
 
-	var numbers []int64
-	for num := range uniqueNumbers {
-		var foo int64
-		if !*gap {
-			err := stmnt.QueryRow(num).Scan(&foo)
-			if err != nil {
-				numbers = append(numbers, num)
-			}
-		} else {
-			numbers = append(numbers, num)
-		}
-
-	}
-
-	if *gap {
-		logger.Info("PROCESSING_PGCRS_IN_GAP", map[string]any{logging.COUNT: len(numbers)})
-	} else {
-		logger.Info("FOUND_MISSING_PGCRS", map[string]any{logging.COUNT: len(numbers)})
-	}
-	// Sort the numbers
-	slices.Sort(numbers)
+	// Anything this run records again gets a newer last_seen_at, so it is not reclaimed until the next run
+	runStart := time.Now()
 
+	count := 0
 	var found []int64
 	var failed []int64
-	var minFailed int64
-	var maxFailed int64
-	minFailedSet := false
-	if len(numbers) > 0 {
-		var latestId int64
-		if !*force {
-			var err error
-			latestId, err = instance.GetLatestInstanceId(5_000)
-			if err != nil {
-				logger.Fatal("ERROR_GETTING_LATEST_INSTANCE_ID", err, map[string]any{})
-			}
-		} else {
-			latestId = 0 // Set to 0 when forcing, worker will skip the comparison
+	var deferred []int64
+	for {
+		entries, err := missed_pgcr.Claim(ctx, *batchSize, *staleAfter, runStart)
+		if err != nil {
+			logger.Fatal("ERROR_CLAIMING_MISSED_PGCRS", err, map[string]any{})
+		}
+		if len(entries) == 0 {
+			break
 		}
 
-		// Set global worker state
-		workerLatestId = latestId
-		workerForce = *force
-		workerMaxRetries = *retries
-
-		firstId := numbers[0]
-		ch := make(chan int64)
-		successes := make(chan int64)
-		failures := make(chan int64)
-		var wg sync.WaitGroup
-
-		workerCount := *numWorkers
-
-		// Start workers
-		logger.Info("WORKERS_STARTING", map[string]any{logging.FIRST_ID: firstId})
-		wg.Add(workerCount)
-		for i := 0; i < workerCount; i++ {
-			go worker(ch, successes, failures, &wg)
+		numbers := make([]int64, 0, len(entries))
+		var resolved []int64
+		for _, entry := range entries {
+			if *gap {
+				numbers = append(numbers, entry.InstanceId)
+				continue
+			}
+			var foo int64
+			if err := stmnt.QueryRow(entry.InstanceId).Scan(&foo); err == nil {
+				// Already stored by someone else
+				resolved = append(resolved, entry.InstanceId)
+			} else {
+				numbers = append(numbers, entry.InstanceId)
+			}
 		}
 
-		var wg2 sync.WaitGroup
-		wg2.Add(1)
-		go func() {
-			defer wg2.Done()
-			for id := range successes {
-				found = append(found, id)
+		if *gap {
+			minN, maxN := entries[0].InstanceId, entries[len(entries)-1].InstanceId
+			if maxN-minN > 200_000 {
+				logger.Error("GAP_TOO_LARGE", nil, map[string]any{logging.MAX: maxN, logging.MIN: minN})
 			}
-		}()
-
-		wg2.Add(1)
-		go func() {
-			defer wg2.Done()
-			for id := range failures {
-				failed = append(failed, id)
-				if !minFailedSet {
-					minFailed = id
-					maxFailed = id
-					minFailedSet = true
-				} else {
-					minFailed = min(minFailed, id)
-					maxFailed = max(maxFailed, id)
+			logger.Debug("EXPANDING_CLAIMED_BATCH", map[string]any{logging.COUNT: len(entries), logging.MIN: minN, logging.MAX: maxN})
+			claimed := make(map[int64]bool, len(entries))
+			for _, entry := range entries {
+				claimed[entry.InstanceId] = true
+			}
+			for i := minN - 1000; i <= maxN+1000; i++ {
+				if !claimed[i] {
+					numbers = append(numbers, i)
 				}
 			}
-		}()
-
-		for j := 0; j < len(numbers); j++ {
-			ch <- numbers[j]
+			slices.Sort(numbers)
+			logger.Info("PROCESSING_PGCRS_IN_GAP", map[string]any{logging.COUNT: len(numbers)})
+		} else {
+			logger.Info("FOUND_MISSING_PGCRS", map[string]any{logging.COUNT: len(numbers), "already_stored": len(resolved)})
+		}
+		count += len(numbers)
+
+		for _, o := range processBatch(numbers, *numWorkers) {
+			switch o.status {
+			case outcomeStored:
+				found = append(found, o.instanceId)
+				resolved = append(resolved, o.instanceId)
+			case outcomeResolved:
+				resolved = append(resolved, o.instanceId)
+			case outcomeDeferred:
+				deferred = append(deferred, o.instanceId)
+			case outcomeFailed:
+				failed = append(failed, o.instanceId)
+				recordFailure(ctx, o, *maxAttempts)
+			}
 		}
 
-		close(ch)
-		wg.Wait()
-		close(failures)
-		close(successes)
-		wg2.Wait()
+		if err := missed_pgcr.Resolve(ctx, resolved...); err != nil {
+			logger.Error("ERROR_RESOLVING_MISSED_PGCRS", err, map[string]any{logging.COUNT: len(resolved)})
+		}
 	}
 
-	// Remove processingLogPath file
-	if _, err := os.Stat(processingLogPath); err == nil {
-		if err := os.Remove(processingLogPath); err != nil {
-			logger.Fatal("ERROR_REMOVING_PROCESSING_LOG_FILE", err, map[string]any{})
+	// Deferred ids go back to pending only now, so this run does not pick them up again
+	for _, id := range deferred {
+		if err := missed_pgcr.Release(ctx, id); err != nil {
+			logger.Warn("ERROR_RELEASING_MISSED_PGCR", err, map[string]any{logging.INSTANCE_ID: id})
 		}
-		logger.Debug("TEMPORARY_FILE_DELETED_SUCCESSFULLY", map[string]any{})
 	}
 
-	// Create new empty missedLogPath only if it doesn't exist
-	// (failed PGCRs written during processing should be preserved)
-	if _, err := os.Stat(missedLogPath); os.IsNotExist(err) {
-		if err := os.MkdirAll(logDir, 0755); err != nil {
-			logger.Fatal("ERROR_CREATING_LOG_DIRECTORY", err, map[string]any{})
-		}
-		missedLogFile, err := createFile(missedLogPath)
-		if err != nil {
-			logger.Fatal("ERROR_CREATING_MISSED_LOG_FILE", err, map[string]any{})
-		}
-		missedLogFile.Close()
+	if count == 0 {
+		logger.Info("NO_MISSED_PGCRS_TO_PROCESS", map[string]any{})
+		return
 	}
 
+	var minFailed, maxFailed int64
+	if len(failed) > 0 {
+		minFailed, maxFailed = slices.Min(failed), slices.Max(failed)
+	}
 	gaps := findGaps(failed)
-	postResults(hadesAlerting, len(numbers), len(failed), len(found), minFailed, maxFailed, gaps)
+	postResults(hadesAlerting, count, len(failed), len(found), minFailed, maxFailed, gaps)
 }
 
-func worker(ch chan int64, successes chan int64, failures chan int64, wg *sync.WaitGroup) {
+// processBatch fetches every id across the workers and collects the outcomes
+func processBatch(numbers []int64, workerCount int) []outcome {
+	if len(numbers) == 0 {
+		return nil
+	}
+
+	ch := make(chan int64)
+	outcomes := make(chan outcome)
+	var wg sync.WaitGroup
+
+	logger.Info("WORKERS_STARTING", map[string]any{logging.FIRST_ID: numbers[0]})
+	wg.Add(workerCount)
+	for i := 0; i < workerCount; i++ {
+		go worker(ch, outcomes, &wg)
+	}
+
+	var results []outcome
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for o := range outcomes {
+			results = append(results, o)
+		}
+	}()
+
+	for _, id := range numbers {
+		ch <- id
+	}
+	close(ch)
+	wg.Wait()
+	close(outcomes)
+	<-done
+
+	return results
+}
+
+// recordFailure puts a failed instance back in the ledger, abandoning it after maxAttempts
+func recordFailure(ctx context.Context, o outcome, maxAttempts int) {
+	attempts, err := missed_pgcr.Record(ctx, o.instanceId, o.reason, missed_pgcr.SourceProcessMissedPGCRs)
+	if err != nil {
+		logger.Error("ERROR_RECORDING_MISSED_PGCR", err, map[string]any{logging.INSTANCE_ID: o.instanceId})
+		return
+	}
+	if attempts < maxAttempts {
+		return
+	}
+	if err := missed_pgcr.Abandon(ctx, o.instanceId); err != nil {
+		logger.Error("ERROR_ABANDONING_MISSED_PGCR", err, map[string]any{logging.INSTANCE_ID: o.instanceId})
+		return
+	}
+	logger.Warn("ABANDONED_MISSED_PGCR", nil, map[string]any{
+		logging.INSTANCE_ID: o.instanceId,
+		logging.ATTEMPT:     attempts,
+		logging.REASON:      o.reason,
+	})
+}
+
+// fetchCtx tags the tool's Bungie requests as background work, so Zeus serves the live crawl first
+var fetchCtx = bungie.WithPriority(context.Background(), bungie.PriorityLow)
+
+func worker(ch chan int64, outcomes chan outcome, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for instanceID := range ch {
 		if !workerForce && instanceID > workerLatestId {
 			logger.Debug("PGCR_NEWER_THAN_LATEST_SKIPPING", map[string]any{logging.INSTANCE_ID: instanceID})
-			instance_storage.WriteMissedLog(instanceID)
-			failures <- instanceID
+			outcomes <- outcome{instanceId: instanceID, status: outcomeDeferred}
 			continue
 		}
 
 		var errors = 0
 		var processed = false
+		var lastResult pgcr_processing.PGCRResult
 		for errors <= workerMaxRetries && !processed {
-			result, instance, pgcr := pgcr_processing.FetchAndProcessPGCR(context.Background(), instanceID, 0)
+			result, instance, pgcr := pgcr_processing.FetchAndProcessPGCR(fetchCtx, instanceID, 0)
+			lastResult = result
 
 			if result == pgcr_processing.NonRaid {
 				processed = true
 				// NonRaid activities are successfully processed, just not raids
+				outcomes <- outcome{instanceId: instanceID, status: outcomeResolved}
 			} else if result == pgcr_processing.Success {
 				_, committed, err := instance_storage.StorePGCR(context.Background(), instance, pgcr)
 				if err != nil {
@@ -299,10 +277,11 @@ func worker(ch chan int64, successes chan int64, failures chan int64, wg *sync.W
 					continue
 				} else if committed {
 					logger.Info(instance_storage.STORED_NEW_INSTANCE, map[string]any{logging.INSTANCE_ID: instanceID})
-					successes <- instanceID
+					outcomes <- outcome{instanceId: instanceID, status: outcomeStored}
 					processed = true
 				} else {
 					logger.Debug("NON_RAID_ACTIVITY", map[string]any{logging.INSTANCE_ID: instanceID})
+					outcomes <- outcome{instanceId: instanceID, status: outcomeResolved}
 					processed = true
 					// Not a raid, successfully processed and ignored
 				}
@@ -311,37 +290,28 @@ func worker(ch chan int64, successes chan int64, failures chan int64, wg *sync.W
 				errors++
 				// continue loop to retry
 			} else if result == pgcr_processing.InsufficientPrivileges {
-				// send to retry queue
+				// send to retry queue, which records it again if it gives up
 				err := publishing.PublishInt64Message(context.Background(), routing.PGCRRetry, instanceID)
 				if err != nil {
 					logger.Error("FAILED_TO_PUBLISH_TO_RETRY_QUEUE", err, map[string]any{logging.INSTANCE_ID: instanceID})
+					outcomes <- outcome{instanceId: instanceID, status: outcomeFailed, reason: missed_pgcr.ReasonBlocked}
+				} else {
+					outcomes <- outcome{instanceId: instanceID, status: outcomeResolved}
 				}
 				processed = true
 			} else {
 				logger.Warn("COULD_NOT_RESOLVE_INSTANCE_ID", nil, map[string]any{logging.INSTANCE_ID: instanceID})
-				instance_storage.WriteMissedLog(instanceID)
-				failures <- instanceID
+				outcomes <- outcome{instanceId: instanceID, status: outcomeFailed, reason: missed_pgcr.ReasonForResult(result)}
 				processed = true
 			}
 		}
-		if errors >= workerMaxRetries {
+		if !processed {
 			logger.Warn("FAILED_TO_FETCH_INSTANCE_ID_MULTIPLE_TIMES_SKIPPING", nil, map[string]any{logging.INSTANCE_ID: instanceID, logging.RETRIES: workerMaxRetries})
-			instance_storage.WriteMissedLog(instanceID)
-			failures <- instanceID
+			outcomes <- outcome{instanceId: instanceID, status: outcomeFailed, reason: missed_pgcr.ReasonForResult(lastResult)}
 		}
 	}
 }
 
-func createFile(filePath string) (*os.File, error) {
-	file, err := os.Create(filePath)
-	return file, err
-}
-
-func moveFile(srcPath, dstPath string) error {
-	err := os.Rename(srcPath, dstPath)
-	return err
-}
-
 type Gap struct {
 	Min   int64
 	Max   int64
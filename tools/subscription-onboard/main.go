@@ -1,8 +1,9 @@
 // subscription-onboard is an admin CLI to attach a Discord webhook destination to clan and/or player
-// subscription rules (beta onboarding). Uses explicit Postgres ids only (no name search).
+// subscription rules (beta onboarding).
 //
-// Clan: -clan-group-id from https://raidhub.io/clan/<id> (repeat for multiple).
-// Player: -player-membership-id from https://raidhub.io/profile/<id> (repeat for multiple).
+// Clan: -clan-group-id from https://raidhub.io/clan/<id>, or -clan-name with the exact clan name (repeat for multiple).
+// Player: -player-membership-id from https://raidhub.io/profile/<id>, or -player-name with a Bungie name
+// like Name#1234 (repeat for multiple). Names are resolved through the Bungie API (via Zeus).
 //
 // Example:
 //
@@ -10,6 +11,7 @@
 //	go run ./tools/subscription-onboard -webhook-url '...' -clan-group-id 4927161 -player-membership-id 4611686018488107374
 //	go run ./tools/subscription-onboard -webhook-url '...' -clan-group-id 4927161 -require-completed
 //	go run ./tools/subscription-onboard -webhook-url '...' -clan-group-id 5411410 -activity-raid-bitmap 400
+//	go run ./tools/subscription-onboard -webhook-url '...' -clan-name 'Elysium' -player-name 'Newo#9010'
 package main
 
 import (
@@ -23,6 +25,7 @@ import (
 	"raidhub/lib/database/postgres"
 	"raidhub/lib/services/subscriptions"
 	"raidhub/lib/utils/logging"
+	"raidhub/lib/web/bungie"
 )
 
 var logger = logging.NewLogger("subscription-onboard")
@@ -37,6 +40,12 @@ func main() {
 	var playerMembershipIDs int64Slice
 	flag.Var(&playerMembershipIDs, "player-membership-id", "Player membership_id (repeat for multiple). Same number as raidhub.io/profile/<id>.")
 
+	var clanNames stringSlice
+	flag.Var(&clanNames, "clan-name", "Exact clan name (repeat for multiple), resolved to a group_id through the Bungie API.")
+
+	var playerNames stringSlice
+	flag.Var(&playerNames, "player-name", "Bungie name like Name#1234 (repeat for multiple), resolved to a membership_id through the Bungie API.")
+
 	requireFresh := flag.Bool("require-fresh", false, "Only notify for fresh raid starts (not checkpoint)")
 	requireCompleted := flag.Bool("require-completed", false, "Only notify for full clears (completed instance)")
 	activityRaidBitmapStr := flag.String("activity-raid-bitmap", "", "Raid filter: uint64 bitmask, decimal or 0x hex (same layout as cheat_detection raid bits). Empty or 0 = all raids.")
@@ -49,14 +58,31 @@ func main() {
 		flag.Usage()
 		os.Exit(2)
 	}
-	if len(clanGroupIDs) == 0 && len(playerMembershipIDs) == 0 {
-		fmt.Fprintln(os.Stderr, "error: pass at least one of -clan-group-id or -player-membership-id")
+	if len(clanGroupIDs) == 0 && len(playerMembershipIDs) == 0 && len(clanNames) == 0 && len(playerNames) == 0 {
+		fmt.Fprintln(os.Stderr, "error: pass at least one of -clan-group-id, -clan-name, -player-membership-id, or -player-name")
 		os.Exit(2)
 	}
 
 	ctx := context.Background()
 	postgres.Wait()
 
+	for _, name := range clanNames {
+		gid, err := resolveClanName(ctx, name)
+		if err != nil {
+			logger.Fatal("CLAN_NAME_RESOLUTION_FAILED", err, map[string]any{"clan_name": name})
+		}
+		logger.Info("CLAN_NAME_RESOLVED", map[string]any{"clan_name": name, "group_id": gid})
+		clanGroupIDs = append(clanGroupIDs, gid)
+	}
+	for _, name := range playerNames {
+		mid, err := resolvePlayerName(ctx, name)
+		if err != nil {
+			logger.Fatal("PLAYER_NAME_RESOLUTION_FAILED", err, map[string]any{"player_name": name})
+		}
+		logger.Info("PLAYER_NAME_RESOLVED", map[string]any{"player_name": name, "membership_id": mid})
+		playerMembershipIDs = append(playerMembershipIDs, mid)
+	}
+
 	if err := subscriptions.ValidateDiscordWebhookURL(*webhookURL); err != nil {
 		logger.Fatal("WEBHOOK_URL_INVALID", err, nil)
 	}
@@ -152,6 +178,66 @@ func runDryRun(ctx context.Context, webhookURL string, clanGroupIDs, playerMembe
 	}
 }
 
+// resolveClanName returns the group_id of the clan with exactly this name
+func resolveClanName(ctx context.Context, name string) (int64, error) {
+	result, err := bungie.Client.GetGroupByName(ctx, name, bungie.GroupTypeClan)
+	if result.BungieErrorCode == bungie.GroupNotFound {
+		return 0, fmt.Errorf("no clan named %q", name)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return result.Data.Detail.GroupId, nil
+}
+
+// resolvePlayerName returns the membership_id of a Bungie name (Name#1234). Cross saved accounts
+// resolve to their primary membership, which is the one RaidHub profiles use.
+func resolvePlayerName(ctx context.Context, bungieName string) (int64, error) {
+	i := strings.LastIndex(bungieName, "#")
+	if i <= 0 {
+		return 0, fmt.Errorf("%q is not a Bungie name like Name#1234", bungieName)
+	}
+	code, err := strconv.Atoi(bungieName[i+1:])
+	if err != nil {
+		return 0, fmt.Errorf("%q has an invalid name code: %w", bungieName, err)
+	}
+
+	result, err := bungie.Client.SearchDestinyPlayerByBungieName(ctx, bungie.MembershipTypeAll, bungieName[:i], code)
+	if err != nil {
+		return 0, err
+	}
+	if result.Data == nil || len(*result.Data) == 0 {
+		return 0, fmt.Errorf("no Destiny player named %q", bungieName)
+	}
+	cards := *result.Data
+	for _, card := range cards {
+		if card.CrossSaveOverride != 0 && card.MembershipType == card.CrossSaveOverride {
+			return card.MembershipId, nil
+		}
+	}
+	if len(cards) > 1 {
+		logger.Warn("PLAYER_NAME_AMBIGUOUS", fmt.Errorf("%d memberships without cross save", len(cards)), map[string]any{
+			"player_name":   bungieName,
+			"membership_id": cards[0].MembershipId,
+		})
+	}
+	return cards[0].MembershipId, nil
+}
+
+type stringSlice []string
+
+func (s *stringSlice) String() string {
+	return fmt.Sprint(*s)
+}
+
+func (s *stringSlice) Set(v string) error {
+	if strings.TrimSpace(v) == "" {
+		return fmt.Errorf("empty name")
+	}
+	*s = append(*s, strings.TrimSpace(v))
+	return nil
+}
+
 type int64Slice []int64
 
 func (s *int64Slice) String() string {